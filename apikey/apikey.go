@@ -0,0 +1,54 @@
+// Package apikey makes API keys and checks the keys clients present. A key
+// looks like tdw_1a2b3c4d_<secret>: its prefix, up to the second underscore,
+// is stored in the clear to find the key, and only a SHA-256 hash of the
+// whole key is kept.
+package apikey
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const tag = "tdw_"
+
+// Generate returns a new key and its prefix.
+func Generate() (key, prefix string, err error) {
+	id := make([]byte, 4)
+	secret := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return "", "", err
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+	prefix = tag + hex.EncodeToString(id)
+	return prefix + "_" + base64.RawURLEncoding.EncodeToString(secret), prefix, nil
+}
+
+// Prefix returns the prefix of key, or false when key is not shaped like
+// one.
+func Prefix(key string) (string, bool) {
+	if !strings.HasPrefix(key, tag) {
+		return "", false
+	}
+	prefix, secret, ok := strings.Cut(key[len(tag):], "_")
+	if !ok || prefix == "" || secret == "" {
+		return "", false
+	}
+	return tag + prefix, true
+}
+
+// Hash returns the hash stored for key.
+func Hash(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// Matches reports whether key has hash, in constant time.
+func Matches(key string, hash []byte) bool {
+	return subtle.ConstantTimeCompare(Hash(key), hash) == 1
+}
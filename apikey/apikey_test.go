@@ -0,0 +1,38 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	key, prefix, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, prefix+"_") || len(prefix) != len("tdw_")+8 {
+		t.Errorf("key %q, prefix %q", key, prefix)
+	}
+	if got, ok := Prefix(key); !ok || got != prefix {
+		t.Errorf("Prefix(%q) = %q, %v", key, got, ok)
+	}
+	if !Matches(key, Hash(key)) {
+		t.Error("key does not match its hash")
+	}
+
+	other, _, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key || Matches(other, Hash(key)) {
+		t.Errorf("two keys match: %q, %q", key, other)
+	}
+}
+
+func TestPrefix(t *testing.T) {
+	for _, key := range []string{"", "secret", "tdw_", "tdw_1a2b3c4d", "tdw_1a2b3c4d_", "tdw__secret", "abc_1a2b3c4d_secret"} {
+		if prefix, ok := Prefix(key); ok {
+			t.Errorf("Prefix(%q) = %q, want no prefix", key, prefix)
+		}
+	}
+}
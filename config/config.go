@@ -0,0 +1,461 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is every setting the binary reads. Values come from Default, then
+// the optional YAML or TOML file, then environment variables, then flags.
+// Each field's yaml path is also its TOML key and flag name, e.g.
+// -database.max_conns=40.
+type Config struct {
+	Server    ServerConfig    `yaml:"server"`
+	Auth      AuthConfig      `yaml:"auth"`
+	Database  DatabaseConfig  `yaml:"database"`
+	Timeouts  TimeoutConfig   `yaml:"timeouts"`
+	RateLimit RateLimitConfig `yaml:"rate_limit"`
+	Cache     CacheConfig     `yaml:"cache"`
+	CORS      CORSConfig      `yaml:"cors"`
+	Log       LogConfig       `yaml:"log"`
+	Ask       AskConfig       `yaml:"ask"`
+	Geo       GeoConfig       `yaml:"geo"`
+	Summary   SummaryConfig   `yaml:"summary"`
+}
+
+type ServerConfig struct {
+	Port            int           `yaml:"port" env:"PORT"`
+	AdminToken      string        `yaml:"admin_token" env:"ADMIN_TOKEN" secret:"true"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// AuthConfig controls API keys. Until Required is set, requests without a
+// key may still read and export; keys add their scopes. CacheTTL is how long
+// a key stays trusted after it is read, and how often its last use is
+// recorded.
+type AuthConfig struct {
+	Required bool          `yaml:"required" env:"AUTH_REQUIRED"`
+	CacheTTL time.Duration `yaml:"cache_ttl" env:"AUTH_CACHE_TTL"`
+}
+
+type DatabaseConfig struct {
+	Host              string        `yaml:"host" env:"DB_HOST"`
+	Port              int           `yaml:"port" env:"DB_PORT"`
+	User              string        `yaml:"user" env:"DB_USER"`
+	Password          string        `yaml:"password" env:"DB_PASSWORD" secret:"true"`
+	Name              string        `yaml:"name" env:"DB_NAME"`
+	SSLMode           string        `yaml:"sslmode" env:"DB_SSLMODE"`
+	MaxConns          int32         `yaml:"max_conns" env:"DB_MAX_CONNS"`
+	MinConns          int32         `yaml:"min_conns" env:"DB_MIN_CONNS"`
+	MaxConnLifetime   time.Duration `yaml:"max_conn_lifetime" env:"DB_MAX_CONN_LIFETIME"`
+	MaxConnIdleTime   time.Duration `yaml:"max_conn_idle_time" env:"DB_MAX_CONN_IDLE_TIME"`
+	HealthCheckPeriod time.Duration `yaml:"health_check_period" env:"DB_HEALTH_CHECK_PERIOD"`
+	ConnectTimeout    time.Duration `yaml:"connect_timeout" env:"DB_CONNECT_TIMEOUT"`
+	StatementTimeout  time.Duration `yaml:"statement_timeout" env:"DB_STATEMENT_TIMEOUT"`
+	AutoMigrate       bool          `yaml:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+}
+
+// TimeoutConfig bounds database work per endpoint class. Clients may ask for
+// up to Max with timeout_ms.
+type TimeoutConfig struct {
+	Lookup         time.Duration `yaml:"lookup" env:"QUERY_TIMEOUT_LOOKUP"`
+	Summary        time.Duration `yaml:"summary" env:"QUERY_TIMEOUT_SUMMARY"`
+	Aggregate      time.Duration `yaml:"aggregate" env:"QUERY_TIMEOUT_AGGREGATE"`
+	Max            time.Duration `yaml:"max" env:"QUERY_TIMEOUT_MAX"`
+	Health         time.Duration `yaml:"health" env:"HEALTH_TIMEOUT"`
+	DisconnectPoll time.Duration `yaml:"disconnect_poll" env:"DISCONNECT_POLL_INTERVAL"`
+}
+
+type RateLimitConfig struct {
+	Enabled bool          `yaml:"enabled" env:"RATE_LIMIT_ENABLED"`
+	Max     int           `yaml:"max" env:"RATE_LIMIT_MAX"`
+	Window  time.Duration `yaml:"window" env:"RATE_LIMIT_WINDOW"`
+}
+
+type CacheConfig struct {
+	Dimensions time.Duration `yaml:"dimensions" env:"CACHE_TTL_DIMENSIONS"`
+	Metadata   time.Duration `yaml:"metadata" env:"CACHE_TTL_METADATA"`
+	Catalog    time.Duration `yaml:"catalog" env:"CACHE_TTL_CATALOG"`
+}
+
+// CORSConfig enables cross-origin requests when AllowOrigins is not empty.
+type CORSConfig struct {
+	AllowOrigins []string      `yaml:"allow_origins" env:"CORS_ALLOW_ORIGINS"`
+	AllowHeaders []string      `yaml:"allow_headers" env:"CORS_ALLOW_HEADERS"`
+	MaxAge       time.Duration `yaml:"max_age" env:"CORS_MAX_AGE"`
+}
+
+type LogConfig struct {
+	Requests   bool   `yaml:"requests" env:"LOG_REQUESTS"`
+	Format     string `yaml:"format" env:"LOG_FORMAT"`
+	TimeFormat string `yaml:"time_format" env:"LOG_TIME_FORMAT"`
+}
+
+type AskConfig struct {
+	TranslatorURL    string `yaml:"translator_url" env:"ASK_TRANSLATOR_URL"`
+	TranslatorModel  string `yaml:"translator_model" env:"ASK_TRANSLATOR_MODEL"`
+	TranslatorAPIKey string `yaml:"translator_api_key" env:"ASK_TRANSLATOR_API_KEY" secret:"true"`
+}
+
+type GeoConfig struct {
+	CountryShapesFile string `yaml:"country_shapes_file" env:"COUNTRY_SHAPES_FILE"`
+}
+
+// SummaryConfig controls rebuilding fact_yearly_summary. Tolerance is the
+// largest relative difference allowed between the fact tables' totals for a
+// year and trade type, e.g. 0.001 for 0.1%.
+type SummaryConfig struct {
+	Tolerance float64 `yaml:"tolerance" env:"SUMMARY_TOLERANCE"`
+}
+
+// Default returns the settings used when nothing overrides them.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:            3000,
+			ShutdownTimeout: 10 * time.Second,
+		},
+		Auth: AuthConfig{
+			CacheTTL: time.Minute,
+		},
+		Database: DatabaseConfig{
+			Host:              "localhost",
+			Port:              5432,
+			User:              "postgres",
+			Name:              "trade_db",
+			SSLMode:           "disable",
+			MaxConns:          25,
+			MinConns:          5,
+			MaxConnLifetime:   time.Hour,
+			MaxConnIdleTime:   30 * time.Minute,
+			HealthCheckPeriod: time.Minute,
+			ConnectTimeout:    10 * time.Second,
+			StatementTimeout:  60 * time.Second,
+		},
+		Timeouts: TimeoutConfig{
+			Lookup:         5 * time.Second,
+			Summary:        10 * time.Second,
+			Aggregate:      30 * time.Second,
+			Max:            60 * time.Second,
+			Health:         2 * time.Second,
+			DisconnectPoll: 250 * time.Millisecond,
+		},
+		RateLimit: RateLimitConfig{
+			Enabled: true,
+			Max:     100,
+			Window:  time.Minute,
+		},
+		Cache: CacheConfig{
+			Dimensions: 5 * time.Minute,
+			Metadata:   10 * time.Minute,
+			Catalog:    10 * time.Minute,
+		},
+		CORS: CORSConfig{
+			AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Admin-Token"},
+			MaxAge:       time.Hour,
+		},
+		Log: LogConfig{
+			Requests:   true,
+			Format:     "${time} | ${status} | ${latency} | ${locals:requestid} | ${method} ${path}\n",
+			TimeFormat: "2006-01-02 15:04:05",
+		},
+		Summary: SummaryConfig{
+			Tolerance: 0.001,
+		},
+	}
+}
+
+// Options are the command-line flags that control loading rather than set
+// configuration values.
+type Options struct {
+	File        string
+	PrintConfig bool
+	Args        []string
+}
+
+// Load parses args, builds the configuration and validates it. The file is
+// taken from -config or CONFIG_FILE.
+func Load(args []string) (*Config, *Options, error) {
+	cfg := Default()
+	opts := &Options{}
+
+	fs := flag.NewFlagSet("trade-api", flag.ContinueOnError)
+	fs.StringVar(&opts.File, "config", os.Getenv("CONFIG_FILE"), "YAML or TOML configuration file")
+	fs.BoolVar(&opts.PrintConfig, "print-config", false, "print the effective configuration with secrets redacted and exit")
+
+	// Flags are applied last, so record them while parsing
+	var overrides []func() error
+	fields := settings(cfg)
+	for _, f := range fields {
+		f := f
+		fs.Func(f.path, fmt.Sprintf("%s (env %s)", f.path, f.env), func(s string) error {
+			if _, err := parseValue(f.value.Type(), s); err != nil {
+				return err
+			}
+			overrides = append(overrides, func() error { return f.set(s) })
+			return nil
+		})
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, nil, err
+	}
+	opts.Args = fs.Args()
+
+	if opts.File != "" {
+		if err := loadFile(cfg, opts.File); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	for _, f := range fields {
+		if f.env == "" {
+			continue
+		}
+		if value, ok := os.LookupEnv(f.env); ok && value != "" {
+			if err := f.set(value); err != nil {
+				return nil, nil, fmt.Errorf("%s: %w", f.env, err)
+			}
+		}
+	}
+
+	for _, apply := range overrides {
+		if err := apply(); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, nil, err
+	}
+	return cfg, opts, nil
+}
+
+// loadFile reads a YAML or TOML file, told apart by its extension.
+func loadFile(cfg *Config, path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %w", err)
+	}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+	case ".toml":
+		if data, err = tomlToYAML(data); err != nil {
+			return fmt.Errorf("invalid config file %s: %w", path, err)
+		}
+	default:
+		return fmt.Errorf("config file %s: unsupported extension %q, use .yaml, .yml or .toml", path, ext)
+	}
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("invalid config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// tomlToYAML rewrites a TOML file as YAML, so both formats share the yaml
+// field names, the unknown key check and duration parsing.
+func tomlToYAML(data []byte) ([]byte, error) {
+	var values map[string]interface{}
+	if _, err := toml.Decode(string(data), &values); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(values)
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check(c.Auth.CacheTTL > 0, "auth.cache_ttl must be positive")
+
+	db := c.Database
+	check(db.Host != "", "database.host is required")
+	check(db.Port > 0 && db.Port < 65536, "database.port must be between 1 and 65535")
+	check(db.User != "", "database.user is required")
+	check(db.Name != "", "database.name is required")
+	check(db.MaxConns > 0, "database.max_conns must be positive")
+	check(db.MinConns >= 0 && db.MinConns <= db.MaxConns, "database.min_conns must be between 0 and max_conns")
+	check(db.ConnectTimeout > 0, "database.connect_timeout must be positive")
+	check(db.StatementTimeout > 0, "database.statement_timeout must be positive")
+
+	t := c.Timeouts
+	check(t.Lookup > 0 && t.Lookup <= t.Max, "timeouts.lookup must be positive and at most timeouts.max")
+	check(t.Summary > 0 && t.Summary <= t.Max, "timeouts.summary must be positive and at most timeouts.max")
+	check(t.Aggregate > 0 && t.Aggregate <= t.Max, "timeouts.aggregate must be positive and at most timeouts.max")
+	check(t.Max <= db.StatementTimeout, "timeouts.max must not exceed database.statement_timeout")
+	check(t.Health > 0, "timeouts.health must be positive")
+	check(t.DisconnectPoll > 0, "timeouts.disconnect_poll must be positive")
+
+	if c.RateLimit.Enabled {
+		check(c.RateLimit.Max > 0, "rate_limit.max must be positive")
+		check(c.RateLimit.Window > 0, "rate_limit.window must be positive")
+	}
+
+	check(c.Cache.Dimensions >= 0 && c.Cache.Metadata >= 0 && c.Cache.Catalog > 0,
+		"cache TTLs must not be negative, and cache.catalog must be positive")
+
+	for _, origin := range c.CORS.AllowOrigins {
+		u, err := url.Parse(origin)
+		check(origin == "*" || (err == nil && u.Scheme != "" && u.Host != ""),
+			"cors.allow_origins: %q is not * or an origin such as https://example.com", origin)
+	}
+
+	if c.Ask.TranslatorURL != "" {
+		u, err := url.Parse(c.Ask.TranslatorURL)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https"), "ask.translator_url must be an http(s) URL")
+	}
+
+	check(c.Summary.Tolerance >= 0 && c.Summary.Tolerance < 1, "summary.tolerance must be at least 0 and less than 1")
+
+	return errors.Join(errs...)
+}
+
+// setting is one leaf field of Config.
+type setting struct {
+	path   string
+	env    string
+	secret bool
+	value  reflect.Value
+}
+
+func (s setting) set(raw string) error {
+	v, err := parseValue(s.value.Type(), raw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", s.path, err)
+	}
+	s.value.Set(v)
+	return nil
+}
+
+func settings(cfg *Config) []setting {
+	var result []setting
+	var walk func(v reflect.Value, prefix string)
+	walk = func(v reflect.Value, prefix string) {
+		t := v.Type()
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			path := prefix + field.Tag.Get("yaml")
+			if field.Type.Kind() == reflect.Struct {
+				walk(v.Field(i), path+".")
+				continue
+			}
+			result = append(result, setting{
+				path:   path,
+				env:    field.Tag.Get("env"),
+				secret: field.Tag.Get("secret") == "true",
+				value:  v.Field(i),
+			})
+		}
+	}
+	walk(reflect.ValueOf(cfg).Elem(), "")
+	return result
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func parseValue(t reflect.Type, raw string) (reflect.Value, error) {
+	v := reflect.New(t).Elem()
+	switch {
+	case t == durationType:
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(int64(d))
+	case t.Kind() == reflect.String:
+		v.SetString(raw)
+	case t.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return v, err
+		}
+		v.SetBool(b)
+	case t.Kind() == reflect.Int || t.Kind() == reflect.Int32:
+		n, err := strconv.ParseInt(raw, 10, t.Bits())
+		if err != nil {
+			return v, err
+		}
+		v.SetInt(n)
+	case t.Kind() == reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return v, err
+		}
+		v.SetFloat(f)
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.String:
+		items := []string{}
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return v, fmt.Errorf("unsupported type %s", t)
+	}
+	return v, nil
+}
+
+// Print writes the configuration as YAML with secrets redacted.
+func (c *Config) Print(w io.Writer) error {
+	root := &yaml.Node{Kind: yaml.MappingNode}
+	sections := map[string]*yaml.Node{}
+	for _, s := range settings(c) {
+		section, key, _ := strings.Cut(s.path, ".")
+		node, ok := sections[section]
+		if !ok {
+			node = &yaml.Node{Kind: yaml.MappingNode}
+			sections[section] = node
+			root.Content = append(root.Content, scalar(section), node)
+		}
+
+		v := s.value.Interface()
+		switch {
+		case s.secret:
+			v = redact(s.value.String())
+		case s.value.Type() == durationType:
+			v = time.Duration(s.value.Int()).String()
+		}
+		value := &yaml.Node{}
+		if err := value.Encode(v); err != nil {
+			return err
+		}
+		node.Content = append(node.Content, scalar(key), value)
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2)
+	defer encoder.Close()
+	return encoder.Encode(root)
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+func redact(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "[REDACTED]"
+}
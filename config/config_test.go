@@ -0,0 +1,127 @@
+package config
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.yaml")
+	yaml := "database:\n  max_conns: 40\n  min_conns: 2\ntimeouts:\n  aggregate: 45s\n"
+	if err := os.WriteFile(file, []byte(yaml), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("DB_MAX_CONNS", "50")
+	t.Setenv("QUERY_TIMEOUT_AGGREGATE", "40s")
+	t.Setenv("SUMMARY_TOLERANCE", "0.005")
+
+	cfg, opts, err := Load([]string{"-config", file, "-timeouts.aggregate=20s", "extra"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Database.MinConns != 2 {
+		t.Errorf("file value: min_conns = %d, want 2", cfg.Database.MinConns)
+	}
+	if cfg.Database.MaxConns != 50 {
+		t.Errorf("env over file: max_conns = %d, want 50", cfg.Database.MaxConns)
+	}
+	if cfg.Timeouts.Aggregate != 20*time.Second {
+		t.Errorf("flag over env: timeouts.aggregate = %s, want 20s", cfg.Timeouts.Aggregate)
+	}
+	if cfg.Summary.Tolerance != 0.005 {
+		t.Errorf("env: summary.tolerance = %g, want 0.005", cfg.Summary.Tolerance)
+	}
+	if cfg.Database.Port != 5432 {
+		t.Errorf("default: database.port = %d, want 5432", cfg.Database.Port)
+	}
+	if len(opts.Args) != 1 || opts.Args[0] != "extra" {
+		t.Errorf("args = %v", opts.Args)
+	}
+}
+
+func TestLoadFileFormats(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, data string) string {
+		t.Helper()
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	toml := `
+[database]
+max_conns = 40
+sslmode = "require"
+
+[timeouts]
+aggregate = "45s"
+
+[cors]
+allow_origins = ["https://dashboard.example.com"]
+`
+	cfg, _, err := Load([]string{"-config", write("config.toml", toml)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Database.MaxConns != 40 || cfg.Database.SSLMode != "require" || cfg.Timeouts.Aggregate != 45*time.Second ||
+		len(cfg.CORS.AllowOrigins) != 1 || cfg.Database.Port != 5432 {
+		t.Errorf("toml: %+v %+v %+v", cfg.Database, cfg.Timeouts, cfg.CORS)
+	}
+
+	tests := []struct {
+		name, data, want string
+	}{
+		{"unknown.toml", "[database]\nmax_connections = 40\n", "max_connections"},
+		{"broken.toml", "[database\n", "invalid config file"},
+		{"config.json", `{"database": {"max_conns": 40}}`, "unsupported extension"},
+		{"config", "database:\n  max_conns: 40\n", "unsupported extension"},
+	}
+	for _, tt := range tests {
+		if _, _, err := Load([]string{"-config", write(tt.name, tt.data)}); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := Default()
+	cfg.Server.Port = 0
+	cfg.Database.MinConns = 100
+	cfg.CORS.AllowOrigins = []string{"example.com"}
+	cfg.Summary.Tolerance = -1
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{"server.port", "database.min_conns", "cors.allow_origins", "summary.tolerance"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+}
+
+func TestPrintRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "hunter2"
+	cfg.Ask.TranslatorAPIKey = "sk-secret"
+
+	var buf bytes.Buffer
+	if err := cfg.Print(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "sk-secret") {
+		t.Errorf("secrets leaked:\n%s", out)
+	}
+	if !strings.Contains(out, "statement_timeout: 1m0s") {
+		t.Errorf("durations should print as strings:\n%s", out)
+	}
+}
@@ -3,22 +3,24 @@ package config
 import (
 	"context"
 	"fmt"
-	"os"
+	"net"
+	"net/url"
+	"strconv"
 	"time"
 
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgconn/ctxwatch"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func InitDB() (*pgxpool.Pool, error) {
-	connString := fmt.Sprintf(
-		"postgres://%s:%s@%s:%s/%s?sslmode=%s",
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_PORT"),
-		os.Getenv("DB_NAME"),
-		getEnvOrDefault("DB_SSLMODE", "disable"),
-	)
+func InitDB(cfg DatabaseConfig) (*pgxpool.Pool, error) {
+	connString := (&url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(cfg.User, cfg.Password),
+		Host:     net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Path:     cfg.Name,
+		RawQuery: url.Values{"sslmode": {cfg.SSLMode}}.Encode(),
+	}).String()
 
 	config, err := pgxpool.ParseConfig(connString)
 	if err != nil {
@@ -26,13 +28,30 @@ func InitDB() (*pgxpool.Pool, error) {
 	}
 
 	// Connection pool settings
-	config.MaxConns = 25
-	config.MinConns = 5
-	config.MaxConnLifetime = time.Hour
-	config.MaxConnIdleTime = 30 * time.Minute
-	config.HealthCheckPeriod = 1 * time.Minute
+	config.MaxConns = cfg.MaxConns
+	config.MinConns = cfg.MinConns
+	config.MaxConnLifetime = cfg.MaxConnLifetime
+	config.MaxConnIdleTime = cfg.MaxConnIdleTime
+	config.HealthCheckPeriod = cfg.HealthCheckPeriod
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	// When a request's context ends, ask Postgres to cancel the running query
+	// instead of only dropping the connection, which would let it run on
+	config.ConnConfig.BuildContextWatcherHandler = func(conn *pgconn.PgConn) ctxwatch.Handler {
+		return &pgconn.CancelRequestContextWatcherHandler{
+			Conn:               conn,
+			CancelRequestDelay: 0,
+			DeadlineDelay:      time.Second,
+		}
+	}
+
+	// Server-side backstop in case a cancel request is lost. Request queries
+	// lower it to their request's deadline. Batch commands pass zero, as their
+	// loads, migrations and rebuilds may run for longer.
+	if cfg.StatementTimeout > 0 {
+		config.ConnConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(cfg.StatementTimeout.Milliseconds(), 10)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
 
 	pool, err := pgxpool.NewWithConfig(ctx, config)
@@ -47,10 +66,3 @@ func InitDB() (*pgxpool.Pool, error) {
 
 	return pool, nil
 }
-
-func getEnvOrDefault(key, defaultValue string) string {
-	if value := os.Getenv(key); value != "" {
-		return value
-	}
-	return defaultValue
-}
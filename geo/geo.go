@@ -0,0 +1,111 @@
+package geo
+
+import (
+	"bytes"
+	_ "embed"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed country_centroids.csv
+var centroidsCSV []byte
+
+var (
+	shapesFile string
+	loadOnce   sync.Once
+	geometries map[string]json.RawMessage
+	loadErr    error
+)
+
+// Point builds a GeoJSON Point geometry. GeoJSON orders coordinates as lon, lat.
+func Point(lat, lon float64) json.RawMessage {
+	return json.RawMessage(fmt.Sprintf(`{"type":"Point","coordinates":[%s,%s]}`,
+		strconv.FormatFloat(lon, 'f', -1, 64), strconv.FormatFloat(lat, 'f', -1, 64)))
+}
+
+// SetShapesFile sets a GeoJSON file of country shapes to use instead of the
+// embedded centroids. It must be called before the first CountryGeometry.
+func SetShapesFile(path string) {
+	shapesFile = path
+}
+
+// CountryGeometry returns the geometry for an ISO 3166-1 alpha-2 code, or nil
+// when the country is unknown. Shapes from the shapes file take precedence
+// over the embedded centroids.
+func CountryGeometry(iso string) (json.RawMessage, error) {
+	loadOnce.Do(func() {
+		geometries, loadErr = loadGeometries(shapesFile)
+	})
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return geometries[strings.ToUpper(iso)], nil
+}
+
+func loadGeometries(shapesFile string) (map[string]json.RawMessage, error) {
+	records, err := csv.NewReader(bytes.NewReader(centroidsCSV)).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse country centroids: %w", err)
+	}
+
+	result := make(map[string]json.RawMessage, len(records))
+	for _, record := range records[1:] {
+		lat, err := strconv.ParseFloat(record[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latitude for %s: %w", record[0], err)
+		}
+		lon, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid longitude for %s: %w", record[0], err)
+		}
+		result[record[0]] = Point(lat, lon)
+	}
+
+	if shapesFile == "" {
+		return result, nil
+	}
+
+	shapes, err := loadShapes(shapesFile)
+	if err != nil {
+		return nil, err
+	}
+	for iso, geometry := range shapes {
+		result[iso] = geometry
+	}
+	return result, nil
+}
+
+// loadShapes reads a GeoJSON FeatureCollection (e.g. Natural Earth admin 0
+// countries) keyed by an ISO alpha-2 property.
+func loadShapes(path string) (map[string]json.RawMessage, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read country shapes: %w", err)
+	}
+
+	var collection struct {
+		Features []struct {
+			Geometry   json.RawMessage        `json:"geometry"`
+			Properties map[string]interface{} `json:"properties"`
+		} `json:"features"`
+	}
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("unable to parse country shapes: %w", err)
+	}
+
+	shapes := map[string]json.RawMessage{}
+	for _, feature := range collection.Features {
+		for _, key := range []string{"ISO_A2", "iso_a2", "iso"} {
+			if iso, ok := feature.Properties[key].(string); ok && len(iso) == 2 {
+				shapes[strings.ToUpper(iso)] = feature.Geometry
+				break
+			}
+		}
+	}
+	return shapes, nil
+}
@@ -0,0 +1,310 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/middleware"
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+)
+
+// dimension names a dimension table in admin errors.
+type dimension struct {
+	table, key   string
+	noun, nounAR string
+}
+
+var (
+	products  = dimension{"dim_product", "product_id", "product", "المنتج"}
+	countries = dimension{"dim_country", "country_id", "country", "الدولة"}
+	ports     = dimension{"dim_port", "port_id", "port", "المنفذ"}
+
+	dimensions = []dimension{products, countries, ports}
+)
+
+var isoCode = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// CreateProduct adds a product. Both descriptions are required.
+func CreateProduct(admin store.AdminStore, invalidate func()) fiber.Handler {
+	return saveMember(products, true, productID, validateProduct, invalidate,
+		func(ctx context.Context, p *models.Product, actor string) error {
+			return admin.CreateProduct(ctx, *p, actor)
+		})
+}
+
+// UpdateProduct replaces the descriptions of the product in the path.
+func UpdateProduct(admin store.AdminStore, invalidate func()) fiber.Handler {
+	return saveMember(products, false, productID, validateProduct, invalidate,
+		func(ctx context.Context, p *models.Product, actor string) error {
+			return admin.UpdateProduct(ctx, *p, actor)
+		})
+}
+
+// CreateCountry adds a country, whose history starts today.
+func CreateCountry(admin store.AdminStore, invalidate func()) fiber.Handler {
+	return saveMember(countries, true, countryID, validateCountry, invalidate,
+		func(ctx context.Context, c *models.Country, actor string) error {
+			return admin.CreateCountry(ctx, *c, today(), actor)
+		})
+}
+
+// UpdateCountry replaces the attributes of the country in the path. The
+// change takes effect in its history today.
+func UpdateCountry(admin store.AdminStore, invalidate func()) fiber.Handler {
+	return saveMember(countries, false, countryID, validateCountry, invalidate,
+		func(ctx context.Context, c *models.Country, actor string) error {
+			return admin.UpdateCountry(ctx, *c, today(), actor)
+		})
+}
+
+// CreatePort adds a port, whose history starts today.
+func CreatePort(admin store.AdminStore, invalidate func()) fiber.Handler {
+	return saveMember(ports, true, portID, validatePort, invalidate,
+		func(ctx context.Context, p *models.Port, actor string) error {
+			return admin.CreatePort(ctx, *p, today(), actor)
+		})
+}
+
+// UpdatePort replaces the attributes of the port in the path. The change
+// takes effect in its history today.
+func UpdatePort(admin store.AdminStore, invalidate func()) fiber.Handler {
+	return saveMember(ports, false, portID, validatePort, invalidate,
+		func(ctx context.Context, p *models.Port, actor string) error {
+			return admin.UpdatePort(ctx, *p, today(), actor)
+		})
+}
+
+// DeleteMember soft-deletes the member of table in the path.
+func DeleteMember(admin store.AdminStore, table string, invalidate func()) fiber.Handler {
+	return setDeleted(lookupDimension(table), admin.DeleteMember, invalidate)
+}
+
+// RestoreMember undoes the deletion of the member of table in the path.
+func RestoreMember(admin store.AdminStore, table string, invalidate func()) fiber.Handler {
+	return setDeleted(lookupDimension(table), admin.RestoreMember, invalidate)
+}
+
+// GetAudit returns the admin changes to dimension members, newest first,
+// optionally only those to one table or member ID.
+func GetAudit(admin store.AdminStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		table := c.Query("table")
+		if table != "" && !slices.ContainsFunc(dimensions, func(d dimension) bool { return d.table == table }) {
+			return problem.BadRequest(problem.CodeInvalidField, "table",
+				fmt.Sprintf("table must be dim_product, dim_country or dim_port, got %q", table),
+				fmt.Sprintf("يجب أن يكون table أحد dim_product أو dim_country أو dim_port وليس %q", table))
+		}
+		var id int64
+		if raw := c.Query("id"); raw != "" {
+			var err error
+			if id, err = strconv.ParseInt(raw, 10, 64); err != nil {
+				return problem.BadRequest(problem.CodeInvalidType, "id",
+					fmt.Sprintf("id must be an integer, got %q", raw), fmt.Sprintf("يجب أن يكون id عدداً صحيحاً وليس %q", raw))
+			}
+		}
+
+		entries, err := admin.Audit(c.UserContext(), table, id, searchLimit(c))
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query the audit trail", "تعذّر الاستعلام عن سجل التغييرات", err)
+		}
+		return c.JSON(entries)
+	}
+}
+
+// saveMember decodes a member from the body, validates it and saves it,
+// then drops the cached dimension responses. Updates take the ID from the
+// path; a body may repeat it but not contradict it.
+func saveMember[T any](dim dimension, create bool, id func(*T) *int64, validate func(*T) []*problem.Error,
+	invalidate func(), save func(context.Context, *T, string) error) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var member T
+		errs, err := decodeStrict(c.Body(), &member)
+		if err != nil {
+			return err
+		}
+
+		if !create {
+			pathID, err := memberID(c, dim)
+			if err != nil {
+				return err
+			}
+			if bodyID := *id(&member); bodyID != 0 && bodyID != pathID {
+				field := "/" + dim.key
+				errs = append(errs, problem.BadRequest(problem.CodeInvalidField, field,
+					fmt.Sprintf("%s is %d but the path is for %s %d", field, bodyID, dim.noun, pathID),
+					fmt.Sprintf("قيمة %s هي %d لكن المسار يخص %s %d", field, bodyID, dim.nounAR, pathID)))
+			}
+			*id(&member) = pathID
+		}
+		for _, e := range validate(&member) {
+			if !overlapsAny(e.Field, errs) {
+				errs = append(errs, e)
+			}
+		}
+		sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+		if err := problem.Validation(errs); err != nil {
+			return err
+		}
+
+		if err := save(c.UserContext(), &member, middleware.Actor(c)); err != nil {
+			return memberError(dim, *id(&member), err)
+		}
+		invalidate()
+
+		status := fiber.StatusOK
+		if create {
+			status = fiber.StatusCreated
+		}
+		return c.Status(status).JSON(member)
+	}
+}
+
+func setDeleted(dim dimension, change func(context.Context, string, int64, string) error, invalidate func()) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := memberID(c, dim)
+		if err != nil {
+			return err
+		}
+		if err := change(c.UserContext(), dim.table, id, middleware.Actor(c)); err != nil {
+			return memberError(dim, id, err)
+		}
+		invalidate()
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// memberError turns an AdminStore error into a problem.
+func memberError(dim dimension, id int64, err error) error {
+	switch {
+	case errors.Is(err, store.ErrExists):
+		return problem.New(fiber.StatusConflict, problem.CodeDuplicateID,
+			fmt.Sprintf("%s %d already exists", dim.noun, id),
+			fmt.Sprintf("معرّف %s %d مستخدم مسبقاً", dim.nounAR, id))
+	case errors.Is(err, store.ErrNotFound):
+		return problem.New(fiber.StatusNotFound, problem.CodeNotFound,
+			fmt.Sprintf("there is no %s %d to change", dim.noun, id),
+			fmt.Sprintf("لا يوجد عنصر يمكن تغييره بمعرّف %s %d", dim.nounAR, id))
+	case errors.Is(err, store.ErrLaterVersion):
+		return problem.New(fiber.StatusConflict, problem.CodeVersionConflict,
+			fmt.Sprintf("%s %d has a version starting after today", dim.noun, id),
+			fmt.Sprintf("يوجد إصدار يبدأ بعد اليوم لمعرّف %s %d", dim.nounAR, id))
+	}
+	return problem.Internal(problem.CodeQueryFailed,
+		fmt.Sprintf("Failed to change %s %d", dim.noun, id), fmt.Sprintf("تعذّر تغيير %s %d", dim.nounAR, id), err)
+}
+
+// memberID parses the member ID in the path.
+func memberID(c *fiber.Ctx, dim dimension) (int64, error) {
+	id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+	if err != nil {
+		return 0, problem.BadRequest(problem.CodeInvalidType, "id",
+			fmt.Sprintf("%s ID must be an integer, got %q", dim.noun, c.Params("id")),
+			fmt.Sprintf("يجب أن يكون معرّف %s عدداً صحيحاً وليس %q", dim.nounAR, c.Params("id")))
+	}
+	return id, nil
+}
+
+func lookupDimension(table string) dimension {
+	i := slices.IndexFunc(dimensions, func(d dimension) bool { return d.table == table })
+	if i < 0 {
+		panic(fmt.Sprintf("unknown dimension table %q", table))
+	}
+	return dimensions[i]
+}
+
+func productID(p *models.Product) *int64 { return &p.ProductID }
+func countryID(c *models.Country) *int64 { return &c.CountryID }
+func portID(p *models.Port) *int64       { return &p.PortID }
+
+func validateProduct(p *models.Product) []*problem.Error {
+	return slices.Concat(
+		positiveID(products, p.ProductID),
+		required("/product_desc_en", &p.ProductDescEN),
+		required("/product_desc_ar", &p.ProductDescAR),
+	)
+}
+
+func validateCountry(c *models.Country) []*problem.Error {
+	errs := slices.Concat(
+		positiveID(countries, c.CountryID),
+		required("/country_name_en", &c.CountryNameEN),
+		required("/country_name_ar", &c.CountryNameAR),
+	)
+	if c.ISOCode != nil {
+		code := strings.TrimSpace(*c.ISOCode)
+		switch {
+		case code == "":
+			c.ISOCode = nil
+		case !isoCode.MatchString(code):
+			errs = append(errs, problem.BadRequest(problem.CodeInvalidField, "/iso_code",
+				fmt.Sprintf("iso_code must be two capital letters, got %q", code),
+				fmt.Sprintf("يجب أن يكون iso_code حرفين كبيرين وليس %q", code)))
+		default:
+			c.ISOCode = &code
+		}
+	}
+	return errs
+}
+
+func validatePort(p *models.Port) []*problem.Error {
+	errs := slices.Concat(
+		positiveID(ports, p.PortID),
+		required("/port_name_en", &p.PortNameEN),
+		required("/port_name_ar", &p.PortNameAR),
+		required("/port_type_en", &p.PortTypeEN),
+		required("/port_type_ar", &p.PortTypeAR),
+	)
+	if p.ModeID <= 0 {
+		errs = append(errs, problem.BadRequest(problem.CodeInvalidField, "/mode_id",
+			"mode_id must be a positive integer", "يجب أن يكون mode_id عدداً صحيحاً موجباً"))
+	}
+	if (p.Latitude == nil) != (p.Longitude == nil) {
+		errs = append(errs, problem.BadRequest(problem.CodeInvalidField, "/latitude",
+			"latitude and longitude must be given together", "يجب تحديد latitude وlongitude معاً"))
+	}
+	if p.Latitude != nil && (*p.Latitude < -90 || *p.Latitude > 90) {
+		errs = append(errs, problem.BadRequest(problem.CodeInvalidField, "/latitude",
+			"latitude must be between -90 and 90", "يجب أن يكون latitude بين -90 و90"))
+	}
+	if p.Longitude != nil && (*p.Longitude < -180 || *p.Longitude > 180) {
+		errs = append(errs, problem.BadRequest(problem.CodeInvalidField, "/longitude",
+			"longitude must be between -180 and 180", "يجب أن يكون longitude بين -180 و180"))
+	}
+	return errs
+}
+
+func positiveID(dim dimension, id int64) []*problem.Error {
+	if id > 0 {
+		return nil
+	}
+	field := "/" + dim.key
+	return []*problem.Error{problem.BadRequest(problem.CodeInvalidField, field,
+		fmt.Sprintf("%s must be a positive integer", field), fmt.Sprintf("يجب أن يكون %s عدداً صحيحاً موجباً", field))}
+}
+
+// required trims a name and reports it when it is empty. Members need their
+// names in both languages.
+func required(field string, value *string) []*problem.Error {
+	*value = strings.TrimSpace(*value)
+	if *value != "" {
+		return nil
+	}
+	return []*problem.Error{problem.BadRequest(problem.CodeMissingField, field,
+		fmt.Sprintf("%s is required", field), fmt.Sprintf("الحقل %s مطلوب", field))}
+}
+
+// today is the day admin changes take effect in the dimension history.
+func today() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour)
+}
@@ -0,0 +1,187 @@
+package handlers_test
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store/storetest"
+)
+
+// asAdmin sends an admin request to app.
+func asAdmin(t *testing.T, app *fiber.App, method, target, body string) *http.Response {
+	t.Helper()
+	return requestTo(t, app, method, target, body, "X-Admin-Token", adminToken)
+}
+
+func wantStatus(t *testing.T, resp *http.Response, status int) {
+	t.Helper()
+	if resp.StatusCode != status {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, status, readBody(t, resp))
+	}
+}
+
+func TestDimensionAdminRequiresToken(t *testing.T) {
+	resp := request(t, "POST", "/api/v1/admin/dimensions/products", `{"product_id":4,"product_desc_en":"Tea","product_desc_ar":"شاي"}`)
+	wantProblem(t, resp, 403, problem.CodeAdminRequired)
+}
+
+func TestCreateProduct(t *testing.T) {
+	st := storetest.New()
+	app := newApp(st)
+
+	var created models.Product
+	decode(t, asAdmin(t, app, "POST", "/api/v1/admin/dimensions/products",
+		`{"product_id":4,"product_desc_en":" Tea ","product_desc_ar":"شاي"}`), 201, &created)
+	if created.ProductID != 4 || created.ProductDescEN != "Tea" {
+		t.Errorf("created = %+v", created)
+	}
+
+	var products []models.Product
+	decode(t, requestTo(t, app, "GET", "/api/v1/dimensions/products?search=tea", ""), 200, &products)
+	if len(products) != 1 || products[0].ProductDescAR != "شاي" {
+		t.Errorf("products = %+v", products)
+	}
+
+	wantProblem(t, asAdmin(t, app, "POST", "/api/v1/admin/dimensions/products",
+		`{"product_id":4,"product_desc_en":"Coffee","product_desc_ar":"قهوة"}`), 409, problem.CodeDuplicateID)
+
+	details := wantProblem(t, asAdmin(t, app, "POST", "/api/v1/admin/dimensions/products",
+		`{"product_id":0,"product_desc_en":"Coffee","product_desc_ar":"  ","product_desc":"x"}`), 400, problem.CodeValidationFailed)
+	want := []struct{ code, field string }{
+		{problem.CodeUnknownField, "/product_desc"},
+		{problem.CodeMissingField, "/product_desc_ar"},
+		{problem.CodeInvalidField, "/product_id"},
+	}
+	if len(details.Errors) != len(want) {
+		t.Fatalf("errors = %+v", details.Errors)
+	}
+	for i, w := range want {
+		if details.Errors[i].Code != w.code || details.Errors[i].Field != w.field {
+			t.Errorf("error %d = %+v, want %s at %s", i, details.Errors[i], w.code, w.field)
+		}
+	}
+
+	if len(st.Fixtures.Audit) != 1 {
+		t.Fatalf("audit = %+v", st.Fixtures.Audit)
+	}
+	if e := st.Fixtures.Audit[0]; e.Table != "dim_product" || e.ID != 4 || e.Action != models.AuditCreate || e.Actor != "admin" || e.Before != nil {
+		t.Errorf("audit entry = %+v", e)
+	}
+}
+
+func TestUpdateProductInvalidatesCache(t *testing.T) {
+	app := newApp(storetest.New())
+	name := func() string {
+		t.Helper()
+		var products []models.Product
+		decode(t, requestTo(t, app, "GET", "/api/v1/dimensions/products?search=dates", ""), 200, &products)
+		if len(products) != 1 {
+			t.Fatalf("products = %+v", products)
+		}
+		return products[0].ProductDescAR
+	}
+
+	if got := name(); got != "تمور" {
+		t.Fatalf("name = %q", got)
+	}
+	var updated models.Product
+	decode(t, asAdmin(t, app, "PUT", "/api/v1/admin/dimensions/products/2",
+		`{"product_desc_en":"Dates","product_desc_ar":"تمور طازجة"}`), 200, &updated)
+	if updated.ProductID != 2 {
+		t.Errorf("updated = %+v", updated)
+	}
+	if got := name(); got != "تمور طازجة" {
+		t.Errorf("name after the update = %q", got)
+	}
+
+	wantProblem(t, asAdmin(t, app, "PUT", "/api/v1/admin/dimensions/products/9",
+		`{"product_desc_en":"Tea","product_desc_ar":"شاي"}`), 404, problem.CodeNotFound)
+	wantProblem(t, asAdmin(t, app, "PUT", "/api/v1/admin/dimensions/products/2",
+		`{"product_id":3,"product_desc_en":"Dates","product_desc_ar":"تمور"}`), 400, problem.CodeInvalidField)
+	wantProblem(t, asAdmin(t, app, "PUT", "/api/v1/admin/dimensions/products/dates",
+		`{"product_desc_en":"Dates","product_desc_ar":"تمور"}`), 400, problem.CodeInvalidType)
+}
+
+func TestUpdatePortRecordsHistory(t *testing.T) {
+	app := newApp(storetest.New())
+	body := `{"port_name_en":"King Khalid Airport","port_name_ar":"مطار الملك خالد","port_type_en":"Air","port_type_ar":"جوي","mode_id":2,"latitude":24.96,"longitude":46.7}`
+	wantStatus(t, asAdmin(t, app, "PUT", "/api/v1/admin/dimensions/ports/200", body), 200)
+
+	var versions []models.PortVersion
+	decode(t, requestTo(t, app, "GET", "/api/v1/dimensions/ports/200/history", ""), 200, &versions)
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	if len(versions) != 2 || versions[0].PortNameEN != "King Khalid International Airport" ||
+		!versions[0].ValidTo.Equal(today) || versions[1].PortNameEN != "King Khalid Airport" || !versions[1].ValidFrom.Equal(today) {
+		t.Errorf("versions = %+v", versions)
+	}
+
+	// A second correction the same day replaces the first
+	body = `{"port_name_en":"King Khalid Intl Airport","port_name_ar":"مطار الملك خالد","port_type_en":"Air","port_type_ar":"جوي","mode_id":2,"latitude":24.96,"longitude":46.7}`
+	wantStatus(t, asAdmin(t, app, "PUT", "/api/v1/admin/dimensions/ports/200", body), 200)
+	decode(t, requestTo(t, app, "GET", "/api/v1/dimensions/ports/200/history", ""), 200, &versions)
+	if len(versions) != 2 || versions[1].PortNameEN != "King Khalid Intl Airport" {
+		t.Errorf("versions = %+v", versions)
+	}
+
+	details := wantProblem(t, asAdmin(t, app, "PUT", "/api/v1/admin/dimensions/ports/200",
+		`{"port_name_en":"X","port_name_ar":"س","port_type_en":"Air","port_type_ar":"","mode_id":0,"latitude":91}`), 400, problem.CodeValidationFailed)
+	if len(details.Errors) != 4 {
+		t.Errorf("errors = %+v", details.Errors)
+	}
+}
+
+func TestDeleteAndRestoreMember(t *testing.T) {
+	st := storetest.New()
+	app := newApp(st)
+	ports := func() int {
+		t.Helper()
+		var ports []models.Port
+		decode(t, requestTo(t, app, "GET", "/api/v1/dimensions/ports", ""), 200, &ports)
+		return len(ports)
+	}
+
+	if n := ports(); n != 3 {
+		t.Fatalf("ports = %d", n)
+	}
+	wantStatus(t, asAdmin(t, app, "DELETE", "/api/v1/admin/dimensions/ports/300", ""), 204)
+	if n := ports(); n != 2 {
+		t.Errorf("ports after the delete = %d, want 2", n)
+	}
+
+	// Facts keep their labels
+	var resp models.PaginatedResponse
+	decode(t, requestTo(t, app, "POST", "/api/v1/trade/aggregate",
+		`{"date_range":{"start_year":2021,"end_year":2023},"group_by":["port"],"filters":{"port_ids":[300]}}`), 200, &resp)
+	if results := aggregateResults(t, resp); len(results) != 1 || results[0].PortNameEN == nil || *results[0].PortNameEN != "Al Batha" {
+		t.Errorf("results = %+v", results)
+	}
+
+	wantProblem(t, asAdmin(t, app, "DELETE", "/api/v1/admin/dimensions/ports/300", ""), 404, problem.CodeNotFound)
+	wantProblem(t, asAdmin(t, app, "PUT", "/api/v1/admin/dimensions/ports/300",
+		`{"port_name_en":"Al Batha","port_name_ar":"البطحاء","port_type_en":"Land","port_type_ar":"بري","mode_id":3}`), 404, problem.CodeNotFound)
+	wantProblem(t, asAdmin(t, app, "POST", "/api/v1/admin/dimensions/ports",
+		`{"port_id":300,"port_name_en":"Al Batha","port_name_ar":"البطحاء","port_type_en":"Land","port_type_ar":"بري","mode_id":3}`), 409, problem.CodeDuplicateID)
+
+	wantStatus(t, asAdmin(t, app, "POST", "/api/v1/admin/dimensions/ports/300/restore", ""), 204)
+	if n := ports(); n != 3 {
+		t.Errorf("ports after the restore = %d, want 3", n)
+	}
+	wantProblem(t, asAdmin(t, app, "POST", "/api/v1/admin/dimensions/ports/300/restore", ""), 404, problem.CodeNotFound)
+
+	var entries []models.AuditEntry
+	decode(t, asAdmin(t, app, "GET", "/api/v1/admin/dimensions/audit?table=dim_port&id=300", ""), 200, &entries)
+	if len(entries) != 2 || entries[0].Action != models.AuditRestore || entries[1].Action != models.AuditDelete ||
+		entries[1].Before == nil || string(entries[1].After) != "null" {
+		t.Errorf("audit = %+v", entries)
+	}
+	decode(t, asAdmin(t, app, "GET", "/api/v1/admin/dimensions/audit?table=dim_product", ""), 200, &entries)
+	if len(entries) != 0 {
+		t.Errorf("product audit = %+v", entries)
+	}
+	wantProblem(t, asAdmin(t, app, "GET", "/api/v1/admin/dimensions/audit?table=dim_region", ""), 400, problem.CodeInvalidField)
+}
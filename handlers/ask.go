@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/models"
+	"trade-api/nlq"
+	"trade-api/problem"
+	"trade-api/store"
+	"trade-api/utils"
+)
+
+const maxQuestionLength = 500
+
+func AskQuestion(trade store.TradeStore, translator nlq.Translator) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var body models.AskRequest
+		if err := c.BodyParser(&body); err != nil {
+			return problem.BadRequest(problem.CodeInvalidBody, "", "Invalid request body", "نص الطلب غير صالح")
+		}
+		question := strings.TrimSpace(body.Question)
+		if question == "" {
+			return problem.BadRequest(problem.CodeInvalidQuestion, "/question", "question is required", "السؤال مطلوب")
+		}
+		if len([]rune(question)) > maxQuestionLength {
+			return problem.BadRequest(problem.CodeInvalidQuestion, "/question",
+				"question must be at most 500 characters", "يجب ألا يتجاوز السؤال 500 حرف")
+		}
+
+		ctx := c.UserContext()
+
+		req, err := translator.Translate(ctx, question)
+		if err != nil {
+			if errors.Is(err, nlq.ErrNotUnderstood) {
+				return &problem.Error{
+					Status:    fiber.StatusUnprocessableEntity,
+					Code:      problem.CodeQuestionNotUnderstood,
+					Field:     "/question",
+					Message:   err.Error(),
+					MessageAR: "تعذّر فهم السؤال. اذكر نوع التجارة أو السنوات أو أسماء المنتجات أو الدول أو المنافذ.",
+				}
+			}
+			return problem.Internal(problem.CodeTranslatorFailed, "Failed to translate question", "تعذّرت ترجمة السؤال", err)
+		}
+
+		if err := PrepareAggregateRequest(ctx, trade, req); err != nil {
+			var invalid *problem.Error
+			if errors.As(err, &invalid) {
+				return &problem.Error{
+					Status:    fiber.StatusUnprocessableEntity,
+					Code:      invalid.Code,
+					Field:     invalid.Field,
+					Message:   "The question produced an invalid query: " + invalid.Message,
+					MessageAR: "نتج عن السؤال استعلام غير صالح: " + invalid.MessageAR,
+					Errors:    invalid.Errors,
+				}
+			}
+			return err
+		}
+
+		results, meta, err := RunAggregate(ctx, trade, req)
+		if err != nil {
+			return err
+		}
+
+		return c.JSON(models.AskResponse{
+			Question: question,
+			Language: questionLanguage(question),
+			Request:  req,
+			Result: &models.PaginatedResponse{
+				Data:             results,
+				Pagination:       meta,
+				QueryDescription: DescribeAggregate(req),
+			},
+		})
+	}
+}
+
+// LoadCatalog reads every dimension member and the years with data, for
+// resolving names in questions.
+func LoadCatalog(st store.Store) nlq.CatalogFunc {
+	return func(ctx context.Context) (*nlq.Catalog, error) {
+		catalog := &nlq.Catalog{}
+		var err error
+
+		if catalog.Products, err = st.Products(ctx, "", 0); err != nil {
+			return nil, err
+		}
+		if catalog.Countries, err = st.Countries(ctx, "", 0); err != nil {
+			return nil, err
+		}
+		if catalog.Ports, err = st.Ports(ctx, "", "", 0); err != nil {
+			return nil, err
+		}
+
+		// Aggregates are validated against the fact table they read, so the
+		// default and relative years come from the years both tables have
+		for _, table := range []string{utils.ProductFactTable, utils.CountryFactTable} {
+			minYear, maxYear, err := st.FactYearRange(ctx, table, 0)
+			if err != nil {
+				return nil, err
+			}
+			if maxYear == 0 {
+				continue
+			}
+			if catalog.MaxYear == 0 {
+				catalog.MinYear, catalog.MaxYear = minYear, maxYear
+				continue
+			}
+			catalog.MinYear = max(catalog.MinYear, minYear)
+			catalog.MaxYear = min(catalog.MaxYear, maxYear)
+		}
+
+		return catalog, nil
+	}
+}
+
+func questionLanguage(question string) string {
+	for _, r := range question {
+		if unicode.Is(unicode.Arabic, r) {
+			return "ar"
+		}
+	}
+	return "en"
+}
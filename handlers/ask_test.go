@@ -0,0 +1,70 @@
+package handlers_test
+
+import (
+	"context"
+	"testing"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store/storetest"
+	"trade-api/utils"
+)
+
+func TestAskQuestion(t *testing.T) {
+	var resp models.AskResponse
+	decode(t, request(t, "POST", "/api/v1/ask", `{"question":"Exports of Dates in 2022"}`), 200, &resp)
+
+	req := resp.Request
+	if req.DateRange.StartYear != 2022 || req.DateRange.EndYear != 2022 {
+		t.Errorf("date range = %+v", req.DateRange)
+	}
+	if len(req.Filters.ProductIDs) != 1 || req.Filters.ProductIDs[0] != 2 {
+		t.Errorf("product filter = %v, want [2]", req.Filters.ProductIDs)
+	}
+	if len(req.TradeTypes) != 1 || req.TradeTypes[0] != "Export" {
+		t.Errorf("trade types = %v, want [Export]", req.TradeTypes)
+	}
+
+	var total int64
+	for _, r := range aggregateResults(t, *resp.Result) {
+		total += r.TotalValue
+	}
+	if total != 250 {
+		t.Errorf("total = %d, want 250", total)
+	}
+	if resp.Language != "en" {
+		t.Errorf("language = %s", resp.Language)
+	}
+}
+
+func TestAskQuestionErrors(t *testing.T) {
+	tests := []struct {
+		body   string
+		status int
+		code   string
+	}{
+		{`{"question":"  "}`, 400, problem.CodeInvalidQuestion},
+		{`{"question":`, 400, problem.CodeInvalidBody},
+		{`{"question":"what is the weather like"}`, 422, problem.CodeQuestionNotUnderstood},
+		{`{"question":"imports in 1990"}`, 422, problem.CodeValidationFailed},
+	}
+	for _, tt := range tests {
+		wantProblem(t, request(t, "POST", "/api/v1/ask", tt.body), tt.status, tt.code)
+	}
+}
+
+func TestAskQuestionDefaultsToFactYears(t *testing.T) {
+	st := storetest.New()
+	_, maxYear, err := st.FactYearRange(context.Background(), utils.ProductFactTable, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A summary ahead of the fact tables does not move the default year
+	st.Fixtures.YearlySummary = append(st.Fixtures.YearlySummary, models.TradeSummary{Year: maxYear + 1, ImportValue: 10})
+
+	var resp models.AskResponse
+	decode(t, requestTo(t, newApp(st), "POST", "/api/v1/ask", `{"question":"Exports of Dates"}`), 200, &resp)
+	if resp.Request.DateRange.EndYear != maxYear {
+		t.Errorf("date range = %+v, want %d", resp.Request.DateRange, maxYear)
+	}
+}
@@ -1,164 +1,82 @@
 package handlers
 
 import (
-	"context"
 	"fmt"
-	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/jackc/pgx/v5/pgxpool"
 
 	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
 )
 
-func GetProducts(db *pgxpool.Pool) fiber.Handler {
+func GetProducts(dims store.DimensionStore) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		search := c.Query("search")
-		limit := c.QueryInt("limit", 50)
-		if limit > 500 {
-			limit = 500
-		}
-
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		query := `
-			SELECT product_id, product_desc_en, product_desc_ar
-			FROM dim_product
-			WHERE 1=1
-		`
-		args := []interface{}{}
-		argCount := 0
-
-		if search != "" {
-			argCount++
-			query += fmt.Sprintf(" AND (product_desc_en ILIKE $%d OR product_desc_ar ILIKE $%d)", argCount, argCount)
-			args = append(args, "%"+search+"%")
-		}
+		ctx := c.UserContext()
 
-		argCount++
-		query += fmt.Sprintf(" ORDER BY product_desc_en LIMIT $%d", argCount)
-		args = append(args, limit)
-
-		rows, err := db.Query(ctx, query, args...)
+		products, err := dims.Products(ctx, c.Query("search"), searchLimit(c))
 		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to query products")
-		}
-		defer rows.Close()
-
-		products := []models.Product{}
-		for rows.Next() {
-			var p models.Product
-			if err := rows.Scan(&p.ProductID, &p.ProductDescEN, &p.ProductDescAR); err != nil {
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to scan product")
-			}
-			products = append(products, p)
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query products", "تعذّر الاستعلام عن المنتجات", err)
 		}
 
 		return c.JSON(products)
 	}
 }
 
-func GetCountries(db *pgxpool.Pool) fiber.Handler {
+func GetCountries(dims store.DimensionStore) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		search := c.Query("search")
-		limit := c.QueryInt("limit", 50)
-		if limit > 500 {
-			limit = 500
-		}
+		ctx := c.UserContext()
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		query := `
-			SELECT country_id, country_name_en, country_name_ar
-			FROM dim_country
-			WHERE 1=1
-		`
-		args := []interface{}{}
-		argCount := 0
-
-		if search != "" {
-			argCount++
-			query += fmt.Sprintf(" AND (country_name_en ILIKE $%d OR country_name_ar ILIKE $%d)", argCount, argCount)
-			args = append(args, "%"+search+"%")
-		}
-
-		argCount++
-		query += fmt.Sprintf(" ORDER BY country_name_en LIMIT $%d", argCount)
-		args = append(args, limit)
-
-		rows, err := db.Query(ctx, query, args...)
+		countries, err := dims.Countries(ctx, c.Query("search"), searchLimit(c))
 		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to query countries")
-		}
-		defer rows.Close()
-
-		countries := []models.Country{}
-		for rows.Next() {
-			var country models.Country
-			if err := rows.Scan(&country.CountryID, &country.CountryNameEN, &country.CountryNameAR); err != nil {
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to scan country")
-			}
-			countries = append(countries, country)
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query countries", "تعذّر الاستعلام عن الدول", err)
 		}
 
 		return c.JSON(countries)
 	}
 }
 
-func GetPorts(db *pgxpool.Pool) fiber.Handler {
+func GetPorts(dims store.DimensionStore) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		search := c.Query("search")
-		portType := c.Query("port_type")
-		limit := c.QueryInt("limit", 50)
-		if limit > 500 {
-			limit = 500
-		}
+		ctx := c.UserContext()
 
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-
-		query := `
-			SELECT port_id, port_name_en, port_name_ar, port_type_en, port_type_ar, mode_id
-			FROM dim_port
-			WHERE 1=1
-		`
-		args := []interface{}{}
-		argCount := 0
-
-		if search != "" {
-			argCount++
-			query += fmt.Sprintf(" AND (port_name_en ILIKE $%d OR port_name_ar ILIKE $%d)", argCount, argCount)
-			args = append(args, "%"+search+"%")
+		ports, err := dims.Ports(ctx, c.Query("search"), c.Query("port_type"), searchLimit(c))
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query ports", "تعذّر الاستعلام عن المنافذ", err)
 		}
 
-		if portType != "" {
-			argCount++
-			query += fmt.Sprintf(" AND port_type_en = $%d", argCount)
-			args = append(args, portType)
-		}
+		return c.JSON(ports)
+	}
+}
 
-		argCount++
-		query += fmt.Sprintf(" ORDER BY port_name_en LIMIT $%d", argCount)
-		args = append(args, limit)
+// GetPortHistory returns every version of a port, oldest first.
+func GetPortHistory(dims store.DimensionStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := memberID(c, ports)
+		if err != nil {
+			return err
+		}
 
-		rows, err := db.Query(ctx, query, args...)
+		versions, err := dims.PortHistory(c.UserContext(), id)
 		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to query ports")
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query port history", "تعذّر الاستعلام عن سجل المنفذ", err)
 		}
-		defer rows.Close()
-
-		ports := []models.Port{}
-		for rows.Next() {
-			var port models.Port
-			if err := rows.Scan(&port.PortID, &port.PortNameEN, &port.PortNameAR,
-				&port.PortTypeEN, &port.PortTypeAR, &port.ModeID); err != nil {
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to scan port")
-			}
-			ports = append(ports, port)
+		if len(versions) == 0 {
+			return problem.New(fiber.StatusNotFound, problem.CodeNotFound,
+				fmt.Sprintf("port %d does not exist", id), fmt.Sprintf("المنفذ %d غير موجود", id))
 		}
 
-		return c.JSON(ports)
+		return c.JSON(versions)
+	}
+}
+
+func searchLimit(c *fiber.Ctx) int {
+	limit := c.QueryInt("limit", models.DefaultSearchLimit)
+	if limit <= 0 {
+		limit = models.DefaultSearchLimit
+	}
+	if limit > models.MaxSearchLimit {
+		limit = models.MaxSearchLimit
 	}
+	return limit
 }
@@ -0,0 +1,92 @@
+package handlers_test
+
+import (
+	"errors"
+	"net/url"
+	"slices"
+	"testing"
+	"time"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store/storetest"
+)
+
+func TestGetProducts(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{"Cars", "Crude Oil", "Dates"}},
+		{"?search=oil", []string{"Crude Oil"}},
+		{"?search=" + url.QueryEscape("تمور"), []string{"Dates"}},
+		{"?limit=2", []string{"Cars", "Crude Oil"}},
+	}
+	for _, tt := range tests {
+		var products []models.Product
+		decode(t, request(t, "GET", "/api/v1/dimensions/products"+tt.query, ""), 200, &products)
+
+		got := []string{}
+		for _, p := range products {
+			got = append(got, p.ProductDescEN)
+		}
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("%q: got %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestGetCountries(t *testing.T) {
+	var countries []models.Country
+	decode(t, request(t, "GET", "/api/v1/dimensions/countries?search=in", ""), 200, &countries)
+
+	if len(countries) != 2 || countries[0].CountryNameEN != "China" || countries[1].CountryNameEN != "India" {
+		t.Fatalf("got %+v, want China and India", countries)
+	}
+	if countries[0].ISOCode == nil || *countries[0].ISOCode != "CN" {
+		t.Errorf("iso_code = %v, want CN", countries[0].ISOCode)
+	}
+}
+
+func TestGetPorts(t *testing.T) {
+	var ports []models.Port
+	decode(t, request(t, "GET", "/api/v1/dimensions/ports?port_type=Air", ""), 200, &ports)
+
+	if len(ports) != 1 || ports[0].PortID != 200 {
+		t.Fatalf("got %+v, want port 200 only", ports)
+	}
+	if ports[0].PortTypeAR != "جوي" || ports[0].ModeID != 2 || ports[0].Latitude == nil {
+		t.Errorf("port fields not returned: %+v", ports[0])
+	}
+}
+
+func TestDimensionQueryFailure(t *testing.T) {
+	st := storetest.New()
+	st.Err = errors.New("connection refused")
+
+	details := wantProblem(t, requestTo(t, newApp(st), "GET", "/api/v1/dimensions/ports", ""), 500, problem.CodeQueryFailed)
+	if details.Detail != "Failed to query ports" {
+		t.Errorf("detail = %q, internal error must not leak", details.Detail)
+	}
+}
+
+func TestGetPortHistory(t *testing.T) {
+	var versions []models.PortVersion
+	decode(t, request(t, "GET", "/api/v1/dimensions/ports/100/history", ""), 200, &versions)
+	if len(versions) != 2 || versions[0].PortNameEN != "Jeddah Port" || versions[1].PortNameEN != "Jeddah Islamic Port" {
+		t.Fatalf("versions = %+v", versions)
+	}
+	renamed := time.Date(2022, 7, 1, 0, 0, 0, 0, time.UTC)
+	if versions[0].ValidFrom != nil || !versions[0].ValidTo.Equal(renamed) || !versions[1].ValidFrom.Equal(renamed) || versions[1].ValidTo != nil {
+		t.Errorf("validity = %v–%v, %v–%v", versions[0].ValidFrom, versions[0].ValidTo, versions[1].ValidFrom, versions[1].ValidTo)
+	}
+
+	// A port that never changed has its current version only
+	decode(t, request(t, "GET", "/api/v1/dimensions/ports/200/history", ""), 200, &versions)
+	if len(versions) != 1 || versions[0].PortID != 200 || versions[0].ValidFrom != nil || versions[0].ValidTo != nil {
+		t.Errorf("versions = %+v", versions)
+	}
+
+	wantProblem(t, request(t, "GET", "/api/v1/dimensions/ports/999/history", ""), 404, problem.CodeNotFound)
+	wantProblem(t, request(t, "GET", "/api/v1/dimensions/ports/jeddah/history", ""), 400, problem.CodeInvalidType)
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"slices"
+
+	"trade-api/geo"
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+)
+
+func validateGeoJSONRequest(req *models.AggregateRequest) error {
+	byCountry := slices.Contains(req.GroupBy, "country")
+	byPort := slices.Contains(req.GroupBy, "port")
+
+	if byCountry == byPort {
+		return problem.BadRequest(problem.CodeIncompatibleDimensions, "/group_by",
+			"format=geojson requires group_by to contain exactly one of: country, port",
+			"تتطلب صيغة geojson أن يحتوي group_by على أحد الحقلين فقط: country أو port")
+	}
+	return nil
+}
+
+func buildFeatureCollection(ctx context.Context, dims store.DimensionStore, req *models.AggregateRequest,
+	results []models.AggregateResult, meta models.PaginationMeta) (*models.FeatureCollection, error) {
+	collection := &models.FeatureCollection{
+		Type:       "FeatureCollection",
+		Features:   []models.Feature{},
+		Pagination: &meta,
+	}
+
+	if slices.Contains(req.GroupBy, "country") {
+		geometries, err := countryGeometries(ctx, dims, results)
+		if err != nil {
+			return nil, err
+		}
+		for _, result := range results {
+			collection.Features = append(collection.Features, models.Feature{
+				Type:       "Feature",
+				ID:         *result.CountryID,
+				Geometry:   geometries[*result.CountryID],
+				Properties: result,
+			})
+		}
+		return collection, nil
+	}
+
+	geometries, err := portGeometries(ctx, dims, results)
+	if err != nil {
+		return nil, err
+	}
+	for _, result := range results {
+		collection.Features = append(collection.Features, models.Feature{
+			Type:       "Feature",
+			ID:         *result.PortID,
+			Geometry:   geometries[*result.PortID],
+			Properties: result,
+		})
+	}
+	return collection, nil
+}
+
+func countryGeometries(ctx context.Context, dims store.DimensionStore, results []models.AggregateResult) (map[int64]json.RawMessage, error) {
+	ids := []int64{}
+	for _, result := range results {
+		ids = append(ids, *result.CountryID)
+	}
+
+	countries, err := dims.CountriesByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	geometries := map[int64]json.RawMessage{}
+	for _, country := range countries {
+		if country.ISOCode == nil {
+			continue
+		}
+		geometry, err := geo.CountryGeometry(*country.ISOCode)
+		if err != nil {
+			return nil, err
+		}
+		geometries[country.CountryID] = geometry
+	}
+	return geometries, nil
+}
+
+func portGeometries(ctx context.Context, dims store.DimensionStore, results []models.AggregateResult) (map[int64]json.RawMessage, error) {
+	ids := []int64{}
+	for _, result := range results {
+		ids = append(ids, *result.PortID)
+	}
+
+	ports, err := dims.PortsByID(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	geometries := map[int64]json.RawMessage{}
+	for _, port := range ports {
+		if port.Latitude == nil || port.Longitude == nil {
+			continue
+		}
+		geometries[port.PortID] = geo.Point(*port.Latitude, *port.Longitude)
+	}
+	return geometries, nil
+}
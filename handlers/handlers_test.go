@@ -0,0 +1,106 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/config"
+	"trade-api/problem"
+	"trade-api/server"
+	"trade-api/store"
+	"trade-api/store/storetest"
+)
+
+const adminToken = "test-admin-token"
+
+// newApp serves the full API, with its middleware and error handler, from st.
+func newApp(st store.Store) *fiber.App {
+	return server.New(st, testConfig())
+}
+
+// testConfig is the default configuration with request logging and rate
+// limiting off and adminToken as the admin token.
+func testConfig() *config.Config {
+	cfg := config.Default()
+	cfg.Log.Requests = false
+	cfg.RateLimit.Enabled = false
+	cfg.Server.AdminToken = adminToken
+	return cfg
+}
+
+// request sends a request to an app backed by the default fixtures. Bodies
+// are sent as JSON; headers are name, value pairs.
+func request(t *testing.T, method, target, body string, headers ...string) *http.Response {
+	t.Helper()
+	return requestTo(t, newApp(storetest.New()), method, target, body, headers...)
+}
+
+func requestTo(t *testing.T, app *fiber.App, method, target, body string, headers ...string) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// decode checks the status and decodes the JSON body into v.
+func decode(t *testing.T, resp *http.Response, status int, v interface{}) {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != status {
+		t.Fatalf("status = %d, want %d: %s", resp.StatusCode, status, body)
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+}
+
+// wantProblem checks that resp is problem details with the status and code.
+func wantProblem(t *testing.T, resp *http.Response, status int, code string) problem.ProblemDetails {
+	t.Helper()
+
+	var details problem.ProblemDetails
+	decode(t, resp, status, &details)
+	if ct := resp.Header.Get(fiber.HeaderContentType); ct != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, problem.ContentType)
+	}
+	if details.Code != code {
+		t.Errorf("code = %s, want %s (%s)", details.Code, code, details.Detail)
+	}
+	return details
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/apikey"
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+)
+
+// GetKeys lists every API key, newest first, without the keys themselves.
+func GetKeys(keys store.KeyStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		list, err := keys.Keys(c.UserContext())
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query API keys", "تعذّر الاستعلام عن مفاتيح API", err)
+		}
+		return c.JSON(list)
+	}
+}
+
+// PostKey creates an API key. The response is the only time the key is
+// shown.
+func PostKey(keys store.KeyStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var req models.APIKeyRequest
+		errs, err := decodeStrict(c.Body(), &req)
+		if err != nil {
+			return err
+		}
+		if err := problem.Validation(errs); err != nil {
+			return err
+		}
+
+		key, err := CreateKey(c.UserContext(), keys, req.Name, req.Scopes)
+		var p *problem.Error
+		if errors.As(err, &p) {
+			return p
+		}
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to create the API key", "تعذّر إنشاء مفتاح API", err)
+		}
+		return c.Status(fiber.StatusCreated).JSON(key)
+	}
+}
+
+// RevokeKey revokes the API key in the path, then calls revoked so cached
+// lookups of it are dropped.
+func RevokeKey(keys store.KeyStore, revoked func()) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := strconv.ParseInt(c.Params("id"), 10, 64)
+		if err != nil {
+			return problem.BadRequest(problem.CodeInvalidType, "id",
+				fmt.Sprintf("key ID must be an integer, got %q", c.Params("id")),
+				fmt.Sprintf("يجب أن يكون معرّف المفتاح عدداً صحيحاً وليس %q", c.Params("id")))
+		}
+		err = keys.RevokeKey(c.UserContext(), id)
+		if errors.Is(err, store.ErrKeyNotFound) {
+			return problem.New(fiber.StatusNotFound, problem.CodeNotFound,
+				fmt.Sprintf("there is no active API key %d", id), fmt.Sprintf("لا يوجد مفتاح API نشط بالمعرّف %d", id))
+		}
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to revoke the API key", "تعذّر إلغاء مفتاح API", err)
+		}
+		revoked()
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+}
+
+// CreateKey makes an API key named name with scopes and stores its hash.
+// Invalid input returns a *problem.Error.
+func CreateKey(ctx context.Context, keys store.KeyStore, name string, scopes []string) (*models.NewAPIKey, error) {
+	k := models.APIKey{Name: strings.TrimSpace(name)}
+	var errs []*problem.Error
+	if k.Name == "" {
+		errs = append(errs, problem.BadRequest(problem.CodeMissingField, "/name", "/name is required", "الحقل /name مطلوب"))
+	}
+	if len(scopes) == 0 {
+		errs = append(errs, problem.BadRequest(problem.CodeMissingField, "/scopes",
+			"/scopes needs at least one scope", "يجب أن يحتوي /scopes على صلاحية واحدة على الأقل"))
+	}
+	options := strings.Join(models.Scopes, ", ")
+	for i, s := range scopes {
+		if !slices.Contains(models.Scopes, s) {
+			errs = append(errs, problem.BadRequest(problem.CodeInvalidField, fmt.Sprintf("/scopes/%d", i),
+				fmt.Sprintf("invalid scope: %s. Valid options: %s", s, options),
+				fmt.Sprintf("صلاحية غير صالحة: %s. الخيارات المتاحة: %s", s, options)))
+		}
+	}
+	if err := problem.Validation(errs); err != nil {
+		return nil, err
+	}
+	// Scopes keep their canonical order, once each
+	for _, s := range models.Scopes {
+		if slices.Contains(scopes, s) {
+			k.Scopes = append(k.Scopes, s)
+		}
+	}
+
+	secret, prefix, err := apikey.Generate()
+	if err != nil {
+		return nil, err
+	}
+	k.Prefix, k.Hash = prefix, apikey.Hash(secret)
+	if err := keys.CreateKey(ctx, &k); err != nil {
+		return nil, err
+	}
+	return &models.NewAPIKey{APIKey: k, Key: secret}, nil
+}
@@ -0,0 +1,122 @@
+package handlers_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/server"
+	"trade-api/store/storetest"
+)
+
+// newKeyedApp serves the API from st with API keys required.
+func newKeyedApp(st *storetest.Memory) *fiber.App {
+	cfg := testConfig()
+	cfg.Auth.Required = true
+	return server.New(st, cfg)
+}
+
+// createKey creates a key with scopes through the admin API.
+func createKey(t *testing.T, app *fiber.App, name string, scopes ...string) models.NewAPIKey {
+	t.Helper()
+	var key models.NewAPIKey
+	decode(t, asAdmin(t, app, "POST", "/api/v1/admin/keys",
+		`{"name":"`+name+`","scopes":["`+strings.Join(scopes, `","`)+`"]}`), 201, &key)
+	return key
+}
+
+func withKey(t *testing.T, app *fiber.App, key, method, target, body string) *http.Response {
+	t.Helper()
+	return requestTo(t, app, method, target, body, "X-API-Key", key)
+}
+
+func TestKeysRequired(t *testing.T) {
+	st := storetest.New()
+	app := newKeyedApp(st)
+
+	wantStatus(t, requestTo(t, app, "GET", "/health", ""), 200)
+	wantStatus(t, requestTo(t, app, "GET", "/openapi.json", ""), 200)
+	wantProblem(t, requestTo(t, app, "GET", "/api/v1/dimensions/products", ""), 401, problem.CodeAuthRequired)
+	wantProblem(t, withKey(t, app, "tdw_00000000_nope", "GET", "/api/v1/dimensions/products", ""), 401, problem.CodeInvalidAPIKey)
+	wantProblem(t, withKey(t, app, "not-a-key", "GET", "/api/v1/dimensions/products", ""), 401, problem.CodeInvalidAPIKey)
+
+	key := createKey(t, app, "dashboard", models.ScopeReadDimensions)
+	if !strings.HasPrefix(key.Key, key.Prefix+"_") || len(st.Fixtures.APIKeys[0].Hash) == 0 {
+		t.Fatalf("key = %+v", key)
+	}
+	wantStatus(t, withKey(t, app, key.Key, "GET", "/api/v1/dimensions/products", ""), 200)
+	wantStatus(t, requestTo(t, app, "GET", "/api/v1/dimensions/countries", "", "Authorization", "Bearer "+key.Key), 200)
+	wantProblem(t, withKey(t, app, key.Key, "GET", "/api/v1/trade/summary?start_year=2021&end_year=2022", ""), 403, problem.CodeScopeRequired)
+	wantProblem(t, withKey(t, app, key.Key, "GET", "/api/v1/admin/keys", ""), 403, problem.CodeAdminRequired)
+	wantProblem(t, withKey(t, app, key.Key+"x", "GET", "/api/v1/dimensions/products", ""), 401, problem.CodeInvalidAPIKey)
+
+	body := readBody(t, asAdmin(t, app, "GET", "/api/v1/admin/keys", ""))
+	if strings.Contains(body, key.Key) || strings.Contains(body, `"hash"`) {
+		t.Errorf("key list reveals the key: %s", body)
+	}
+	var keys []models.APIKey
+	decode(t, asAdmin(t, app, "GET", "/api/v1/admin/keys", ""), 200, &keys)
+	if len(keys) != 1 || keys[0].Name != "dashboard" || keys[0].LastUsedAt == nil {
+		t.Errorf("keys = %+v", keys)
+	}
+}
+
+func TestExportScope(t *testing.T) {
+	app := newKeyedApp(storetest.New())
+	reader := createKey(t, app, "reader", models.ScopeReadTrade)
+	exporter := createKey(t, app, "exporter", models.ScopeReadTrade, models.ScopeExport)
+
+	summary := "/api/v1/trade/summary?start_year=2021&end_year=2022"
+	wantStatus(t, withKey(t, app, reader.Key, "GET", summary, ""), 200)
+	wantProblem(t, withKey(t, app, reader.Key, "GET", summary+"&format=markdown", ""), 403, problem.CodeScopeRequired)
+	wantProblem(t, withKey(t, app, reader.Key, "GET", "/api/v1/sdmx/data/summary?start_year=2021&end_year=2022", ""), 403, problem.CodeScopeRequired)
+	wantStatus(t, withKey(t, app, exporter.Key, "GET", summary+"&format=markdown", ""), 200)
+	wantStatus(t, withKey(t, app, exporter.Key, "GET", "/api/v1/sdmx/data/summary?start_year=2021&end_year=2022", ""), 200)
+}
+
+func TestRevokeKey(t *testing.T) {
+	app := newKeyedApp(storetest.New())
+	key := createKey(t, app, "ci", models.ScopeReadDimensions)
+	wantStatus(t, withKey(t, app, key.Key, "GET", "/api/v1/dimensions/products", ""), 200)
+
+	wantStatus(t, asAdmin(t, app, "DELETE", "/api/v1/admin/keys/1", ""), 204)
+	wantProblem(t, withKey(t, app, key.Key, "GET", "/api/v1/dimensions/products", ""), 401, problem.CodeInvalidAPIKey)
+	wantProblem(t, asAdmin(t, app, "DELETE", "/api/v1/admin/keys/1", ""), 404, problem.CodeNotFound)
+	wantProblem(t, asAdmin(t, app, "DELETE", "/api/v1/admin/keys/ci", ""), 400, problem.CodeInvalidType)
+}
+
+func TestCreateKeyValidation(t *testing.T) {
+	app := newApp(storetest.New())
+	details := wantProblem(t, asAdmin(t, app, "POST", "/api/v1/admin/keys",
+		`{"name":" ","scopes":["read:trade","write:trade"]}`), 400, problem.CodeValidationFailed)
+	if len(details.Errors) != 2 || details.Errors[0].Field != "/name" || details.Errors[1].Field != "/scopes/1" {
+		t.Errorf("errors = %+v", details.Errors)
+	}
+	wantProblem(t, asAdmin(t, app, "POST", "/api/v1/admin/keys", `{"name":"ci"}`), 400, problem.CodeMissingField)
+	wantProblem(t, asAdmin(t, app, "POST", "/api/v1/admin/keys", `{"name":"ci","scopes":["export"],"expires":1}`), 400, problem.CodeUnknownField)
+
+	var key models.NewAPIKey
+	decode(t, asAdmin(t, app, "POST", "/api/v1/admin/keys", `{"name":"ci","scopes":["export","read:trade","export"]}`), 201, &key)
+	if strings.Join(key.Scopes, ",") != "read:trade,export" {
+		t.Errorf("scopes = %v", key.Scopes)
+	}
+}
+
+func TestAdminKeyActsByName(t *testing.T) {
+	st := storetest.New()
+	app := newApp(st)
+	key := createKey(t, app, "curator", models.ScopeAdmin)
+
+	// Without required keys, anonymous requests still read
+	wantStatus(t, requestTo(t, app, "GET", "/api/v1/dimensions/products", ""), 200)
+	wantProblem(t, requestTo(t, app, "GET", "/api/v1/admin/keys", ""), 403, problem.CodeAdminRequired)
+
+	wantStatus(t, withKey(t, app, key.Key, "DELETE", "/api/v1/admin/dimensions/ports/300", ""), 204)
+	if want := "curator (" + key.Prefix + ")"; len(st.Fixtures.Audit) != 1 || st.Fixtures.Audit[0].Actor != want {
+		t.Errorf("audit = %+v, want actor %q", st.Fixtures.Audit, want)
+	}
+}
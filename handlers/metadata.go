@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+)
+
+func GetMetadata(st store.Store) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+
+		metadata, err := QueryMetadata(ctx, st)
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query metadata", "تعذّر الاستعلام عن البيانات الوصفية", err)
+		}
+
+		return c.JSON(metadata)
+	}
+}
+
+// QueryMetadata reads the years, trade types and dimension members present in
+// the data. It scans the fact tables, so callers should cache the result.
+func QueryMetadata(ctx context.Context, st store.Store) (*models.Metadata, error) {
+	metadata := &models.Metadata{
+		TradeTypes:             []string{},
+		ModeIDs:                []int{},
+		GroupByFields:          models.GroupByFields,
+		SortByFields:           models.SortByFields,
+		SortOrders:             models.SortOrders,
+		IncompatibleDimensions: [][]string{{"product", "country"}},
+	}
+	var err error
+
+	if metadata.FactTables, err = st.FactTables(ctx); err != nil {
+		return nil, err
+	}
+	for _, fact := range metadata.FactTables {
+		for _, tt := range fact.TradeTypes {
+			if !slices.Contains(metadata.TradeTypes, tt) {
+				metadata.TradeTypes = append(metadata.TradeTypes, tt)
+			}
+		}
+	}
+	slices.Sort(metadata.TradeTypes)
+
+	if metadata.SummaryYears, err = st.SummaryYears(ctx); err != nil {
+		return nil, err
+	}
+
+	if metadata.PortTypes, err = st.PortTypes(ctx); err != nil {
+		return nil, err
+	}
+	for _, pt := range metadata.PortTypes {
+		if !slices.Contains(metadata.ModeIDs, pt.ModeID) {
+			metadata.ModeIDs = append(metadata.ModeIDs, pt.ModeID)
+		}
+	}
+
+	if metadata.DimensionCounts, err = st.Counts(ctx); err != nil {
+		return nil, err
+	}
+
+	if metadata.LastDataLoad, err = st.LastDataLoad(ctx); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,38 @@
+package handlers_test
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"trade-api/models"
+)
+
+func TestGetMetadata(t *testing.T) {
+	var metadata models.Metadata
+	decode(t, request(t, "GET", "/api/v1/metadata", ""), 200, &metadata)
+
+	if len(metadata.FactTables) != 2 {
+		t.Fatalf("got %d fact tables, want 2", len(metadata.FactTables))
+	}
+	for _, fact := range metadata.FactTables {
+		if !slices.Equal(fact.Years, []int{2021, 2022, 2023}) {
+			t.Errorf("%s years = %v", fact.Name, fact.Years)
+		}
+	}
+	if !slices.Equal(metadata.TradeTypes, []string{"Export", "Import", "Re-Export"}) {
+		t.Errorf("trade types = %v", metadata.TradeTypes)
+	}
+	if !slices.Equal(metadata.SummaryYears, []int{2021, 2022, 2023}) {
+		t.Errorf("summary years = %v", metadata.SummaryYears)
+	}
+	if !slices.Equal(metadata.ModeIDs, []int{1, 2, 3}) || metadata.PortTypes[0].PortTypeEN != "Sea" {
+		t.Errorf("mode ids = %v, port types = %+v", metadata.ModeIDs, metadata.PortTypes)
+	}
+	if want := (models.DimensionCounts{Products: 3, Countries: 3, Ports: 3}); metadata.DimensionCounts != want {
+		t.Errorf("dimension counts = %+v, want %+v", metadata.DimensionCounts, want)
+	}
+	if want := time.Date(2024, 1, 15, 3, 0, 0, 0, time.UTC); metadata.LastDataLoad == nil || !metadata.LastDataLoad.Equal(want) {
+		t.Errorf("last data load = %v, want %v", metadata.LastDataLoad, want)
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+	"trade-api/utils"
+)
+
+func GetQuality(st store.Store, tolerance float64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		report, err := QueryQuality(c.UserContext(), st, tolerance)
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to check data quality", "تعذّر فحص جودة البيانات", err)
+		}
+		return c.JSON(report)
+	}
+}
+
+// QueryQuality compares the fact tables and the yearly summary for every
+// year and trade type, and lists orphaned IDs, missing translations and
+// missing trade types. It scans the fact tables, so callers should cache the
+// result.
+func QueryQuality(ctx context.Context, st store.Store, tolerance float64) (*models.QualityReport, error) {
+	totals, err := st.FactTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := publishedSummary(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &models.QualityReport{
+		Tolerance:         tolerance,
+		Totals:            qualityTotals(totals, summary, tolerance),
+		MissingTradeTypes: missingTradeTypes(totals, summary),
+	}
+	for _, t := range report.Totals {
+		if !t.Consistent {
+			report.Discrepancies++
+		}
+	}
+	if report.OrphanedIDs, err = st.OrphanedIDs(ctx); err != nil {
+		return nil, err
+	}
+	if report.MissingTranslations, err = st.MissingTranslations(ctx); err != nil {
+		return nil, err
+	}
+
+	report.Passed = report.Discrepancies == 0 && len(report.OrphanedIDs) == 0 &&
+		len(report.MissingTranslations) == 0 && len(report.MissingTradeTypes) == 0
+	return report, nil
+}
+
+// qualityTotals lines up the three tables for every year and trade type any
+// of them holds. A summary year counts all of its non-zero trade types.
+func qualityTotals(totals []models.FactTotal, summary map[int]models.TradeSummary, tolerance float64) []models.QualityTotal {
+	type key struct {
+		year      int
+		tradeType string
+	}
+	byKey := map[key]*models.QualityTotal{}
+	row := func(year int, tradeType string) *models.QualityTotal {
+		k := key{year, tradeType}
+		t, ok := byKey[k]
+		if !ok {
+			t = &models.QualityTotal{Year: year, TradeType: tradeType}
+			byKey[k] = t
+		}
+		return t
+	}
+
+	for _, t := range totals {
+		switch t.Table {
+		case utils.ProductFactTable:
+			row(t.Year, t.TradeType).ProductTotal += t.Value
+		case utils.CountryFactTable:
+			row(t.Year, t.TradeType).CountryTotal += t.Value
+		}
+	}
+	for _, s := range summary {
+		for tradeType, value := range summaryValues(s) {
+			if value != 0 {
+				row(s.Year, tradeType)
+			}
+		}
+	}
+
+	results := []models.QualityTotal{}
+	for _, t := range byKey {
+		t.CountryDifference = t.CountryTotal - t.ProductTotal
+		consistent := relativeDifference(t.ProductTotal, t.CountryTotal) <= tolerance
+		if s, ok := summary[t.Year]; ok {
+			value := summaryValues(s)[t.TradeType]
+			t.SummaryTotal = &value
+			t.SummaryDifference = value - t.ProductTotal
+			consistent = consistent && relativeDifference(t.ProductTotal, value) <= tolerance
+		} else {
+			consistent = false
+		}
+		t.Consistent = consistent
+		results = append(results, *t)
+	}
+	slices.SortFunc(results, func(a, b models.QualityTotal) int {
+		return cmp.Or(cmp.Compare(a.Year, b.Year), cmp.Compare(a.TradeType, b.TradeType))
+	})
+	return results
+}
+
+// summaryValues returns a summary row's value for each trade type. Its
+// columns are in the order of models.TradeTypes.
+func summaryValues(s models.TradeSummary) map[string]int64 {
+	columns := []int64{s.ImportValue, s.ExportValue, s.ReExportValue}
+	values := make(map[string]int64, len(models.TradeTypes))
+	for i, tradeType := range models.TradeTypes {
+		values[tradeType] = columns[i]
+	}
+	return values
+}
+
+// missingTradeTypes finds the trade types each fact table lacks for every
+// year that either fact table or the summary holds, so a year missing from a
+// table altogether is reported with all of them.
+func missingTradeTypes(totals []models.FactTotal, summary map[int]models.TradeSummary) []models.MissingTradeTypes {
+	type key struct {
+		table string
+		year  int
+	}
+	present := map[key][]string{}
+	years := []int{}
+	for _, t := range totals {
+		k := key{t.Table, t.Year}
+		present[k] = append(present[k], t.TradeType)
+		if !slices.Contains(years, t.Year) {
+			years = append(years, t.Year)
+		}
+	}
+	for year := range summary {
+		if !slices.Contains(years, year) {
+			years = append(years, year)
+		}
+	}
+
+	missing := []models.MissingTradeTypes{}
+	for _, table := range []string{utils.ProductFactTable, utils.CountryFactTable} {
+		for _, year := range years {
+			m := models.MissingTradeTypes{Table: table, Year: year, TradeTypes: []string{}}
+			for _, tt := range models.TradeTypes {
+				if !slices.Contains(present[key{table, year}], tt) {
+					m.TradeTypes = append(m.TradeTypes, tt)
+				}
+			}
+			if len(m.TradeTypes) > 0 {
+				missing = append(missing, m)
+			}
+		}
+	}
+	slices.SortFunc(missing, func(a, b models.MissingTradeTypes) int {
+		return cmp.Or(cmp.Compare(a.Table, b.Table), cmp.Compare(a.Year, b.Year))
+	})
+	return missing
+}
@@ -0,0 +1,86 @@
+package handlers_test
+
+import (
+	"slices"
+	"testing"
+
+	"trade-api/models"
+	"trade-api/store/storetest"
+	"trade-api/utils"
+)
+
+func TestGetQuality(t *testing.T) {
+	var report models.QualityReport
+	decode(t, request(t, "GET", "/api/v1/quality", ""), 200, &report)
+	if !report.Passed || report.Discrepancies != 0 || len(report.Totals) != 9 {
+		t.Errorf("report = %+v", report)
+	}
+	if len(report.OrphanedIDs) != 0 || len(report.MissingTranslations) != 0 || len(report.MissingTradeTypes) != 0 {
+		t.Errorf("report = %+v", report)
+	}
+}
+
+func TestGetQualityFindsProblems(t *testing.T) {
+	st := storetest.New()
+	st.Fixtures.Products[0].ProductDescAR = " "
+	st.Fixtures.Ports[0].PortTypeAR = ""
+	st.Fixtures.ProductFacts = append(st.Fixtures.ProductFacts, storetest.Fact{Year: 2023, ProductID: 999, PortID: 999, TradeType: "Export", Value: 0})
+	var facts []storetest.Fact
+	for _, f := range st.Fixtures.CountryFacts {
+		if f.Year != 2021 || f.TradeType != "Re-Export" {
+			facts = append(facts, f)
+		}
+	}
+	st.Fixtures.CountryFacts = facts
+	st.Fixtures.YearlySummary = st.Fixtures.YearlySummary[1:]
+
+	var report models.QualityReport
+	decode(t, requestTo(t, newApp(st), "GET", "/api/v1/quality", ""), 200, &report)
+	if report.Passed {
+		t.Error("report passed")
+	}
+
+	// 2021 is missing from the summary, and its re-exports from the country facts
+	if report.Discrepancies != 3 {
+		t.Errorf("discrepancies = %d, want 3", report.Discrepancies)
+	}
+	for _, total := range report.Totals {
+		if total.Year == 2021 && total.TradeType == "Re-Export" &&
+			(total.ProductTotal != 50 || total.CountryTotal != 0 || total.CountryDifference != -50 || total.SummaryTotal != nil) {
+			t.Errorf("2021 re-exports = %+v", total)
+		}
+	}
+
+	if len(report.OrphanedIDs) != 2 || report.OrphanedIDs[0].Column != "port_id" || report.OrphanedIDs[1].Column != "product_id" ||
+		report.OrphanedIDs[0].ID != 999 || report.OrphanedIDs[0].Rows != 1 {
+		t.Errorf("orphaned IDs = %+v", report.OrphanedIDs)
+	}
+	if len(report.MissingTranslations) != 2 || report.MissingTranslations[0].Table != "dim_port" ||
+		report.MissingTranslations[0].Column != "port_type_ar" || report.MissingTranslations[1].Column != "product_desc_ar" {
+		t.Errorf("missing translations = %+v", report.MissingTranslations)
+	}
+	if len(report.MissingTradeTypes) != 1 || report.MissingTradeTypes[0].Year != 2021 ||
+		report.MissingTradeTypes[0].TradeTypes[0] != "Re-Export" {
+		t.Errorf("missing trade types = %+v", report.MissingTradeTypes)
+	}
+}
+
+func TestGetQualityFindsMissingYears(t *testing.T) {
+	st := storetest.New()
+	var facts []storetest.Fact
+	for _, f := range st.Fixtures.CountryFacts {
+		if f.Year != 2022 {
+			facts = append(facts, f)
+		}
+	}
+	st.Fixtures.CountryFacts = facts
+
+	var report models.QualityReport
+	decode(t, requestTo(t, newApp(st), "GET", "/api/v1/quality", ""), 200, &report)
+	if len(report.MissingTradeTypes) != 1 {
+		t.Fatalf("missing trade types = %+v", report.MissingTradeTypes)
+	}
+	if m := report.MissingTradeTypes[0]; m.Table != utils.CountryFactTable || m.Year != 2022 || !slices.Equal(m.TradeTypes, models.TradeTypes) {
+		t.Errorf("missing trade types = %+v", m)
+	}
+}
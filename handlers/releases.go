@@ -0,0 +1,120 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+)
+
+func GetReleases(trade store.TradeStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		releases, err := trade.Releases(c.UserContext())
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query releases", "تعذّر الاستعلام عن الإصدارات", err)
+		}
+		return c.JSON(releases)
+	}
+}
+
+// DiffReleases compares an aggregate request between the releases in the
+// from and to query parameters. to defaults to the latest release and from
+// to the one before to; from=0 compares with an empty warehouse.
+func DiffReleases(trade store.TradeStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := parseAggregateRequest(c, trade)
+		if err != nil {
+			return err
+		}
+		if req.AsOfRelease != 0 {
+			return problem.BadRequest(problem.CodeUnknownField, "/as_of_release",
+				"as_of_release does not apply to a diff; use the from and to parameters",
+				"لا ينطبق as_of_release على المقارنة؛ استخدم المعاملين from و to")
+		}
+
+		ctx := c.UserContext()
+
+		releases, err := trade.Releases(ctx)
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query releases", "تعذّر الاستعلام عن الإصدارات", err)
+		}
+		latest := 0
+		if len(releases) > 0 {
+			latest = releases[0].ReleaseID
+		}
+		to := c.QueryInt("to", latest)
+		from := c.QueryInt("from", to-1)
+
+		var errs []*problem.Error
+		if !hasRelease(releases, to) {
+			errs = append(errs, unknownRelease("to", to, releases))
+		}
+		if from != 0 && !hasRelease(releases, from) {
+			errs = append(errs, unknownRelease("from", from, releases))
+		}
+		if err := problem.Validation(errs); err != nil {
+			return err
+		}
+
+		changes, totalCount, err := trade.AggregateDiff(ctx, req, from, to)
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to compare releases", "تعذّرت المقارنة بين الإصدارين", err)
+		}
+
+		return c.JSON(models.ReleaseDiff{
+			FromRelease: from,
+			ToRelease:   to,
+			Data:        changes,
+			Pagination:  paginationMeta(req, totalCount),
+		})
+	}
+}
+
+// parseRelease reads the as_of_release query parameter, which defaults to 0
+// for the latest release.
+func parseRelease(c *fiber.Ctx, trade store.TradeStore) (int, error) {
+	release := c.QueryInt("as_of_release", 0)
+	if err := ValidateRelease(c.UserContext(), trade, release); err != nil {
+		return 0, err
+	}
+	return release, nil
+}
+
+// ValidateRelease checks that release is 0, for the latest, or an existing
+// release.
+func ValidateRelease(ctx context.Context, trade store.TradeStore, release int) error {
+	if release == 0 {
+		return nil
+	}
+	releases, err := trade.Releases(ctx)
+	if err != nil {
+		return problem.Internal(problem.CodeQueryFailed, "Failed to query releases", "تعذّر الاستعلام عن الإصدارات", err)
+	}
+	if !hasRelease(releases, release) {
+		return unknownRelease("as_of_release", release, releases)
+	}
+	return nil
+}
+
+func hasRelease(releases []models.Release, release int) bool {
+	return slices.ContainsFunc(releases, func(r models.Release) bool { return r.ReleaseID == release })
+}
+
+// unknownRelease reports a release that does not exist. releases are newest
+// first.
+func unknownRelease(field string, release int, releases []models.Release) *problem.Error {
+	if len(releases) == 0 {
+		return problem.BadRequest(problem.CodeUnknownRelease, field,
+			fmt.Sprintf("release %d does not exist; there are no releases yet", release),
+			fmt.Sprintf("الإصدار %d غير موجود؛ لا توجد إصدارات بعد", release))
+	}
+	latest := releases[0].ReleaseID
+	return problem.BadRequest(problem.CodeUnknownRelease, field,
+		fmt.Sprintf("release %d does not exist; releases are numbered 1 to %d", release, latest),
+		fmt.Sprintf("الإصدار %d غير موجود؛ الإصدارات مرقّمة من 1 إلى %d", release, latest))
+}
@@ -0,0 +1,156 @@
+package handlers_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store/storetest"
+)
+
+// revised returns a store whose release 2 revises the 2023 Jeddah car
+// imports from 700 to 900.
+func revised(t *testing.T) *storetest.Memory {
+	t.Helper()
+
+	st := storetest.New()
+	facts := st.Fixtures.ProductFacts
+	for i, f := range facts {
+		if f.Year == 2023 && f.ProductID == 1 && f.PortID == 100 && f.TradeType == "Import" {
+			facts[i].ValidTo = 2
+			f.Value, f.ValidFrom = 900, 2
+			st.Fixtures.ProductFacts = append(facts, f)
+			st.Fixtures.Releases = append(st.Fixtures.Releases, models.Release{ReleaseID: 2, Source: "revision", CreatedAt: time.Now()})
+			return st
+		}
+	}
+	t.Fatal("the fixtures have no 2023 Jeddah car imports")
+	return nil
+}
+
+func TestGetReleases(t *testing.T) {
+	var releases []models.Release
+	decode(t, requestTo(t, newApp(revised(t)), "GET", "/api/v1/releases", ""), 200, &releases)
+	if len(releases) != 2 || releases[0].ReleaseID != 2 || releases[1].ReleaseID != 1 || releases[1].Source != "fixtures" {
+		t.Errorf("releases = %+v", releases)
+	}
+}
+
+func TestAggregateAsOfRelease(t *testing.T) {
+	app := newApp(revised(t))
+	total := func(body string) int64 {
+		t.Helper()
+		var resp models.PaginatedResponse
+		decode(t, requestTo(t, app, "POST", "/api/v1/trade/aggregate", body), 200, &resp)
+		results := aggregateResults(t, resp)
+		if len(results) != 1 {
+			t.Fatalf("results = %+v", results)
+		}
+		return results[0].TotalValue
+	}
+
+	body := `{"date_range":{"start_year":2023,"end_year":2023},"group_by":["year"],"trade_types":["Import"]%s}`
+	if got := total(fmt.Sprintf(body, "")); got != 1100 {
+		t.Errorf("latest = %d, want 1100", got)
+	}
+	if got := total(fmt.Sprintf(body, `,"as_of_release":2`)); got != 1100 {
+		t.Errorf("release 2 = %d, want 1100", got)
+	}
+	if got := total(fmt.Sprintf(body, `,"as_of_release":1`)); got != 900 {
+		t.Errorf("release 1 = %d, want 900", got)
+	}
+
+	details := wantProblem(t, requestTo(t, app, "POST", "/api/v1/trade/aggregate", fmt.Sprintf(body, `,"as_of_release":3`)), 400, problem.CodeUnknownRelease)
+	if len(details.Errors) != 1 || details.Errors[0].Field != "/as_of_release" {
+		t.Errorf("errors = %+v", details.Errors)
+	}
+	wantProblem(t, requestTo(t, app, "POST", "/api/v1/trade/aggregate", fmt.Sprintf(body, `,"as_of_release":-1`)), 400, problem.CodeUnknownRelease)
+}
+
+// TestAggregateYearBounds checks that the years a request may ask for are
+// those of the fact table and release it reads, not of the yearly summary.
+func TestAggregateYearBounds(t *testing.T) {
+	st := storetest.New()
+	st.Fixtures.CountryFacts = append(st.Fixtures.CountryFacts,
+		storetest.Fact{Year: 2024, CountryID: 10, PortID: 100, TradeType: "Import", Value: 5, ValidFrom: 2})
+	st.Fixtures.Releases = append(st.Fixtures.Releases, models.Release{ReleaseID: 2, Source: "2024", CreatedAt: time.Now()})
+	app := newApp(st)
+
+	body := `{"date_range":{"start_year":2023,"end_year":2024},"group_by":["%s"]%s}`
+	wantStatus(t, requestTo(t, app, "POST", "/api/v1/trade/aggregate", fmt.Sprintf(body, "country", "")), 200)
+	wantProblem(t, requestTo(t, app, "POST", "/api/v1/trade/aggregate", fmt.Sprintf(body, "product", "")), 400, problem.CodeYearOutOfRange)
+	wantProblem(t, requestTo(t, app, "POST", "/api/v1/trade/aggregate", fmt.Sprintf(body, "country", `,"as_of_release":1`)), 400, problem.CodeYearOutOfRange)
+}
+
+func TestSummaryAsOfRelease(t *testing.T) {
+	st := storetest.New()
+	st.Fixtures.YearlySummary[1].ImportValue = 700
+	app := newApp(st)
+
+	var rebuild models.SummaryRebuild
+	decode(t, requestTo(t, app, "POST", "/api/v1/admin/summary/rebuild", "", "X-Admin-Token", adminToken), 200, &rebuild)
+	if !rebuild.Published || rebuild.Release != 2 {
+		t.Fatalf("rebuild = %+v", rebuild)
+	}
+
+	for target, want := range map[string]int64{
+		"/api/v1/trade/summary?start_year=2022&end_year=2022":                 750,
+		"/api/v1/trade/summary?start_year=2022&end_year=2022&as_of_release=2": 750,
+		"/api/v1/trade/summary?start_year=2022&end_year=2022&as_of_release=1": 700,
+	} {
+		var summaries []models.TradeSummary
+		decode(t, requestTo(t, app, "GET", target, ""), 200, &summaries)
+		if len(summaries) != 1 || summaries[0].ImportValue != want {
+			t.Errorf("%s: summary = %+v, want imports %d", target, summaries, want)
+		}
+	}
+
+	var balance models.TradeBalance
+	decode(t, requestTo(t, app, "GET", "/api/v1/trade/balance?start_year=2022&end_year=2022&as_of_release=1", ""), 200, &balance)
+	if balance.TotalImport != 700 {
+		t.Errorf("balance as of release 1 = %+v", balance)
+	}
+
+	wantProblem(t, requestTo(t, app, "GET", "/api/v1/trade/summary?start_year=2022&end_year=2022&as_of_release=3", ""), 400, problem.CodeUnknownRelease)
+	wantProblem(t, requestTo(t, app, "GET", "/api/v1/sdmx/data/summary?start_year=2022&end_year=2022&as_of_release=3", ""), 400, problem.CodeUnknownRelease)
+}
+
+func TestDiffReleases(t *testing.T) {
+	app := newApp(revised(t))
+	body := `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["year","product"]}`
+
+	var diff models.ReleaseDiff
+	decode(t, requestTo(t, app, "POST", "/api/v1/releases/diff", body), 200, &diff)
+	if diff.FromRelease != 1 || diff.ToRelease != 2 || diff.Pagination.TotalCount != 1 || len(diff.Data) != 1 {
+		t.Fatalf("diff = %+v", diff)
+	}
+	if c := diff.Data[0]; *c.Year != 2023 || *c.ProductID != 1 || c.TotalValue != 1100 || c.PreviousValue != 900 || c.Change != 200 {
+		t.Errorf("change = %+v", c)
+	}
+
+	// Nothing changed within a release
+	decode(t, requestTo(t, app, "POST", "/api/v1/releases/diff?from=1&to=1", body), 200, &diff)
+	if len(diff.Data) != 0 {
+		t.Errorf("diff = %+v", diff)
+	}
+
+	// Every group is new since the empty warehouse
+	decode(t, requestTo(t, app, "POST", "/api/v1/releases/diff?from=0&to=1", body), 200, &diff)
+	if diff.Pagination.TotalCount != 9 {
+		t.Errorf("diff = %+v", diff)
+	}
+	for _, c := range diff.Data {
+		if c.PreviousValue != 0 || c.Change != c.TotalValue {
+			t.Errorf("change = %+v", c)
+		}
+	}
+
+	details := wantProblem(t, requestTo(t, app, "POST", "/api/v1/releases/diff?from=5&to=7", body), 400, problem.CodeValidationFailed)
+	if len(details.Errors) != 2 || details.Errors[0].Code != problem.CodeUnknownRelease || details.Errors[1].Field != "from" {
+		t.Errorf("errors = %+v", details.Errors)
+	}
+	wantProblem(t, requestTo(t, app, "POST", "/api/v1/releases/diff",
+		`{"date_range":{"start_year":2021,"end_year":2023},"group_by":["year"],"as_of_release":1}`), 400, problem.CodeUnknownField)
+}
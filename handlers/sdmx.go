@@ -0,0 +1,118 @@
+package handlers
+
+import (
+	"cmp"
+	"slices"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/sdmx"
+	"trade-api/store"
+)
+
+func GetSDMXStructure(dims store.DimensionStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := c.UserContext()
+
+		products, err := dims.Products(ctx, "", 0)
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query products", "تعذّر الاستعلام عن المنتجات", err)
+		}
+		countries, err := dims.Countries(ctx, "", 0)
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query countries", "تعذّر الاستعلام عن الدول", err)
+		}
+		ports, err := dims.Ports(ctx, "", "", 0)
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query ports", "تعذّر الاستعلام عن المنافذ", err)
+		}
+
+		// Codelists are ordered by ID, while searches order by English name
+		slices.SortFunc(products, func(a, b models.Product) int { return cmp.Compare(a.ProductID, b.ProductID) })
+		slices.SortFunc(countries, func(a, b models.Country) int { return cmp.Compare(a.CountryID, b.CountryID) })
+		slices.SortFunc(ports, func(a, b models.Port) int { return cmp.Compare(a.PortID, b.PortID) })
+
+		productCodes := make([]sdmx.Code, 0, len(products))
+		for _, p := range products {
+			productCodes = append(productCodes, sdmx.MemberCode(p.ProductID, p.ProductDescEN, p.ProductDescAR))
+		}
+		countryCodes := make([]sdmx.Code, 0, len(countries))
+		for _, country := range countries {
+			countryCodes = append(countryCodes, sdmx.MemberCode(country.CountryID, country.CountryNameEN, country.CountryNameAR))
+		}
+		portCodes := make([]sdmx.Code, 0, len(ports))
+		for _, port := range ports {
+			portCodes = append(portCodes, sdmx.MemberCode(port.PortID, port.PortNameEN, port.PortNameAR))
+		}
+
+		return c.JSON(sdmx.NewStructureMessage(productCodes, countryCodes, portCodes, time.Now()), sdmx.StructureMediaType)
+	}
+}
+
+func GetSDMXAggregate(trade store.TradeStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		req, err := parseAggregateRequest(c, trade)
+		if err != nil {
+			return err
+		}
+
+		ctx := c.UserContext()
+
+		results, _, err := RunAggregate(ctx, trade, req)
+		if err != nil {
+			return err
+		}
+
+		name := sdmx.Names{"en": "Trade aggregate", "ar": "تجميع بيانات التجارة"}
+		return c.JSON(sdmx.NewDataMessage(name, sdmx.FromAggregate(req, results), time.Now()), sdmx.DataMediaType)
+	}
+}
+
+func GetSDMXSummary(trade store.TradeStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		startYear, endYear, err := parseYearRange(c)
+		if err != nil {
+			return err
+		}
+		release, err := parseRelease(c, trade)
+		if err != nil {
+			return err
+		}
+
+		ctx := c.UserContext()
+
+		summaries, err := trade.YearlySummary(ctx, startYear, endYear, release)
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query trade summary", "تعذّر الاستعلام عن ملخص التجارة", err)
+		}
+
+		name := sdmx.Names{"en": "Yearly trade summary", "ar": "الملخص السنوي للتجارة"}
+		return c.JSON(sdmx.NewDataMessage(name, sdmx.FromSummary(summaries), time.Now()), sdmx.DataMediaType)
+	}
+}
+
+func GetSDMXBalance(trade store.TradeStore) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		startYear, endYear, err := parseYearRange(c)
+		if err != nil {
+			return err
+		}
+		release, err := parseRelease(c, trade)
+		if err != nil {
+			return err
+		}
+
+		ctx := c.UserContext()
+
+		balance, err := trade.Balance(ctx, startYear, endYear, release)
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query trade balance", "تعذّر الاستعلام عن الميزان التجاري", err)
+		}
+
+		name := sdmx.Names{"en": "Trade balance", "ar": "الميزان التجاري"}
+		return c.JSON(sdmx.NewDataMessage(name, sdmx.FromBalance(balance), time.Now()), sdmx.DataMediaType)
+	}
+}
@@ -0,0 +1,90 @@
+package handlers_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"trade-api/problem"
+	"trade-api/sdmx"
+)
+
+func TestGetSDMXStructure(t *testing.T) {
+	resp := request(t, "GET", "/api/v1/sdmx/datastructure", "")
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/vnd.sdmx.structure+json") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var message sdmx.StructureMessage
+	decode(t, resp, 200, &message)
+
+	want := map[string][]string{
+		"CL_PRODUCT": {"1", "2", "3"},
+		"CL_COUNTRY": {"10", "20", "30"},
+		"CL_PORT":    {"100", "200", "300"},
+	}
+	for _, codelist := range message.Data.Codelists {
+		ids, ok := want[codelist.ID]
+		if !ok {
+			continue
+		}
+		delete(want, codelist.ID)
+		// Members are ordered by ID and followed by the total code
+		for i, id := range ids {
+			if codelist.Codes[i].ID != id {
+				t.Errorf("%s code %d = %s, want %s", codelist.ID, i, codelist.Codes[i].ID, id)
+			}
+		}
+		if len(codelist.Codes) != len(ids)+1 {
+			t.Errorf("%s has %d codes, want %d", codelist.ID, len(codelist.Codes), len(ids)+1)
+		}
+	}
+	for id := range want {
+		t.Errorf("codelist %s missing", id)
+	}
+
+	// Every component names a concept the message defines
+	concepts := map[string]bool{}
+	for _, scheme := range message.Data.ConceptSchemes {
+		for _, c := range scheme.Concepts {
+			concepts[fmt.Sprintf("urn:sdmx:org.sdmx.infomodel.conceptscheme.Concept=%s:%s(%s).%s", scheme.AgencyID, scheme.ID, scheme.Version, c.ID)] = true
+		}
+	}
+	dsd := message.Data.DataStructures[0].DataStructureComponents
+	components := append(append(dsd.DimensionList.Dimensions, dsd.DimensionList.TimeDimensions...), dsd.MeasureList.PrimaryMeasure)
+	if len(components) != len(sdmx.Dimensions)+1 {
+		t.Errorf("got %d components", len(components))
+	}
+	for _, c := range components {
+		if !concepts[c.ConceptIdentity] {
+			t.Errorf("%s refers to %s, which the message does not define", c.ID, c.ConceptIdentity)
+		}
+	}
+}
+
+func TestGetSDMXData(t *testing.T) {
+	tests := []struct {
+		method, target, body string
+		observations         int
+	}{
+		{"GET", "/api/v1/sdmx/data/summary?start_year=2021&end_year=2023", "", 12},
+		{"GET", "/api/v1/sdmx/data/balance?start_year=2021&end_year=2023", "", 4},
+		{"POST", "/api/v1/sdmx/data/aggregate", `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["port","year"]}`, 9},
+	}
+	for _, tt := range tests {
+		resp := request(t, tt.method, tt.target, tt.body)
+		if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "application/vnd.sdmx.data+json") {
+			t.Errorf("%s: Content-Type = %q", tt.target, ct)
+		}
+		var message sdmx.DataMessage
+		decode(t, resp, 200, &message)
+
+		if len(message.DataSets) != 1 || len(message.DataSets[0].Observations) != tt.observations {
+			t.Errorf("%s: got %d data sets, want %d observations", tt.target, len(message.DataSets), tt.observations)
+		}
+	}
+}
+
+func TestSDMXValidation(t *testing.T) {
+	wantProblem(t, request(t, "GET", "/api/v1/sdmx/data/balance?start_year=2021", ""), 400, problem.CodeMissingDateRange)
+	wantProblem(t, request(t, "POST", "/api/v1/sdmx/data/aggregate", `{"group_by":["year"]}`), 400, problem.CodeMissingDateRange)
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+	"trade-api/utils"
+)
+
+func PostRebuildSummary(st store.Store, tolerance float64) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		rebuild, err := RebuildSummary(c.UserContext(), st, tolerance, c.QueryBool("dry_run"))
+		if err != nil {
+			return problem.Internal(problem.CodeQueryFailed, "Failed to rebuild the yearly summary", "تعذّرت إعادة بناء الملخص السنوي", err)
+		}
+		if !rebuild.Published && !rebuild.DryRun {
+			return reconciliationProblem(rebuild)
+		}
+		return c.JSON(rebuild)
+	}
+}
+
+// reconciliationProblem lists each year and trade type outside the tolerance.
+func reconciliationProblem(rebuild *models.SummaryRebuild) error {
+	p := problem.New(fiber.StatusConflict, problem.CodeReconciliationFailed,
+		fmt.Sprintf("The fact tables disagree on %d totals by more than %g; the yearly summary was not published", rebuild.Discrepancies, rebuild.Tolerance),
+		fmt.Sprintf("يختلف جدولا الحقائق في %d من المجاميع بأكثر من %g؛ لم يُنشر الملخص السنوي", rebuild.Discrepancies, rebuild.Tolerance))
+	for _, r := range rebuild.Reconciliation {
+		if r.WithinTolerance {
+			continue
+		}
+		p.Errors = append(p.Errors, &problem.Error{
+			Code:      problem.CodeReconciliationFailed,
+			Field:     fmt.Sprintf("%d/%s", r.Year, r.TradeType),
+			Message:   fmt.Sprintf("product total %d, country total %d (%.4f%%)", r.ProductTotal, r.CountryTotal, r.RelativeDifference*100),
+			MessageAR: fmt.Sprintf("مجموع المنتجات %d، مجموع الدول %d (%.4f%%)", r.ProductTotal, r.CountryTotal, r.RelativeDifference*100),
+		})
+	}
+	return p
+}
+
+// RebuildSummary recomputes the yearly summary from the product fact table
+// and reconciles it with the country fact table. It publishes the summary as
+// a new release unless dryRun is set or any year and trade type differs
+// between the tables by more than tolerance.
+func RebuildSummary(ctx context.Context, st store.Store, tolerance float64, dryRun bool) (*models.SummaryRebuild, error) {
+	totals, err := st.FactTotals(ctx)
+	if err != nil {
+		return nil, err
+	}
+	previous, err := publishedSummary(ctx, st)
+	if err != nil {
+		return nil, err
+	}
+
+	rebuild := &models.SummaryRebuild{
+		Tolerance:      tolerance,
+		DryRun:         dryRun,
+		Summary:        summarize(totals),
+		Changes:        []models.SummaryChange{},
+		Reconciliation: reconcile(totals, tolerance),
+	}
+	for _, r := range rebuild.Reconciliation {
+		if !r.WithinTolerance {
+			rebuild.Discrepancies++
+		}
+	}
+
+	rebuilt := map[int]models.TradeSummary{}
+	for _, s := range rebuild.Summary {
+		rebuilt[s.Year] = s
+	}
+	years := []int{}
+	for year := range rebuilt {
+		years = append(years, year)
+	}
+	for year := range previous {
+		if _, ok := rebuilt[year]; !ok {
+			years = append(years, year)
+		}
+	}
+	slices.Sort(years)
+	for _, year := range years {
+		old, hadOld := previous[year]
+		s, hasNew := rebuilt[year]
+		if hadOld && hasNew && old == s {
+			continue
+		}
+		change := models.SummaryChange{Year: year}
+		if hadOld {
+			change.Previous = &old
+		}
+		if hasNew {
+			change.Rebuilt = &s
+		}
+		rebuild.Changes = append(rebuild.Changes, change)
+	}
+
+	if dryRun || rebuild.Discrepancies > 0 {
+		return rebuild, nil
+	}
+	if rebuild.Release, err = st.ReplaceYearlySummary(ctx, rebuild.Summary); err != nil {
+		return nil, err
+	}
+	rebuild.Published = true
+	return rebuild, nil
+}
+
+// publishedSummary returns the current yearly summary by year.
+func publishedSummary(ctx context.Context, st store.TradeStore) (map[int]models.TradeSummary, error) {
+	years, err := st.SummaryYears(ctx)
+	if err != nil || len(years) == 0 {
+		return map[int]models.TradeSummary{}, err
+	}
+	summaries, err := st.YearlySummary(ctx, years[0], years[len(years)-1], 0)
+	if err != nil {
+		return nil, err
+	}
+	byYear := map[int]models.TradeSummary{}
+	for _, s := range summaries {
+		byYear[s.Year] = s
+	}
+	return byYear, nil
+}
+
+// summarize builds a summary row per year of the product fact table.
+func summarize(totals []models.FactTotal) []models.TradeSummary {
+	byYear := map[int]*models.TradeSummary{}
+	for _, t := range totals {
+		if t.Table != utils.ProductFactTable {
+			continue
+		}
+		s, ok := byYear[t.Year]
+		if !ok {
+			s = &models.TradeSummary{Year: t.Year}
+			byYear[t.Year] = s
+		}
+		switch t.TradeType {
+		case "Import":
+			s.ImportValue += t.Value
+		case "Export":
+			s.ExportValue += t.Value
+		case "Re-Export":
+			s.ReExportValue += t.Value
+		}
+	}
+
+	summaries := []models.TradeSummary{}
+	for _, s := range byYear {
+		s.TradeBalanceValue = s.ExportValue + s.ReExportValue - s.ImportValue
+		s.TotalTradeValue = s.ImportValue + s.ExportValue + s.ReExportValue
+		summaries = append(summaries, *s)
+	}
+	slices.SortFunc(summaries, func(a, b models.TradeSummary) int { return cmp.Compare(a.Year, b.Year) })
+	return summaries
+}
+
+// reconcile compares the fact tables for every year and trade type either
+// one holds.
+func reconcile(totals []models.FactTotal, tolerance float64) []models.Reconciliation {
+	type key struct {
+		year      int
+		tradeType string
+	}
+	byKey := map[key]*models.Reconciliation{}
+	for _, t := range totals {
+		k := key{t.Year, t.TradeType}
+		r, ok := byKey[k]
+		if !ok {
+			r = &models.Reconciliation{Year: t.Year, TradeType: t.TradeType}
+			byKey[k] = r
+		}
+		switch t.Table {
+		case utils.ProductFactTable:
+			r.ProductTotal += t.Value
+		case utils.CountryFactTable:
+			r.CountryTotal += t.Value
+		}
+	}
+
+	results := []models.Reconciliation{}
+	for _, r := range byKey {
+		r.Difference = r.ProductTotal - r.CountryTotal
+		r.RelativeDifference = relativeDifference(r.ProductTotal, r.CountryTotal)
+		r.WithinTolerance = r.RelativeDifference <= tolerance
+		results = append(results, *r)
+	}
+	slices.SortFunc(results, func(a, b models.Reconciliation) int {
+		return cmp.Or(cmp.Compare(a.Year, b.Year), cmp.Compare(a.TradeType, b.TradeType))
+	})
+	return results
+}
+
+// relativeDifference is the difference between a and b over the larger of
+// the two, or 0 when both are 0.
+func relativeDifference(a, b int64) float64 {
+	larger := max(abs(a), abs(b))
+	if larger == 0 {
+		return 0
+	}
+	return math.Abs(float64(a-b)) / float64(larger)
+}
+
+func abs(n int64) int64 {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
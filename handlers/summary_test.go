@@ -0,0 +1,80 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/server"
+	"trade-api/store/storetest"
+)
+
+func TestRebuildSummary(t *testing.T) {
+	st := storetest.New()
+	// Drift 2022 and add a year with no facts
+	st.Fixtures.YearlySummary[1].ImportValue = 700
+	st.Fixtures.YearlySummary = append(st.Fixtures.YearlySummary, models.TradeSummary{Year: 2020, ImportValue: 1})
+	app := newApp(st)
+
+	wantProblem(t, requestTo(t, app, "POST", "/api/v1/admin/summary/rebuild", ""), 403, problem.CodeAdminRequired)
+
+	var rebuild models.SummaryRebuild
+	decode(t, requestTo(t, app, "POST", "/api/v1/admin/summary/rebuild?dry_run=true", "", "X-Admin-Token", adminToken), 200, &rebuild)
+	if rebuild.Published || rebuild.Discrepancies != 0 || len(rebuild.Reconciliation) != 9 {
+		t.Errorf("dry run = %+v", rebuild)
+	}
+	if len(rebuild.Changes) != 2 || rebuild.Changes[0].Year != 2020 || rebuild.Changes[0].Rebuilt != nil ||
+		rebuild.Changes[1].Year != 2022 || rebuild.Changes[1].Previous.ImportValue != 700 || rebuild.Changes[1].Rebuilt.ImportValue != 750 {
+		t.Errorf("changes = %+v", rebuild.Changes)
+	}
+	if len(st.Fixtures.YearlySummary) != 4 {
+		t.Fatal("a dry run changed the summary")
+	}
+
+	decode(t, requestTo(t, app, "POST", "/api/v1/admin/summary/rebuild", "", "X-Admin-Token", adminToken), 200, &rebuild)
+	if !rebuild.Published {
+		t.Fatalf("rebuild = %+v", rebuild)
+	}
+	var summaries []models.TradeSummary
+	decode(t, requestTo(t, app, "GET", "/api/v1/trade/summary?start_year=2020&end_year=2023", ""), 200, &summaries)
+	if len(summaries) != 3 || summaries[1].ImportValue != 750 || summaries[1].TradeBalanceValue != 780 {
+		t.Errorf("summary = %+v", summaries)
+	}
+}
+
+func TestRebuildSummaryRefusesDiscrepancies(t *testing.T) {
+	st := storetest.New()
+	st.Fixtures.YearlySummary[0].ExportValue = 1
+	for i, f := range st.Fixtures.CountryFacts {
+		if f.Year == 2023 && f.TradeType == "Import" {
+			st.Fixtures.CountryFacts[i].Value += 10
+			break
+		}
+	}
+
+	details := wantProblem(t, requestTo(t, newApp(st), "POST", "/api/v1/admin/summary/rebuild", "", "X-Admin-Token", adminToken),
+		409, problem.CodeReconciliationFailed)
+	if len(details.Errors) != 1 || details.Errors[0].Field != "2023/Import" {
+		t.Errorf("errors = %+v", details.Errors)
+	}
+	if st.Fixtures.YearlySummary[0].ExportValue != 1 {
+		t.Error("a refused rebuild changed the summary")
+	}
+
+	// A looser tolerance accepts the 10 in 910
+	cfg := testConfig()
+	cfg.Summary.Tolerance = 0.02
+	var rebuild models.SummaryRebuild
+	decode(t, requestTo(t, server.New(st, cfg), "POST", "/api/v1/admin/summary/rebuild", "", "X-Admin-Token", adminToken), 200, &rebuild)
+	if !rebuild.Published || rebuild.Discrepancies != 0 {
+		t.Errorf("rebuild = %+v", rebuild)
+	}
+	for _, r := range rebuild.Reconciliation {
+		if r.Year == 2023 && r.TradeType == "Import" && (r.Difference != -10 || r.CountryTotal != 910) {
+			t.Errorf("reconciliation = %+v", r)
+		}
+	}
+	if st.Fixtures.YearlySummary[0].ExportValue != 1200 {
+		t.Error("the summary was not published")
+	}
+}
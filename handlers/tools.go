@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/problem"
+	"trade-api/tools"
+)
+
+func GetTools() fiber.Handler {
+	definitions := tools.Definitions()
+
+	return func(c *fiber.Ctx) error {
+		format := c.Query("format", "generic")
+		if !slices.Contains(tools.Formats, format) {
+			options := strings.Join(tools.Formats, ", ")
+			return problem.BadRequest(problem.CodeInvalidFormat, "format",
+				fmt.Sprintf("invalid format: %s. Valid options: %s", format, options),
+				fmt.Sprintf("صيغة غير صالحة: %s. الخيارات المتاحة: %s", format, options))
+		}
+
+		return c.JSON(tools.Render(definitions, format))
+	}
+}
@@ -0,0 +1,19 @@
+package handlers_test
+
+import (
+	"testing"
+
+	"trade-api/problem"
+)
+
+func TestGetTools(t *testing.T) {
+	for _, format := range []string{"generic", "openai", "anthropic", "gemini"} {
+		var definitions interface{}
+		decode(t, request(t, "GET", "/api/v1/tools?format="+format, ""), 200, &definitions)
+		if definitions == nil {
+			t.Errorf("%s: empty tool definitions", format)
+		}
+	}
+
+	wantProblem(t, request(t, "GET", "/api/v1/tools?format=yaml", ""), 400, problem.CodeInvalidFormat)
+}
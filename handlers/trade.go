@@ -3,234 +3,260 @@ package handlers
 import (
 	"context"
 	"fmt"
-	"log"
-	"time"
+	"slices"
+	"strings"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/jackc/pgx/v5/pgxpool"
 
+	"trade-api/middleware"
 	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
 	"trade-api/utils"
 )
 
-func GetTradeSummary(db *pgxpool.Pool) fiber.Handler {
+func GetTradeSummary(trade store.TradeStore) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		startYear := c.QueryInt("start_year", 0)
-		endYear := c.QueryInt("end_year", 0)
-
-		if startYear == 0 || endYear == 0 {
-			return fiber.NewError(fiber.StatusBadRequest, "start_year and end_year are required")
+		startYear, endYear, err := parseYearRange(c)
+		if err != nil {
+			return err
 		}
-
-		if startYear > endYear {
-			return fiber.NewError(fiber.StatusBadRequest, "start_year must be less than or equal to end_year")
+		format, lang, err := parseFormat(c, "json", "markdown")
+		if err != nil {
+			return err
+		}
+		release, err := parseRelease(c, trade)
+		if err != nil {
+			return err
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		query := `
-			SELECT 
-				year,
-				COALESCE(import_value, 0) as import_value,
-				COALESCE(export_value, 0) as export_value,
-				COALESCE(reexport_value, 0) as reexport_value,
-				COALESCE(tradebalance_value, 0) as tradebalance_value,
-				COALESCE(import_value, 0) + COALESCE(export_value, 0) + COALESCE(reexport_value, 0) as total_trade_value
-			FROM fact_yearly_summary
-			WHERE year BETWEEN $1 AND $2
-			ORDER BY year
-		`
+		ctx := c.UserContext()
 
-		rows, err := db.Query(ctx, query, startYear, endYear)
+		summaries, err := trade.YearlySummary(ctx, startYear, endYear, release)
 		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to query trade summary")
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query trade summary", "تعذّر الاستعلام عن ملخص التجارة", err)
 		}
-		defer rows.Close()
 
-		summaries := []models.TradeSummary{}
-		for rows.Next() {
-			var s models.TradeSummary
-			if err := rows.Scan(&s.Year, &s.ImportValue, &s.ExportValue, &s.ReExportValue,
-				&s.TradeBalanceValue, &s.TotalTradeValue); err != nil {
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to scan summary")
-			}
-			summaries = append(summaries, s)
+		if format == "markdown" {
+			return sendMarkdown(c, utils.SummaryMarkdown(summaries, startYear, endYear, lang))
 		}
 
 		return c.JSON(summaries)
 	}
 }
 
-func GetTradeBalance(db *pgxpool.Pool) fiber.Handler {
+func GetTradeBalance(trade store.TradeStore) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		startYear := c.QueryInt("start_year", 0)
-		endYear := c.QueryInt("end_year", 0)
-
-		if startYear == 0 || endYear == 0 {
-			return fiber.NewError(fiber.StatusBadRequest, "start_year and end_year are required")
+		startYear, endYear, err := parseYearRange(c)
+		if err != nil {
+			return err
 		}
-
-		if startYear > endYear {
-			return fiber.NewError(fiber.StatusBadRequest, "start_year must be less than or equal to end_year")
+		format, lang, err := parseFormat(c, "json", "markdown")
+		if err != nil {
+			return err
+		}
+		release, err := parseRelease(c, trade)
+		if err != nil {
+			return err
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-
-		query := `
-			SELECT 
-				COALESCE(SUM(import_value), 0) as total_import,
-				COALESCE(SUM(export_value), 0) as total_export,
-				COALESCE(SUM(reexport_value), 0) as total_reexport,
-				COALESCE(SUM(export_value), 0) + COALESCE(SUM(reexport_value), 0) - COALESCE(SUM(import_value), 0) as trade_balance
-			FROM fact_yearly_summary
-			WHERE year BETWEEN $1 AND $2
-		`
-
-		var balance models.TradeBalance
-		balance.StartYear = startYear
-		balance.EndYear = endYear
+		ctx := c.UserContext()
 
-		err := db.QueryRow(ctx, query, startYear, endYear).Scan(
-			&balance.TotalImport,
-			&balance.TotalExport,
-			&balance.TotalReExport,
-			&balance.TradeBalance,
-		)
+		balance, err := trade.Balance(ctx, startYear, endYear, release)
 		if err != nil {
-			log.Printf("Trade balance query error: %v", err)
-			return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to query trade balance: %v", err))
+			return problem.Internal(problem.CodeQueryFailed, "Failed to query trade balance", "تعذّر الاستعلام عن الميزان التجاري", err)
+		}
+
+		if format == "markdown" {
+			return sendMarkdown(c, utils.BalanceMarkdown(balance, lang))
 		}
 
 		return c.JSON(balance)
 	}
 }
 
-func AggregateTradeData(db *pgxpool.Pool) fiber.Handler {
+func AggregateTradeData(st store.Store) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		var req models.AggregateRequest
-		if err := c.BodyParser(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, "Invalid request body")
-		}
-
-		// Validate request
-		if err := validateAggregateRequest(&req); err != nil {
-			return fiber.NewError(fiber.StatusBadRequest, err.Error())
+		req, err := parseAggregateRequest(c, st)
+		if err != nil {
+			return err
 		}
 
-		// Set defaults
-		if req.Pagination.Page == 0 {
-			req.Pagination.Page = 1
-		}
-		if req.Pagination.Limit == 0 {
-			req.Pagination.Limit = 25
-		}
-		if req.Pagination.Limit > 1000 {
-			req.Pagination.Limit = 1000
-		}
-		if req.Sorting.SortBy == "" {
-			req.Sorting.SortBy = "total_value"
+		format, lang, err := parseFormat(c, "json", "geojson", "markdown")
+		if err != nil {
+			return err
 		}
-		if req.Sorting.SortOrder == "" {
-			req.Sorting.SortOrder = "desc"
+		if format == "geojson" {
+			if err := validateGeoJSONRequest(req); err != nil {
+				return err
+			}
 		}
 
-		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-		defer cancel()
+		ctx := c.UserContext()
 
-		// Build query
-		query, countQuery, args := utils.BuildAggregateQuery(&req)
-
-		log.Printf("Count Query: %s", countQuery)
-		log.Printf("Args: %+v", args)
-
-		// Get total count
-		var totalCount int64
-		if err := db.QueryRow(ctx, countQuery, args...).Scan(&totalCount); err != nil {
-			log.Printf("Count query error: %v", err)
-			return fiber.NewError(fiber.StatusInternalServerError, fmt.Sprintf("Failed to get total count: %v", err))
+		dryRun, explain := c.QueryBool("dry_run"), c.QueryBool("explain")
+		if dryRun || explain {
+			if !middleware.IsAdmin(c) {
+				return problem.New(fiber.StatusForbidden, problem.CodeAdminRequired,
+					"dry_run and explain require admin permission", "يتطلب dry_run و explain صلاحية المشرف")
+			}
+			plan, err := PlanAggregate(ctx, st, req, explain)
+			if err != nil {
+				return problem.Internal(problem.CodeQueryFailed, "Failed to explain query", "تعذّر تحليل الاستعلام", err)
+			}
+			return c.JSON(plan)
 		}
 
-		// Get data
-		offset := (req.Pagination.Page - 1) * req.Pagination.Limit
-		query += fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(args)+1, len(args)+2)
-		args = append(args, req.Pagination.Limit, offset)
-
-		rows, err := db.Query(ctx, query, args...)
+		results, meta, err := RunAggregate(ctx, st, req)
 		if err != nil {
-			return fiber.NewError(fiber.StatusInternalServerError, "Failed to execute query: "+err.Error())
+			return err
 		}
-		defer rows.Close()
-
-		results := []models.AggregateResult{}
-		for rows.Next() {
-			result := models.AggregateResult{}
-			scanTargets := utils.BuildScanTargets(&req, &result)
 
-			if err := rows.Scan(scanTargets...); err != nil {
-				return fiber.NewError(fiber.StatusInternalServerError, "Failed to scan result: "+err.Error())
-			}
-			results = append(results, result)
+		if format == "markdown" {
+			return sendMarkdown(c, utils.AggregateMarkdown(req, results, meta, lang))
+		}
+		if c.Query("lang") != "" {
+			utils.ProjectAggregateLang(results, lang)
 		}
 
-		totalPages := int(totalCount) / req.Pagination.Limit
-		if int(totalCount)%req.Pagination.Limit > 0 {
-			totalPages++
+		if format == "geojson" {
+			collection, err := buildFeatureCollection(ctx, st, req, results, meta)
+			if err != nil {
+				return problem.Internal(problem.CodeQueryFailed, "Failed to load geometries", "تعذّر تحميل البيانات الجغرافية", err)
+			}
+			collection.QueryDescription = DescribeAggregate(req)
+			return c.JSON(collection, "application/geo+json")
 		}
 
 		response := models.PaginatedResponse{
-			Data: results,
-			Pagination: models.PaginationMeta{
-				CurrentPage: req.Pagination.Page,
-				PageSize:    req.Pagination.Limit,
-				TotalCount:  totalCount,
-				TotalPages:  totalPages,
-			},
+			Data:             results,
+			Pagination:       meta,
+			QueryDescription: DescribeAggregate(req),
 		}
 
 		return c.JSON(response)
 	}
 }
 
-func validateAggregateRequest(req *models.AggregateRequest) error {
-	if req.DateRange.StartYear == 0 || req.DateRange.EndYear == 0 {
-		return fmt.Errorf("date_range.start_year and date_range.end_year are required")
+func parseYearRange(c *fiber.Ctx) (int, int, error) {
+	startYear := c.QueryInt("start_year", 0)
+	endYear := c.QueryInt("end_year", 0)
+
+	if err := ValidateYearRange(startYear, endYear); err != nil {
+		return 0, 0, err
 	}
-	if req.DateRange.StartYear > req.DateRange.EndYear {
-		return fmt.Errorf("start_year must be less than or equal to end_year")
+
+	return startYear, endYear, nil
+}
+
+func ValidateYearRange(startYear, endYear int) error {
+	if startYear == 0 || endYear == 0 {
+		return problem.BadRequest(problem.CodeMissingDateRange, "start_year",
+			"start_year and end_year are required", "start_year و end_year مطلوبان")
 	}
-	if len(req.GroupBy) == 0 {
-		return fmt.Errorf("group_by is required and must contain at least one field")
+
+	if startYear > endYear {
+		return problem.BadRequest(problem.CodeInvalidDateRange, "start_year",
+			"start_year must be less than or equal to end_year", "يجب أن تكون start_year أقل من أو تساوي end_year")
 	}
 
-	validGroupBy := map[string]bool{
-		"year": true, "product": true, "country": true, "port": true, "trade_type": true,
+	return nil
+}
+
+// parseFormat reads the format and lang query parameters. lang defaults to en.
+func parseFormat(c *fiber.Ctx, formats ...string) (string, string, error) {
+	format := c.Query("format", formats[0])
+	if !slices.Contains(formats, format) {
+		options := strings.Join(formats, ", ")
+		return "", "", problem.BadRequest(problem.CodeInvalidFormat, "format",
+			fmt.Sprintf("invalid format: %s. Valid options: %s", format, options),
+			fmt.Sprintf("صيغة غير صالحة: %s. الخيارات المتاحة: %s", format, options))
 	}
-	for _, g := range req.GroupBy {
-		if !validGroupBy[g] {
-			return fmt.Errorf("invalid group_by field: %s. Valid options: year, product, country, port, trade_type", g)
-		}
+	if format != formats[0] && !middleware.HasScope(c, models.ScopeExport) {
+		return "", "", middleware.ScopeError(models.ScopeExport)
 	}
 
-	validTradeTypes := map[string]bool{"Import": true, "Export": true, "Re-Export": true}
-	for _, tt := range req.TradeTypes {
-		if !validTradeTypes[tt] {
-			return fmt.Errorf("invalid trade_type: %s. Valid options: Import, Export, Re-Export", tt)
-		}
+	lang := c.Query("lang", "en")
+	if lang != "en" && lang != "ar" {
+		return "", "", problem.BadRequest(problem.CodeInvalidLang, "lang",
+			"invalid lang: "+lang+". Valid options: en, ar", "لغة غير صالحة: "+lang+". الخيارات المتاحة: en, ar")
 	}
 
-	validSortBy := map[string]bool{
-		"total_value": true, "year": true, "product_desc_en": true,
-		"country_name_en": true, "port_name_en": true, "trade_type": true,
+	return format, lang, nil
+}
+
+func sendMarkdown(c *fiber.Ctx, body string) error {
+	c.Set(fiber.HeaderContentType, "text/markdown; charset=utf-8")
+	return c.SendString(body)
+}
+
+func parseAggregateRequest(c *fiber.Ctx, trade store.TradeStore) (*models.AggregateRequest, error) {
+	return ParseAggregateRequest(c.UserContext(), trade, c.Body())
+}
+
+// RunAggregate returns one page of results for a validated request.
+func RunAggregate(ctx context.Context, trade store.TradeStore, req *models.AggregateRequest) ([]models.AggregateResult, models.PaginationMeta, error) {
+	results, totalCount, err := trade.Aggregate(ctx, req)
+	if err != nil {
+		return nil, models.PaginationMeta{}, problem.Internal(problem.CodeQueryFailed, "Failed to execute query", "تعذّر تنفيذ الاستعلام", err)
 	}
-	if !validSortBy[req.Sorting.SortBy] {
-		return fmt.Errorf("invalid sort_by field: %s", req.Sorting.SortBy)
+
+	return results, paginationMeta(req, totalCount), nil
+}
+
+// paginationMeta describes the requested page of totalCount groups.
+func paginationMeta(req *models.AggregateRequest, totalCount int64) models.PaginationMeta {
+	totalPages := int(totalCount) / req.Pagination.Limit
+	if int(totalCount)%req.Pagination.Limit > 0 {
+		totalPages++
+	}
+
+	return models.PaginationMeta{
+		CurrentPage: req.Pagination.Page,
+		PageSize:    req.Pagination.Limit,
+		TotalCount:  totalCount,
+		TotalPages:  totalPages,
 	}
+}
 
-	if req.Sorting.SortOrder != "asc" && req.Sorting.SortOrder != "desc" {
-		return fmt.Errorf("invalid sort_order: %s. Valid options: asc, desc", req.Sorting.SortOrder)
+// DescribeAggregate reports the request as normalized by
+// PrepareAggregateRequest, in words and as data, with the fact table it reads.
+func DescribeAggregate(req *models.AggregateRequest) *models.QueryDescription {
+	return &models.QueryDescription{
+		EN:                utils.DescribeAggregate(req, "en"),
+		AR:                utils.DescribeAggregate(req, "ar"),
+		NormalizedRequest: *req,
+		FactTable:         utils.FactTable(req),
 	}
+}
 
-	return nil
+// PlanAggregate returns the SQL generated for req without running it. With
+// explain set, the data query is run under EXPLAIN (ANALYZE, FORMAT JSON).
+func PlanAggregate(ctx context.Context, trade store.TradeStore, req *models.AggregateRequest, explain bool) (*models.QueryPlan, error) {
+	q, err := utils.BuildAggregateQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	query, args := q.Paginated(req.Pagination.Limit, req.Pagination.Offset())
+
+	plan := &models.QueryPlan{
+		FactTable:  q.FactTable,
+		Joins:      q.Joins,
+		Query:      strings.Join(strings.Fields(query), " "),
+		CountQuery: strings.Join(strings.Fields(q.CountQuery), " "),
+		Args:       args,
+	}
+	if plan.Joins == nil {
+		plan.Joins = []string{}
+	}
+
+	if explain {
+		explained, err := trade.ExplainAggregate(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		plan.Explain = explained
+	}
+
+	return plan, nil
 }
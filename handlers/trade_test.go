@@ -0,0 +1,299 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store/storetest"
+)
+
+func TestGetTradeSummary(t *testing.T) {
+	var summaries []models.TradeSummary
+	decode(t, request(t, "GET", "/api/v1/trade/summary?start_year=2021&end_year=2022", ""), 200, &summaries)
+
+	want := []models.TradeSummary{
+		{Year: 2021, ImportValue: 600, ExportValue: 1200, ReExportValue: 50, TradeBalanceValue: 650, TotalTradeValue: 1850},
+		{Year: 2022, ImportValue: 750, ExportValue: 1450, ReExportValue: 80, TradeBalanceValue: 780, TotalTradeValue: 2280},
+	}
+	if len(summaries) != len(want) {
+		t.Fatalf("got %d years, want %d", len(summaries), len(want))
+	}
+	for i := range want {
+		if summaries[i] != want[i] {
+			t.Errorf("year %d: got %+v, want %+v", want[i].Year, summaries[i], want[i])
+		}
+	}
+}
+
+func TestGetTradeSummaryMarkdown(t *testing.T) {
+	resp := request(t, "GET", "/api/v1/trade/summary?start_year=2021&end_year=2023&format=markdown&lang=ar", "")
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if body := readBody(t, resp); !strings.Contains(body, "2023") {
+		t.Errorf("markdown is missing 2023:\n%s", body)
+	}
+}
+
+func TestTradeSummaryParameters(t *testing.T) {
+	tests := []struct {
+		query string
+		code  string
+	}{
+		{"", problem.CodeMissingDateRange},
+		{"?start_year=2023&end_year=2021", problem.CodeInvalidDateRange},
+		{"?start_year=2021&end_year=2023&format=xml", problem.CodeInvalidFormat},
+		{"?start_year=2021&end_year=2023&lang=fr", problem.CodeInvalidLang},
+	}
+	for _, tt := range tests {
+		wantProblem(t, request(t, "GET", "/api/v1/trade/summary"+tt.query, ""), 400, tt.code)
+	}
+}
+
+func TestGetTradeBalance(t *testing.T) {
+	var balance models.TradeBalance
+	decode(t, request(t, "GET", "/api/v1/trade/balance?start_year=2021&end_year=2023", ""), 200, &balance)
+
+	want := models.TradeBalance{StartYear: 2021, EndYear: 2023, TotalImport: 2250, TotalExport: 4050, TotalReExport: 200, TradeBalance: 2000}
+	if balance != want {
+		t.Errorf("got %+v, want %+v", balance, want)
+	}
+}
+
+func TestAggregateByProduct(t *testing.T) {
+	body := `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["product"]}`
+
+	var resp models.PaginatedResponse
+	decode(t, request(t, "POST", "/api/v1/trade/aggregate", body), 200, &resp)
+
+	results := aggregateResults(t, resp)
+	want := []struct {
+		name  string
+		total int64
+	}{{"Crude Oil", 3300}, {"Cars", 2250}, {"Dates", 950}}
+	if len(results) != len(want) {
+		t.Fatalf("got %d results, want %d", len(results), len(want))
+	}
+	for i, w := range want {
+		if *results[i].ProductDescEN != w.name || results[i].TotalValue != w.total {
+			t.Errorf("result %d = %s %d, want %s %d", i, *results[i].ProductDescEN, results[i].TotalValue, w.name, w.total)
+		}
+	}
+	if resp.Pagination.TotalCount != 3 || resp.Pagination.TotalPages != 1 {
+		t.Errorf("pagination = %+v", resp.Pagination)
+	}
+	if resp.QueryDescription == nil || resp.QueryDescription.FactTable != "fact_trade_by_product_port" {
+		t.Errorf("query description = %+v", resp.QueryDescription)
+	}
+}
+
+func TestAggregatePagination(t *testing.T) {
+	body := `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["product"],"pagination":{"page":2,"limit":2}}`
+
+	var resp models.PaginatedResponse
+	decode(t, request(t, "POST", "/api/v1/trade/aggregate", body), 200, &resp)
+
+	results := aggregateResults(t, resp)
+	if len(results) != 1 || *results[0].ProductDescEN != "Dates" {
+		t.Errorf("page 2 = %+v, want Dates only", results)
+	}
+	want := models.PaginationMeta{CurrentPage: 2, PageSize: 2, TotalCount: 3, TotalPages: 2}
+	if resp.Pagination != want {
+		t.Errorf("pagination = %+v, want %+v", resp.Pagination, want)
+	}
+}
+
+func TestAggregateFilters(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want map[string]int64
+	}{
+		{
+			name: "country and trade type",
+			body: `{"date_range":{"start_year":2022,"end_year":2022},"group_by":["country"],"trade_types":["Export"]}`,
+			want: map[string]int64{"India": 800, "China": 650},
+		},
+		{
+			name: "port type",
+			body: `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["year"],"filters":{"port_types":["Land"]}}`,
+			want: map[string]int64{"2021": 50, "2022": 150, "2023": 70},
+		},
+		{
+			name: "product and port",
+			body: `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["trade_type"],"filters":{"product_ids":[1],"port_ids":[200]}}`,
+			want: map[string]int64{"Import": 300},
+		},
+		{
+			name: "port type reclassified since",
+			body: `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["year"],"filters":{"port_types":["Dry Port"]}}`,
+			want: map[string]int64{},
+		},
+		{
+			name: "port type filter ignores label_as_of",
+			body: `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["year"],"filters":{"port_types":["Land"]},"label_as_of":2022}`,
+			want: map[string]int64{"2021": 50, "2022": 150, "2023": 70},
+		},
+		{
+			name: "port name as of 2021",
+			body: `{"date_range":{"start_year":2023,"end_year":2023},"group_by":["port"],"filters":{"port_ids":[100]},"label_as_of":2021}`,
+			want: map[string]int64{"Jeddah Port": 1800},
+		},
+		{
+			name: "country name as of 2021",
+			body: `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["country"],"filters":{"country_ids":[30]},"label_as_of":2021}`,
+			want: map[string]int64{"Federal Republic of Germany": 1020},
+		},
+	}
+	for _, tt := range tests {
+		var resp models.PaginatedResponse
+		decode(t, request(t, "POST", "/api/v1/trade/aggregate", tt.body), 200, &resp)
+
+		got := map[string]int64{}
+		for _, r := range aggregateResults(t, resp) {
+			got[groupLabel(r)] = r.TotalValue
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+			continue
+		}
+		for label, total := range tt.want {
+			if got[label] != total {
+				t.Errorf("%s: %s = %d, want %d", tt.name, label, got[label], total)
+			}
+		}
+	}
+}
+
+func TestLabelAsOfKeepsNewMembers(t *testing.T) {
+	// Port 200 was only added to the history in 2024, after a load had
+	// dropped it, so it had no version in effect at the end of 2021
+	st := storetest.New()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	st.Fixtures.PortHistory = append(st.Fixtures.PortHistory, models.PortVersion{Port: st.Fixtures.Ports[1], ValidFrom: &from})
+	app := newApp(st)
+
+	totals := func(body string) map[string]int64 {
+		t.Helper()
+		var resp models.PaginatedResponse
+		decode(t, requestTo(t, app, "POST", "/api/v1/trade/aggregate", body), 200, &resp)
+		got := map[string]int64{}
+		for _, r := range aggregateResults(t, resp) {
+			got[groupLabel(r)] = r.TotalValue
+		}
+		return got
+	}
+	current := totals(`{"date_range":{"start_year":2021,"end_year":2023},"group_by":["port"]}`)
+	labelled := totals(`{"date_range":{"start_year":2021,"end_year":2023},"group_by":["port"],"label_as_of":2021}`)
+	if got, want := labelled["King Khalid International Airport"], current["King Khalid International Airport"]; got == 0 || got != want {
+		t.Errorf("port 200 as of 2021 = %d, want its current total %d (labelled %v)", got, want, labelled)
+	}
+	if labelled["Jeddah Port"] != current["Jeddah Islamic Port"] || len(labelled) != len(current) {
+		t.Errorf("labelled = %v, current = %v", labelled, current)
+	}
+}
+
+func TestAggregateValidation(t *testing.T) {
+	tests := []struct {
+		body string
+		code string
+	}{
+		{`{"date_range":{"start_year":2021,"end_year":2023},"group_by":["product","country"]}`, problem.CodeIncompatibleDimensions},
+		{`{"date_range":{"start_year":2019,"end_year":2023},"group_by":["year"]}`, problem.CodeYearOutOfRange},
+		{`{"date_range":{"start_year":"2021","end_year":2023},"group_by":["year"]}`, problem.CodeInvalidType},
+		{`{"date_range":{"start_year":2021,"end_year":2023},"group_by":["year"],"sorting":{"sort_by":"port_name_en"}}`, problem.CodeInvalidSortBy},
+		{`{"date_range":{"start_year":2021,"end_year":2023},"group_by":["year"],"label_as_of":-1}`, problem.CodeYearOutOfRange},
+		{`[]`, problem.CodeInvalidBody},
+	}
+	for _, tt := range tests {
+		wantProblem(t, request(t, "POST", "/api/v1/trade/aggregate", tt.body), 400, tt.code)
+	}
+}
+
+func TestAggregateGeoJSON(t *testing.T) {
+	body := `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["country"]}`
+
+	resp := request(t, "POST", "/api/v1/trade/aggregate?format=geojson", body)
+	if ct := resp.Header.Get("Content-Type"); ct != "application/geo+json" {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	var collection models.FeatureCollection
+	decode(t, resp, 200, &collection)
+
+	if len(collection.Features) != 3 {
+		t.Fatalf("got %d features, want 3", len(collection.Features))
+	}
+	for _, f := range collection.Features {
+		// Germany has no ISO code in the fixtures, so no geometry
+		hasGeometry := string(f.Geometry) != "null"
+		if hasGeometry != (f.ID != 30) {
+			t.Errorf("feature %d geometry = %s", f.ID, f.Geometry)
+		}
+	}
+
+	body = `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["year"]}`
+	wantProblem(t, request(t, "POST", "/api/v1/trade/aggregate?format=geojson", body), 400, problem.CodeIncompatibleDimensions)
+}
+
+func TestAggregateMarkdown(t *testing.T) {
+	body := `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["port"]}`
+
+	resp := request(t, "POST", "/api/v1/trade/aggregate?format=markdown", body)
+	if resp.StatusCode != 200 {
+		t.Fatalf("status = %d", resp.StatusCode)
+	}
+	if md := readBody(t, resp); !strings.Contains(md, "Jeddah Islamic Port") {
+		t.Errorf("markdown is missing port names:\n%s", md)
+	}
+}
+
+func TestAggregateDryRun(t *testing.T) {
+	body := `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["product"]}`
+
+	wantProblem(t, request(t, "POST", "/api/v1/trade/aggregate?dry_run=true", body), 403, problem.CodeAdminRequired)
+
+	var plan models.QueryPlan
+	decode(t, request(t, "POST", "/api/v1/trade/aggregate?dry_run=true", body, "X-Admin-Token", adminToken), 200, &plan)
+	if plan.FactTable != "fact_trade_by_product_port" || !strings.Contains(plan.Query, "LIMIT $3 OFFSET $4") {
+		t.Errorf("plan = %+v", plan)
+	}
+
+	// The in-memory store cannot EXPLAIN
+	wantProblem(t, request(t, "POST", "/api/v1/trade/aggregate?explain=true", body, "X-Admin-Token", adminToken), 500, problem.CodeQueryFailed)
+}
+
+func aggregateResults(t *testing.T, resp models.PaginatedResponse) []models.AggregateResult {
+	t.Helper()
+
+	data, err := json.Marshal(resp.Data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var results []models.AggregateResult
+	if err := json.Unmarshal(data, &results); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func groupLabel(r models.AggregateResult) string {
+	switch {
+	case r.CountryNameEN != nil:
+		return *r.CountryNameEN
+	case r.PortNameEN != nil:
+		return *r.PortNameEN
+	case r.TradeType != nil:
+		return *r.TradeType
+	case r.Year != nil:
+		return strconv.Itoa(*r.Year)
+	}
+	return ""
+}
@@ -0,0 +1,368 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+	"trade-api/utils"
+)
+
+// ParseAggregateRequest strictly decodes an aggregate request body, applies
+// defaults and validates it. Unknown fields, type mismatches and every
+// validation failure are reported together in one problem.
+func ParseAggregateRequest(ctx context.Context, trade store.TradeStore, body []byte) (*models.AggregateRequest, error) {
+	var req models.AggregateRequest
+	errs, err := decodeStrict(body, &req)
+	if err != nil {
+		return nil, err
+	}
+
+	applyAggregateDefaults(&req)
+	for _, e := range validateAggregateRequest(&req, loadYearBounds(ctx, trade, &req)) {
+		if !overlapsAny(e.Field, errs) {
+			errs = append(errs, e)
+		}
+	}
+	if e := validateAsOfRelease(ctx, trade, req.AsOfRelease); e != nil {
+		errs = append(errs, e)
+	}
+
+	if err := problem.Validation(errs); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// PrepareAggregateRequest applies the pagination and sorting defaults to a
+// request built in code, then validates it.
+func PrepareAggregateRequest(ctx context.Context, trade store.TradeStore, req *models.AggregateRequest) error {
+	applyAggregateDefaults(req)
+	errs := validateAggregateRequest(req, loadYearBounds(ctx, trade, req))
+	if e := validateAsOfRelease(ctx, trade, req.AsOfRelease); e != nil {
+		errs = append(errs, e)
+	}
+	return problem.Validation(errs)
+}
+
+func applyAggregateDefaults(req *models.AggregateRequest) {
+	if req.Pagination.Page == 0 {
+		req.Pagination.Page = 1
+	}
+	if req.Pagination.Limit == 0 {
+		req.Pagination.Limit = models.DefaultPageLimit
+	}
+	if req.Pagination.Limit > models.MaxPageLimit {
+		req.Pagination.Limit = models.MaxPageLimit
+	}
+	if req.Sorting.SortBy == "" {
+		req.Sorting.SortBy = "total_value"
+	}
+	if req.Sorting.SortOrder == "" {
+		req.Sorting.SortOrder = "desc"
+	}
+}
+
+// validateAggregateRequest returns every problem with req. Year bounds are
+// only checked when the years with data are known.
+func validateAggregateRequest(req *models.AggregateRequest, bounds *yearBounds) []*problem.Error {
+	var errs []*problem.Error
+	add := func(code, field, message, messageAR string) {
+		errs = append(errs, problem.BadRequest(code, field, message, messageAR))
+	}
+
+	start, end := req.DateRange.StartYear, req.DateRange.EndYear
+	switch {
+	case start == 0 || end == 0:
+		add(problem.CodeMissingDateRange, "/date_range",
+			"date_range.start_year and date_range.end_year are required",
+			"date_range.start_year و date_range.end_year مطلوبان")
+	case start > end:
+		add(problem.CodeInvalidDateRange, "/date_range/start_year",
+			"start_year must be less than or equal to end_year",
+			"يجب أن تكون start_year أقل من أو تساوي end_year")
+	case bounds != nil:
+		if start < bounds.min || start > bounds.max {
+			add(problem.CodeYearOutOfRange, "/date_range/start_year",
+				fmt.Sprintf("start_year %d is outside the years with data (%d–%d)", start, bounds.min, bounds.max),
+				fmt.Sprintf("سنة البداية %d خارج السنوات المتوفرة بياناتها (%d–%d)", start, bounds.min, bounds.max))
+		}
+		if end < bounds.min || end > bounds.max {
+			add(problem.CodeYearOutOfRange, "/date_range/end_year",
+				fmt.Sprintf("end_year %d is outside the years with data (%d–%d)", end, bounds.min, bounds.max),
+				fmt.Sprintf("سنة النهاية %d خارج السنوات المتوفرة بياناتها (%d–%d)", end, bounds.min, bounds.max))
+		}
+	}
+
+	if len(req.GroupBy) == 0 {
+		add(problem.CodeMissingGroupBy, "/group_by",
+			"group_by is required and must contain at least one field",
+			"group_by مطلوب ويجب أن يحتوي على حقل واحد على الأقل")
+	}
+	for i, g := range req.GroupBy {
+		if !slices.Contains(models.GroupByFields, g) {
+			options := strings.Join(models.GroupByFields, ", ")
+			add(problem.CodeInvalidGroupBy, fmt.Sprintf("/group_by/%d", i),
+				fmt.Sprintf("invalid group_by field: %s. Valid options: %s", g, options),
+				fmt.Sprintf("حقل تجميع غير صالح: %s. الخيارات المتاحة: %s", g, options))
+		}
+	}
+
+	// Products and countries live in different fact tables
+	needsProduct := slices.Contains(req.GroupBy, "product") || len(req.Filters.ProductIDs) > 0
+	needsCountry := slices.Contains(req.GroupBy, "country") || len(req.Filters.CountryIDs) > 0
+	if needsProduct && needsCountry {
+		add(problem.CodeIncompatibleDimensions, "/group_by",
+			"product and country cannot be combined in one query",
+			"لا يمكن الجمع بين المنتج والدولة في استعلام واحد")
+	}
+
+	for i, tt := range req.TradeTypes {
+		if !slices.Contains(models.TradeTypes, tt) {
+			options := strings.Join(models.TradeTypes, ", ")
+			add(problem.CodeInvalidTradeType, fmt.Sprintf("/trade_types/%d", i),
+				fmt.Sprintf("invalid trade_type: %s. Valid options: %s", tt, options),
+				fmt.Sprintf("نوع تجارة غير صالح: %s. الخيارات المتاحة: %s", tt, options))
+		}
+	}
+
+	for field, ids := range map[string][]int64{
+		"product_ids": req.Filters.ProductIDs,
+		"country_ids": req.Filters.CountryIDs,
+		"port_ids":    req.Filters.PortIDs,
+	} {
+		if len(ids) > models.MaxFilterIDs {
+			add(problem.CodeTooManyFilterIDs, "/filters/"+field,
+				fmt.Sprintf("filters.%s has %d IDs; at most %d are allowed", field, len(ids), models.MaxFilterIDs),
+				fmt.Sprintf("يحتوي filters.%s على %d معرّفاً والحد الأقصى %d", field, len(ids), models.MaxFilterIDs))
+		}
+	}
+
+	if req.Pagination.Page < 1 {
+		add(problem.CodeInvalidPagination, "/pagination/page",
+			"pagination.page must be at least 1", "يجب ألا تقل pagination.page عن 1")
+	}
+	if req.Pagination.Limit < 1 {
+		add(problem.CodeInvalidPagination, "/pagination/limit",
+			"pagination.limit must be at least 1", "يجب ألا يقل pagination.limit عن 1")
+	}
+
+	if !slices.Contains(models.SortByFields, req.Sorting.SortBy) {
+		options := strings.Join(models.SortByFields, ", ")
+		add(problem.CodeInvalidSortBy, "/sorting/sort_by",
+			fmt.Sprintf("invalid sort_by field: %s. Valid options: %s", req.Sorting.SortBy, options),
+			fmt.Sprintf("حقل ترتيب غير صالح: %s. الخيارات المتاحة: %s", req.Sorting.SortBy, options))
+	} else if group, ok := models.SortByGroup[req.Sorting.SortBy]; ok && !slices.Contains(req.GroupBy, group) {
+		add(problem.CodeInvalidSortBy, "/sorting/sort_by",
+			fmt.Sprintf("sort_by %s requires %s in group_by", req.Sorting.SortBy, group),
+			fmt.Sprintf("يتطلب الترتيب حسب %s وجود %s في group_by", req.Sorting.SortBy, group))
+	}
+	if !slices.Contains(models.SortOrders, req.Sorting.SortOrder) {
+		options := strings.Join(models.SortOrders, ", ")
+		add(problem.CodeInvalidSortOrder, "/sorting/sort_order",
+			fmt.Sprintf("invalid sort_order: %s. Valid options: %s", req.Sorting.SortOrder, options),
+			fmt.Sprintf("اتجاه ترتيب غير صالح: %s. الخيارات المتاحة: %s", req.Sorting.SortOrder, options))
+	}
+
+	if req.AsOfRelease < 0 {
+		add(problem.CodeUnknownRelease, "/as_of_release",
+			"as_of_release must be a release number, or omitted for the latest",
+			"يجب أن يكون as_of_release رقم إصدار، أو أن يُحذف لأحدث إصدار")
+	}
+	if req.LabelAsOf < 0 {
+		add(problem.CodeYearOutOfRange, "/label_as_of",
+			"label_as_of must be a year, or omitted for the current names",
+			"يجب أن يكون label_as_of سنة، أو أن يُحذف للأسماء الحالية")
+	}
+
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Field < errs[j].Field })
+	return errs
+}
+
+// decodeStrict decodes a JSON object body into v. Unknown fields and type
+// mismatches are returned as field errors to report with the validation
+// ones; a body that is not a JSON object fails outright.
+func decodeStrict(body []byte, v interface{}) ([]*problem.Error, error) {
+	var raw interface{}
+	if err := json.Unmarshal(body, &raw); err != nil {
+		return nil, problem.BadRequest(problem.CodeInvalidBody, "", "Invalid request body: "+err.Error(), "نص الطلب ليس JSON صالحاً")
+	}
+	if _, ok := raw.(map[string]interface{}); !ok {
+		return nil, problem.BadRequest(problem.CodeInvalidBody, "", "Request body must be a JSON object", "يجب أن يكون نص الطلب كائن JSON")
+	}
+
+	errs := unknownFields(raw, reflect.TypeOf(v), "")
+
+	if err := json.Unmarshal(body, v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return nil, problem.BadRequest(problem.CodeInvalidBody, "", "Invalid request body", "نص الطلب غير صالح")
+		}
+		field := "/" + strings.ReplaceAll(typeErr.Field, ".", "/")
+		errs = append(errs, problem.BadRequest(problem.CodeInvalidType, field,
+			fmt.Sprintf("%s must be %s, got %s", field, jsonType(typeErr.Type), typeErr.Value),
+			fmt.Sprintf("يجب أن يكون %s من النوع %s وليس %s", field, jsonType(typeErr.Type), typeErr.Value)))
+	}
+	return errs, nil
+}
+
+// unknownFields walks decoded JSON against the struct it will be decoded into
+// and reports every member the struct does not have.
+func unknownFields(v interface{}, t reflect.Type, path string) []*problem.Error {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	var errs []*problem.Error
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		known := map[string]reflect.Type{}
+		names := []string{}
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+			if name != "" && name != "-" {
+				known[name] = t.Field(i).Type
+				names = append(names, name)
+			}
+		}
+
+		keys := make([]string, 0, len(obj))
+		for k := range obj {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		for _, k := range keys {
+			field := path + "/" + k
+			ft, ok := known[k]
+			if ok {
+				errs = append(errs, unknownFields(obj[k], ft, field)...)
+				continue
+			}
+			message := fmt.Sprintf("unknown field %q", k)
+			messageAR := fmt.Sprintf("حقل غير معروف %q", k)
+			if guess := closest(k, names); guess != "" {
+				message += fmt.Sprintf("; did you mean %q?", guess)
+				messageAR += fmt.Sprintf("؛ هل تقصد %q؟", guess)
+			}
+			errs = append(errs, problem.BadRequest(problem.CodeUnknownField, field, message, messageAR))
+		}
+	case reflect.Slice:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return nil
+		}
+		for i, item := range arr {
+			errs = append(errs, unknownFields(item, t.Elem(), fmt.Sprintf("%s/%d", path, i))...)
+		}
+	}
+	return errs
+}
+
+// closest returns the candidate within two edits of name, if any.
+func closest(name string, candidates []string) string {
+	best, bestDist := "", 3
+	for _, c := range candidates {
+		if d := editDistance(name, c); d < bestDist {
+			best, bestDist = c, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return "an integer"
+	case reflect.String:
+		return "a string"
+	case reflect.Slice:
+		return "an array"
+	case reflect.Struct:
+		return "an object"
+	}
+	return t.String()
+}
+
+// overlapsAny reports whether field is, contains or is contained in the
+// field of one of errs, so a type error is not repeated as a missing value.
+func overlapsAny(field string, errs []*problem.Error) bool {
+	for _, e := range errs {
+		if e.Code != problem.CodeInvalidType {
+			continue
+		}
+		if strings.HasPrefix(field, e.Field) || strings.HasPrefix(e.Field, field) {
+			return true
+		}
+	}
+	return false
+}
+
+type yearBounds struct {
+	min, max int
+}
+
+// loadYearBounds returns the first and last years with data in the fact
+// table and release req reads. It returns nil when they cannot be read, which
+// skips the year bounds check rather than rejecting every request.
+func loadYearBounds(ctx context.Context, trade store.TradeStore, req *models.AggregateRequest) *yearBounds {
+	minYear, maxYear, err := trade.FactYearRange(ctx, utils.FactTable(req), req.AsOfRelease)
+	if err != nil {
+		log.Printf("Year bounds query error: %v", err)
+		return nil
+	}
+	if maxYear == 0 {
+		return nil
+	}
+	return &yearBounds{min: minYear, max: maxYear}
+}
+
+// validateAsOfRelease checks that a positive as_of_release exists. Like the
+// year bounds, the check is skipped when the releases cannot be read.
+func validateAsOfRelease(ctx context.Context, trade store.TradeStore, release int) *problem.Error {
+	if release <= 0 {
+		return nil
+	}
+	releases, err := trade.Releases(ctx)
+	if err != nil {
+		log.Printf("Releases query error: %v", err)
+		return nil
+	}
+	if !hasRelease(releases, release) {
+		return unknownRelease("/as_of_release", release, releases)
+	}
+	return nil
+}
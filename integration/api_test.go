@@ -0,0 +1,717 @@
+// Package integration runs the HTTP API against a real Postgres loaded with a
+// synthetic warehouse, and compares every endpoint with totals computed
+// independently in Go. The same suite runs against the in-memory store, so
+// the fake and the database are held to the same answers.
+package integration
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/config"
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/sdmx"
+	"trade-api/server"
+	"trade-api/store"
+	"trade-api/store/storetest"
+	"trade-api/utils"
+)
+
+const adminToken = "integration-admin-token"
+
+func TestPostgres(t *testing.T) {
+	f := generate()
+	runSuite(t, newApp(store.NewPostgres(load(t, f))), f, true)
+}
+
+func TestMemory(t *testing.T) {
+	f := generate()
+	runSuite(t, newApp(&storetest.Memory{Fixtures: f}), f, false)
+}
+
+func newApp(st store.Store) *fiber.App {
+	cfg := config.Default()
+	cfg.Log.Requests = false
+	cfg.RateLimit.Enabled = false
+	cfg.Server.AdminToken = adminToken
+	return server.New(st, cfg)
+}
+
+// suite holds an app and the data it serves.
+type suite struct {
+	app *fiber.App
+	f   storetest.Fixtures
+}
+
+// runSuite checks every endpoint. explain is false for stores that cannot
+// produce query plans.
+func runSuite(t *testing.T, app *fiber.App, f storetest.Fixtures, explain bool) {
+	s := &suite{app: app, f: f}
+
+	t.Run("health", s.health)
+	t.Run("dimensions", s.dimensions)
+	t.Run("port history", s.portHistory)
+	t.Run("metadata", s.metadata)
+	t.Run("summary", s.summary)
+	t.Run("balance", s.balance)
+	t.Run("summary matches facts", s.summaryMatchesFacts)
+	t.Run("rebuild summary", s.rebuildSummary)
+	t.Run("quality", s.quality)
+	t.Run("aggregate", s.aggregate)
+	t.Run("aggregate pagination", s.aggregatePagination)
+	t.Run("aggregate geojson", s.aggregateGeoJSON)
+	t.Run("aggregate markdown", s.aggregateMarkdown)
+	t.Run("releases", s.releases)
+	t.Run("sdmx", s.sdmx)
+	t.Run("ask", s.ask)
+	t.Run("mcp", s.mcp)
+	t.Run("docs", s.docs)
+	if explain {
+		t.Run("explain", s.explain)
+	}
+	t.Run("dimension admin", s.dimensionAdmin)
+	t.Run("api keys", s.apiKeys)
+}
+
+func (s *suite) health(t *testing.T) {
+	var body struct{ Status string }
+	s.decode(t, s.do(t, "GET", "/health", ""), &body)
+	if body.Status != "healthy" {
+		t.Errorf("status = %q", body.Status)
+	}
+}
+
+func (s *suite) dimensions(t *testing.T) {
+	var products []models.Product
+	s.decode(t, s.do(t, "GET", "/api/v1/dimensions/products?limit=500", ""), &products)
+	if !slices.Equal(products, s.f.Products) {
+		t.Errorf("products = %+v, want %+v", products, s.f.Products)
+	}
+
+	s.decode(t, s.do(t, "GET", "/api/v1/dimensions/products?search=PRODUCT%2001&limit=3", ""), &products)
+	if want := s.f.Products[9:12]; !slices.Equal(products, want) {
+		t.Errorf("search products = %+v, want %+v", products, want)
+	}
+
+	var countries []models.Country
+	s.decode(t, s.do(t, "GET", "/api/v1/dimensions/countries?search=%D8%AF%D9%88%D9%84%D8%A9%20030", ""), &countries)
+	if len(countries) != 1 || countries[0].CountryID != 30 || countries[0].ISOCode != nil {
+		t.Errorf("search countries = %+v, want country 30 without an ISO code", countries)
+	}
+
+	var ports []models.Port
+	s.decode(t, s.do(t, "GET", "/api/v1/dimensions/ports?port_type=Land&limit=500", ""), &ports)
+	var want []models.Port
+	for _, p := range s.f.Ports {
+		if p.PortTypeEN == "Land" {
+			want = append(want, p)
+		}
+	}
+	if len(ports) != len(want) {
+		t.Fatalf("land ports = %+v, want %+v", ports, want)
+	}
+	for i := range want {
+		if ports[i].PortID != want[i].PortID || ports[i].Latitude != nil || ports[i].ModeID != want[i].ModeID {
+			t.Errorf("land port %d = %+v, want %+v", i, ports[i], want[i])
+		}
+	}
+}
+
+// portHistory checks that a port that never changed has one version, and
+// that labels as of a year match the current ones.
+func (s *suite) portHistory(t *testing.T) {
+	port := s.f.Ports[0]
+	var versions []models.PortVersion
+	s.decode(t, s.do(t, "GET", fmt.Sprintf("/api/v1/dimensions/ports/%d/history", port.PortID), ""), &versions)
+	if len(versions) != 1 || versions[0].PortNameEN != port.PortNameEN || versions[0].ValidFrom != nil || versions[0].ValidTo != nil {
+		t.Errorf("versions = %+v", versions)
+	}
+
+	resp := s.do(t, "GET", "/api/v1/dimensions/ports/999999/history", "")
+	if body := readBody(t, resp); resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("unknown port: status = %d: %s", resp.StatusCode, body)
+	}
+
+	req := s.request([]string{"country", "port"})
+	current, _ := s.aggregatePage(t, req)
+	req.LabelAsOf = firstYear
+	labelled, _ := s.aggregatePage(t, req)
+	if !slices.EqualFunc(current, labelled, func(a, b models.AggregateResult) bool {
+		return *a.CountryNameEN == *b.CountryNameEN && *a.PortNameEN == *b.PortNameEN && a.TotalValue == b.TotalValue
+	}) {
+		t.Errorf("labels as of %d differ from the current ones", firstYear)
+	}
+}
+
+func (s *suite) metadata(t *testing.T) {
+	var metadata models.Metadata
+	s.decode(t, s.do(t, "GET", "/api/v1/metadata", ""), &metadata)
+
+	years := []int{}
+	for year := firstYear; year <= lastYear; year++ {
+		years = append(years, year)
+	}
+	if !slices.Equal(metadata.SummaryYears, years) {
+		t.Errorf("summary years = %v, want %v", metadata.SummaryYears, years)
+	}
+	for _, table := range metadata.FactTables {
+		if !slices.Equal(table.Years, years) || !slices.Equal(sorted(table.TradeTypes), sorted(models.TradeTypes)) {
+			t.Errorf("%s: years %v, trade types %v", table.Name, table.Years, table.TradeTypes)
+		}
+	}
+	if len(metadata.FactTables) != 2 {
+		t.Errorf("got %d fact tables, want 2", len(metadata.FactTables))
+	}
+
+	want := models.DimensionCounts{Products: int64(len(s.f.Products)), Countries: int64(len(s.f.Countries)), Ports: int64(len(s.f.Ports))}
+	if metadata.DimensionCounts != want {
+		t.Errorf("dimension counts = %+v, want %+v", metadata.DimensionCounts, want)
+	}
+	if !slices.Equal(metadata.PortTypes, portTypes) {
+		t.Errorf("port types = %+v, want %+v", metadata.PortTypes, portTypes)
+	}
+	if metadata.LastDataLoad == nil {
+		t.Error("last_data_load is null")
+	}
+}
+
+func (s *suite) summary(t *testing.T) {
+	var summaries []models.TradeSummary
+	s.decode(t, s.do(t, "GET", fmt.Sprintf("/api/v1/trade/summary?start_year=%d&end_year=%d", firstYear, lastYear), ""), &summaries)
+	if !slices.Equal(summaries, s.f.YearlySummary) {
+		t.Errorf("summary = %+v, want %+v", summaries, s.f.YearlySummary)
+	}
+}
+
+func (s *suite) balance(t *testing.T) {
+	var balance models.TradeBalance
+	s.decode(t, s.do(t, "GET", "/api/v1/trade/balance?start_year=2020&end_year=2022", ""), &balance)
+
+	want := models.TradeBalance{StartYear: 2020, EndYear: 2022}
+	for _, summary := range s.f.YearlySummary {
+		if summary.Year >= 2020 && summary.Year <= 2022 {
+			want.TotalImport += summary.ImportValue
+			want.TotalExport += summary.ExportValue
+			want.TotalReExport += summary.ReExportValue
+		}
+	}
+	want.TradeBalance = want.TotalExport + want.TotalReExport - want.TotalImport
+	if balance != want {
+		t.Errorf("balance = %+v, want %+v", balance, want)
+	}
+}
+
+// summaryMatchesFacts checks that the summary endpoint agrees with both fact
+// tables aggregated through the API, which catches the summary table drifting
+// from the facts it is derived from.
+func (s *suite) summaryMatchesFacts(t *testing.T) {
+	var summaries []models.TradeSummary
+	s.decode(t, s.do(t, "GET", fmt.Sprintf("/api/v1/trade/summary?start_year=%d&end_year=%d", firstYear, lastYear), ""), &summaries)
+	fromSummary := map[string]int64{}
+	for _, summary := range summaries {
+		fromSummary[fmt.Sprintf("%d|Import", summary.Year)] = summary.ImportValue
+		fromSummary[fmt.Sprintf("%d|Export", summary.Year)] = summary.ExportValue
+		fromSummary[fmt.Sprintf("%d|Re-Export", summary.Year)] = summary.ReExportValue
+	}
+
+	// Filtering on every country reads the country fact table
+	var countryIDs []int64
+	for _, c := range s.f.Countries {
+		countryIDs = append(countryIDs, c.CountryID)
+	}
+	for _, filters := range []models.Filters{{}, {CountryIDs: countryIDs}} {
+		req := s.request([]string{"year", "trade_type"})
+		req.Filters = filters
+		got := s.aggregateAll(t, req)
+		if !maps.Equal(got, fromSummary) {
+			t.Errorf("%s totals = %v, summary = %v", utils.FactTable(req), got, fromSummary)
+		}
+	}
+}
+
+// aggregate runs every group_by combination, unfiltered and with every
+// filter, and compares the groups and totals with the fixtures.
+func (s *suite) aggregate(t *testing.T) {
+	for _, groupBy := range groupings() {
+		for _, filtered := range []bool{false, true} {
+			req := s.request(groupBy)
+			req.DateRange = models.DateRange{StartYear: 2019, EndYear: 2022}
+			if filtered {
+				req.TradeTypes = []string{"Import", "Re-Export"}
+				req.Filters = models.Filters{PortIDs: []int64{100, 200, 300, 400, 600}, PortTypes: []string{"Sea", "Air"}}
+				if utils.FactTable(req) == utils.CountryFactTable {
+					req.Filters.CountryIDs = []int64{10, 30, 50, 70}
+				} else {
+					req.Filters.ProductIDs = []int64{1, 2, 3, 5, 8, 13}
+				}
+			}
+
+			name := strings.Join(groupBy, ",")
+			if filtered {
+				name += " filtered"
+			}
+			t.Run(name, func(t *testing.T) {
+				want := expectedAggregate(s.f, req)
+				if len(want) == 0 {
+					t.Fatal("request matches no facts")
+				}
+				if got := s.aggregateAll(t, req); !maps.Equal(got, want) {
+					t.Errorf("got %v, want %v", got, want)
+				}
+			})
+		}
+	}
+}
+
+// aggregatePagination pages through a grouping and checks that the pages are
+// disjoint, ordered and complete.
+func (s *suite) aggregatePagination(t *testing.T) {
+	req := s.request([]string{"product", "port"})
+	want := expectedAggregate(s.f, req)
+
+	got := map[string]int64{}
+	var last int64 = -1
+	for page := 1; ; page++ {
+		req.Pagination = models.Pagination{Page: page, Limit: 7}
+		results, meta := s.aggregatePage(t, req)
+		if meta.TotalCount != int64(len(want)) || meta.TotalPages != (len(want)+6)/7 {
+			t.Fatalf("page %d: pagination = %+v, want %d groups", page, meta, len(want))
+		}
+		for _, r := range results {
+			key := groupKey(r, req.GroupBy)
+			if _, ok := got[key]; ok {
+				t.Errorf("page %d repeats %s", page, key)
+			}
+			if last >= 0 && r.TotalValue > last {
+				t.Errorf("page %d: %s total %d follows %d in descending order", page, key, r.TotalValue, last)
+			}
+			got[key], last = r.TotalValue, r.TotalValue
+		}
+		if page >= meta.TotalPages {
+			break
+		}
+	}
+	if !maps.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func (s *suite) aggregateGeoJSON(t *testing.T) {
+	req := s.request([]string{"port"})
+	var collection models.FeatureCollection
+	s.decode(t, s.do(t, "POST", "/api/v1/trade/aggregate?format=geojson", mustJSON(t, req)), &collection)
+
+	want := expectedAggregate(s.f, req)
+	if len(collection.Features) != len(want) {
+		t.Fatalf("got %d features, want %d", len(collection.Features), len(want))
+	}
+	for _, feature := range collection.Features {
+		port := s.f.Ports[slices.IndexFunc(s.f.Ports, func(p models.Port) bool { return p.PortID == feature.ID })]
+		if hasGeometry := string(feature.Geometry) != "null"; hasGeometry != (port.Latitude != nil) {
+			t.Errorf("port %d geometry = %s", feature.ID, feature.Geometry)
+		}
+		if key := groupKey(feature.Properties, req.GroupBy); feature.Properties.TotalValue != want[key] {
+			t.Errorf("%s = %d, want %d", key, feature.Properties.TotalValue, want[key])
+		}
+	}
+}
+
+func (s *suite) aggregateMarkdown(t *testing.T) {
+	resp := s.do(t, "POST", "/api/v1/trade/aggregate?format=markdown&lang=ar", mustJSON(t, s.request([]string{"trade_type"})))
+	if ct := resp.Header.Get(fiber.HeaderContentType); !strings.HasPrefix(ct, "text/markdown") {
+		t.Errorf("Content-Type = %q", ct)
+	}
+	if body := readBody(t, resp); !strings.Contains(body, "|") {
+		t.Errorf("markdown has no table:\n%s", body)
+	}
+}
+
+func (s *suite) sdmx(t *testing.T) {
+	var structure sdmx.StructureMessage
+	s.decode(t, s.do(t, "GET", "/api/v1/sdmx/datastructure", ""), &structure)
+	sizes := map[string]int{"CL_PRODUCT": len(s.f.Products), "CL_COUNTRY": len(s.f.Countries), "CL_PORT": len(s.f.Ports)}
+	for _, codelist := range structure.Data.Codelists {
+		if n, ok := sizes[codelist.ID]; ok && len(codelist.Codes) != n+1 {
+			t.Errorf("%s has %d codes, want %d and the total", codelist.ID, len(codelist.Codes), n)
+		}
+	}
+
+	years := lastYear - firstYear + 1
+	req := s.request([]string{"country", "trade_type"})
+	tests := []struct {
+		method, target, body string
+		observations         int
+	}{
+		{"GET", fmt.Sprintf("/api/v1/sdmx/data/summary?start_year=%d&end_year=%d", firstYear, lastYear), "", 4 * years},
+		{"GET", "/api/v1/sdmx/data/balance?start_year=2020&end_year=2021", "", 4},
+		{"POST", "/api/v1/sdmx/data/aggregate", mustJSON(t, req), len(expectedAggregate(s.f, req))},
+	}
+	for _, tt := range tests {
+		var message sdmx.DataMessage
+		s.decode(t, s.do(t, tt.method, tt.target, tt.body), &message)
+		if len(message.DataSets) != 1 || len(message.DataSets[0].Observations) != tt.observations {
+			t.Errorf("%s: got %+v, want %d observations", tt.target, message.DataSets, tt.observations)
+		}
+	}
+}
+
+func (s *suite) ask(t *testing.T) {
+	product := s.f.Products[4]
+	question := fmt.Sprintf(`{"question":"Exports of %s in 2021"}`, product.ProductDescEN)
+
+	var resp models.AskResponse
+	s.decode(t, s.do(t, "POST", "/api/v1/ask", question), &resp)
+
+	var total int64
+	for _, fact := range s.f.ProductFacts {
+		if fact.Year == 2021 && fact.TradeType == "Export" && fact.ProductID == product.ProductID {
+			total += fact.Value
+		}
+	}
+	var got int64
+	for _, r := range results(t, *resp.Result) {
+		got += r.TotalValue
+	}
+	if got != total {
+		t.Errorf("answer to %s totals %d, want %d (request %+v)", question, got, total, resp.Request)
+	}
+}
+
+func (s *suite) mcp(t *testing.T) {
+	message := fmt.Sprintf(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_trade_balance","arguments":{"start_year":%d,"end_year":%d}}}`,
+		firstYear, lastYear)
+	var reply struct {
+		Result struct {
+			Content []struct{ Text string } `json:"content"`
+			IsError bool                    `json:"isError"`
+		} `json:"result"`
+	}
+	s.decode(t, s.do(t, "POST", "/mcp", message), &reply)
+
+	var balance int64
+	for _, summary := range s.f.YearlySummary {
+		balance += summary.TradeBalanceValue
+	}
+	want := fmt.Sprintf(`"trade_balance":%d`, balance)
+	if reply.Result.IsError || len(reply.Result.Content) != 1 || !strings.Contains(reply.Result.Content[0].Text, want) {
+		t.Errorf("got %+v, want %s", reply.Result, want)
+	}
+}
+
+func (s *suite) docs(t *testing.T) {
+	var spec map[string]any
+	s.decode(t, s.do(t, "GET", "/openapi.json", ""), &spec)
+	if spec["paths"] == nil {
+		t.Error("spec has no paths")
+	}
+	var tools []any
+	s.decode(t, s.do(t, "GET", "/api/v1/tools", ""), &tools)
+	if len(tools) == 0 {
+		t.Error("no tools")
+	}
+}
+
+// rebuildSummary checks, without publishing, that a rebuild reproduces the
+// generated summary and that the fact tables reconcile exactly.
+func (s *suite) rebuildSummary(t *testing.T) {
+	var rebuild models.SummaryRebuild
+	s.decode(t, s.do(t, "POST", "/api/v1/admin/summary/rebuild?dry_run=true", "", "X-Admin-Token", adminToken), &rebuild)
+	if rebuild.Published || rebuild.Discrepancies != 0 || len(rebuild.Changes) != 0 {
+		t.Errorf("rebuild = %+v", rebuild)
+	}
+	if want := (lastYear - firstYear + 1) * len(models.TradeTypes); len(rebuild.Reconciliation) != want {
+		t.Errorf("%d reconciliations, want %d", len(rebuild.Reconciliation), want)
+	}
+	for _, r := range rebuild.Reconciliation {
+		if r.Difference != 0 {
+			t.Errorf("%d %s: product %d, country %d", r.Year, r.TradeType, r.ProductTotal, r.CountryTotal)
+		}
+	}
+}
+
+// releases checks that the first release holds all the data.
+func (s *suite) releases(t *testing.T) {
+	var releases []models.Release
+	s.decode(t, s.do(t, "GET", "/api/v1/releases", ""), &releases)
+	if len(releases) != 1 || releases[0].ReleaseID != 1 {
+		t.Fatalf("releases = %+v", releases)
+	}
+
+	var summaries []models.TradeSummary
+	s.decode(t, s.do(t, "GET", fmt.Sprintf("/api/v1/trade/summary?start_year=%d&end_year=%d&as_of_release=1", firstYear, lastYear), ""), &summaries)
+	if !slices.Equal(summaries, s.f.YearlySummary) {
+		t.Errorf("summary as of release 1 = %+v", summaries)
+	}
+	resp := s.do(t, "GET", fmt.Sprintf("/api/v1/trade/summary?start_year=%d&end_year=%d&as_of_release=2", firstYear, lastYear), "")
+	if body := readBody(t, resp); resp.StatusCode != fiber.StatusBadRequest || !strings.Contains(body, problem.CodeUnknownRelease) {
+		t.Errorf("release 2: status = %d: %s", resp.StatusCode, body)
+	}
+
+	// Everything changed since the empty warehouse
+	req := s.request([]string{"year"})
+	want := s.aggregateAll(t, req)
+	var diff models.ReleaseDiff
+	s.decode(t, s.do(t, "POST", "/api/v1/releases/diff?from=0", mustJSON(t, req)), &diff)
+	if diff.FromRelease != 0 || diff.ToRelease != 1 || len(diff.Data) != len(want) {
+		t.Fatalf("diff = %+v", diff)
+	}
+	for _, c := range diff.Data {
+		if key := groupKey(c.AggregateResult, req.GroupBy); c.TotalValue != want[key] || c.PreviousValue != 0 || c.Change != c.TotalValue {
+			t.Errorf("%s: %+v, want total %d", key, c, want[key])
+		}
+	}
+}
+
+// quality checks that the generated warehouse passes every quality check.
+func (s *suite) quality(t *testing.T) {
+	var report models.QualityReport
+	s.decode(t, s.do(t, "GET", "/api/v1/quality", ""), &report)
+	if !report.Passed {
+		t.Errorf("report = %+v", report)
+	}
+	if want := (lastYear - firstYear + 1) * len(models.TradeTypes); len(report.Totals) != want {
+		t.Errorf("%d totals, want %d", len(report.Totals), want)
+	}
+}
+
+// dimensionAdmin adds, corrects, deletes and restores a product and
+// corrects a country, checking the dimension lists and the audit trail. It
+// changes the data, so it runs last.
+func (s *suite) dimensionAdmin(t *testing.T) {
+	admin := []string{"X-Admin-Token", adminToken}
+	expect := func(resp *http.Response, status int) {
+		t.Helper()
+		if body := readBody(t, resp); resp.StatusCode != status {
+			t.Fatalf("status = %d, want %d: %s", resp.StatusCode, status, body)
+		}
+	}
+	search := func(target string) int {
+		t.Helper()
+		var members []json.RawMessage
+		s.decode(t, s.do(t, "GET", target, ""), &members)
+		return len(members)
+	}
+
+	id := slices.MaxFunc(s.f.Products, func(a, b models.Product) int { return cmp.Compare(a.ProductID, b.ProductID) }).ProductID + 1
+	product := fmt.Sprintf("/api/v1/admin/dimensions/products/%d", id)
+	expect(s.do(t, "POST", "/api/v1/admin/dimensions/products",
+		fmt.Sprintf(`{"product_id":%d,"product_desc_en":"Admin Product","product_desc_ar":"منتج"}`, id), admin...), fiber.StatusCreated)
+	expect(s.do(t, "POST", "/api/v1/admin/dimensions/products",
+		fmt.Sprintf(`{"product_id":%d,"product_desc_en":"Other","product_desc_ar":"آخر"}`, id), admin...), fiber.StatusConflict)
+	expect(s.do(t, "PUT", product, `{"product_desc_en":"Admin Product","product_desc_ar":"منتج المشرف"}`, admin...), fiber.StatusOK)
+	if n := search("/api/v1/dimensions/products?search=" + url.QueryEscape("منتج المشرف")); n != 1 {
+		t.Errorf("%d products with the corrected name, want 1", n)
+	}
+
+	expect(s.do(t, "DELETE", product, "", admin...), fiber.StatusNoContent)
+	if n := search("/api/v1/dimensions/products?search=Admin%20Product"); n != 0 {
+		t.Errorf("%d deleted products listed", n)
+	}
+	expect(s.do(t, "PUT", product, `{"product_desc_en":"Admin Product","product_desc_ar":"منتج"}`, admin...), fiber.StatusNotFound)
+	expect(s.do(t, "POST", product+"/restore", "", admin...), fiber.StatusNoContent)
+	if n := search("/api/v1/dimensions/products?search=Admin%20Product"); n != 1 {
+		t.Errorf("%d restored products listed, want 1", n)
+	}
+
+	var entries []models.AuditEntry
+	s.decode(t, s.do(t, "GET", fmt.Sprintf("/api/v1/admin/dimensions/audit?table=dim_product&id=%d", id), "", admin...), &entries)
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	if want := []string{"restore", "delete", "update", "create"}; !slices.Equal(actions, want) {
+		t.Fatalf("actions = %v, want %v", actions, want)
+	}
+	if update := entries[2]; !strings.Contains(string(update.Before), `"منتج"`) || !strings.Contains(string(update.After), "منتج المشرف") {
+		t.Errorf("update = %s to %s", update.Before, update.After)
+	}
+
+	country := s.f.Countries[0]
+	country.CountryNameAR += " (مصححة)"
+	expect(s.do(t, "PUT", fmt.Sprintf("/api/v1/admin/dimensions/countries/%d", country.CountryID), mustJSON(t, country), admin...), fiber.StatusOK)
+	if n := search("/api/v1/dimensions/countries?search=" + url.QueryEscape("مصححة")); n != 1 {
+		t.Errorf("%d countries with the corrected name, want 1", n)
+	}
+}
+
+func (s *suite) apiKeys(t *testing.T) {
+	admin := []string{"X-Admin-Token", adminToken}
+	resp := s.do(t, "POST", "/api/v1/admin/keys", `{"name":"integration","scopes":["admin","read:trade"]}`, admin...)
+	body := readBody(t, resp)
+	if resp.StatusCode != fiber.StatusCreated {
+		t.Fatalf("create status = %d: %s", resp.StatusCode, body)
+	}
+	var key models.NewAPIKey
+	if err := json.Unmarshal([]byte(body), &key); err != nil {
+		t.Fatal(err)
+	}
+	if key.KeyID == 0 || key.Key == "" || !slices.Equal(key.Scopes, []string{"read:trade", "admin"}) {
+		t.Fatalf("key = %+v", key)
+	}
+
+	withKey := []string{"X-API-Key", key.Key}
+	var keys []models.APIKey
+	s.decode(t, s.do(t, "GET", "/api/v1/admin/keys", "", withKey...), &keys)
+	if len(keys) == 0 || keys[0].KeyID != key.KeyID || keys[0].Prefix != key.Prefix || keys[0].LastUsedAt == nil {
+		t.Errorf("keys = %+v", keys)
+	}
+
+	if resp := s.do(t, "DELETE", fmt.Sprintf("/api/v1/admin/keys/%d", key.KeyID), "", admin...); resp.StatusCode != fiber.StatusNoContent {
+		t.Fatalf("revoke status = %d: %s", resp.StatusCode, readBody(t, resp))
+	}
+	if resp := s.do(t, "GET", "/api/v1/dimensions/products", "", withKey...); resp.StatusCode != fiber.StatusUnauthorized {
+		t.Errorf("revoked key status = %d", resp.StatusCode)
+	}
+}
+
+// explain runs the planned query through EXPLAIN, which only a real database
+// can do.
+func (s *suite) explain(t *testing.T) {
+	body := mustJSON(t, s.request([]string{"country", "port"}))
+	var plan models.QueryPlan
+	s.decode(t, s.do(t, "POST", "/api/v1/trade/aggregate?explain=true", body, "X-Admin-Token", adminToken), &plan)
+	if plan.FactTable != utils.CountryFactTable || !json.Valid(plan.Explain) || len(plan.Explain) < 10 {
+		t.Errorf("plan = %+v", plan)
+	}
+}
+
+// request returns an aggregate request over every year with room for every
+// group on one page.
+func (s *suite) request(groupBy []string) *models.AggregateRequest {
+	return &models.AggregateRequest{
+		DateRange:  models.DateRange{StartYear: firstYear, EndYear: lastYear},
+		GroupBy:    groupBy,
+		Pagination: models.Pagination{Page: 1, Limit: models.MaxPageLimit},
+	}
+}
+
+// aggregateAll returns the totals of a request that fits on one page, keyed
+// like expectedAggregate.
+func (s *suite) aggregateAll(t *testing.T, req *models.AggregateRequest) map[string]int64 {
+	t.Helper()
+
+	results, meta := s.aggregatePage(t, req)
+	if meta.TotalPages > 1 {
+		t.Fatalf("%d groups do not fit on one page", meta.TotalCount)
+	}
+	got := map[string]int64{}
+	for _, r := range results {
+		key := groupKey(r, req.GroupBy)
+		if _, ok := got[key]; ok {
+			t.Errorf("group %s appears twice", key)
+		}
+		got[key] = r.TotalValue
+	}
+	return got
+}
+
+func (s *suite) aggregatePage(t *testing.T, req *models.AggregateRequest) ([]models.AggregateResult, models.PaginationMeta) {
+	t.Helper()
+
+	var resp models.PaginatedResponse
+	s.decode(t, s.do(t, "POST", "/api/v1/trade/aggregate", mustJSON(t, req)), &resp)
+	return results(t, resp), resp.Pagination
+}
+
+// do sends a request with a JSON body, if any, and headers as name, value
+// pairs.
+func (s *suite) do(t *testing.T, method, target, body string, headers ...string) *http.Response {
+	t.Helper()
+
+	var reader io.Reader
+	if body != "" {
+		reader = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, reader)
+	if body != "" {
+		req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := s.app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// decode checks for a 200 and decodes the JSON body into v.
+func (s *suite) decode(t *testing.T, resp *http.Response, v any) {
+	t.Helper()
+
+	body := readBody(t, resp)
+	if resp.StatusCode != fiber.StatusOK {
+		t.Fatalf("status = %d: %s", resp.StatusCode, body)
+	}
+	if err := json.Unmarshal([]byte(body), v); err != nil {
+		t.Fatalf("decode %s: %v", body, err)
+	}
+}
+
+func readBody(t *testing.T, resp *http.Response) string {
+	t.Helper()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+// results re-decodes the untyped data of a paginated response.
+func results(t *testing.T, resp models.PaginatedResponse) []models.AggregateResult {
+	t.Helper()
+
+	var results []models.AggregateResult
+	if err := json.Unmarshal([]byte(mustJSON(t, resp.Data)), &results); err != nil {
+		t.Fatal(err)
+	}
+	return results
+}
+
+func mustJSON(t *testing.T, v any) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// groupings returns every group_by combination the API accepts.
+func groupings() [][]string {
+	var result [][]string
+	for mask := 1; mask < 1<<len(models.GroupByFields); mask++ {
+		var groupBy []string
+		for i, field := range models.GroupByFields {
+			if mask&(1<<i) != 0 {
+				groupBy = append(groupBy, field)
+			}
+		}
+		if !slices.Contains(groupBy, "product") || !slices.Contains(groupBy, "country") {
+			result = append(result, groupBy)
+		}
+	}
+	return result
+}
+
+func sorted(s []string) []string {
+	s = slices.Clone(s)
+	slices.Sort(s)
+	return s
+}
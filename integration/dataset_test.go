@@ -0,0 +1,294 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"trade-api/models"
+	"trade-api/store/migrations"
+	"trade-api/store/storetest"
+	"trade-api/utils"
+)
+
+const (
+	firstYear = 2018
+	lastYear  = 2023
+)
+
+var portTypes = []models.PortType{
+	{ModeID: 1, PortTypeEN: "Sea", PortTypeAR: "بحري"},
+	{ModeID: 2, PortTypeEN: "Air", PortTypeAR: "جوي"},
+	{ModeID: 3, PortTypeEN: "Land", PortTypeAR: "بري"},
+}
+
+// generate builds the synthetic warehouse. It is deterministic, so failures
+// reproduce. Names are zero-padded so that byte order and every collation
+// agree on sorting.
+//
+// Country facts split each year and trade type total of the product facts
+// over random country and port cells, and the yearly summary is derived from
+// the product facts, so all three agree as they do in the real warehouse.
+func generate() storetest.Fixtures {
+	r := rand.New(rand.NewPCG(42, 2024))
+	var f storetest.Fixtures
+
+	for i := 1; i <= 15; i++ {
+		f.Products = append(f.Products, models.Product{
+			ProductID:     int64(i),
+			ProductDescEN: fmt.Sprintf("Product %03d", i),
+			ProductDescAR: fmt.Sprintf("منتج %03d", i),
+		})
+	}
+	for i := 1; i <= 9; i++ {
+		country := models.Country{
+			CountryID:     int64(i * 10),
+			CountryNameEN: fmt.Sprintf("Country %03d", i*10),
+			CountryNameAR: fmt.Sprintf("دولة %03d", i*10),
+		}
+		// Every third country has no ISO code
+		if i%3 != 0 {
+			code := fmt.Sprintf("C%c", 'A'+i)
+			country.ISOCode = &code
+		}
+		f.Countries = append(f.Countries, country)
+	}
+	for i := 1; i <= 7; i++ {
+		pt := portTypes[i%len(portTypes)]
+		port := models.Port{
+			PortID:     int64(i * 100),
+			PortNameEN: fmt.Sprintf("Port %03d", i*100),
+			PortNameAR: fmt.Sprintf("منفذ %03d", i*100),
+			PortTypeEN: pt.PortTypeEN,
+			PortTypeAR: pt.PortTypeAR,
+			ModeID:     pt.ModeID,
+		}
+		// Land ports have no coordinates
+		if pt.PortTypeEN != "Land" {
+			lat, lon := 16+float64(i), 36+float64(i)
+			port.Latitude, port.Longitude = &lat, &lon
+		}
+		f.Ports = append(f.Ports, port)
+	}
+
+	for year := firstYear; year <= lastYear; year++ {
+		summary := models.TradeSummary{Year: year}
+		for _, tradeType := range models.TradeTypes {
+			var total int64
+			for _, p := range f.Products {
+				for _, port := range f.Ports {
+					if r.IntN(10) >= 4 {
+						continue
+					}
+					value := 1 + r.Int64N(100_000)
+					total += value
+					f.ProductFacts = append(f.ProductFacts, storetest.Fact{
+						Year: year, ProductID: p.ProductID, PortID: port.PortID, TradeType: tradeType, Value: value,
+					})
+				}
+			}
+			f.CountryFacts = append(f.CountryFacts, splitTotal(r, f.Countries, f.Ports, year, tradeType, total)...)
+
+			switch tradeType {
+			case "Import":
+				summary.ImportValue = total
+			case "Export":
+				summary.ExportValue = total
+			case "Re-Export":
+				summary.ReExportValue = total
+			}
+		}
+		summary.TradeBalanceValue = summary.ExportValue + summary.ReExportValue - summary.ImportValue
+		summary.TotalTradeValue = summary.ImportValue + summary.ExportValue + summary.ReExportValue
+		f.YearlySummary = append(f.YearlySummary, summary)
+	}
+
+	loaded := time.Date(2024, 1, 15, 3, 0, 0, 0, time.UTC)
+	f.LastDataLoad = &loaded
+	f.Releases = []models.Release{{ReleaseID: 1, Source: "synthetic", CreatedAt: loaded}}
+	return f
+}
+
+// splitTotal spreads total over distinct random country and port cells.
+func splitTotal(r *rand.Rand, countries []models.Country, ports []models.Port, year int, tradeType string, total int64) []storetest.Fact {
+	cells := r.Perm(len(countries) * len(ports))[:1+r.IntN(len(countries)*len(ports)/2)]
+	cuts := []int64{0, total}
+	for range cells[1:] {
+		cuts = append(cuts, r.Int64N(total+1))
+	}
+	slices.Sort(cuts)
+
+	var facts []storetest.Fact
+	for i, cell := range cells {
+		if value := cuts[i+1] - cuts[i]; value > 0 {
+			facts = append(facts, storetest.Fact{
+				Year:      year,
+				CountryID: countries[cell/len(ports)].CountryID,
+				PortID:    ports[cell%len(ports)].PortID,
+				TradeType: tradeType,
+				Value:     value,
+			})
+		}
+	}
+	return facts
+}
+
+// load migrates a fresh schema and copies f into it.
+func load(t *testing.T, f storetest.Fixtures) *pgxpool.Pool {
+	t.Helper()
+	ctx := context.Background()
+
+	pool := newSchema(t)
+	if _, err := migrations.Up(ctx, pool); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Release()
+
+	// The facts and summary are all in the first release
+	copyRows(t, conn.Conn(), "releases", []string{"release_id", "source", "created_at"},
+		rows(f.Releases, func(r models.Release) []any { return []any{r.ReleaseID, r.Source, r.CreatedAt} }))
+	copyRows(t, conn.Conn(), "dim_product", []string{"product_id", "product_desc_en", "product_desc_ar"},
+		rows(f.Products, func(p models.Product) []any { return []any{p.ProductID, p.ProductDescEN, p.ProductDescAR} }))
+	copyRows(t, conn.Conn(), "dim_country", []string{"country_id", "country_name_en", "country_name_ar", "iso_code"},
+		rows(f.Countries, func(c models.Country) []any { return []any{c.CountryID, c.CountryNameEN, c.CountryNameAR, c.ISOCode} }))
+	copyRows(t, conn.Conn(), "dim_port", []string{"port_id", "port_name_en", "port_name_ar", "port_type_en", "port_type_ar", "mode_id", "latitude", "longitude"},
+		rows(f.Ports, func(p models.Port) []any {
+			return []any{p.PortID, p.PortNameEN, p.PortNameAR, p.PortTypeEN, p.PortTypeAR, p.ModeID, p.Latitude, p.Longitude}
+		}))
+	copyRows(t, conn.Conn(), utils.ProductFactTable, []string{"year", "product_id", "port_id", "trade_type", "value", "valid_from_release"},
+		rows(f.ProductFacts, func(fact storetest.Fact) []any {
+			return []any{fact.Year, fact.ProductID, fact.PortID, fact.TradeType, fact.Value, 1}
+		}))
+	copyRows(t, conn.Conn(), utils.CountryFactTable, []string{"year", "country_id", "port_id", "trade_type", "value", "valid_from_release"},
+		rows(f.CountryFacts, func(fact storetest.Fact) []any {
+			return []any{fact.Year, fact.CountryID, fact.PortID, fact.TradeType, fact.Value, 1}
+		}))
+	copyRows(t, conn.Conn(), "fact_yearly_summary", []string{"year", "import_value", "export_value", "reexport_value", "tradebalance_value", "valid_from_release"},
+		rows(f.YearlySummary, func(s models.TradeSummary) []any {
+			return []any{s.Year, s.ImportValue, s.ExportValue, s.ReExportValue, s.TradeBalanceValue, 1}
+		}))
+
+	// Every member has one version, as after the migration
+	for _, seed := range []string{
+		`INSERT INTO dim_country_history (country_id, country_name_en, country_name_ar, iso_code)
+		 SELECT country_id, country_name_en, country_name_ar, iso_code FROM dim_country`,
+		`INSERT INTO dim_port_history (port_id, port_name_en, port_name_ar, port_type_en, port_type_ar, mode_id, latitude, longitude)
+		 SELECT port_id, port_name_en, port_name_ar, port_type_en, port_type_ar, mode_id, latitude, longitude FROM dim_port`,
+	} {
+		if _, err := conn.Exec(ctx, seed); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The catalog reports the last analyze time as the data load time
+	if _, err := conn.Exec(ctx, "ANALYZE"); err != nil {
+		t.Fatal(err)
+	}
+	return pool
+}
+
+func copyRows(t *testing.T, conn *pgx.Conn, table string, columns []string, data [][]any) {
+	t.Helper()
+
+	n, err := conn.CopyFrom(context.Background(), pgx.Identifier{table}, columns, pgx.CopyFromRows(data))
+	if err != nil {
+		t.Fatalf("copy %s: %v", table, err)
+	}
+	if n != int64(len(data)) {
+		t.Fatalf("copy %s: copied %d rows, want %d", table, n, len(data))
+	}
+}
+
+func rows[T any](items []T, row func(T) []any) [][]any {
+	data := make([][]any, 0, len(items))
+	for _, item := range items {
+		data = append(data, row(item))
+	}
+	return data
+}
+
+// groupKey identifies a result group by its values in group_by order, such
+// as "2021|Product 003".
+func groupKey(r models.AggregateResult, groupBy []string) string {
+	parts := make([]string, 0, len(groupBy))
+	for _, group := range groupBy {
+		switch group {
+		case "year":
+			parts = append(parts, strconv.Itoa(deref(r.Year)))
+		case "product":
+			parts = append(parts, deref(r.ProductDescEN))
+		case "country":
+			parts = append(parts, deref(r.CountryNameEN))
+		case "port":
+			parts = append(parts, deref(r.PortNameEN))
+		case "trade_type":
+			parts = append(parts, deref(r.TradeType))
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
+
+// expectedAggregate totals the fact table the request reads, keyed like
+// groupKey. It deliberately shares no code with either store.
+func expectedAggregate(f storetest.Fixtures, req *models.AggregateRequest) map[string]int64 {
+	products := map[int64]string{}
+	for _, p := range f.Products {
+		products[p.ProductID] = p.ProductDescEN
+	}
+	countries := map[int64]string{}
+	for _, c := range f.Countries {
+		countries[c.CountryID] = c.CountryNameEN
+	}
+	ports := map[int64]models.Port{}
+	for _, p := range f.Ports {
+		ports[p.PortID] = p
+	}
+
+	facts := f.ProductFacts
+	if utils.FactTable(req) == utils.CountryFactTable {
+		facts = f.CountryFacts
+	}
+
+	want := map[string]int64{}
+	for _, fact := range facts {
+		port := ports[fact.PortID]
+		if fact.Year < req.DateRange.StartYear || fact.Year > req.DateRange.EndYear ||
+			!allows(req.TradeTypes, fact.TradeType) ||
+			!allows(req.Filters.ProductIDs, fact.ProductID) ||
+			!allows(req.Filters.CountryIDs, fact.CountryID) ||
+			!allows(req.Filters.PortIDs, fact.PortID) ||
+			!allows(req.Filters.PortTypes, port.PortTypeEN) {
+			continue
+		}
+		year, product, country := fact.Year, products[fact.ProductID], countries[fact.CountryID]
+		r := models.AggregateResult{Year: &year, ProductDescEN: &product, CountryNameEN: &country, PortNameEN: &port.PortNameEN, TradeType: &fact.TradeType}
+		want[groupKey(r, req.GroupBy)] += fact.Value
+	}
+	return want
+}
+
+// allows reports whether a filter admits v. An empty filter admits anything.
+func allows[T comparable](filter []T, v T) bool {
+	return len(filter) == 0 || slices.Contains(filter, v)
+}
@@ -0,0 +1,421 @@
+package integration
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"trade-api/loader"
+	"trade-api/models"
+	"trade-api/store"
+	"trade-api/store/migrations"
+	"trade-api/store/storetest"
+	"trade-api/utils"
+)
+
+// TestLoad loads the synthetic warehouse from CSV files with the load command
+// and runs the API suite against the result, then reloads one year.
+func TestLoad(t *testing.T) {
+	pool := migrated(t)
+	f := generate()
+	dir := t.TempDir()
+	writeFixtures(t, dir, f)
+
+	const manifest = `
+source: synthetic
+tables:
+  - {table: dim_product, file: dim_product.csv, columns: {product_desc_en: Name}}
+  - {table: dim_country, file: dim_country.csv}
+  - {table: dim_port, file: dim_port.csv}
+  - {table: fact_trade_by_product_port, file: fact_trade_by_product_port.csv}
+  - {table: fact_trade_by_country_port, file: fact_trade_by_country_port.csv}
+  - {table: fact_yearly_summary, file: fact_yearly_summary.csv}
+`
+
+	// A dry run reports the changes but neither makes them nor uses up a
+	// release number
+	report, err := loader.Load(context.Background(), pool, writeManifest(t, dir, manifest), loader.Options{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Committed || report.Release != 0 || report.Tables[3].Inserted != int64(len(f.ProductFacts)) ||
+		count(t, pool, utils.ProductFactTable) != 0 || count(t, pool, "releases") != 0 {
+		t.Errorf("dry run: %+v", report)
+	}
+
+	report = runLoad(t, pool, dir, manifest)
+	if !report.Committed || report.IssueCount != 0 || report.Release != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	if tr := report.Tables[3]; tr.Table != utils.ProductFactTable || tr.Inserted != int64(len(f.ProductFacts)) || tr.Deleted != 0 || len(tr.Years) != lastYear-firstYear+1 {
+		t.Errorf("product facts: %+v", tr)
+	}
+
+	app := newApp(store.NewPostgres(pool))
+	runSuite(t, app, f, true)
+
+	// Reload 2023 with every value doubled, one product renamed and a port
+	// renamed in the middle of the year. The suite read the first port's
+	// history, which the dimension cache still holds, so rename the second.
+	var facts []storetest.Fact
+	var replaced int
+	for _, fact := range f.ProductFacts {
+		if fact.Year == lastYear {
+			fact.Value *= 2
+			facts = append(facts, fact)
+			replaced++
+		}
+	}
+	f.Products[0].ProductDescEN = "Product 001 (revised)"
+	renamed := f.Ports[1]
+	f.Ports[1].PortNameEN = renamed.PortNameEN + " (renamed)"
+	writeCSV(t, filepath.Join(dir, "product_2023.csv"), []string{"year", "product_id", "port_id", "trade_type", "value"},
+		rows(facts, func(fact storetest.Fact) []any {
+			return []any{fact.Year, fact.ProductID, fact.PortID, fact.TradeType, fact.Value}
+		}))
+	writeFixtures(t, dir, f)
+
+	report = runLoad(t, pool, dir, fmt.Sprintf(`
+effective_date: %d-07-01
+tables:
+  - {table: dim_product, file: dim_product.csv, columns: {product_desc_en: Name}}
+  - {table: dim_port, file: dim_port.csv}
+  - {table: fact_trade_by_product_port, file: product_2023.csv}
+`, lastYear))
+	if report.Release != 2 {
+		t.Errorf("release = %d, want 2", report.Release)
+	}
+	if products := report.Tables[0]; products.Inserted != 0 || products.Updated != 1 || products.Deleted != 0 {
+		t.Errorf("products: %+v", products)
+	}
+	if ports := report.Tables[1]; ports.Updated != 1 {
+		t.Errorf("ports: %+v", ports)
+	}
+	if tr := report.Tables[2]; tr.Deleted != int64(replaced) || tr.Inserted != int64(replaced) || len(tr.Years) != 1 || tr.Years[0] != lastYear {
+		t.Errorf("product facts: %+v", tr)
+	}
+
+	s := &suite{app: app, f: f}
+	var versions []models.PortVersion
+	s.decode(t, s.do(t, "GET", fmt.Sprintf("/api/v1/dimensions/ports/%d/history", renamed.PortID), ""), &versions)
+	if len(versions) != 2 || versions[0].PortNameEN != renamed.PortNameEN || versions[0].ValidFrom != nil ||
+		versions[1].PortNameEN != f.Ports[1].PortNameEN || versions[1].ValidFrom == nil || !versions[1].ValidFrom.Equal(*versions[0].ValidTo) ||
+		versions[1].ValidFrom.Format(time.DateOnly) != fmt.Sprintf("%d-07-01", lastYear) || versions[1].ValidTo != nil {
+		t.Errorf("versions = %+v", versions)
+	}
+	portReq := s.request([]string{"port"})
+	portReq.Filters.PortIDs = []int64{renamed.PortID}
+	for year, want := range map[int]string{0: f.Ports[1].PortNameEN, lastYear: f.Ports[1].PortNameEN, lastYear - 1: renamed.PortNameEN} {
+		portReq.LabelAsOf = year
+		if results, _ := s.aggregatePage(t, portReq); len(results) != 1 || *results[0].PortNameEN != want {
+			t.Errorf("label_as_of %d: %+v, want %s", year, results, want)
+		}
+	}
+
+	req := s.request([]string{"year"})
+	got := s.aggregateAll(t, req)
+	req.AsOfRelease = 1
+	published := s.aggregateAll(t, req)
+	for year := firstYear; year <= lastYear; year++ {
+		var want int64
+		for _, fact := range f.ProductFacts {
+			if fact.Year == year {
+				want += fact.Value
+			}
+		}
+		key := fmt.Sprint(year)
+		if published[key] != want {
+			t.Errorf("%d total as of release 1 = %d, want %d", year, published[key], want)
+		}
+		if year == lastYear {
+			want *= 2
+		}
+		if got[key] != want {
+			t.Errorf("%d total = %d, want %d", year, got[key], want)
+		}
+	}
+
+	// Only the reloaded year changed between the releases
+	req.AsOfRelease = 0
+	var diff models.ReleaseDiff
+	s.decode(t, s.do(t, "POST", "/api/v1/releases/diff", mustJSON(t, req)), &diff)
+	key := fmt.Sprint(lastYear)
+	if diff.FromRelease != 1 || diff.ToRelease != 2 || len(diff.Data) != 1 || diff.Data[0].Year == nil || *diff.Data[0].Year != lastYear ||
+		diff.Data[0].TotalValue != got[key] || diff.Data[0].PreviousValue != published[key] {
+		t.Errorf("diff = %+v", diff)
+	}
+}
+
+// TestLoadRejectsInvalidData checks each validation and that a rejected load
+// changes nothing.
+func TestLoadRejectsInvalidData(t *testing.T) {
+	pool := migrated(t)
+	f := generate()
+	dir := t.TempDir()
+	writeFixtures(t, dir, f)
+	runLoad(t, pool, dir, `
+tables:
+  - {table: dim_product, file: dim_product.csv, columns: {product_desc_en: Name}}
+  - {table: dim_port, file: dim_port.csv}
+  - {table: fact_trade_by_product_port, file: fact_trade_by_product_port.csv}
+`)
+
+	header := []string{"year", "product_id", "port_id", "trade_type", "value"}
+	writeCSV(t, filepath.Join(dir, "bad_facts.csv"), header, [][]any{
+		{2024, 1, 100, "Export", 10},
+		{2024, 1, 100, "Export", 20},  // duplicate of row 2
+		{2024, 2, 100, "Import", -5},  // negative
+		{2024, 999, 100, "Import", 5}, // unknown product
+		{2024, 3, 100, "Transit", 5},  // unknown trade type
+		{2024, 4, 100, "Import", "x"}, // not a number
+	})
+	// Product 15 is dropped from the dimension but older facts use it
+	writeCSV(t, filepath.Join(dir, "fewer_products.csv"), []string{"product_id", "Name", "product_desc_ar"},
+		rows(f.Products[:14], func(p models.Product) []any { return []any{p.ProductID, p.ProductDescEN, p.ProductDescAR} }))
+
+	manifest := writeManifest(t, dir, `
+tables:
+  - {table: dim_product, file: fewer_products.csv, columns: {product_desc_en: Name}}
+  - {table: fact_trade_by_product_port, file: bad_facts.csv}
+`)
+	before := count(t, pool, utils.ProductFactTable)
+	report, err := loader.Load(context.Background(), pool, manifest, loader.Options{})
+	if !errors.Is(err, loader.ErrRejected) {
+		t.Fatalf("err = %v, want ErrRejected", err)
+	}
+
+	var issues []string
+	for _, issue := range report.Issues {
+		issues = append(issues, issue.String())
+	}
+	got := strings.Join(issues, "\n")
+	for _, want := range []string{
+		`fact_trade_by_product_port row 7 value "x": not a whole number`,
+		`fact_trade_by_product_port row 2 "2024, 1, 100, Export": duplicate key (year, product_id, port_id, trade_type) on rows 2, 3`,
+		`fact_trade_by_product_port row 4 value "-5": value must not be negative`,
+		`fact_trade_by_product_port row 5 product_id "999": not in dim_product`,
+		`fact_trade_by_product_port row 6 trade_type "Transit": unknown trade type`,
+		`dim_product product_id "15": missing from the file but used by fact_trade_by_product_port`,
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("issues do not include %s:\n%s", want, got)
+		}
+	}
+	if report.Committed || count(t, pool, utils.ProductFactTable) != before || count(t, pool, "dim_product") != len(f.Products) {
+		t.Error("a rejected load changed the database")
+	}
+}
+
+// TestLoadSoftDeletesMissingMembers checks that a dimension file without a
+// member an admin created soft-deletes it with an audit entry, that a later
+// file restores it, and that it leaves an admin's deletion alone.
+func TestLoadSoftDeletesMissingMembers(t *testing.T) {
+	pool := migrated(t)
+	ctx := context.Background()
+	f := generate()
+	dir := t.TempDir()
+	writeFixtures(t, dir, f)
+	const manifest = `
+source: products
+tables:
+  - {table: dim_product, file: dim_product.csv, columns: {product_desc_en: Name}}
+`
+	runLoad(t, pool, dir, manifest)
+
+	st := store.NewPostgres(pool)
+	extra := models.Product{ProductID: 9001, ProductDescEN: "Added by hand", ProductDescAR: "أضيف يدوياً"}
+	if err := st.CreateProduct(ctx, extra, "admin"); err != nil {
+		t.Fatal(err)
+	}
+
+	report := runLoad(t, pool, dir, manifest)
+	if tr := report.Tables[0]; tr.Deleted != 1 || len(tr.DeletedIDs) != 1 || tr.DeletedIDs[0] != extra.ProductID {
+		t.Errorf("products: %+v", tr)
+	}
+	if count(t, pool, "dim_product") != len(f.Products)+1 {
+		t.Error("the load removed the missing member's row")
+	}
+	entries, err := st.Audit(ctx, "dim_product", extra.ProductID, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].Action != models.AuditDelete || entries[0].Actor != "load: products" {
+		t.Errorf("audit = %+v", entries)
+	}
+
+	// Listed again, the member comes back
+	f.Products = append(f.Products, extra)
+	writeFixtures(t, dir, f)
+	report = runLoad(t, pool, dir, manifest)
+	if tr := report.Tables[0]; tr.Deleted != 0 || len(tr.RestoredIDs) != 1 || tr.RestoredIDs[0] != extra.ProductID {
+		t.Errorf("products: %+v", tr)
+	}
+
+	// An admin's deletion stands
+	if err := st.DeleteMember(ctx, "dim_product", extra.ProductID, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	report = runLoad(t, pool, dir, manifest)
+	if tr := report.Tables[0]; len(tr.RestoredIDs) != 0 || len(tr.DeletedIDs) != 0 {
+		t.Errorf("products: %+v", tr)
+	}
+	products, err := st.Products(ctx, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(products) != len(f.Products)-1 {
+		t.Errorf("%d products listed, want %d", len(products), len(f.Products)-1)
+	}
+}
+
+func TestFactYearRangeFollowsLoads(t *testing.T) {
+	pool := migrated(t)
+	ctx := context.Background()
+	full := generate()
+	dir := t.TempDir()
+	const manifest = `
+source: synthetic
+tables:
+  - {table: dim_product, file: dim_product.csv, columns: {product_desc_en: Name}}
+  - {table: dim_country, file: dim_country.csv}
+  - {table: dim_port, file: dim_port.csv}
+  - {table: fact_trade_by_product_port, file: fact_trade_by_product_port.csv}
+`
+
+	// Load every year but the last, then read the range into the cache
+	f := full
+	f.ProductFacts = nil
+	for _, fact := range full.ProductFacts {
+		if fact.Year < lastYear {
+			f.ProductFacts = append(f.ProductFacts, fact)
+		}
+	}
+	writeFixtures(t, dir, f)
+	runLoad(t, pool, dir, manifest)
+
+	st := store.NewPostgres(pool)
+	if _, maxYear, err := st.FactYearRange(ctx, utils.ProductFactTable, 0); err != nil || maxYear != lastYear-1 {
+		t.Fatalf("before: max year %d, %v; want %d", maxYear, err, lastYear-1)
+	}
+
+	// A later load shows at once, and the earlier release keeps its range
+	writeFixtures(t, dir, full)
+	runLoad(t, pool, dir, manifest)
+	if minYear, maxYear, err := st.FactYearRange(ctx, utils.ProductFactTable, 0); err != nil || minYear != firstYear || maxYear != lastYear {
+		t.Errorf("after: %d-%d, %v; want %d-%d", minYear, maxYear, err, firstYear, lastYear)
+	}
+	if _, maxYear, err := st.FactYearRange(ctx, utils.ProductFactTable, 1); err != nil || maxYear != lastYear-1 {
+		t.Errorf("release 1: max year %d, %v; want %d", maxYear, err, lastYear-1)
+	}
+}
+
+func migrated(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	pool := newSchema(t)
+	if _, err := migrations.Up(context.Background(), pool); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return pool
+}
+
+func runLoad(t *testing.T, pool *pgxpool.Pool, dir, manifest string) *loader.Report {
+	t.Helper()
+	report, err := loader.Load(context.Background(), pool, writeManifest(t, dir, manifest), loader.Options{})
+	if err != nil {
+		var b strings.Builder
+		if report != nil {
+			report.WriteText(&b)
+		}
+		t.Fatalf("load: %v\n%s", err, b.String())
+	}
+	return report
+}
+
+func writeManifest(t *testing.T, dir, manifest string) *loader.Manifest {
+	t.Helper()
+	path := filepath.Join(dir, "manifest.yaml")
+	if err := os.WriteFile(path, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	m, err := loader.ReadManifest(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// writeFixtures writes a CSV file per table, named after the table, with a
+// header per column. The English product name is headed Name, to exercise
+// column mapping.
+func writeFixtures(t *testing.T, dir string, f storetest.Fixtures) {
+	t.Helper()
+	file := func(table string) string { return filepath.Join(dir, table+".csv") }
+
+	writeCSV(t, file("dim_product"), []string{"product_id", "Name", "product_desc_ar"},
+		rows(f.Products, func(p models.Product) []any { return []any{p.ProductID, p.ProductDescEN, p.ProductDescAR} }))
+	writeCSV(t, file("dim_country"), []string{"country_id", "country_name_en", "country_name_ar", "iso_code"},
+		rows(f.Countries, func(c models.Country) []any {
+			return []any{c.CountryID, c.CountryNameEN, c.CountryNameAR, deref(c.ISOCode)}
+		}))
+	writeCSV(t, file("dim_port"), []string{"port_id", "port_name_en", "port_name_ar", "port_type_en", "port_type_ar", "mode_id", "latitude", "longitude"},
+		rows(f.Ports, func(p models.Port) []any {
+			lat, lon := "", ""
+			if p.Latitude != nil {
+				lat, lon = fmt.Sprint(*p.Latitude), fmt.Sprint(*p.Longitude)
+			}
+			return []any{p.PortID, p.PortNameEN, p.PortNameAR, p.PortTypeEN, p.PortTypeAR, p.ModeID, lat, lon}
+		}))
+	writeCSV(t, file(utils.ProductFactTable), []string{"year", "product_id", "port_id", "trade_type", "value"},
+		rows(f.ProductFacts, func(fact storetest.Fact) []any {
+			return []any{fact.Year, fact.ProductID, fact.PortID, fact.TradeType, fact.Value}
+		}))
+	writeCSV(t, file(utils.CountryFactTable), []string{"year", "country_id", "port_id", "trade_type", "value"},
+		rows(f.CountryFacts, func(fact storetest.Fact) []any {
+			return []any{fact.Year, fact.CountryID, fact.PortID, fact.TradeType, fact.Value}
+		}))
+	writeCSV(t, file("fact_yearly_summary"), []string{"year", "import_value", "export_value", "reexport_value", "tradebalance_value"},
+		rows(f.YearlySummary, func(s models.TradeSummary) []any {
+			return []any{s.Year, s.ImportValue, s.ExportValue, s.ReExportValue, s.TradeBalanceValue}
+		}))
+}
+
+func writeCSV(t *testing.T, path string, header []string, data [][]any) {
+	t.Helper()
+
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.Write(header)
+	for _, row := range data {
+		record := make([]string, len(row))
+		for i, v := range row {
+			record[i] = fmt.Sprint(v)
+		}
+		w.Write(record)
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func count(t *testing.T, pool *pgxpool.Pool, table string) int {
+	t.Helper()
+	var n int
+	if err := pool.QueryRow(context.Background(), "SELECT count(*) FROM "+table).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
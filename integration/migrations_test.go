@@ -0,0 +1,153 @@
+package integration
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"trade-api/store/migrations"
+)
+
+// TestMigrations applies every migration, reverts them all and applies them
+// again, so each down script must undo its up script exactly.
+func TestMigrations(t *testing.T) {
+	pool := newSchema(t)
+	ctx := context.Background()
+	all := migrations.All()
+
+	// Status only reads, so a database never migrated stays untouched
+	states, err := migrations.Status(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(states) != len(all) || states[0].AppliedAt != nil {
+		t.Errorf("status before any migration = %+v", states)
+	}
+	var created bool
+	if err := pool.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&created); err != nil || created {
+		t.Errorf("status created schema_migrations: %v, err %v", created, err)
+	}
+
+	// Concurrent runs, as from replicas starting together, apply each
+	// migration once
+	var wg sync.WaitGroup
+	applied := make([][]migrations.Migration, 3)
+	for i := range applied {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var err error
+			if applied[i], err = migrations.Up(ctx, pool); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	total := 0
+	for _, a := range applied {
+		total += len(a)
+	}
+	if total != len(all) {
+		t.Fatalf("concurrent runs applied %d migrations, want %d", total, len(all))
+	}
+
+	states, err = migrations.Status(ctx, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range states {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d %s is pending after up", s.Version, s.Name)
+		}
+	}
+
+	tables := func() int {
+		var n int
+		err := pool.QueryRow(ctx, `
+			SELECT count(*) FROM information_schema.tables
+			WHERE table_schema = current_schema() AND table_name <> 'schema_migrations'
+		`).Scan(&n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+	migrated := tables()
+
+	reverted, err := migrations.Down(ctx, pool, len(all)+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reverted) != len(all) || reverted[0].Version != len(all) {
+		t.Errorf("down reverted %+v", reverted)
+	}
+	if n := tables(); n != 0 {
+		t.Errorf("%d tables left after reverting every migration", n)
+	}
+
+	if _, err := migrations.Up(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	if n := tables(); n != migrated {
+		t.Errorf("re-applying created %d tables, want %d", n, migrated)
+	}
+}
+
+// TestMigrationsAdoptHandMadeSchema migrates a warehouse created by hand
+// before migrations existed, with rows, without the columns added since and
+// with a differently named summary key, and checks the first migration then
+// refuses to drop it.
+func TestMigrationsAdoptHandMadeSchema(t *testing.T) {
+	pool := newSchema(t)
+	ctx := context.Background()
+
+	_, err := pool.Exec(ctx, `
+		CREATE TABLE dim_product (product_id BIGINT PRIMARY KEY, product_desc_en TEXT NOT NULL, product_desc_ar TEXT NOT NULL);
+		CREATE TABLE dim_country (country_id BIGINT PRIMARY KEY, country_name_en TEXT NOT NULL, country_name_ar TEXT NOT NULL);
+		CREATE TABLE dim_port (
+			port_id BIGINT PRIMARY KEY, port_name_en TEXT NOT NULL, port_name_ar TEXT NOT NULL,
+			port_type_en TEXT NOT NULL, port_type_ar TEXT NOT NULL, mode_id INTEGER NOT NULL
+		);
+		CREATE TABLE fact_trade_by_product_port (
+			year INTEGER NOT NULL, product_id BIGINT NOT NULL REFERENCES dim_product,
+			port_id BIGINT NOT NULL REFERENCES dim_port, trade_type TEXT NOT NULL, value BIGINT NOT NULL
+		);
+		CREATE TABLE fact_trade_by_country_port (
+			year INTEGER NOT NULL, country_id BIGINT NOT NULL REFERENCES dim_country,
+			port_id BIGINT NOT NULL REFERENCES dim_port, trade_type TEXT NOT NULL, value BIGINT NOT NULL
+		);
+		CREATE TABLE fact_yearly_summary (
+			year INTEGER CONSTRAINT summary_year PRIMARY KEY,
+			import_value BIGINT, export_value BIGINT, reexport_value BIGINT, tradebalance_value BIGINT
+		);
+		INSERT INTO dim_country VALUES (1, 'Oman', 'عمان');
+		INSERT INTO fact_yearly_summary VALUES (2023, 10, 20, 5, 15);
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := migrations.Up(ctx, pool); err != nil {
+		t.Fatal(err)
+	}
+	var columns int
+	err = pool.QueryRow(ctx, `
+		SELECT count(*) FROM information_schema.columns
+		WHERE table_schema = current_schema()
+		  AND (table_name, column_name) IN (('dim_country', 'iso_code'), ('dim_port', 'latitude'), ('dim_port', 'longitude'))
+	`).Scan(&columns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if columns != 3 {
+		t.Errorf("found %d of the 3 columns added since the hand-made schema", columns)
+	}
+
+	if _, err := migrations.Down(ctx, pool, len(migrations.All())); err == nil {
+		t.Error("reverting every migration dropped a warehouse holding data")
+	}
+	var rows int
+	if err := pool.QueryRow(ctx, `SELECT count(*) FROM dim_country`).Scan(&rows); err != nil || rows != 1 {
+		t.Errorf("dim_country has %d rows after the refused revert, err %v", rows, err)
+	}
+}
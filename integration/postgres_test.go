@@ -0,0 +1,217 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// A TEST_DATABASE_URL must point at a database the tests may create and drop
+// schemas in. Without one the tests start a throwaway server with the local
+// initdb and pg_ctl binaries, or with Docker.
+const databaseURLEnv = "TEST_DATABASE_URL"
+
+const dockerImage = "postgres:16-alpine"
+
+// postgres is the server shared by every test in the package, started on
+// first use and stopped by TestMain.
+var postgres struct {
+	once sync.Once
+	url  string
+	stop func()
+	err  error
+}
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if postgres.stop != nil {
+		postgres.stop()
+	}
+	os.Exit(code)
+}
+
+// newSchema returns a pool whose connections use a new, empty schema, which
+// is dropped when the test finishes. The test is skipped when there is no
+// Postgres to run against.
+func newSchema(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	if testing.Short() {
+		t.Skip("skipping integration test in short mode")
+	}
+	postgres.once.Do(func() { postgres.url, postgres.stop, postgres.err = startPostgres() })
+	if errors.Is(postgres.err, errNoPostgres) {
+		t.Skip(postgres.err)
+	}
+	if postgres.err != nil {
+		t.Fatal(postgres.err)
+	}
+
+	ctx := context.Background()
+	name := pgx.Identifier{"trade_api_test_" + strconv.FormatInt(time.Now().UnixNano(), 36)}
+	exec := func(sql string) error {
+		conn, err := pgx.Connect(ctx, postgres.url)
+		if err != nil {
+			return err
+		}
+		defer conn.Close(ctx)
+		_, err = conn.Exec(ctx, sql)
+		return err
+	}
+	if err := exec("CREATE SCHEMA " + name.Sanitize()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if err := exec("DROP SCHEMA " + name.Sanitize() + " CASCADE"); err != nil {
+			t.Error(err)
+		}
+	})
+
+	config, err := pgxpool.ParseConfig(postgres.url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.ConnConfig.RuntimeParams["search_path"] = name[0]
+	pool, err := pgxpool.NewWithConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Registered after the drop, so it runs first
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+// startPostgres returns the URL of a running server and a function that stops
+// it, or errNoPostgres when there is no way to get one.
+func startPostgres() (url string, stop func(), err error) {
+	if url := os.Getenv(databaseURLEnv); url != "" {
+		return url, func() {}, nil
+	}
+	if bin, ok := postgresBinDir(); ok {
+		return startLocal(bin)
+	}
+	if path, err := exec.LookPath("docker"); err == nil && exec.Command(path, "info").Run() == nil {
+		return startDocker(path)
+	}
+	return "", nil, errNoPostgres
+}
+
+var errNoPostgres = errors.New("no Postgres available: set " + databaseURLEnv + ", or install Postgres or Docker")
+
+// postgresBinDir finds initdb on PATH or, as on Debian, in pg_config's bindir.
+func postgresBinDir() (string, bool) {
+	if path, err := exec.LookPath("initdb"); err == nil {
+		return filepath.Dir(path), true
+	}
+	out, err := exec.Command("pg_config", "--bindir").Output()
+	if err != nil {
+		return "", false
+	}
+	dir := strings.TrimSpace(string(out))
+	_, err = os.Stat(filepath.Join(dir, "initdb"))
+	return dir, err == nil
+}
+
+func startLocal(bin string) (string, func(), error) {
+	dir, err := os.MkdirTemp("", "trade-api-pg-")
+	if err != nil {
+		return "", nil, err
+	}
+	data := filepath.Join(dir, "data")
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	initdb := exec.Command(filepath.Join(bin, "initdb"), "-D", data, "-U", "postgres", "-A", "trust", "-E", "UTF8", "--locale=C")
+	if out, err := initdb.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("initdb: %v\n%s", err, out)
+	}
+
+	pgctl := filepath.Join(bin, "pg_ctl")
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off", port, dir)
+	start := exec.Command(pgctl, "-D", data, "-l", filepath.Join(dir, "log"), "-o", options, "-w", "start")
+	if out, err := start.CombinedOutput(); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, fmt.Errorf("pg_ctl start: %v\n%s", err, out)
+	}
+
+	stop := func() {
+		exec.Command(pgctl, "-D", data, "-m", "immediate", "stop").Run()
+		os.RemoveAll(dir)
+	}
+	url := fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port)
+	if err := waitReady(url); err != nil {
+		stop()
+		return "", nil, err
+	}
+	return url, stop, nil
+}
+
+func startDocker(docker string) (string, func(), error) {
+	out, err := exec.Command(docker, "run", "-d", "--rm", "-p", "127.0.0.1::5432",
+		"-e", "POSTGRES_PASSWORD=postgres", dockerImage).Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("docker run: %w", err)
+	}
+	id := strings.TrimSpace(string(out))
+	stop := func() { exec.Command(docker, "rm", "-f", id).Run() }
+
+	out, err = exec.Command(docker, "port", id, "5432/tcp").Output()
+	if err != nil {
+		stop()
+		return "", nil, fmt.Errorf("docker port: %w", err)
+	}
+	// The first line is the IPv4 binding, such as 127.0.0.1:49153
+	addr := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+
+	url := "postgres://postgres:postgres@" + addr + "/postgres?sslmode=disable"
+	if err := waitReady(url); err != nil {
+		stop()
+		return "", nil, err
+	}
+	return url, stop, nil
+}
+
+// waitReady polls until the server accepts connections and answers a query.
+func waitReady(url string) error {
+	deadline := time.Now().Add(60 * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		conn, err := pgx.Connect(ctx, url)
+		if err == nil {
+			_, err = conn.Exec(ctx, "SELECT 1")
+			conn.Close(ctx)
+		}
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("postgres not ready: %w", err)
+		}
+		time.Sleep(250 * time.Millisecond)
+	}
+}
+
+func freePort() (int, error) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port, nil
+}
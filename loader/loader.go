@@ -0,0 +1,417 @@
+// Package loader bulk-loads statistics authority exports into the warehouse.
+//
+// Each file listed in a Manifest is parsed in Go, copied with COPY into a
+// temporary staging table and validated there: duplicate keys, negative
+// values, unknown trade types and dimension IDs that are not in the
+// dimension being loaded or, failing that, already in the database. Only
+// when nothing is wrong are the production tables changed, all in one
+// transaction, so readers see either the old data or the new.
+//
+// Each load is a new release. Dimension files hold every member: rows are
+// inserted or updated, and members missing from the file are soft-deleted
+// with an entry in the admin audit trail. Fact
+// files replace the years they contain and leave other years alone; the rows
+// they change or drop are not deleted but closed at the new release, so
+// earlier releases can still be read. Changed countries and ports get a new
+// version in their history from the manifest's effective date.
+package loader
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"trade-api/models"
+	"trade-api/store"
+)
+
+// ErrRejected means validation found issues and nothing was changed. The
+// report lists the issues.
+var ErrRejected = errors.New("load rejected: the data has validation issues")
+
+type Options struct {
+	// DryRun validates and applies the load, reports the changes and then
+	// rolls everything back
+	DryRun bool
+}
+
+// staged is a table's parsed file.
+type staged struct {
+	*table
+	rows [][]any
+}
+
+type load struct {
+	ctx       context.Context
+	tx        pgx.Tx
+	dryRun    bool
+	report    *Report
+	staged    []*staged
+	release   int
+	effective time.Time
+}
+
+// Load runs the manifest. The report is returned whenever the files could be
+// read, including when the load is rejected or fails.
+func Load(ctx context.Context, db *pgxpool.Pool, m *Manifest, opts Options) (*Report, error) {
+	report := &Report{Source: m.Source, StartedAt: time.Now(), DryRun: opts.DryRun, Issues: []Issue{}}
+	defer func() { report.FinishedAt = time.Now() }()
+
+	l := &load{ctx: ctx, dryRun: opts.DryRun, report: report, effective: m.effective()}
+	if err := l.read(m); err != nil {
+		return nil, err
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback(ctx)
+	l.tx = tx
+
+	for _, s := range l.staged {
+		if err := l.stage(s); err != nil {
+			return report, fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+	if err := l.validate(); err != nil {
+		return report, err
+	}
+	if report.IssueCount > 0 {
+		return report, ErrRejected
+	}
+	if err := l.apply(); err != nil {
+		return report, err
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	report.FinishedAt = time.Now()
+	data, err := json.Marshal(report)
+	if err != nil {
+		return report, err
+	}
+	_, err = tx.Exec(ctx, `
+		INSERT INTO data_loads (source, started_at, finished_at, report, release_id)
+		VALUES ($1, $2, $3, $4, $5)
+	`, report.Source, report.StartedAt, report.FinishedAt, string(data), report.Release)
+	if err != nil {
+		return report, fmt.Errorf("unable to record load: %w", err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return report, err
+	}
+	report.Committed = true
+	return report, nil
+}
+
+// read parses every file in table order, so dimensions come before the facts
+// that reference them.
+func (l *load) read(m *Manifest) error {
+	for _, t := range tables {
+		i := slices.IndexFunc(m.Tables, func(ts TableSource) bool { return ts.Table == t.name })
+		if i < 0 {
+			continue
+		}
+		ts := m.Tables[i]
+		path := m.path(ts)
+
+		header, records, err := readFile(path, ts.Sheet, ts.HeaderRow)
+		if err != nil {
+			return fmt.Errorf("%s: %w", t.name, err)
+		}
+		indexes, err := columnIndexes(t, ts.Columns, header)
+		if err != nil {
+			return fmt.Errorf("%s: %s: %w", t.name, path, err)
+		}
+		rows, issues := parseRecords(t, indexes, records)
+		for _, issue := range issues {
+			l.report.addIssue(issue)
+		}
+		if len(records) == 0 {
+			l.report.addIssue(Issue{Table: t.name, Message: "the file has no data rows"})
+		}
+
+		l.staged = append(l.staged, &staged{table: t, rows: rows})
+		l.report.Tables = append(l.report.Tables, TableReport{Table: t.name, File: path, Rows: len(records)})
+	}
+	return nil
+}
+
+func (l *load) stage(s *staged) error {
+	if _, err := l.tx.Exec(l.ctx, s.stageDDL()); err != nil {
+		return err
+	}
+	_, err := l.tx.CopyFrom(l.ctx, pgx.Identifier{s.stage()}, append([]string{"_row"}, s.columnNames()...), pgx.CopyFromRows(s.rows))
+	return err
+}
+
+// loaded returns the staged table named name, or nil.
+func (l *load) loaded(name string) *staged {
+	for _, s := range l.staged {
+		if s.name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func (l *load) validate() error {
+	for _, s := range l.staged {
+		keys := strings.Join(s.key, ", ")
+		err := l.check(s.name, "", "duplicate key ("+keys+")", fmt.Sprintf(`
+			SELECT min(_row), concat_ws(', ', %s), 'on rows ' || string_agg(_row::text, ', ' ORDER BY _row)
+			FROM %s GROUP BY %s HAVING count(*) > 1 ORDER BY 1
+		`, keys, s.stage(), keys))
+		if err != nil {
+			return err
+		}
+
+		for _, c := range s.columns {
+			var err error
+			switch {
+			case c.nonNegative:
+				err = l.check(s.name, c.name, "value must not be negative", fmt.Sprintf(`
+					SELECT _row, %[1]s::text, '' FROM %[2]s WHERE %[1]s < 0 ORDER BY _row
+				`, c.name, s.stage()))
+			case c.name == "trade_type":
+				err = l.check(s.name, c.name, "unknown trade type (valid: "+strings.Join(models.TradeTypes, ", ")+")", fmt.Sprintf(`
+					SELECT _row, trade_type, '' FROM %s WHERE NOT (trade_type = ANY($1)) ORDER BY _row
+				`, s.stage()), models.TradeTypes)
+			case c.references != "":
+				err = l.check(s.name, c.name, "not in "+c.references, fmt.Sprintf(`
+					SELECT s._row, s.%[1]s::text, '' FROM %[2]s s
+					WHERE NOT EXISTS (SELECT 1 FROM %[3]s d WHERE d.%[1]s = s.%[1]s)
+					ORDER BY s._row
+				`, c.name, s.stage(), l.source(c.references)))
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		if s.dimension {
+			if err := l.checkStillReferenced(s); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// checkStillReferenced reports members missing from a dimension file that
+// fact rows use. Replaced fact rows are kept for earlier releases, so this
+// includes every version.
+func (l *load) checkStillReferenced(dim *staged) error {
+	key := dim.key[0]
+	for _, fact := range tables {
+		if !slices.ContainsFunc(fact.columns, func(c column) bool { return c.references == dim.name }) {
+			continue
+		}
+		err := l.check(dim.name, key, "missing from the file but used by "+fact.name, fmt.Sprintf(`
+			SELECT 0, f.%[1]s::text, '' FROM %[2]s f
+			WHERE NOT EXISTS (SELECT 1 FROM %[3]s d WHERE d.%[1]s = f.%[1]s)
+			GROUP BY f.%[1]s ORDER BY f.%[1]s
+		`, key, fact.name, dim.stage()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// source is the table that holds a dimension after the load: its staging
+// table when the load replaces it, otherwise the production table.
+func (l *load) source(dimension string) string {
+	if s := l.loaded(dimension); s != nil {
+		return s.stage()
+	}
+	return dimension
+}
+
+// check runs a query returning row, value and detail columns and reports
+// each result as an issue.
+func (l *load) check(table, column, message, query string, args ...any) error {
+	rows, err := l.tx.Query(l.ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("%s: validation query failed: %w", table, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row int
+		var value, detail string
+		if err := rows.Scan(&row, &value, &detail); err != nil {
+			return err
+		}
+		issue := Issue{Table: table, Row: row, Column: column, Value: value, Message: message}
+		if detail != "" {
+			issue.Message += " " + detail
+		}
+		l.report.addIssue(issue)
+	}
+	return rows.Err()
+}
+
+// apply changes production data in a new release. Dimensions go first, so
+// the fact rows can use new members. A dry run is rolled back, so it uses a
+// placeholder release rather than a number.
+func (l *load) apply() error {
+	var err error
+	if l.dryRun {
+		l.release, err = store.NewDryRunRelease(l.ctx, l.tx, l.report.Source)
+	} else {
+		l.release, err = store.NewRelease(l.ctx, l.tx, l.report.Source)
+		l.report.Release = l.release
+	}
+	if err != nil {
+		return fmt.Errorf("unable to create release: %w", err)
+	}
+
+	for _, s := range l.staged {
+		if !s.dimension {
+			continue
+		}
+		if err := l.upsert(s); err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+		if _, err := store.RecordHistory(l.ctx, l.tx, s.name, l.effective); err != nil {
+			return fmt.Errorf("%s: unable to record history: %w", s.name, err)
+		}
+	}
+
+	for _, s := range l.staged {
+		if s.dimension {
+			continue
+		}
+		if err := l.replaceYears(s); err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+
+	// Refresh planner statistics for the new data
+	for _, s := range l.staged {
+		if _, err := l.tx.Exec(l.ctx, "ANALYZE "+s.name); err != nil {
+			return fmt.Errorf("%s: %w", s.name, err)
+		}
+	}
+	return nil
+}
+
+// replaceYears makes a fact table's current rows in the years of its file
+// match the file. Changed and dropped rows are closed and counted as deleted;
+// unchanged rows are left alone.
+func (l *load) replaceYears(s *staged) error {
+	tr := l.report.table(s.name)
+	rows, err := l.tx.Query(l.ctx, fmt.Sprintf(`SELECT DISTINCT year FROM %s ORDER BY year`, s.stage()))
+	if err != nil {
+		return err
+	}
+	if tr.Years, err = pgx.CollectRows(rows, pgx.RowTo[int]); err != nil {
+		return err
+	}
+
+	var values []string
+	for _, c := range s.columnNames() {
+		if !slices.Contains(s.key, c) {
+			values = append(values, c)
+		}
+	}
+	tr.Deleted, tr.Inserted, err = store.ReplaceVersions(l.ctx, l.tx, store.Versioned{
+		Table:  s.name,
+		Stage:  s.stage(),
+		Key:    s.key,
+		Values: values,
+		Scope:  fmt.Sprintf("p.year IN (SELECT year FROM %s)", s.stage()),
+	}, l.release)
+	return err
+}
+
+// upsert makes a dimension table match its file. Unchanged rows are left
+// alone, so they are counted neither as inserted nor as updated. Members
+// missing from the file are soft-deleted, like an admin deletion, so facts
+// and the audit trail keep them; a later file that lists them again restores
+// them, unless an admin deleted them since.
+func (l *load) upsert(s *staged) error {
+	columns := strings.Join(s.columnNames(), ", ")
+	var sets, old, excluded []string
+	for _, c := range s.columnNames() {
+		sets = append(sets, c+" = EXCLUDED."+c)
+		old = append(old, s.name+"."+c)
+		excluded = append(excluded, "EXCLUDED."+c)
+	}
+	key := s.key[0]
+
+	rows, err := l.tx.Query(l.ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (%[2]s) SELECT %[2]s FROM %[3]s
+		ON CONFLICT (%[4]s) DO UPDATE SET %[5]s
+		WHERE (%[6]s) IS DISTINCT FROM (%[7]s)
+		RETURNING xmax = 0
+	`, s.name, columns, s.stage(), key, strings.Join(sets, ", "), strings.Join(old, ", "), strings.Join(excluded, ", ")))
+	if err != nil {
+		return err
+	}
+	inserted, err := pgx.CollectRows(rows, pgx.RowTo[bool])
+	if err != nil {
+		return err
+	}
+	tr := l.report.table(s.name)
+	for _, isNew := range inserted {
+		if isNew {
+			tr.Inserted++
+		} else {
+			tr.Updated++
+		}
+	}
+
+	if tr.RestoredIDs, err = l.audited(s, models.AuditRestore, fmt.Sprintf(`
+		UPDATE %[1]s p SET deleted_at = NULL
+		WHERE p.deleted_at IS NOT NULL
+		  AND EXISTS (SELECT 1 FROM %[2]s s WHERE s.%[3]s = p.%[3]s)
+		  AND (SELECT a.actor FROM dimension_audit a
+		       WHERE a.table_name = $1 AND a.member_id = p.%[3]s
+		       ORDER BY a.audit_id DESC LIMIT 1) LIKE '%[4]s%%'
+		RETURNING p.%[3]s, NULL::jsonb, to_jsonb(p) - 'deleted_at'
+	`, s.name, s.stage(), key, loadActor)); err != nil {
+		return err
+	}
+	if tr.DeletedIDs, err = l.audited(s, models.AuditDelete, fmt.Sprintf(`
+		UPDATE %[1]s p SET deleted_at = now()
+		WHERE p.deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM %[2]s s WHERE s.%[3]s = p.%[3]s)
+		RETURNING p.%[3]s, to_jsonb(p) - 'deleted_at', NULL::jsonb
+	`, s.name, s.stage(), key)); err != nil {
+		return err
+	}
+	tr.Deleted = int64(len(tr.DeletedIDs))
+	return nil
+}
+
+// loadActor prefixes the actor of the audit entries loads write, which tells
+// members a load deleted from those an admin deleted.
+const loadActor = "load: "
+
+// audited runs change, an UPDATE of a dimension table returning each changed
+// member's ID and its before and after images, records an audit entry with
+// action for every member and returns their IDs.
+func (l *load) audited(s *staged, action, change string) ([]int64, error) {
+	rows, err := l.tx.Query(l.ctx, `
+		WITH changed (member_id, before, after) AS (`+change+`),
+		audit AS (
+			INSERT INTO dimension_audit (table_name, member_id, action, actor, before, after)
+			SELECT $1, member_id, $2, $3, before, after FROM changed
+		)
+		SELECT member_id FROM changed ORDER BY member_id
+	`, s.name, action, loadActor+l.report.Source)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int64])
+}
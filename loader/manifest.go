@@ -0,0 +1,139 @@
+package loader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest describes one load: the file holding each table and how the
+// file's columns map to the table's. See load.example.yaml.
+type Manifest struct {
+	// Source names the release in reports and data_loads, such as
+	// "GASTAT 2024 Q3". It defaults to the manifest path.
+	Source string `yaml:"source"`
+	// EffectiveDate is the day the dimension changes in this load took
+	// effect, such as when a port was renamed, as YYYY-MM-DD. It dates the
+	// new versions in the country and port history and defaults to the day
+	// of the load.
+	EffectiveDate string        `yaml:"effective_date"`
+	Tables        []TableSource `yaml:"tables"`
+
+	// dir resolves relative file paths
+	dir string
+}
+
+// TableSource is the file for one table.
+type TableSource struct {
+	Table string `yaml:"table"`
+	// File is a .csv or .xlsx path, relative to the manifest
+	File string `yaml:"file"`
+	// Sheet selects an XLSX worksheet; the first sheet is the default
+	Sheet string `yaml:"sheet"`
+	// HeaderRow is the 1-based row holding column headers; data follows it
+	HeaderRow int `yaml:"header_row"`
+	// Columns maps table columns to file headers. Unmapped columns are
+	// read from a header with their own name.
+	Columns map[string]string `yaml:"columns"`
+}
+
+// ReadManifest parses and validates a manifest file.
+func ReadManifest(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifest: %w", err)
+	}
+	decoder := yaml.NewDecoder(strings.NewReader(string(data)))
+	decoder.KnownFields(true)
+
+	m := &Manifest{}
+	if err := decoder.Decode(m); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	if m.Source == "" {
+		m.Source = path
+	}
+	m.dir = filepath.Dir(path)
+	for i := range m.Tables {
+		if m.Tables[i].HeaderRow == 0 {
+			m.Tables[i].HeaderRow = 1
+		}
+	}
+
+	if err := m.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Validate reports every problem with the manifest at once.
+func (m *Manifest) Validate() error {
+	var errs []error
+	if len(m.Tables) == 0 {
+		errs = append(errs, errors.New("no tables to load"))
+	}
+
+	if m.EffectiveDate != "" {
+		if _, err := time.Parse(time.DateOnly, m.EffectiveDate); err != nil {
+			errs = append(errs, fmt.Errorf("effective_date must be YYYY-MM-DD, got %q", m.EffectiveDate))
+		}
+	}
+
+	seen := map[string]bool{}
+	for i, ts := range m.Tables {
+		where := fmt.Sprintf("tables[%d]", i)
+		t, err := lookupTable(ts.Table)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", where, err))
+			continue
+		}
+		where = ts.Table
+		if seen[ts.Table] {
+			errs = append(errs, fmt.Errorf("%s: listed more than once", where))
+		}
+		seen[ts.Table] = true
+
+		switch ext := strings.ToLower(filepath.Ext(ts.File)); {
+		case ts.File == "":
+			errs = append(errs, fmt.Errorf("%s: file is required", where))
+		case ext != ".csv" && ext != ".xlsx":
+			errs = append(errs, fmt.Errorf("%s: file must be .csv or .xlsx, got %s", where, ts.File))
+		case ext == ".csv" && ts.Sheet != "":
+			errs = append(errs, fmt.Errorf("%s: sheet only applies to .xlsx files", where))
+		}
+		if ts.HeaderRow < 1 {
+			errs = append(errs, fmt.Errorf("%s: header_row must be at least 1", where))
+		}
+		for col, header := range ts.Columns {
+			if !t.hasColumn(col) {
+				errs = append(errs, fmt.Errorf("%s: unknown column %q (columns: %s)", where, col, strings.Join(t.columnNames(), ", ")))
+			}
+			if strings.TrimSpace(header) == "" {
+				errs = append(errs, fmt.Errorf("%s: column %s maps to an empty header", where, col))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// effective is the day the load's dimension changes took effect.
+func (m *Manifest) effective() time.Time {
+	if day, err := time.Parse(time.DateOnly, m.EffectiveDate); err == nil {
+		return day
+	}
+	return time.Now()
+}
+
+// path resolves a table's file relative to the manifest.
+func (m *Manifest) path(ts TableSource) string {
+	if filepath.IsAbs(ts.File) {
+		return ts.File
+	}
+	return filepath.Join(m.dir, ts.File)
+}
@@ -0,0 +1,65 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadManifestExample(t *testing.T) {
+	m, err := ReadManifest(filepath.Join("..", "load.example.yaml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Source != "GASTAT 2024 Q3" || len(m.Tables) != 5 {
+		t.Errorf("got %+v", m)
+	}
+	if got := m.effective(); !got.Equal(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("effective = %s", got)
+	}
+	if got := m.path(m.Tables[0]); got != filepath.Join("..", "products.xlsx") {
+		t.Errorf("path = %s, want it relative to the manifest", got)
+	}
+	if m.Tables[0].HeaderRow != 1 || m.Tables[2].HeaderRow != 1 || m.Tables[3].HeaderRow != 3 {
+		t.Errorf("header rows = %d %d %d", m.Tables[0].HeaderRow, m.Tables[2].HeaderRow, m.Tables[3].HeaderRow)
+	}
+}
+
+func TestReadManifestReportsEveryError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "manifest.yaml")
+	manifest := `
+effective_date: 1 July 2024
+tables:
+  - table: dim_region
+    file: regions.csv
+  - table: dim_port
+    file: ports.txt
+  - table: dim_port
+    file: ports.csv
+    sheet: Ports
+    columns:
+      port_code: Code
+`
+	if err := os.WriteFile(path, []byte(manifest), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := ReadManifest(path)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, want := range []string{`unknown table "dim_region"`, "must be .csv or .xlsx", "more than once", "sheet only applies", `unknown column "port_code"`, "effective_date must be YYYY-MM-DD"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error does not mention %s: %v", want, err)
+		}
+	}
+
+	if err := os.WriteFile(path, []byte("tables: []\nextra: true\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ReadManifest(path); err == nil || !strings.Contains(err.Error(), "extra") {
+		t.Errorf("unknown key: err = %v", err)
+	}
+}
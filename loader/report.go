@@ -0,0 +1,153 @@
+package loader
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// maxIssues caps the issues a report lists; IssueCount still counts all.
+const maxIssues = 200
+
+// Report describes a load: what was read, what changed and what was wrong.
+// Release is the release the load created, which only exists once committed.
+type Report struct {
+	Source     string        `json:"source"`
+	StartedAt  time.Time     `json:"started_at"`
+	FinishedAt time.Time     `json:"finished_at"`
+	DryRun     bool          `json:"dry_run"`
+	Committed  bool          `json:"committed"`
+	Release    int           `json:"release,omitempty"`
+	Tables     []TableReport `json:"tables"`
+	IssueCount int           `json:"issue_count"`
+	Issues     []Issue       `json:"issues"`
+}
+
+// TableReport counts the rows read from a table's file and the changes made
+// to the table. Years lists the years a fact load replaced. Fact rows are
+// never deleted: Deleted counts the rows the load closed, because the file
+// changed or dropped them, and Inserted the new versions and new rows.
+// Dimension members are soft-deleted: DeletedIDs lists the members missing
+// from the file and RestoredIDs those an earlier load deleted that the file
+// lists again.
+type TableReport struct {
+	Table       string  `json:"table"`
+	File        string  `json:"file"`
+	Rows        int     `json:"rows"`
+	Years       []int   `json:"years,omitempty"`
+	Inserted    int64   `json:"inserted"`
+	Updated     int64   `json:"updated"`
+	Deleted     int64   `json:"deleted"`
+	DeletedIDs  []int64 `json:"deleted_ids,omitempty"`
+	RestoredIDs []int64 `json:"restored_ids,omitempty"`
+}
+
+// Issue is a validation failure. Row is the 1-based row in the source file,
+// or 0 when the issue is not tied to one row.
+type Issue struct {
+	Table   string `json:"table"`
+	Row     int    `json:"row,omitempty"`
+	Column  string `json:"column,omitempty"`
+	Value   string `json:"value,omitempty"`
+	Message string `json:"message"`
+}
+
+func (r *Report) addIssue(issue Issue) {
+	r.IssueCount++
+	if len(r.Issues) < maxIssues {
+		r.Issues = append(r.Issues, issue)
+	}
+}
+
+func (r *Report) table(name string) *TableReport {
+	for i := range r.Tables {
+		if r.Tables[i].Table == name {
+			return &r.Tables[i]
+		}
+	}
+	return nil
+}
+
+// WriteText writes the report for a terminal.
+func (r *Report) WriteText(w io.Writer) error {
+	status := "committed"
+	switch {
+	case r.IssueCount > 0:
+		status = "rejected, nothing changed"
+	case r.DryRun:
+		status = "dry run, nothing changed"
+	case !r.Committed:
+		status = "failed, nothing changed"
+	}
+	fmt.Fprintf(w, "Load %q: %s (%s)\n", r.Source, status, r.FinishedAt.Sub(r.StartedAt).Round(time.Millisecond))
+	if r.Committed {
+		fmt.Fprintf(w, "Release %d\n", r.Release)
+	}
+	fmt.Fprintln(w)
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "TABLE\tROWS\tINSERTED\tUPDATED\tDELETED\tYEARS\t")
+	for _, t := range r.Tables {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%s\t\n", t.Table, t.Rows, t.Inserted, t.Updated, t.Deleted, yearList(t.Years))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, t := range r.Tables {
+		if len(t.DeletedIDs) > 0 {
+			fmt.Fprintf(w, "%s: soft-deleted, missing from the file: %s\n", t.Table, idList(t.DeletedIDs))
+		}
+		if len(t.RestoredIDs) > 0 {
+			fmt.Fprintf(w, "%s: restored, back in the file: %s\n", t.Table, idList(t.RestoredIDs))
+		}
+	}
+
+	if r.IssueCount > 0 {
+		fmt.Fprintf(w, "\n%d issues", r.IssueCount)
+		if r.IssueCount > len(r.Issues) {
+			fmt.Fprintf(w, " (first %d shown)", len(r.Issues))
+		}
+		fmt.Fprintln(w, ":")
+		for _, issue := range r.Issues {
+			fmt.Fprintf(w, "  %s\n", issue)
+		}
+	}
+	return nil
+}
+
+func (i Issue) String() string {
+	var b strings.Builder
+	b.WriteString(i.Table)
+	if i.Row > 0 {
+		fmt.Fprintf(&b, " row %d", i.Row)
+	}
+	if i.Column != "" {
+		fmt.Fprintf(&b, " %s", i.Column)
+	}
+	if i.Value != "" {
+		fmt.Fprintf(&b, " %q", i.Value)
+	}
+	fmt.Fprintf(&b, ": %s", i.Message)
+	return b.String()
+}
+
+func yearList(years []int) string {
+	if len(years) == 0 {
+		return "-"
+	}
+	parts := make([]string, len(years))
+	for i, y := range years {
+		parts[i] = fmt.Sprint(y)
+	}
+	return strings.Join(parts, ",")
+}
+
+func idList(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = fmt.Sprint(id)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,194 @@
+package loader
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// record is a data row of a source file and its 1-based row number.
+type record struct {
+	row   int
+	cells []string
+}
+
+// readFile returns the header row and the non-blank data rows below it.
+func readFile(path, sheet string, headerRow int) ([]string, []record, error) {
+	var rows [][]string
+	var err error
+	if strings.EqualFold(filepath.Ext(path), ".xlsx") {
+		rows, err = readXLSX(path, sheet)
+	} else {
+		rows, err = readCSV(path)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(rows) < headerRow {
+		return nil, nil, fmt.Errorf("%s has no header row %d", path, headerRow)
+	}
+
+	var records []record
+	for i := headerRow; i < len(rows); i++ {
+		if !blank(rows[i]) {
+			records = append(records, record{row: i + 1, cells: rows[i]})
+		}
+	}
+	return rows[headerRow-1], records, nil
+}
+
+func readCSV(path string) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	var rows [][]string
+	for {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		rows = append(rows, row)
+	}
+	// Spreadsheet exports often start with a byte order mark
+	if len(rows) > 0 && len(rows[0]) > 0 {
+		rows[0][0] = strings.TrimPrefix(rows[0][0], "\ufeff")
+	}
+	return rows, nil
+}
+
+func readXLSX(path, sheet string) ([][]string, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if sheet == "" {
+		sheet = f.GetSheetName(0)
+	}
+	// Raw values, so numbers are not rounded or grouped by cell formats
+	rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rows, nil
+}
+
+func blank(cells []string) bool {
+	for _, c := range cells {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// columnIndexes finds the header position of each table column, matching
+// headers case-insensitively.
+func columnIndexes(t *table, mapping map[string]string, header []string) ([]int, error) {
+	positions := map[string]int{}
+	for i, h := range header {
+		positions[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+
+	indexes := make([]int, len(t.columns))
+	var missing []string
+	for i, c := range t.columns {
+		name := c.name
+		if mapped, ok := mapping[c.name]; ok {
+			name = mapped
+		}
+		pos, ok := positions[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			missing = append(missing, fmt.Sprintf("%s (header %q)", c.name, name))
+		}
+		indexes[i] = pos
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("missing columns: %s", strings.Join(missing, ", "))
+	}
+	return indexes, nil
+}
+
+// parseRecords converts records to staging rows, which start with the row
+// number, and reports cells that do not fit their column.
+func parseRecords(t *table, indexes []int, records []record) ([][]any, []Issue) {
+	var rows [][]any
+	var issues []Issue
+	for _, rec := range records {
+		row := []any{int32(rec.row)}
+		ok := true
+		for i, c := range t.columns {
+			var cell string
+			if indexes[i] < len(rec.cells) {
+				cell = strings.TrimSpace(rec.cells[indexes[i]])
+			}
+			v, err := parseCell(c, cell)
+			if err != nil {
+				issues = append(issues, Issue{Table: t.name, Row: rec.row, Column: c.name, Value: cell, Message: err.Error()})
+				ok = false
+			}
+			row = append(row, v)
+		}
+		if ok {
+			rows = append(rows, row)
+		}
+	}
+	return rows, issues
+}
+
+func parseCell(c column, cell string) (any, error) {
+	if cell == "" {
+		if c.nullable {
+			return nil, nil
+		}
+		return nil, errors.New("value is required")
+	}
+
+	switch c.typ {
+	case typeInt:
+		n, err := parseInteger(cell, 32)
+		return int32(n), err
+	case typeBigInt:
+		return parseInteger(cell, 64)
+	case typeFloat:
+		f, err := strconv.ParseFloat(cell, 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, errors.New("not a number")
+		}
+		return f, nil
+	default:
+		return cell, nil
+	}
+}
+
+// parseInteger accepts digit grouping commas, and whole numbers written as
+// decimals or in exponent form, as spreadsheets store them.
+func parseInteger(cell string, bits int) (int64, error) {
+	s := strings.ReplaceAll(cell, ",", "")
+	if n, err := strconv.ParseInt(s, 10, bits); err == nil {
+		return n, nil
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	limit := math.Ldexp(1, bits-1)
+	if err != nil || f != math.Trunc(f) || f < -limit || f >= limit {
+		return 0, errors.New("not a whole number")
+	}
+	return int64(f), nil
+}
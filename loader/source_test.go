@@ -0,0 +1,126 @@
+package loader
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadCSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "countries.csv")
+	data := "\ufeffExport of,,,\nCode,Name EN,Name AR,ISO\n10,China,الصين,CN\n,,,\n20,\"India, Republic of\",الهند,\n"
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	header, records, err := readFile(path, "", 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(header, []string{"Code", "Name EN", "Name AR", "ISO"}) {
+		t.Errorf("header = %q", header)
+	}
+	// The blank row 4 is skipped
+	if len(records) != 2 || records[0].row != 3 || records[1].row != 5 {
+		t.Fatalf("records = %+v", records)
+	}
+
+	mapping := map[string]string{"country_id": "code", "country_name_en": "NAME EN", "country_name_ar": "Name AR", "iso_code": "ISO"}
+	indexes, err := columnIndexes(lookup(t, "dim_country"), mapping, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, issues := parseRecords(lookup(t, "dim_country"), indexes, records)
+	want := [][]any{
+		{int32(3), int64(10), "China", "الصين", "CN"},
+		{int32(5), int64(20), "India, Republic of", "الهند", nil},
+	}
+	if len(issues) != 0 || !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, issues = %v", rows, issues)
+	}
+
+	if _, err := columnIndexes(lookup(t, "dim_country"), nil, header); err == nil {
+		t.Error("unmapped headers: expected missing columns")
+	}
+}
+
+func TestReadXLSX(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trade.xlsx")
+	f := excelize.NewFile()
+	f.NewSheet("Data")
+	cells := [][]any{
+		{"Year", "HS", "Port", "Type", "Value"},
+		{2023, 1, 100, "Export", 12345678901},
+		{2023, 2, 100, "Import", 1.5},
+		{"", 3, 100, "Import", 10},
+	}
+	for i, row := range cells {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := f.SetSheetRow("Data", cell, &row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := f.SaveAs(path); err != nil {
+		t.Fatal(err)
+	}
+
+	header, records, err := readFile(path, "Data", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fact := lookup(t, "fact_trade_by_product_port")
+	mapping := map[string]string{"year": "Year", "product_id": "HS", "port_id": "Port", "trade_type": "Type", "value": "Value"}
+	indexes, err := columnIndexes(fact, mapping, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows, issues := parseRecords(fact, indexes, records)
+
+	want := [][]any{{int32(2), int32(2023), int64(1), int64(100), "Export", int64(12345678901)}}
+	if !reflect.DeepEqual(rows, want) {
+		t.Errorf("rows = %v, want %v", rows, want)
+	}
+	wantIssues := []Issue{
+		{Table: fact.name, Row: 3, Column: "value", Value: "1.5", Message: "not a whole number"},
+		{Table: fact.name, Row: 4, Column: "year", Message: "value is required"},
+	}
+	if !reflect.DeepEqual(issues, wantIssues) {
+		t.Errorf("issues = %+v, want %+v", issues, wantIssues)
+	}
+}
+
+func TestParseInteger(t *testing.T) {
+	tests := []struct {
+		cell string
+		bits int
+		want int64
+		ok   bool
+	}{
+		{"42", 64, 42, true},
+		{"1,234,567", 64, 1234567, true},
+		{"1.2E+10", 64, 12000000000, true},
+		{"2023.0", 32, 2023, true},
+		{"-5", 64, -5, true},
+		{"3000000000", 32, 0, false},
+		{"1.5", 64, 0, false},
+		{"n/a", 64, 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseInteger(tt.cell, tt.bits)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseInteger(%q, %d) = %d, %v", tt.cell, tt.bits, got, err)
+		}
+	}
+}
+
+func lookup(t *testing.T, name string) *table {
+	t.Helper()
+	table, err := lookupTable(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return table
+}
@@ -0,0 +1,163 @@
+package loader
+
+import (
+	"fmt"
+	"strings"
+
+	"trade-api/utils"
+)
+
+type columnType int
+
+const (
+	typeInt columnType = iota
+	typeBigInt
+	typeFloat
+	typeText
+)
+
+func (t columnType) sql() string {
+	return [...]string{"INTEGER", "BIGINT", "DOUBLE PRECISION", "TEXT"}[t]
+}
+
+type column struct {
+	name     string
+	typ      columnType
+	nullable bool
+	// nonNegative rejects values below zero
+	nonNegative bool
+	// references names the dimension table whose key this column holds
+	references string
+}
+
+// table describes a warehouse table the loader can fill. Dimensions are
+// replaced as a whole; facts replace the years present in the file.
+type table struct {
+	name      string
+	dimension bool
+	columns   []column
+	key       []string
+}
+
+var tables = []*table{
+	{
+		name:      "dim_product",
+		dimension: true,
+		columns: []column{
+			{name: "product_id", typ: typeBigInt},
+			{name: "product_desc_en", typ: typeText},
+			{name: "product_desc_ar", typ: typeText},
+		},
+		key: []string{"product_id"},
+	},
+	{
+		name:      "dim_country",
+		dimension: true,
+		columns: []column{
+			{name: "country_id", typ: typeBigInt},
+			{name: "country_name_en", typ: typeText},
+			{name: "country_name_ar", typ: typeText},
+			{name: "iso_code", typ: typeText, nullable: true},
+		},
+		key: []string{"country_id"},
+	},
+	{
+		name:      "dim_port",
+		dimension: true,
+		columns: []column{
+			{name: "port_id", typ: typeBigInt},
+			{name: "port_name_en", typ: typeText},
+			{name: "port_name_ar", typ: typeText},
+			{name: "port_type_en", typ: typeText},
+			{name: "port_type_ar", typ: typeText},
+			{name: "mode_id", typ: typeInt},
+			{name: "latitude", typ: typeFloat, nullable: true},
+			{name: "longitude", typ: typeFloat, nullable: true},
+		},
+		key: []string{"port_id"},
+	},
+	{
+		name: utils.ProductFactTable,
+		columns: []column{
+			{name: "year", typ: typeInt},
+			{name: "product_id", typ: typeBigInt, references: "dim_product"},
+			{name: "port_id", typ: typeBigInt, references: "dim_port"},
+			{name: "trade_type", typ: typeText},
+			{name: "value", typ: typeBigInt, nonNegative: true},
+		},
+		key: []string{"year", "product_id", "port_id", "trade_type"},
+	},
+	{
+		name: utils.CountryFactTable,
+		columns: []column{
+			{name: "year", typ: typeInt},
+			{name: "country_id", typ: typeBigInt, references: "dim_country"},
+			{name: "port_id", typ: typeBigInt, references: "dim_port"},
+			{name: "trade_type", typ: typeText},
+			{name: "value", typ: typeBigInt, nonNegative: true},
+		},
+		key: []string{"year", "country_id", "port_id", "trade_type"},
+	},
+	{
+		name: "fact_yearly_summary",
+		columns: []column{
+			{name: "year", typ: typeInt},
+			{name: "import_value", typ: typeBigInt, nullable: true, nonNegative: true},
+			{name: "export_value", typ: typeBigInt, nullable: true, nonNegative: true},
+			{name: "reexport_value", typ: typeBigInt, nullable: true, nonNegative: true},
+			// The balance is negative whenever imports exceed exports
+			{name: "tradebalance_value", typ: typeBigInt, nullable: true},
+		},
+		key: []string{"year"},
+	},
+}
+
+// TableNames lists the tables a manifest may load, in load order.
+func TableNames() []string {
+	names := make([]string, len(tables))
+	for i, t := range tables {
+		names[i] = t.name
+	}
+	return names
+}
+
+func lookupTable(name string) (*table, error) {
+	for _, t := range tables {
+		if t.name == name {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown table %q (available: %s)", name, strings.Join(TableNames(), ", "))
+}
+
+func (t *table) columnNames() []string {
+	names := make([]string, len(t.columns))
+	for i, c := range t.columns {
+		names[i] = c.name
+	}
+	return names
+}
+
+func (t *table) hasColumn(name string) bool {
+	for _, c := range t.columns {
+		if c.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// stage is the name of the table's temporary staging table.
+func (t *table) stage() string {
+	return "stage_" + t.name
+}
+
+// stageDDL creates the staging table, which has a _row column holding the
+// source row number for error reports.
+func (t *table) stageDDL() string {
+	defs := []string{"_row INTEGER NOT NULL"}
+	for _, c := range t.columns {
+		defs = append(defs, c.name+" "+c.typ.sql())
+	}
+	return fmt.Sprintf("CREATE TEMP TABLE %s (%s) ON COMMIT DROP", t.stage(), strings.Join(defs, ", "))
+}
@@ -2,84 +2,93 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
+	"text/tabwriter"
 	"time"
 
-	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/compress"
-	"github.com/gofiber/fiber/v2/middleware/helmet"
-	"github.com/gofiber/fiber/v2/middleware/limiter"
-	"github.com/gofiber/fiber/v2/middleware/logger"
-	"github.com/gofiber/fiber/v2/middleware/recover"
-
 	"trade-api/config"
+	"trade-api/geo"
 	"trade-api/handlers"
-	"trade-api/middleware"
+	"trade-api/loader"
+	"trade-api/mcp"
+	"trade-api/models"
+	"trade-api/server"
+	"trade-api/store"
+	"trade-api/store/migrations"
+
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 func main() {
+	// An optional subcommand comes before any flags
+	args := os.Args[1:]
+	command := "serve"
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		command, args = args[0], args[1:]
+	}
+
+	cfg, opts, err := config.Load(args)
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	if opts.PrintConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			log.Fatalf("Failed to print configuration: %v", err)
+		}
+		return
+	}
+	geo.SetShapesFile(cfg.Geo.CountryShapesFile)
+
+	switch command {
+	case "serve":
+		serve(cfg)
+	case "mcp":
+		runMCP(cfg)
+	case "migrate":
+		runMigrate(cfg, opts.Args)
+	case "load":
+		runLoad(cfg, opts.Args)
+	case "rebuild-summary":
+		runRebuildSummary(cfg, opts.Args)
+	case "keys":
+		runKeys(cfg, opts.Args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q (available: serve, mcp, migrate, load, rebuild-summary, keys)\n", command)
+		os.Exit(2)
+	}
+}
+
+func serve(cfg *config.Config) {
 	// Initialize database connection
-	db, err := config.InitDB()
+	db, err := config.InitDB(cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 	defer db.Close()
 
-	// Create Fiber app
-	app := fiber.New(fiber.Config{
-		AppName:      "Trade Data Warehouse API v1.0",
-		ErrorHandler: customErrorHandler,
-	})
-
-	// Global middleware
-	app.Use(recover.New())
-	app.Use(helmet.New())
-	app.Use(compress.New())
-	app.Use(logger.New(logger.Config{
-		Format:     "${time} | ${status} | ${latency} | ${method} ${path}\n",
-		TimeFormat: "2006-01-02 15:04:05",
-	}))
-
-	// Rate limiting
-	app.Use(limiter.New(limiter.Config{
-		Max:        100,
-		Expiration: 1 * time.Minute,
-	}))
-
-	// Health check
-	app.Get("/health", func(c *fiber.Ctx) error {
-		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-		defer cancel()
-
-		if err := db.Ping(ctx); err != nil {
-			return c.Status(503).JSON(fiber.Map{"status": "unhealthy", "error": err.Error()})
-		}
-		return c.JSON(fiber.Map{"status": "healthy"})
-	})
-
-	// API routes
-	api := app.Group("/api/v1")
-
-	// Dimension endpoints
-	dimensions := api.Group("/dimensions")
-	dimensions.Get("/products", middleware.Cache(5*time.Minute), handlers.GetProducts(db))
-	dimensions.Get("/countries", middleware.Cache(5*time.Minute), handlers.GetCountries(db))
-	dimensions.Get("/ports", middleware.Cache(5*time.Minute), handlers.GetPorts(db))
-
-	// Trade endpoints
-	trade := api.Group("/trade")
-	trade.Get("/summary", handlers.GetTradeSummary(db))
-	trade.Get("/balance", handlers.GetTradeBalance(db))
-	trade.Post("/aggregate", handlers.AggregateTradeData(db))
+	if cfg.Database.AutoMigrate {
+		applied, err := migrations.Up(context.Background(), db)
+		if err != nil {
+			log.Fatalf("Failed to migrate database: %v", err)
+		}
+		for _, m := range applied {
+			log.Printf("Applied migration %d %s", m.Version, m.Name)
+		}
+	}
+
+	app := server.New(store.NewPostgres(db), cfg)
 
 	// Start server with graceful shutdown
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3000"
-	}
+	port := strconv.Itoa(cfg.Server.Port)
 
 	go func() {
 		if err := app.Listen(":" + port); err != nil {
@@ -95,25 +104,293 @@ func main() {
 	<-quit
 
 	log.Println("Shutting down server...")
-	if err := app.Shutdown(); err != nil {
+	if err := app.ShutdownWithTimeout(cfg.Server.ShutdownTimeout); err != nil {
 		log.Fatalf("Server forced to shutdown: %v", err)
 	}
 	log.Println("Server exited")
 }
 
-func customErrorHandler(c *fiber.Ctx, err error) error {
-	code := fiber.StatusInternalServerError
-	message := "Internal Server Error"
+// runMCP serves the Model Context Protocol over stdin/stdout. stdout carries
+// protocol messages only; logs go to stderr.
+func runMCP(cfg *config.Config) {
+	db, err := config.InitDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := mcp.NewServer(store.NewPostgres(db), cfg.Timeouts.Aggregate).ServeStdio(ctx, os.Stdin, os.Stdout); err != nil && ctx.Err() == nil {
+		log.Fatalf("MCP server failed: %v", err)
+	}
+}
+
+// runMigrate applies, reverts or lists schema migrations:
+//
+//	migrate up          apply every pending migration
+//	migrate down [n]    revert the latest n migrations (default 1)
+//	migrate status      list migrations and when each was applied
+func runMigrate(cfg *config.Config, args []string) {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "usage: migrate up | down [n] | status")
+		os.Exit(2)
+	}
+
+	db, err := initBatchDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch action := args[0]; action {
+	case "up":
+		applied, err := migrations.Up(ctx, db)
+		for _, m := range applied {
+			fmt.Printf("applied %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				log.Fatalf("down takes a positive number of steps, got %q", args[1])
+			}
+		}
+		reverted, err := migrations.Down(ctx, db, steps)
+		for _, m := range reverted {
+			fmt.Printf("reverted %d %s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+	case "status":
+		states, err := migrations.Status(ctx, db)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		applied := 0
+		for _, s := range states {
+			name, at := s.Name, "pending"
+			if name == "" {
+				name = "(unknown to this binary)"
+			}
+			if s.AppliedAt != nil {
+				at = s.AppliedAt.Format(time.RFC3339)
+				applied++
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", s.Version, name, at)
+		}
+		w.Flush()
+		if applied == 0 {
+			fmt.Println("No migrations applied")
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate action %q (available: up, down, status)\n", action)
+		os.Exit(2)
+	}
+}
+
+// runLoad loads the files listed in a manifest into the warehouse:
+//
+//	load <manifest.yaml> [-dry-run] [-report report.json]
+func runLoad(cfg *config.Config, args []string) {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fmt.Fprintln(os.Stderr, "usage: load <manifest.yaml> [-dry-run] [-report report.json]")
+		os.Exit(2)
+	}
+	fs := flag.NewFlagSet("load", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "validate and report the changes, then roll them back")
+	reportFile := fs.String("report", "", "also write the report as JSON to this file")
+	fs.Parse(args[1:])
+
+	manifest, err := loader.ReadManifest(args[0])
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	db, err := initBatchDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	report, err := loader.Load(ctx, db, manifest, loader.Options{DryRun: *dryRun})
+	if report != nil {
+		report.WriteText(os.Stdout)
+		if *reportFile != "" {
+			data, _ := json.MarshalIndent(report, "", "  ")
+			if err := os.WriteFile(*reportFile, data, 0o644); err != nil {
+				log.Printf("Failed to write report: %v", err)
+			}
+		}
+	}
+	if errors.Is(err, loader.ErrRejected) {
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatalf("Load failed: %v", err)
+	}
+}
+
+// runRebuildSummary recomputes fact_yearly_summary from the product fact
+// table and publishes it if the country fact table agrees within
+// summary.tolerance:
+//
+//	rebuild-summary          rebuild, reconcile and publish
+//	rebuild-summary check    rebuild and reconcile without publishing
+func runRebuildSummary(cfg *config.Config, args []string) {
+	if len(args) > 1 || (len(args) == 1 && args[0] != "check") {
+		fmt.Fprintln(os.Stderr, "usage: rebuild-summary [check]")
+		os.Exit(2)
+	}
+	dryRun := len(args) == 1
+
+	db, err := initBatchDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	rebuild, err := handlers.RebuildSummary(ctx, store.NewPostgres(db), cfg.Summary.Tolerance, dryRun)
+	if err != nil {
+		log.Fatalf("Rebuild failed: %v", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "YEAR\tTRADE TYPE\tPRODUCT TOTAL\tCOUNTRY TOTAL\tDIFFERENCE\t")
+	for _, r := range rebuild.Reconciliation {
+		mark := ""
+		if !r.WithinTolerance {
+			mark = "  exceeds tolerance"
+		}
+		fmt.Fprintf(w, "%d\t%s\t%d\t%d\t%.4f%%\t%s\n", r.Year, r.TradeType, r.ProductTotal, r.CountryTotal, r.RelativeDifference*100, mark)
+	}
+	w.Flush()
+
+	fmt.Println()
+	if len(rebuild.Changes) == 0 {
+		fmt.Println("The published summary already matches the facts.")
+	}
+	for _, c := range rebuild.Changes {
+		switch {
+		case c.Previous == nil:
+			fmt.Printf("%d: added\n", c.Year)
+		case c.Rebuilt == nil:
+			fmt.Printf("%d: removed, no facts\n", c.Year)
+		default:
+			fmt.Printf("%d: import %d -> %d, export %d -> %d, re-export %d -> %d, balance %d -> %d\n", c.Year,
+				c.Previous.ImportValue, c.Rebuilt.ImportValue, c.Previous.ExportValue, c.Rebuilt.ExportValue,
+				c.Previous.ReExportValue, c.Rebuilt.ReExportValue, c.Previous.TradeBalanceValue, c.Rebuilt.TradeBalanceValue)
+		}
+	}
+
+	fmt.Println()
+	switch {
+	case rebuild.Published:
+		fmt.Printf("Published the summary for %d years as release %d.\n", len(rebuild.Summary), rebuild.Release)
+	case rebuild.DryRun:
+		fmt.Println("Dry run, nothing published.")
+	default:
+		fmt.Printf("%d totals differ by more than %g; nothing published.\n", rebuild.Discrepancies, rebuild.Tolerance)
+		os.Exit(1)
+	}
+}
+
+// runKeys manages API keys:
+//
+//	keys create <name> <scope>...   create a key and print it, once
+//	keys list                       list keys and when each was last used
+//	keys revoke <id>                revoke a key
+func runKeys(cfg *config.Config, args []string) {
+	usage := func() {
+		fmt.Fprintf(os.Stderr, "usage: keys create <name> <scope>... | list | revoke <id>\nscopes: %s\n", strings.Join(models.Scopes, ", "))
+		os.Exit(2)
+	}
+	if len(args) == 0 {
+		usage()
+	}
+
+	db, err := config.InitDB(cfg.Database)
+	if err != nil {
+		log.Fatalf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	st := store.NewPostgres(db)
 
-	if e, ok := err.(*fiber.Error); ok {
-		code = e.Code
-		message = e.Message
+	switch action := args[0]; action {
+	case "create":
+		if len(args) < 3 {
+			usage()
+		}
+		key, err := handlers.CreateKey(ctx, st, args[1], args[2:])
+		if err != nil {
+			log.Fatalf("Failed to create the key: %v", err)
+		}
+		fmt.Printf("Created key %d (%s) with scopes %s.\n", key.KeyID, key.Prefix, strings.Join(key.Scopes, ", "))
+		fmt.Println("Store it now; it cannot be shown again:")
+		fmt.Println(key.Key)
+	case "list":
+		keys, err := st.Keys(ctx)
+		if err != nil {
+			log.Fatalf("Failed to list keys: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tCREATED\tLAST USED\tREVOKED")
+		for _, k := range keys {
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", k.KeyID, k.Name, k.Prefix, strings.Join(k.Scopes, ","),
+				k.CreatedAt.Format(time.RFC3339), formatTime(k.LastUsedAt, "never"), formatTime(k.RevokedAt, "-"))
+		}
+		w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			usage()
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			log.Fatalf("revoke takes a key ID, got %q", args[1])
+		}
+		if err := st.RevokeKey(ctx, id); err != nil {
+			log.Fatalf("Failed to revoke key %d: %v", id, err)
+		}
+		fmt.Printf("Revoked key %d. Servers stop accepting it within auth.cache_ttl (%s).\n", id, cfg.Auth.CacheTTL)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown keys action %q (available: create, list, revoke)\n", action)
+		os.Exit(2)
+	}
+}
+
+func formatTime(t *time.Time, none string) string {
+	if t == nil {
+		return none
 	}
+	return t.Format(time.RFC3339)
+}
 
-	return c.Status(code).JSON(fiber.Map{
-		"error":  message,
-		"code":   code,
-		"path":   c.Path(),
-		"method": c.Method(),
-	})
+// initBatchDB connects for the migrate, load and rebuild-summary commands,
+// without the statement_timeout meant for request queries: their copies,
+// index builds and full-table scans may run for longer.
+func initBatchDB(cfg config.DatabaseConfig) (*pgxpool.Pool, error) {
+	cfg.StatementTimeout = 0
+	return config.InitDB(cfg)
 }
@@ -0,0 +1,131 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+
+	"trade-api/problem"
+)
+
+const keepAliveInterval = 25 * time.Second
+
+// sseSession is one open SSE stream. ctx ends when the stream closes, which
+// cancels the calls still running for it.
+type sseSession struct {
+	ctx      context.Context
+	messages chan []byte
+}
+
+// StreamableHTTP handles POST /mcp: each JSON-RPC message gets its reply in
+// the response body. The server is stateless, so no session header is issued.
+func (s *Server) StreamableHTTP() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		reply := s.HandleMessage(c.UserContext(), c.Body())
+		if reply == nil {
+			return c.SendStatus(fiber.StatusAccepted)
+		}
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+		return c.Send(reply)
+	}
+}
+
+// SSE handles GET /mcp/sse for the HTTP+SSE transport. The first event tells
+// the client where to POST messages; replies arrive as "message" events.
+func (s *Server) SSE() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id, err := newSessionID()
+		if err != nil {
+			return problem.Internal(problem.CodeInternal, "Failed to create session", "تعذّر إنشاء الجلسة", err)
+		}
+		ctx, cancel := context.WithCancelCause(context.Background())
+		session := &sseSession{ctx: ctx, messages: make(chan []byte, 16)}
+
+		s.sessionsMu.Lock()
+		s.sessions[id] = session
+		s.sessionsMu.Unlock()
+
+		c.Set(fiber.HeaderContentType, "text/event-stream")
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderConnection, "keep-alive")
+		c.Set("X-Accel-Buffering", "no")
+
+		endpoint := fmt.Sprintf("%s/messages?session_id=%s", c.Path()[:len(c.Path())-len("/sse")], id)
+		c.Context().SetBodyStreamWriter(fasthttp.StreamWriter(func(w *bufio.Writer) {
+			defer func() {
+				s.sessionsMu.Lock()
+				delete(s.sessions, id)
+				s.sessionsMu.Unlock()
+				cancel(problem.ErrClientClosed)
+			}()
+
+			fmt.Fprintf(w, "event: endpoint\ndata: %s\n\n", endpoint)
+			if err := w.Flush(); err != nil {
+				return
+			}
+
+			ticker := time.NewTicker(keepAliveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case message := <-session.messages:
+					fmt.Fprintf(w, "event: message\ndata: %s\n\n", message)
+				case <-ticker.C:
+					fmt.Fprint(w, ": keep-alive\n\n")
+				}
+				// A failed flush means the client has gone away
+				if err := w.Flush(); err != nil {
+					return
+				}
+			}
+		}))
+		return nil
+	}
+}
+
+// Messages handles POST /mcp/messages for the HTTP+SSE transport.
+func (s *Server) Messages() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		s.sessionsMu.Lock()
+		session, ok := s.sessions[c.Query("session_id")]
+		s.sessionsMu.Unlock()
+		if !ok {
+			return &problem.Error{
+				Status:    fiber.StatusNotFound,
+				Code:      problem.CodeSessionNotFound,
+				Field:     "session_id",
+				Message:   "Unknown or expired session_id",
+				MessageAR: "معرّف الجلسة غير معروف أو منتهي الصلاحية",
+			}
+		}
+
+		// The request body is only valid until the handler returns
+		body := append([]byte(nil), c.Body()...)
+		go func() {
+			// The call outlives this request but not the stream its reply
+			// goes to; HandleMessage applies the call timeout
+			if reply := s.HandleMessage(session.ctx, body); reply != nil {
+				select {
+				case session.messages <- reply:
+				case <-session.ctx.Done():
+				}
+			}
+		}()
+
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+}
+
+func newSessionID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,344 @@
+package mcp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/handlers"
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+	"trade-api/tools"
+)
+
+// Server answers MCP requests from the store and the handlers package. It is
+// shared by the stdio and HTTP transports.
+type Server struct {
+	st          store.Store
+	callTimeout time.Duration
+
+	sessionsMu sync.Mutex
+	sessions   map[string]*sseSession
+}
+
+// NewServer answers from st, bounding each tool call and resource read by
+// callTimeout.
+func NewServer(st store.Store, callTimeout time.Duration) *Server {
+	return &Server{st: st, callTimeout: callTimeout, sessions: map[string]*sseSession{}}
+}
+
+var resources = []resource{
+	{
+		URI:         "trade://dimensions/products",
+		Name:        "products",
+		Description: "Every product with its English and Arabic description",
+		MimeType:    "application/json",
+	},
+	{
+		URI:         "trade://dimensions/countries",
+		Name:        "countries",
+		Description: "Every trading partner country with its English and Arabic name",
+		MimeType:    "application/json",
+	},
+	{
+		URI:         "trade://dimensions/ports",
+		Name:        "ports",
+		Description: "Every port of entry with its names, port type and mode",
+		MimeType:    "application/json",
+	},
+	{
+		URI:         "trade://metadata",
+		Name:        "metadata",
+		Description: "Years and trade types per fact table, port types, valid group_by and sort_by values and which dimensions combine",
+		MimeType:    "application/json",
+	},
+}
+
+// HandleMessage processes a JSON-RPC message or batch and returns the encoded
+// reply, or nil when the message only contained notifications.
+func (s *Server) HandleMessage(ctx context.Context, message []byte) []byte {
+	message = bytes.TrimSpace(message)
+	if len(message) > 0 && message[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(message, &batch); err != nil {
+			return encode(errorResponse(nil, codeParseError, "Parse error"))
+		}
+		replies := []response{}
+		for _, item := range batch {
+			if reply := s.handle(ctx, item); reply != nil {
+				replies = append(replies, *reply)
+			}
+		}
+		if len(replies) == 0 {
+			return nil
+		}
+		return encode(replies)
+	}
+
+	if reply := s.handle(ctx, message); reply != nil {
+		return encode(reply)
+	}
+	return nil
+}
+
+func (s *Server) handle(ctx context.Context, message []byte) (reply *response) {
+	var req request
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("MCP %s panic: %v", req.Method, r)
+			reply = errorResponse(req.ID, codeInternalError, "Internal error")
+		}
+	}()
+
+	if err := json.Unmarshal(message, &req); err != nil {
+		return errorResponse(nil, codeParseError, "Parse error")
+	}
+	if req.JSONRPC != "2.0" || req.Method == "" {
+		return errorResponse(req.ID, codeInvalidRequest, "Invalid request")
+	}
+
+	result, err := s.dispatch(ctx, req.Method, req.Params)
+
+	// Notifications never get a reply
+	if req.ID == nil {
+		return nil
+	}
+
+	if err != nil {
+		var rpcErr *rpcError
+		if errors.As(err, &rpcErr) {
+			return errorResponse(req.ID, rpcErr.Code, rpcErr.Message)
+		}
+		log.Printf("MCP %s error: %v", req.Method, err)
+		return errorResponse(req.ID, codeInternalError, "Internal error")
+	}
+	return &response{JSONRPC: "2.0", ID: req.ID, Result: result}
+}
+
+func (s *Server) dispatch(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "initialize":
+		var p initializeParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		version := protocolVersions[0]
+		if slices.Contains(protocolVersions, p.ProtocolVersion) {
+			version = p.ProtocolVersion
+		}
+		return initializeResult{
+			ProtocolVersion: version,
+			Capabilities: map[string]interface{}{
+				"tools":     map[string]interface{}{},
+				"resources": map[string]interface{}{},
+			},
+			ServerInfo: implementation{Name: "trade-api", Version: "1.0"},
+			Instructions: "Trade statistics by product, country, port, year and trade type. " +
+				"Resolve names to IDs with the search tools or the dimension resources before filtering aggregate_trade.",
+		}, nil
+
+	case "ping":
+		return struct{}{}, nil
+
+	case "notifications/initialized", "notifications/cancelled":
+		return nil, nil
+
+	case "tools/list":
+		list := []tool{}
+		for _, t := range tools.Definitions() {
+			list = append(list, tool{Name: t.Name, Description: t.Description, InputSchema: t.Parameters})
+		}
+		return map[string]interface{}{"tools": list}, nil
+
+	case "tools/call":
+		var p callToolParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.callTool(ctx, p)
+
+	case "resources/list":
+		return map[string]interface{}{"resources": resources}, nil
+
+	case "resources/templates/list":
+		return map[string]interface{}{"resourceTemplates": []interface{}{}}, nil
+
+	case "resources/read":
+		var p readResourceParams
+		if err := decodeParams(params, &p); err != nil {
+			return nil, err
+		}
+		return s.readResource(ctx, p.URI)
+	}
+
+	return nil, &rpcError{Code: codeMethodNotFound, Message: "Method not found: " + method}
+}
+
+func (s *Server) callTool(ctx context.Context, p callToolParams) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.callTimeout)
+	defer cancel()
+
+	var args struct {
+		Search      string `json:"search"`
+		PortType    string `json:"port_type"`
+		Limit       int    `json:"limit"`
+		StartYear   int    `json:"start_year"`
+		EndYear     int    `json:"end_year"`
+		AsOfRelease int    `json:"as_of_release"`
+	}
+	if p.Name != "aggregate_trade" {
+		if err := decodeParams(p.Arguments, &args); err != nil {
+			return nil, err
+		}
+		// Same as the HTTP search endpoints
+		if args.Limit <= 0 {
+			args.Limit = models.DefaultSearchLimit
+		}
+		args.Limit = min(args.Limit, models.MaxSearchLimit)
+	}
+
+	var result interface{}
+	var err error
+	switch p.Name {
+	case "search_products":
+		result, err = s.st.Products(ctx, args.Search, args.Limit)
+	case "search_countries":
+		result, err = s.st.Countries(ctx, args.Search, args.Limit)
+	case "search_ports":
+		result, err = s.st.Ports(ctx, args.Search, args.PortType, args.Limit)
+	case "get_trade_summary":
+		if err = validateSummaryArgs(ctx, s.st, args.StartYear, args.EndYear, args.AsOfRelease); err == nil {
+			result, err = s.st.YearlySummary(ctx, args.StartYear, args.EndYear, args.AsOfRelease)
+		}
+	case "get_trade_balance":
+		if err = validateSummaryArgs(ctx, s.st, args.StartYear, args.EndYear, args.AsOfRelease); err == nil {
+			result, err = s.st.Balance(ctx, args.StartYear, args.EndYear, args.AsOfRelease)
+		}
+	case "aggregate_trade":
+		var req *models.AggregateRequest
+		if req, err = handlers.ParseAggregateRequest(ctx, s.st, p.Arguments); err == nil {
+			var results []models.AggregateResult
+			var meta models.PaginationMeta
+			results, meta, err = handlers.RunAggregate(ctx, s.st, req)
+			result = models.PaginatedResponse{
+				Data:             results,
+				Pagination:       meta,
+				QueryDescription: handlers.DescribeAggregate(req),
+			}
+		}
+	default:
+		return nil, &rpcError{Code: codeInvalidParams, Message: "Unknown tool: " + p.Name}
+	}
+
+	if err != nil {
+		// The result has no reader once the client has gone
+		if problem.ClientClosed(ctx) {
+			return toolError("The client closed the connection."), nil
+		}
+		// Tool failures are reported in the result so the model can correct
+		// itself, including timeouts, whose message says how to narrow the query
+		if e := problem.From(err); e.Status < fiber.StatusInternalServerError || e.Code == problem.CodeQueryTimeout {
+			return toolError(toolErrorText(e)), nil
+		}
+		log.Printf("MCP tool %s error: %v", p.Name, err)
+		return toolError("The query failed. Try again or narrow it down."), nil
+	}
+
+	text, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return callToolResult{Content: []content{{Type: "text", Text: string(text)}}}, nil
+}
+
+// validateSummaryArgs checks the arguments of the summary and balance tools.
+func validateSummaryArgs(ctx context.Context, trade store.TradeStore, startYear, endYear, release int) error {
+	if err := handlers.ValidateYearRange(startYear, endYear); err != nil {
+		return err
+	}
+	return handlers.ValidateRelease(ctx, trade, release)
+}
+
+func (s *Server) readResource(ctx context.Context, uri string) (interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.callTimeout)
+	defer cancel()
+
+	var result interface{}
+	var err error
+	switch uri {
+	case "trade://dimensions/products":
+		result, err = s.st.Products(ctx, "", 0)
+	case "trade://dimensions/countries":
+		result, err = s.st.Countries(ctx, "", 0)
+	case "trade://dimensions/ports":
+		result, err = s.st.Ports(ctx, "", "", 0)
+	case "trade://metadata":
+		result, err = handlers.QueryMetadata(ctx, s.st)
+	default:
+		return nil, &rpcError{Code: codeInvalidParams, Message: "Unknown resource: " + uri}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	text, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"contents": []resourceContents{{URI: uri, MimeType: "application/json", Text: string(text)}},
+	}, nil
+}
+
+func toolError(message string) callToolResult {
+	return callToolResult{Content: []content{{Type: "text", Text: message}}, IsError: true}
+}
+
+// toolErrorText lists every validation error so the model can fix them all
+// in one retry.
+func toolErrorText(e *problem.Error) string {
+	if len(e.Errors) <= 1 {
+		return e.Code + ": " + e.Message
+	}
+	lines := []string{e.Message + ":"}
+	for _, fe := range e.Errors {
+		lines = append(lines, fmt.Sprintf("- %s %s: %s", fe.Code, fe.Field, fe.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func decodeParams(params json.RawMessage, v interface{}) error {
+	if len(params) == 0 || string(params) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(params, v); err != nil {
+		return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf("Invalid params: %v", err)}
+	}
+	return nil
+}
+
+func errorResponse(id json.RawMessage, code int, message string) *response {
+	if id == nil {
+		id = json.RawMessage("null")
+	}
+	return &response{JSONRPC: "2.0", ID: id, Error: &rpcError{Code: code, Message: message}}
+}
+
+func encode(v interface{}) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("MCP encode error: %v", err)
+		return nil
+	}
+	return data
+}
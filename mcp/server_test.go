@@ -0,0 +1,212 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store/storetest"
+)
+
+// call sends one JSON-RPC request and decodes its result into v.
+func call(t *testing.T, s *Server, method string, params string, v interface{}) {
+	t.Helper()
+
+	message := `{"jsonrpc":"2.0","id":1,"method":"` + method + `","params":` + params + `}`
+	var reply struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.Unmarshal(s.HandleMessage(context.Background(), []byte(message)), &reply); err != nil {
+		t.Fatal(err)
+	}
+	if reply.Error != nil {
+		t.Fatalf("%s: error %d %s", method, reply.Error.Code, reply.Error.Message)
+	}
+	if err := json.Unmarshal(reply.Result, v); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestToolsCall(t *testing.T) {
+	s := NewServer(storetest.New(), time.Minute)
+
+	tests := []struct {
+		name      string
+		arguments string
+		contains  string
+		isError   bool
+	}{
+		{"search_products", `{"search":"dates"}`, `"product_id":2`, false},
+		{"search_countries", `{"search":"india"}`, `"iso_code":"IN"`, false},
+		{"search_ports", `{"port_type":"Land"}`, `"port_id":300`, false},
+		{"get_trade_summary", `{"start_year":2023,"end_year":2023}`, `"total_trade_value":2370`, false},
+		{"get_trade_balance", `{"start_year":2021,"end_year":2023}`, `"trade_balance":2000`, false},
+		{"aggregate_trade", `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["trade_type"]}`, `"total_value":4050`, false},
+		{"aggregate_trade", `{"date_range":{"start_year":2021,"end_year":2023},"group_by":["product","country"]}`, "INCOMPATIBLE_DIMENSIONS", true},
+		{"get_trade_balance", `{}`, "MISSING_DATE_RANGE", true},
+	}
+	for _, tt := range tests {
+		var result callToolResult
+		call(t, s, "tools/call", `{"name":"`+tt.name+`","arguments":`+tt.arguments+`}`, &result)
+
+		if result.IsError != tt.isError || len(result.Content) != 1 || !strings.Contains(result.Content[0].Text, tt.contains) {
+			t.Errorf("%s %s: got %+v, want %q", tt.name, tt.arguments, result, tt.contains)
+		}
+	}
+}
+
+// limitStore records the limit of the last product search.
+type limitStore struct {
+	*storetest.Memory
+	limit int
+}
+
+func (l *limitStore) Products(ctx context.Context, search string, limit int) ([]models.Product, error) {
+	l.limit = limit
+	return l.Memory.Products(ctx, search, limit)
+}
+
+func TestSearchLimit(t *testing.T) {
+	st := &limitStore{Memory: storetest.New()}
+	s := NewServer(st, time.Minute)
+
+	for arguments, want := range map[string]int{
+		`{}`:             models.DefaultSearchLimit,
+		`{"limit":0}`:    models.DefaultSearchLimit,
+		`{"limit":7}`:    7,
+		`{"limit":1000}`: models.MaxSearchLimit,
+	} {
+		var result callToolResult
+		call(t, s, "tools/call", `{"name":"search_products","arguments":`+arguments+`}`, &result)
+		if st.limit != want {
+			t.Errorf("%s: limit %d, want %d", arguments, st.limit, want)
+		}
+	}
+}
+
+func TestResourcesRead(t *testing.T) {
+	s := NewServer(storetest.New(), time.Minute)
+
+	for _, r := range resources {
+		var result struct {
+			Contents []resourceContents `json:"contents"`
+		}
+		call(t, s, "resources/read", `{"uri":"`+r.URI+`"}`, &result)
+
+		if len(result.Contents) != 1 || !json.Valid([]byte(result.Contents[0].Text)) {
+			t.Errorf("%s: got %+v", r.URI, result)
+		}
+	}
+}
+
+func TestHTTPTransport(t *testing.T) {
+	s := NewServer(storetest.New(), time.Minute)
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			return c.SendStatus(problem.From(err).Status)
+		},
+	})
+	app.Post("/mcp", s.StreamableHTTP())
+	app.Post("/mcp/messages", s.Messages())
+
+	resp, err := app.Test(httptest.NewRequest("POST", "/mcp",
+		strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var reply struct {
+		Result struct {
+			Tools []tool `json:"tools"`
+		} `json:"result"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&reply); err != nil {
+		t.Fatal(err)
+	}
+	if len(reply.Result.Tools) == 0 {
+		t.Error("tools/list returned no tools")
+	}
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/mcp",
+		strings.NewReader(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Errorf("notification status = %d, want 202", resp.StatusCode)
+	}
+
+	resp, err = app.Test(httptest.NewRequest("POST", "/mcp/messages?session_id=unknown",
+		strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusNotFound {
+		t.Errorf("unknown session status = %d, want 404", resp.StatusCode)
+	}
+}
+
+// blockingStore holds summary reads until their context ends and reports why
+// it ended.
+type blockingStore struct {
+	*storetest.Memory
+	ended chan error
+}
+
+func (b *blockingStore) YearlySummary(ctx context.Context, startYear, endYear, release int) ([]models.TradeSummary, error) {
+	<-ctx.Done()
+	b.ended <- ctx.Err()
+	return nil, ctx.Err()
+}
+
+func TestCallTimeout(t *testing.T) {
+	st := &blockingStore{Memory: storetest.New(), ended: make(chan error, 1)}
+	s := NewServer(st, 20*time.Millisecond)
+
+	var result callToolResult
+	call(t, s, "tools/call", `{"name":"get_trade_summary","arguments":{"start_year":2021,"end_year":2023}}`, &result)
+	if !result.IsError || len(result.Content) != 1 || !strings.Contains(result.Content[0].Text, problem.CodeQueryTimeout) {
+		t.Errorf("got %+v, want %s", result, problem.CodeQueryTimeout)
+	}
+	if err := <-st.ended; !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("store context ended with %v", err)
+	}
+}
+
+func TestSSECallsEndWithStream(t *testing.T) {
+	st := &blockingStore{Memory: storetest.New(), ended: make(chan error, 1)}
+	s := NewServer(st, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s.sessions["open"] = &sseSession{ctx: ctx, messages: make(chan []byte, 1)}
+
+	app := fiber.New()
+	app.Post("/mcp/messages", s.Messages())
+	resp, err := app.Test(httptest.NewRequest("POST", "/mcp/messages?session_id=open", strings.NewReader(
+		`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"get_trade_summary","arguments":{"start_year":2021,"end_year":2023}}}`)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != fiber.StatusAccepted {
+		t.Fatalf("status %d", resp.StatusCode)
+	}
+
+	// Closing the stream cancels the call, well before the call timeout
+	cancel()
+	select {
+	case err := <-st.ended:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("store context ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("call still running after its stream closed")
+	}
+}
@@ -0,0 +1,36 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"io"
+)
+
+// maxMessageSize bounds a single newline-delimited stdio message.
+const maxMessageSize = 4 << 20
+
+// ServeStdio reads newline-delimited JSON-RPC messages from r and writes
+// replies to w until r is closed or ctx is cancelled. Logs must go to stderr.
+func (s *Server) ServeStdio(ctx context.Context, r io.Reader, w io.Writer) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxMessageSize)
+
+	for scanner.Scan() {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			continue
+		}
+
+		reply := s.HandleMessage(ctx, line)
+		if reply == nil {
+			continue
+		}
+		if _, err := w.Write(append(reply, '\n')); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
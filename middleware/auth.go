@@ -0,0 +1,240 @@
+package middleware
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/apikey"
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store"
+)
+
+const principalLocalKey = "principal"
+
+// publicPaths answer every request, with or without a key.
+var publicPaths = []string{"/health", "/openapi.json", "/docs"}
+
+// anonymousScopes are what requests without a key may do while keys are
+// not required.
+var anonymousScopes = []string{models.ScopeReadDimensions, models.ScopeReadTrade, models.ScopeExport}
+
+// Principal is who made a request and what it may do.
+type Principal struct {
+	// Name is the key's name and prefix, "admin" for the admin token, or
+	// empty for an anonymous request.
+	Name   string
+	Scopes []string
+}
+
+// AuthConfig configures Auth. AdminToken, when set, is accepted as a key
+// with every scope. Required rejects requests without a key; otherwise they
+// get the read and export scopes. CacheTTL is how long a key looked up is
+// trusted before it is read again, which is also how often its last use is
+// recorded.
+type AuthConfig struct {
+	AdminToken string
+	Required   bool
+	CacheTTL   time.Duration
+}
+
+// Auth authenticates requests by the API key in X-API-Key, or an
+// Authorization bearer header. The admin token may also come in
+// X-Admin-Token. Routes then check the principal's scopes with
+// RequireScope.
+type Auth struct {
+	keys store.KeyStore
+	cfg  AuthConfig
+
+	mu    sync.Mutex
+	cache map[string]*cachedKey
+}
+
+type cachedKey struct {
+	key     *models.APIKey
+	loaded  time.Time
+	touched time.Time
+}
+
+func NewAuth(keys store.KeyStore, cfg AuthConfig) *Auth {
+	return &Auth{keys: keys, cfg: cfg, cache: map[string]*cachedKey{}}
+}
+
+// Forget drops every key looked up, so a revoked key stops working at once.
+func (a *Auth) Forget() {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	clear(a.cache)
+}
+
+// Handler rejects requests with a key that is unknown or revoked, and
+// requests without one when keys are required, except to public paths.
+func (a *Auth) Handler() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if slices.Contains(publicPaths, c.Path()) {
+			return c.Next()
+		}
+
+		p := &Principal{}
+		if !a.cfg.Required {
+			p.Scopes = anonymousScopes
+		}
+		presented := credential(c)
+		switch {
+		case presented == "":
+			if a.cfg.Required {
+				return problem.New(fiber.StatusUnauthorized, problem.CodeAuthRequired,
+					"An API key is required; send it in the X-API-Key header", "يلزم مفتاح API؛ أرسله في الترويسة X-API-Key")
+			}
+		case a.cfg.AdminToken != "" && subtle.ConstantTimeCompare([]byte(presented), []byte(a.cfg.AdminToken)) == 1:
+			p = &Principal{Name: "admin", Scopes: models.Scopes}
+		default:
+			key, err := a.verify(c.UserContext(), presented)
+			if err != nil {
+				return problem.Internal(problem.CodeQueryFailed, "Failed to check the API key", "تعذّر التحقق من مفتاح API", err)
+			}
+			if key == nil {
+				return problem.New(fiber.StatusUnauthorized, problem.CodeInvalidAPIKey,
+					"The API key is invalid or revoked", "مفتاح API غير صالح أو ملغى")
+			}
+			scopes := slices.Clone(p.Scopes)
+			for _, s := range key.Scopes {
+				if !slices.Contains(scopes, s) {
+					scopes = append(scopes, s)
+				}
+			}
+			p = &Principal{Name: fmt.Sprintf("%s (%s)", key.Name, key.Prefix), Scopes: scopes}
+		}
+		c.Locals(principalLocalKey, p)
+		return c.Next()
+	}
+}
+
+// credential returns the key or token the request presents. Authorization
+// headers with another scheme than Bearer, such as Basic credentials meant
+// for a proxy, present nothing.
+func credential(c *fiber.Ctx) string {
+	for _, header := range []string{"X-API-Key", "X-Admin-Token"} {
+		if v := c.Get(header); v != "" {
+			return v
+		}
+	}
+	scheme, token, ok := strings.Cut(c.Get(fiber.HeaderAuthorization), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// verify returns the active key presented is, or nil. Keys are read at most
+// once per CacheTTL, and their last use recorded as often.
+func (a *Auth) verify(ctx context.Context, presented string) (*models.APIKey, error) {
+	prefix, ok := apikey.Prefix(presented)
+	if !ok {
+		return nil, nil
+	}
+	now := time.Now()
+
+	a.mu.Lock()
+	entry := a.cache[prefix]
+	a.mu.Unlock()
+	if entry == nil || now.Sub(entry.loaded) >= a.cfg.CacheTTL {
+		key, err := a.keys.KeyByPrefix(ctx, prefix)
+		if errors.Is(err, store.ErrKeyNotFound) {
+			// Unknown prefixes are not cached, so made-up keys cannot fill
+			// the cache
+			return nil, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry = &cachedKey{key: key, loaded: now}
+		a.mu.Lock()
+		if old := a.cache[prefix]; old != nil {
+			entry.touched = old.touched
+		}
+		a.cache[prefix] = entry
+		a.mu.Unlock()
+	}
+
+	key := entry.key
+	if key.RevokedAt != nil || !apikey.Matches(presented, key.Hash) {
+		return nil, nil
+	}
+
+	a.mu.Lock()
+	touch := now.Sub(entry.touched) >= a.cfg.CacheTTL
+	if touch {
+		entry.touched = now
+	}
+	a.mu.Unlock()
+	if touch {
+		if err := a.keys.TouchKey(ctx, key.KeyID, now); err != nil {
+			log.Printf("Failed to record the use of API key %s: %v", key.Prefix, err)
+		}
+	}
+	return key, nil
+}
+
+func principal(c *fiber.Ctx) *Principal {
+	p, _ := c.Locals(principalLocalKey).(*Principal)
+	if p == nil {
+		return &Principal{}
+	}
+	return p
+}
+
+// HasScope reports whether the request may use scope.
+func HasScope(c *fiber.Ctx, scope string) bool {
+	return slices.Contains(principal(c).Scopes, scope)
+}
+
+// RequireScope rejects requests without every one of scopes.
+func RequireScope(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, scope := range scopes {
+			if !HasScope(c, scope) {
+				return ScopeError(scope)
+			}
+		}
+		return c.Next()
+	}
+}
+
+// ScopeError is the error for a request without scope.
+func ScopeError(scope string) error {
+	return problem.New(fiber.StatusForbidden, problem.CodeScopeRequired,
+		fmt.Sprintf("This request needs an API key with the %s scope", scope),
+		fmt.Sprintf("يتطلب هذا الطلب مفتاح API بصلاحية %s", scope))
+}
+
+// IsAdmin reports whether the request has the admin scope, which admin-only
+// options check.
+func IsAdmin(c *fiber.Ctx) bool {
+	return HasScope(c, models.ScopeAdmin)
+}
+
+// RequireAdmin rejects requests without the admin scope.
+func RequireAdmin() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !IsAdmin(c) {
+			return problem.New(fiber.StatusForbidden, problem.CodeAdminRequired,
+				"Admin permission required", "يتطلب هذا الإجراء صلاحية المشرف")
+		}
+		return c.Next()
+	}
+}
+
+// Actor names who made an admin request in audit trails.
+func Actor(c *fiber.Ctx) string {
+	return principal(c).Name
+}
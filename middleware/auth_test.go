@@ -0,0 +1,129 @@
+package middleware_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/apikey"
+	"trade-api/middleware"
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/store/storetest"
+)
+
+// newKey stores a key with scopes and returns it.
+func newKey(t *testing.T, st *storetest.Memory, name string, scopes ...string) string {
+	t.Helper()
+	key, prefix, err := apikey.Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.CreateKey(context.Background(), &models.APIKey{Name: name, Prefix: prefix, Hash: apikey.Hash(key), Scopes: scopes}); err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestAuthCredentials(t *testing.T) {
+	st := storetest.New()
+	key := newKey(t, st, "dashboard", models.ScopeReadTrade)
+	auth := middleware.NewAuth(st, middleware.AuthConfig{AdminToken: "s3cret-admin-token", Required: true, CacheTTL: time.Minute})
+
+	var actor string
+	app := newApp(auth.Handler(), func(c *fiber.Ctx) error {
+		actor = middleware.Actor(c)
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		name      string
+		target    string
+		headers   []string
+		status    int
+		code      string
+		wantActor string
+	}{
+		{"no credential", "/api", nil, 401, problem.CodeAuthRequired, ""},
+		{"public path", "/health", nil, 200, "", ""},
+		{"X-API-Key", "/api", []string{"X-API-Key", key}, 200, "", "dashboard"},
+		{"bearer", "/api", []string{"Authorization", "Bearer " + key}, 200, "", "dashboard"},
+		{"bearer in lower case", "/api", []string{"Authorization", "bearer " + key}, 200, "", "dashboard"},
+		{"basic is ignored", "/api", []string{"Authorization", "Basic dXNlcjpwYXNz"}, 401, problem.CodeAuthRequired, ""},
+		{"key as another scheme", "/api", []string{"Authorization", "Token " + key}, 401, problem.CodeAuthRequired, ""},
+		{"bare key", "/api", []string{"Authorization", key}, 401, problem.CodeAuthRequired, ""},
+		{"wrong key", "/api", []string{"X-API-Key", key + "x"}, 401, problem.CodeInvalidAPIKey, ""},
+		{"admin token", "/api", []string{"X-Admin-Token", "s3cret-admin-token"}, 200, "", "admin"},
+		{"admin token as bearer", "/api", []string{"Authorization", "Bearer s3cret-admin-token"}, 200, "", "admin"},
+		{"admin token prefix", "/api", []string{"X-Admin-Token", "s3cret-admin"}, 401, problem.CodeInvalidAPIKey, ""},
+		{"admin token extended", "/api", []string{"X-Admin-Token", "s3cret-admin-token!"}, 401, problem.CodeInvalidAPIKey, ""},
+	}
+	for _, tt := range tests {
+		actor = ""
+		status, code := get(t, app, tt.target, tt.headers...)
+		if status != tt.status || code != tt.code {
+			t.Errorf("%s: %d %s, want %d %s", tt.name, status, code, tt.status, tt.code)
+		}
+		if !strings.HasPrefix(actor, tt.wantActor) {
+			t.Errorf("%s: actor %q, want %s", tt.name, actor, tt.wantActor)
+		}
+	}
+}
+
+func TestAuthWithoutAdminToken(t *testing.T) {
+	st := storetest.New()
+	app := newApp(middleware.NewAuth(st, middleware.AuthConfig{CacheTTL: time.Minute}).Handler(), middleware.RequireAdmin(),
+		func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) })
+
+	// An unset token matches nothing, not even an empty header
+	if status, code := get(t, app, "/", "X-Admin-Token", "anything"); status != 401 || code != problem.CodeInvalidAPIKey {
+		t.Errorf("any token: %d %s", status, code)
+	}
+	if status, code := get(t, app, "/", "X-Admin-Token", ""); status != 403 || code != problem.CodeAdminRequired {
+		t.Errorf("empty token: %d %s", status, code)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	st := storetest.New()
+	reader := newKey(t, st, "reader", models.ScopeReadDimensions)
+	admin := newKey(t, st, "admin key", models.ScopeAdmin)
+	ok := func(c *fiber.Ctx) error { return c.SendStatus(fiber.StatusOK) }
+
+	tests := []struct {
+		name     string
+		required bool
+		route    []fiber.Handler
+		key      string
+		status   int
+		code     string
+	}{
+		// Without required keys, anonymous requests read and export
+		{"anonymous read", false, []fiber.Handler{middleware.RequireScope(models.ScopeReadTrade)}, "", 200, ""},
+		{"anonymous export", false, []fiber.Handler{middleware.RequireScope(models.ScopeReadTrade, models.ScopeExport)}, "", 200, ""},
+		{"anonymous admin scope", false, []fiber.Handler{middleware.RequireScope(models.ScopeAdmin)}, "", 403, problem.CodeScopeRequired},
+		{"anonymous admin route", false, []fiber.Handler{middleware.RequireAdmin()}, "", 403, problem.CodeAdminRequired},
+		// A key adds its scopes to the anonymous ones
+		{"admin key reads", false, []fiber.Handler{middleware.RequireScope(models.ScopeReadTrade)}, admin, 200, ""},
+		{"admin key administers", false, []fiber.Handler{middleware.RequireAdmin()}, admin, 200, ""},
+		// With required keys, only the key's scopes count
+		{"key scope", true, []fiber.Handler{middleware.RequireScope(models.ScopeReadDimensions)}, reader, 200, ""},
+		{"missing scope", true, []fiber.Handler{middleware.RequireScope(models.ScopeReadTrade)}, reader, 403, problem.CodeScopeRequired},
+		{"one of two scopes", true, []fiber.Handler{middleware.RequireScope(models.ScopeReadDimensions, models.ScopeExport)}, reader, 403, problem.CodeScopeRequired},
+		{"admin key only administers", true, []fiber.Handler{middleware.RequireScope(models.ScopeReadTrade)}, admin, 403, problem.CodeScopeRequired},
+	}
+	for _, tt := range tests {
+		auth := middleware.NewAuth(st, middleware.AuthConfig{Required: tt.required, CacheTTL: time.Minute})
+		app := newApp(append(append([]fiber.Handler{auth.Handler()}, tt.route...), ok)...)
+		var headers []string
+		if tt.key != "" {
+			headers = []string{"X-API-Key", tt.key}
+		}
+		if status, code := get(t, app, "/", headers...); status != tt.status || code != tt.code {
+			t.Errorf("%s: %d %s, want %d %s", tt.name, status, code, tt.status, tt.code)
+		}
+	}
+}
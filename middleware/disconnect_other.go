@@ -0,0 +1,11 @@
+//go:build !(linux || darwin || freebsd || netbsd || openbsd)
+
+package middleware
+
+import "net"
+
+// Disconnects are not detected on this platform; requests still end at their
+// timeout.
+func watchable(net.Conn) bool { return false }
+
+func peerClosed(net.Conn) bool { return false }
@@ -1,19 +1,39 @@
 package middleware
 
 import (
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cache"
 )
 
-func Cache(duration time.Duration) fiber.Handler {
+// CacheGeneration lets writers drop the responses of every cache sharing it.
+// Its number is part of their keys, so responses cached before Invalidate
+// are never served again and expire on their own.
+type CacheGeneration struct {
+	n atomic.Uint64
+}
+
+// Invalidate drops every response cached under g.
+func (g *CacheGeneration) Invalidate() {
+	g.n.Add(1)
+}
+
+// Cache caches GET responses for duration, keyed by path and query. Responses
+// are dropped early when gen, which may be nil, is invalidated.
+func Cache(duration time.Duration, gen *CacheGeneration) fiber.Handler {
 	return cache.New(cache.Config{
 		Expiration:   duration,
 		CacheControl: true,
 		KeyGenerator: func(c *fiber.Ctx) string {
 			// Include query parameters in cache key
-			return c.Path() + "?" + string(c.Request().URI().QueryString())
+			key := c.Path() + "?" + string(c.Request().URI().QueryString())
+			if gen != nil {
+				key = strconv.FormatUint(gen.n.Load(), 10) + ":" + key
+			}
+			return key
 		},
 	})
 }
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/problem"
+)
+
+// Timeout bounds the request context by timeout. Clients may ask for a
+// shorter or longer limit with ?timeout_ms=, capped at max.
+func Timeout(timeout, max time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		d := timeout
+		if hint := c.Query("timeout_ms"); hint != "" {
+			ms, err := strconv.Atoi(hint)
+			if err != nil || ms <= 0 {
+				return problem.BadRequest(problem.CodeInvalidTimeout, "timeout_ms",
+					"timeout_ms must be a positive integer", "يجب أن يكون timeout_ms عدداً صحيحاً موجباً")
+			}
+			d = min(time.Duration(ms)*time.Millisecond, max)
+		}
+
+		ctx, cancel := context.WithTimeout(c.UserContext(), d)
+		defer cancel()
+		c.SetUserContext(ctx)
+
+		return c.Next()
+	}
+}
+
+// CancelOnDisconnect gives each request a context that is canceled with
+// problem.ErrClientClosed when the client closes its connection, checked
+// every interval, so database work stops with it. Fiber does not cancel request contexts itself.
+func CancelOnDisconnect(interval time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithCancelCause(c.UserContext())
+		defer cancel(nil)
+		c.SetUserContext(ctx)
+
+		conn := c.Context().Conn()
+		if !watchable(conn) {
+			return c.Next()
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if peerClosed(conn) {
+						cancel(problem.ErrClientClosed)
+						return
+					}
+				}
+			}
+		}()
+
+		return c.Next()
+	}
+}
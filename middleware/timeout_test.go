@@ -0,0 +1,106 @@
+package middleware_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+
+	"trade-api/middleware"
+	"trade-api/problem"
+)
+
+// newApp serves every path with handlers, writing errors as problem details
+// the way the server does.
+func newApp(handlers ...fiber.Handler) *fiber.App {
+	app := fiber.New(fiber.Config{
+		ErrorHandler: func(c *fiber.Ctx, err error) error {
+			p := problem.From(err)
+			return c.Status(p.Status).JSON(p.Details(c.Path(), c.Method(), ""))
+		},
+	})
+	app.Get("/*", handlers...)
+	return app
+}
+
+// get requests target and returns the status and the problem code, if any.
+func get(t *testing.T, app *fiber.App, target string, headers ...string) (int, string) {
+	t.Helper()
+	req := httptest.NewRequest("GET", target, nil)
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	resp, err := app.Test(req, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Code string `json:"code"`
+	}
+	if resp.StatusCode != fiber.StatusOK {
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return resp.StatusCode, body.Code
+}
+
+func TestTimeoutLimits(t *testing.T) {
+	var left time.Duration
+	app := newApp(middleware.Timeout(time.Second, 5*time.Second), func(c *fiber.Ctx) error {
+		deadline, ok := c.UserContext().Deadline()
+		if !ok {
+			t.Error("request context has no deadline")
+		}
+		left = time.Until(deadline)
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	tests := []struct {
+		target   string
+		min, max time.Duration
+	}{
+		{"/", 500 * time.Millisecond, time.Second},
+		{"/?timeout_ms=200", 0, 200 * time.Millisecond},
+		{"/?timeout_ms=3000", 2500 * time.Millisecond, 3 * time.Second},
+		// Capped at max
+		{"/?timeout_ms=600000", 4500 * time.Millisecond, 5 * time.Second},
+	}
+	for _, tt := range tests {
+		if status, code := get(t, app, tt.target); status != fiber.StatusOK {
+			t.Errorf("%s: status %d %s", tt.target, status, code)
+			continue
+		}
+		if left <= tt.min || left > tt.max {
+			t.Errorf("%s: %v left, want between %v and %v", tt.target, left, tt.min, tt.max)
+		}
+	}
+}
+
+func TestTimeoutRejectsBadHints(t *testing.T) {
+	app := newApp(middleware.Timeout(time.Second, 5*time.Second), func(c *fiber.Ctx) error {
+		t.Error("handler ran for a bad hint")
+		return nil
+	})
+	for _, hint := range []string{"abc", "0", "-5", "1.5"} {
+		status, code := get(t, app, "/?timeout_ms="+hint)
+		if status != fiber.StatusBadRequest || code != problem.CodeInvalidTimeout {
+			t.Errorf("timeout_ms=%s: %d %s, want 400 %s", hint, status, code, problem.CodeInvalidTimeout)
+		}
+	}
+}
+
+func TestTimeoutExceeded(t *testing.T) {
+	app := newApp(middleware.Timeout(time.Second, 5*time.Second), func(c *fiber.Ctx) error {
+		<-c.UserContext().Done()
+		return problem.Internal(problem.CodeQueryFailed, "query failed", "فشل الاستعلام", c.UserContext().Err())
+	})
+	status, code := get(t, app, "/?timeout_ms=20")
+	if status != fiber.StatusGatewayTimeout || code != problem.CodeQueryTimeout {
+		t.Errorf("got %d %s, want 504 %s", status, code, problem.CodeQueryTimeout)
+	}
+}
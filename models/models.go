@@ -1,5 +1,39 @@
 package models
 
+import (
+	"encoding/json"
+	"time"
+)
+
+// Values accepted by AggregateRequest. Validation, the OpenAPI spec and the
+// agent tool schemas all read from these.
+var (
+	GroupByFields = []string{"year", "product", "country", "port", "trade_type"}
+	TradeTypes    = []string{"Import", "Export", "Re-Export"}
+	SortByFields  = []string{"total_value", "year", "product_desc_en", "country_name_en", "port_name_en", "trade_type"}
+	SortOrders    = []string{"asc", "desc"}
+
+	// SortByGroup names the group_by dimension each sort_by field other than
+	// total_value needs, as only grouped columns can be ordered by.
+	SortByGroup = map[string]string{
+		"year":            "year",
+		"product_desc_en": "product",
+		"country_name_en": "country",
+		"port_name_en":    "port",
+		"trade_type":      "trade_type",
+	}
+)
+
+const (
+	DefaultPageLimit   = 25
+	MaxPageLimit       = 1000
+	DefaultSearchLimit = 50
+	MaxSearchLimit     = 500
+
+	// MaxFilterIDs caps each of the product, country and port ID filters.
+	MaxFilterIDs = 200
+)
+
 type Product struct {
 	ProductID     int64  `json:"product_id"`
 	ProductDescEN string `json:"product_desc_en"`
@@ -7,18 +41,39 @@ type Product struct {
 }
 
 type Country struct {
-	CountryID     int64  `json:"country_id"`
-	CountryNameEN string `json:"country_name_en"`
-	CountryNameAR string `json:"country_name_ar"`
+	CountryID     int64   `json:"country_id"`
+	CountryNameEN string  `json:"country_name_en"`
+	CountryNameAR string  `json:"country_name_ar"`
+	ISOCode       *string `json:"iso_code,omitempty"`
 }
 
 type Port struct {
-	PortID     int64  `json:"port_id"`
-	PortNameEN string `json:"port_name_en"`
-	PortNameAR string `json:"port_name_ar"`
-	PortTypeEN string `json:"port_type_en"`
-	PortTypeAR string `json:"port_type_ar"`
-	ModeID     int    `json:"mode_id"`
+	PortID     int64    `json:"port_id"`
+	PortNameEN string   `json:"port_name_en"`
+	PortNameAR string   `json:"port_name_ar"`
+	PortTypeEN string   `json:"port_type_en"`
+	PortTypeAR string   `json:"port_type_ar"`
+	ModeID     int      `json:"mode_id"`
+	Latitude   *float64 `json:"latitude,omitempty"`
+	Longitude  *float64 `json:"longitude,omitempty"`
+}
+
+// CountryVersion is a country's attributes from ValidFrom up to, but not
+// including, ValidTo. The first version has no ValidFrom and the current one
+// no ValidTo.
+type CountryVersion struct {
+	Country
+	ValidFrom *time.Time `json:"valid_from"`
+	ValidTo   *time.Time `json:"valid_to"`
+}
+
+// PortVersion is a port's attributes from ValidFrom up to, but not
+// including, ValidTo. The first version has no ValidFrom and the current one
+// no ValidTo.
+type PortVersion struct {
+	Port
+	ValidFrom *time.Time `json:"valid_from"`
+	ValidTo   *time.Time `json:"valid_to"`
 }
 
 type TradeSummary struct {
@@ -46,6 +101,13 @@ type AggregateRequest struct {
 	Filters    Filters    `json:"filters,omitempty"`
 	Pagination Pagination `json:"pagination,omitempty"`
 	Sorting    Sorting    `json:"sorting,omitempty"`
+	// AsOfRelease reads the facts as they stood in that release; 0 reads
+	// the latest
+	AsOfRelease int `json:"as_of_release,omitempty"`
+	// LabelAsOf names countries and ports as they were at the end of that
+	// year, keeping the current names of members without a version then;
+	// 0 uses their current names. It never changes the totals
+	LabelAsOf int `json:"label_as_of,omitempty"`
 }
 
 type DateRange struct {
@@ -65,6 +127,11 @@ type Pagination struct {
 	Limit int `json:"limit"`
 }
 
+// Offset is the number of rows before the requested page.
+func (p Pagination) Offset() int {
+	return (p.Page - 1) * p.Limit
+}
+
 type Sorting struct {
 	SortBy    string `json:"sort_by"`
 	SortOrder string `json:"sort_order"`
@@ -86,8 +153,17 @@ type AggregateResult struct {
 }
 
 type PaginatedResponse struct {
-	Data       interface{}    `json:"data"`
-	Pagination PaginationMeta `json:"pagination"`
+	Data             interface{}       `json:"data"`
+	Pagination       PaginationMeta    `json:"pagination"`
+	QueryDescription *QueryDescription `json:"query_description,omitempty"`
+}
+
+// QueryDescription explains what an aggregate response actually computed.
+type QueryDescription struct {
+	EN                string           `json:"en"`
+	AR                string           `json:"ar"`
+	NormalizedRequest AggregateRequest `json:"normalized_request"`
+	FactTable         string           `json:"fact_table"`
 }
 
 type PaginationMeta struct {
@@ -96,3 +172,255 @@ type PaginationMeta struct {
 	TotalCount  int64 `json:"total_count"`
 	TotalPages  int   `json:"total_pages"`
 }
+
+type FeatureCollection struct {
+	Type             string            `json:"type"`
+	Features         []Feature         `json:"features"`
+	Pagination       *PaginationMeta   `json:"pagination,omitempty"`
+	QueryDescription *QueryDescription `json:"query_description,omitempty"`
+}
+
+type Feature struct {
+	Type       string          `json:"type"`
+	ID         int64           `json:"id"`
+	Geometry   json.RawMessage `json:"geometry"`
+	Properties AggregateResult `json:"properties"`
+}
+
+type QueryPlan struct {
+	FactTable  string          `json:"fact_table"`
+	Joins      []string        `json:"joins"`
+	Query      string          `json:"query"`
+	CountQuery string          `json:"count_query"`
+	Args       []interface{}   `json:"args"`
+	Explain    json.RawMessage `json:"explain,omitempty"`
+}
+
+type AskRequest struct {
+	Question string `json:"question"`
+}
+
+type AskResponse struct {
+	Question string             `json:"question"`
+	Language string             `json:"language"`
+	Request  *AggregateRequest  `json:"request"`
+	Result   *PaginatedResponse `json:"result"`
+}
+
+// Metadata describes what the data can answer, so clients need not hardcode
+// year ranges or valid values.
+type Metadata struct {
+	FactTables             []FactTableMetadata `json:"fact_tables"`
+	SummaryYears           []int               `json:"summary_years"`
+	TradeTypes             []string            `json:"trade_types"`
+	PortTypes              []PortType          `json:"port_types"`
+	ModeIDs                []int               `json:"mode_ids"`
+	GroupByFields          []string            `json:"group_by_fields"`
+	SortByFields           []string            `json:"sort_by_fields"`
+	SortOrders             []string            `json:"sort_orders"`
+	IncompatibleDimensions [][]string          `json:"incompatible_dimensions"`
+	DimensionCounts        DimensionCounts     `json:"dimension_counts"`
+	LastDataLoad           *time.Time          `json:"last_data_load"`
+}
+
+// FactTableMetadata lists the dimensions a fact table answers and the years
+// and trade types it holds.
+type FactTableMetadata struct {
+	Name       string   `json:"name"`
+	Dimensions []string `json:"dimensions"`
+	Years      []int    `json:"years"`
+	TradeTypes []string `json:"trade_types"`
+}
+
+type PortType struct {
+	ModeID     int    `json:"mode_id"`
+	PortTypeEN string `json:"port_type_en"`
+	PortTypeAR string `json:"port_type_ar"`
+}
+
+type DimensionCounts struct {
+	Products  int64 `json:"products"`
+	Countries int64 `json:"countries"`
+	Ports     int64 `json:"ports"`
+}
+
+// FactTotal is the sum of a fact table's values for one year and trade type.
+type FactTotal struct {
+	Table     string `json:"table"`
+	Year      int    `json:"year"`
+	TradeType string `json:"trade_type"`
+	Value     int64  `json:"value"`
+}
+
+// SummaryRebuild is the yearly summary recomputed from the product fact
+// table, the changes it makes to the published summary and its
+// reconciliation with the country fact table. It is published only when
+// every reconciliation is within Tolerance, as a new release.
+type SummaryRebuild struct {
+	Tolerance      float64          `json:"tolerance"`
+	DryRun         bool             `json:"dry_run"`
+	Published      bool             `json:"published"`
+	Release        int              `json:"release,omitempty"`
+	Discrepancies  int              `json:"discrepancies"`
+	Summary        []TradeSummary   `json:"summary"`
+	Changes        []SummaryChange  `json:"changes"`
+	Reconciliation []Reconciliation `json:"reconciliation"`
+}
+
+// SummaryChange is a year the rebuild changes. Previous is null for a year
+// new to the summary, and Rebuilt for a year no longer in the facts.
+type SummaryChange struct {
+	Year     int           `json:"year"`
+	Previous *TradeSummary `json:"previous"`
+	Rebuilt  *TradeSummary `json:"rebuilt"`
+}
+
+// Reconciliation compares the two fact tables' totals for a year and trade
+// type. RelativeDifference is the difference over the larger total.
+type Reconciliation struct {
+	Year               int     `json:"year"`
+	TradeType          string  `json:"trade_type"`
+	ProductTotal       int64   `json:"product_total"`
+	CountryTotal       int64   `json:"country_total"`
+	Difference         int64   `json:"difference"`
+	RelativeDifference float64 `json:"relative_difference"`
+	WithinTolerance    bool    `json:"within_tolerance"`
+}
+
+// QualityReport says whether the warehouse can be trusted: whether the fact
+// tables and the yearly summary agree, and what is incomplete. Passed is true
+// when every list is empty and every total is consistent.
+type QualityReport struct {
+	Passed              bool                 `json:"passed"`
+	Tolerance           float64              `json:"tolerance"`
+	Discrepancies       int                  `json:"discrepancies"`
+	Totals              []QualityTotal       `json:"totals"`
+	OrphanedIDs         []OrphanedID         `json:"orphaned_ids"`
+	MissingTranslations []MissingTranslation `json:"missing_translations"`
+	MissingTradeTypes   []MissingTradeTypes  `json:"missing_trade_types"`
+}
+
+// QualityTotal is one year and trade type in every table. SummaryTotal is
+// null when the summary has no row for the year. Each difference is that
+// table's total minus the product fact table's, and Consistent means both
+// are within the tolerance.
+type QualityTotal struct {
+	Year              int    `json:"year"`
+	TradeType         string `json:"trade_type"`
+	ProductTotal      int64  `json:"product_total"`
+	CountryTotal      int64  `json:"country_total"`
+	SummaryTotal      *int64 `json:"summary_total"`
+	CountryDifference int64  `json:"country_difference"`
+	SummaryDifference int64  `json:"summary_difference"`
+	Consistent        bool   `json:"consistent"`
+}
+
+// OrphanedID is a dimension ID used by fact rows but missing from its
+// dimension table.
+type OrphanedID struct {
+	Table  string `json:"table"`
+	Column string `json:"column"`
+	ID     int64  `json:"id"`
+	Rows   int64  `json:"rows"`
+}
+
+// MissingTranslation is a dimension row with an empty Arabic column. NameEN
+// identifies the row.
+type MissingTranslation struct {
+	Table  string `json:"table"`
+	ID     int64  `json:"id"`
+	Column string `json:"column"`
+	NameEN string `json:"name_en"`
+}
+
+// MissingTradeTypes lists the trade types a fact table lacks for a year it
+// otherwise holds.
+type MissingTradeTypes struct {
+	Table      string   `json:"table"`
+	Year       int      `json:"year"`
+	TradeTypes []string `json:"trade_types"`
+}
+
+// Release is a numbered vintage of the fact data, created by each load and
+// summary rebuild.
+type Release struct {
+	ReleaseID int       `json:"release_id"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AggregateChange is an aggregate group whose total differs between two
+// releases. TotalValue is the total in the later release and PreviousValue
+// in the earlier one; either is 0 for a group only the other release has.
+type AggregateChange struct {
+	AggregateResult
+	PreviousValue int64 `json:"previous_value"`
+	Change        int64 `json:"change"`
+}
+
+type ReleaseDiff struct {
+	FromRelease int               `json:"from_release"`
+	ToRelease   int               `json:"to_release"`
+	Data        []AggregateChange `json:"data"`
+	Pagination  PaginationMeta    `json:"pagination"`
+}
+
+// Actions recorded in the dimension audit trail.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+)
+
+// AuditEntry is one change an admin or a load made to a dimension member.
+// Loads are recorded with the actor "load: <source>". Before is null for a
+// created or restored member and After for a deleted one.
+type AuditEntry struct {
+	AuditID   int64           `json:"audit_id"`
+	Table     string          `json:"table"`
+	ID        int64           `json:"id"`
+	Action    string          `json:"action"`
+	Actor     string          `json:"actor"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	ChangedAt time.Time       `json:"changed_at"`
+}
+
+// API key scopes. ScopeExport covers every output other than plain JSON, and
+// ScopeAdmin the admin endpoints and admin-only options.
+const (
+	ScopeReadDimensions = "read:dimensions"
+	ScopeReadTrade      = "read:trade"
+	ScopeExport         = "export"
+	ScopeAdmin          = "admin"
+)
+
+// Scopes are every scope a key can have.
+var Scopes = []string{ScopeReadDimensions, ScopeReadTrade, ScopeExport, ScopeAdmin}
+
+// APIKey is a credential clients send in X-API-Key. Only a hash of the key is
+// stored; Prefix is its public start, which finds it and names it in lists.
+type APIKey struct {
+	KeyID      int64      `json:"key_id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	Hash       []byte     `json:"-"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+}
+
+// APIKeyRequest asks for a new API key.
+type APIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// NewAPIKey is a key just created, with the secret key itself. It is shown
+// only this once.
+type NewAPIKey struct {
+	APIKey
+	Key string `json:"key"`
+}
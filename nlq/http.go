@@ -0,0 +1,157 @@
+package nlq
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"trade-api/models"
+	"trade-api/tools"
+)
+
+// HTTPTranslator asks a model behind an OpenAI-compatible chat completions
+// endpoint to fill in the request. This covers hosted APIs as well as local
+// model servers such as llama.cpp, vLLM or Ollama. Member names are returned
+// by the model and resolved to IDs against the catalog; a name that matches
+// no member fails the translation with an UnresolvedError.
+type HTTPTranslator struct {
+	URL     string
+	Model   string
+	APIKey  string
+	Client  *http.Client
+	catalog CatalogFunc
+}
+
+func NewHTTPTranslator(url, model, apiKey string, catalog CatalogFunc) *HTTPTranslator {
+	return &HTTPTranslator{
+		URL:     url,
+		Model:   model,
+		APIKey:  apiKey,
+		Client:  &http.Client{Timeout: 30 * time.Second},
+		catalog: catalog,
+	}
+}
+
+// modelRequest is what the model is asked to produce: an aggregate request
+// with member names instead of IDs.
+type modelRequest struct {
+	models.AggregateRequest
+	ProductNames []string `json:"product_names"`
+	CountryNames []string `json:"country_names"`
+	PortNames    []string `json:"port_names"`
+}
+
+type chatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+func (t *HTTPTranslator) Translate(ctx context.Context, question string) (*models.AggregateRequest, error) {
+	catalog, err := t.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"model":           t.Model,
+		"temperature":     0,
+		"response_format": map[string]string{"type": "json_object"},
+		"messages": []chatMessage{
+			{Role: "system", Content: systemPrompt(catalog)},
+			{Role: "user", Content: question},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	if t.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+t.APIKey)
+	}
+
+	resp, err := t.Client.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("translator request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return nil, fmt.Errorf("translator returned %d: %s", resp.StatusCode, detail)
+	}
+
+	var completion struct {
+		Choices []struct {
+			Message chatMessage `json:"message"`
+		} `json:"choices"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&completion); err != nil {
+		return nil, fmt.Errorf("invalid translator response: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("translator returned no choices")
+	}
+
+	var out modelRequest
+	if err := json.Unmarshal([]byte(completion.Choices[0].Message.Content), &out); err != nil {
+		return nil, fmt.Errorf("%w: model output is not a valid request: %v", ErrNotUnderstood, err)
+	}
+
+	req := out.AggregateRequest
+	members := catalogMembers(catalog)
+	unresolved := &UnresolvedError{}
+	resolve := func(kind string, names []string, ids *[]int64) {
+		for _, name := range names {
+			n := strings.TrimSpace(normalize(name))
+			if n == "" {
+				continue
+			}
+			found := false
+			for _, m := range members {
+				if m.kind == kind && m.name == n {
+					*ids = appendUnique(*ids, m.id)
+					found = true
+				}
+			}
+			if !found {
+				unresolved.Names = append(unresolved.Names, name)
+			}
+		}
+	}
+	resolve("product", out.ProductNames, &req.Filters.ProductIDs)
+	resolve("country", out.CountryNames, &req.Filters.CountryIDs)
+	resolve("port", out.PortNames, &req.Filters.PortIDs)
+	if len(unresolved.Names) > 0 {
+		return nil, unresolved
+	}
+
+	return &req, nil
+}
+
+func systemPrompt(catalog *Catalog) string {
+	var schema []byte
+	for _, t := range tools.Definitions() {
+		if t.Name == "aggregate_trade" {
+			schema, _ = json.Marshal(t.Parameters)
+		}
+	}
+
+	return fmt.Sprintf(`You translate questions about trade statistics, in English or Arabic, into a JSON query.
+Reply with a single JSON object matching this schema:
+%s
+Do not fill filters.product_ids, filters.country_ids or filters.port_ids. Instead list the English names of
+products, countries and ports mentioned in the question in "product_names", "country_names" and "port_names".
+Products and countries cannot be combined in one query.
+Data is available for %d to %d; use %d when the question gives no year.`,
+		schema, catalog.MinYear, catalog.MaxYear, catalog.MaxYear)
+}
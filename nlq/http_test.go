@@ -0,0 +1,63 @@
+package nlq
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"trade-api/models"
+)
+
+func testCatalog(ctx context.Context) (*Catalog, error) {
+	return &Catalog{
+		Products:  []models.Product{{ProductID: 2, ProductDescEN: "Dates", ProductDescAR: "تمور"}},
+		Countries: []models.Country{{CountryID: 10, CountryNameEN: "Oman", CountryNameAR: "عمان"}},
+		MinYear:   2020,
+		MaxYear:   2023,
+	}, nil
+}
+
+// modelServer answers every chat completion with content.
+func modelServer(t *testing.T, content string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": chatMessage{Role: "assistant", Content: content}}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestHTTPTranslatorResolvesNames(t *testing.T) {
+	srv := modelServer(t, `{"date_range":{"start_year":2022,"end_year":2022},"group_by":["year"],"country_names":["oman"]}`)
+	req, err := NewHTTPTranslator(srv.URL, "test", "", testCatalog).Translate(context.Background(), "exports to Oman in 2022")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(req.Filters.CountryIDs) != 1 || req.Filters.CountryIDs[0] != 10 {
+		t.Errorf("country filter = %v, want [10]", req.Filters.CountryIDs)
+	}
+}
+
+func TestHTTPTranslatorRejectsUnknownNames(t *testing.T) {
+	srv := modelServer(t, `{"date_range":{"start_year":2022,"end_year":2022},"group_by":["year"],"country_names":["Oman","Atlantis"]}`)
+	translator := NewHTTPTranslator(srv.URL, "test", "", testCatalog)
+
+	_, err := translator.Translate(context.Background(), "exports to Oman and Atlantis")
+	var unresolved *UnresolvedError
+	if !errors.As(err, &unresolved) || !errors.Is(err, ErrNotUnderstood) {
+		t.Fatalf("err = %v, want an UnresolvedError", err)
+	}
+	if len(unresolved.Names) != 1 || unresolved.Names[0] != "Atlantis" {
+		t.Errorf("unresolved = %v, want [Atlantis]", unresolved.Names)
+	}
+
+	// The rule translator would drop the name, so it is not asked
+	if _, err := Fallback(translator, NewRuleTranslator(testCatalog)).Translate(context.Background(), "exports to Oman and Atlantis"); !errors.As(err, &unresolved) {
+		t.Errorf("fallback err = %v, want an UnresolvedError", err)
+	}
+}
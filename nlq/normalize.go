@@ -0,0 +1,112 @@
+package nlq
+
+import (
+	"strings"
+	"unicode"
+)
+
+var arabicLetters = strings.NewReplacer(
+	"أ", "ا", "إ", "ا", "آ", "ا", "ى", "ي", "ة", "ه", "ـ", "",
+)
+
+// normalize lowercases text, folds Arabic letter variants, converts
+// Arabic-Indic digits and reduces punctuation to single spaces. The result is
+// padded with spaces so phrases can be matched on word boundaries.
+func normalize(text string) string {
+	text = arabicLetters.Replace(strings.ToLower(text))
+
+	var b strings.Builder
+	b.WriteByte(' ')
+	space := true
+	for _, r := range text {
+		switch {
+		case r >= 'ً' && r <= 'ْ':
+			// Drop tashkeel
+			continue
+		case r >= '٠' && r <= '٩':
+			r = '0' + (r - '٠')
+		case r >= '۰' && r <= '۹':
+			r = '0' + (r - '۰')
+		}
+
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+		} else if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	if !space {
+		b.WriteByte(' ')
+	}
+	return b.String()
+}
+
+func isArabic(text string) bool {
+	for _, r := range text {
+		if unicode.Is(unicode.Arabic, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// Arabic attaches conjunctions, prepositions and the article to the word.
+var arabicPrefixes = []string{"", "ال", "و", "وال", "ب", "بال", "ل", "لل", "ف", "فال", "من", "مع"}
+
+// phraseIndex finds a normalized phrase on word boundaries in q and returns its
+// position and length. A trailing "*" matches any word ending, e.g. "import*"
+// matches "imports" and "imported".
+func phraseIndex(q, phrase string) (int, int) {
+	prefixOnly := strings.HasSuffix(phrase, "*")
+	phrase = strings.TrimSuffix(phrase, "*")
+
+	prefixes := []string{""}
+	if isArabic(phrase) {
+		prefixes = arabicPrefixes
+	}
+
+	for _, prefix := range prefixes {
+		needle := " " + prefix + phrase
+		if !prefixOnly {
+			needle += " "
+		}
+		if i := strings.Index(q, needle); i >= 0 {
+			end := i + len(needle)
+			if prefixOnly {
+				for end < len(q) && q[end] != ' ' {
+					end++
+				}
+			}
+			return i, end - i
+		}
+	}
+	return -1, 0
+}
+
+func hasAny(q string, phrases ...string) bool {
+	for _, p := range phrases {
+		if i, _ := phraseIndex(q, p); i >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// consume reports whether any phrase occurs in q and blanks every match so
+// later rules do not see it again.
+func consume(q *string, phrases ...string) bool {
+	found := false
+	for _, p := range phrases {
+		for {
+			i, n := phraseIndex(*q, p)
+			if i < 0 {
+				break
+			}
+			*q = (*q)[:i] + strings.Repeat(" ", n) + (*q)[i+n:]
+			found = true
+		}
+	}
+	return found
+}
@@ -0,0 +1,259 @@
+package nlq
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"trade-api/models"
+)
+
+// Phrases are matched against normalized text, so Arabic forms use ا for
+// hamza variants and ه for taa marbuta.
+var (
+	reExportPhrases = []string{"re export*", "reexport*", "اعاده تصدير", "اعاده التصدير", "معاد تصدير*"}
+	importPhrases   = []string{"import*", "واردات", "استيراد", "مستورد*"}
+	exportPhrases   = []string{"export*", "صادرات", "تصدير", "مصدره"}
+
+	groupPhrases = map[string][]string{
+		"product":    {"by product*", "per product*", "product*", "commodit*", "goods", "items", "منتج*", "سلع", "سلعه", "بضائع"},
+		"country":    {"by country", "per country", "countries", "country", "partner*", "دول", "دوله", "شركاء", "بلدان"},
+		"port":       {"by port*", "per port*", "ports", "port", "منفذ", "منافذ", "ميناء", "موانئ"},
+		"year":       {"by year", "per year", "each year", "every year", "yearly", "annual*", "trend*", "over time", "سنوي*", "حسب السنه", "كل سنه", "كل عام"},
+		"trade_type": {"by trade type", "by type", "per trade type", "trade type*", "حسب نوع", "نوع التجاره"},
+	}
+
+	// portTypePhrases are keyed by English port type, lowercased.
+	portTypePhrases = map[string][]string{
+		"sea":  {"sea port*", "seaport*", "sea", "maritime", "بحري*", "بحر"},
+		"air":  {"air port*", "airport*", "air", "جوي*", "مطار*", "مطارات"},
+		"land": {"land port*", "land", "road", "border*", "بري", "بريه", "حدودي*"},
+	}
+
+	yearPattern   = regexp.MustCompile(`\b(19\d{2}|20\d{2})\b`)
+	lastYearsEN   = regexp.MustCompile(`\b(?:last|past|previous) (\d+) years?\b`)
+	lastYearsAR   = regexp.MustCompile(`اخر (\d+) (?:سنوات|سنه|اعوام|عام)`)
+	sincePattern  = regexp.MustCompile(`(?:\bsince|منذ) (19\d{2}|20\d{2})`)
+	topPattern    = regexp.MustCompile(`(?:\b(?:top|highest|largest|biggest|leading)|اعلى|اكبر|اهم) (\d+)`)
+	bottomPattern = regexp.MustCompile(`(?:\b(?:bottom|lowest|smallest)|اقل|ادنى) (\d+)`)
+)
+
+// RuleTranslator maps questions to aggregate requests with keyword rules and
+// the dimension catalog. It needs no network access.
+type RuleTranslator struct {
+	catalog CatalogFunc
+}
+
+func NewRuleTranslator(catalog CatalogFunc) *RuleTranslator {
+	return &RuleTranslator{catalog: catalog}
+}
+
+type member struct {
+	kind string
+	id   int64
+	name string
+}
+
+func (t *RuleTranslator) Translate(ctx context.Context, question string) (*models.AggregateRequest, error) {
+	catalog, err := t.catalog(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	q := normalize(question)
+	if strings.TrimSpace(q) == "" {
+		return nil, fmt.Errorf("%w: the question is empty", ErrNotUnderstood)
+	}
+	req := &models.AggregateRequest{}
+
+	// Named members first, so their words are not read as keywords
+	for _, m := range catalogMembers(catalog) {
+		if !consume(&q, m.name) {
+			continue
+		}
+		switch m.kind {
+		case "product":
+			req.Filters.ProductIDs = appendUnique(req.Filters.ProductIDs, m.id)
+		case "country":
+			req.Filters.CountryIDs = appendUnique(req.Filters.CountryIDs, m.id)
+		case "port":
+			req.Filters.PortIDs = appendUnique(req.Filters.PortIDs, m.id)
+		}
+	}
+
+	// Re-export before export, since "re-export" contains "export"
+	if consume(&q, reExportPhrases...) {
+		req.TradeTypes = append(req.TradeTypes, "Re-Export")
+	}
+	if consume(&q, importPhrases...) {
+		req.TradeTypes = append(req.TradeTypes, "Import")
+	}
+	if consume(&q, exportPhrases...) {
+		req.TradeTypes = append(req.TradeTypes, "Export")
+	}
+
+	req.Filters.PortTypes = matchPortTypes(&q, catalog)
+
+	if m := topPattern.FindStringSubmatch(q); m != nil {
+		req.Pagination.Limit, _ = strconv.Atoi(m[1])
+		req.Sorting = models.Sorting{SortBy: "total_value", SortOrder: "desc"}
+		q = strings.Replace(q, m[0], " ", 1)
+	} else if m := bottomPattern.FindStringSubmatch(q); m != nil {
+		req.Pagination.Limit, _ = strconv.Atoi(m[1])
+		req.Sorting = models.Sorting{SortBy: "total_value", SortOrder: "asc"}
+		q = strings.Replace(q, m[0], " ", 1)
+	}
+
+	req.DateRange = matchYears(q, catalog)
+
+	for _, g := range models.GroupByFields {
+		if hasAny(q, groupPhrases[g]...) {
+			req.GroupBy = append(req.GroupBy, g)
+		}
+	}
+
+	if !understood(req, q) {
+		return nil, fmt.Errorf("%w: no trade types, members, years or groupings were recognized", ErrNotUnderstood)
+	}
+
+	byProduct := slices.Contains(req.GroupBy, "product") || len(req.Filters.ProductIDs) > 0
+	byCountry := slices.Contains(req.GroupBy, "country") || len(req.Filters.CountryIDs) > 0
+	if byProduct && byCountry {
+		return nil, fmt.Errorf("%w: products and countries are recorded separately and cannot be combined in one question", ErrNotUnderstood)
+	}
+
+	if len(req.GroupBy) == 0 {
+		if req.DateRange.StartYear != req.DateRange.EndYear {
+			req.GroupBy = []string{"year"}
+		} else {
+			req.GroupBy = []string{"trade_type"}
+		}
+	}
+	if req.Sorting.SortBy == "" {
+		if len(req.GroupBy) == 1 && req.GroupBy[0] == "year" {
+			req.Sorting = models.Sorting{SortBy: "year", SortOrder: "asc"}
+		} else {
+			req.Sorting = models.Sorting{SortBy: "total_value", SortOrder: "desc"}
+		}
+	}
+
+	return req, nil
+}
+
+// understood reports whether anything in the question mapped onto the
+// request, so small talk is rejected instead of answered with a default query.
+func understood(req *models.AggregateRequest, q string) bool {
+	f := req.Filters
+	return len(f.ProductIDs)+len(f.CountryIDs)+len(f.PortIDs)+len(f.PortTypes) > 0 ||
+		len(req.TradeTypes) > 0 ||
+		len(req.GroupBy) > 0 ||
+		req.Pagination.Limit > 0 ||
+		yearPattern.MatchString(q) ||
+		lastYearsEN.MatchString(q) ||
+		lastYearsAR.MatchString(q)
+}
+
+// catalogMembers lists member names longest first, so "South Korea" wins over
+// "Korea". Very short names are skipped to avoid accidental matches.
+func catalogMembers(catalog *Catalog) []member {
+	members := []member{}
+	add := func(kind string, id int64, names ...string) {
+		for _, name := range names {
+			n := strings.TrimSpace(normalize(name))
+			if utf8.RuneCountInString(n) >= 3 {
+				members = append(members, member{kind: kind, id: id, name: n})
+			}
+		}
+	}
+
+	for _, c := range catalog.Countries {
+		add("country", c.CountryID, c.CountryNameEN, c.CountryNameAR)
+	}
+	for _, p := range catalog.Ports {
+		add("port", p.PortID, p.PortNameEN, p.PortNameAR)
+	}
+	for _, p := range catalog.Products {
+		add("product", p.ProductID, p.ProductDescEN, p.ProductDescAR)
+	}
+
+	sort.SliceStable(members, func(i, j int) bool {
+		return len(members[i].name) > len(members[j].name)
+	})
+	return members
+}
+
+func matchPortTypes(q *string, catalog *Catalog) []string {
+	types := []string{}
+	seen := map[string]bool{}
+	for _, p := range catalog.Ports {
+		if seen[p.PortTypeEN] {
+			continue
+		}
+		seen[p.PortTypeEN] = true
+
+		phrases := append([]string{}, portTypePhrases[strings.ToLower(p.PortTypeEN)]...)
+		for _, name := range []string{p.PortTypeEN, p.PortTypeAR} {
+			if n := strings.TrimSpace(normalize(name)); n != "" {
+				phrases = append(phrases, n)
+			}
+		}
+		if consume(q, phrases...) {
+			types = append(types, p.PortTypeEN)
+		}
+	}
+	sort.Strings(types)
+	if len(types) == 0 {
+		return nil
+	}
+	return types
+}
+
+// matchYears reads explicit years and relative periods. Without either, the
+// latest year with data is used.
+func matchYears(q string, catalog *Catalog) models.DateRange {
+	latest := catalog.MaxYear
+
+	if m := lastYearsEN.FindStringSubmatch(q); m != nil {
+		return lastYears(m[1], catalog)
+	}
+	if m := lastYearsAR.FindStringSubmatch(q); m != nil {
+		return lastYears(m[1], catalog)
+	}
+	if m := sincePattern.FindStringSubmatch(q); m != nil {
+		start, _ := strconv.Atoi(m[1])
+		return models.DateRange{StartYear: start, EndYear: max(start, latest)}
+	}
+
+	years := []int{}
+	for _, m := range yearPattern.FindAllString(q, -1) {
+		year, _ := strconv.Atoi(m)
+		years = append(years, year)
+	}
+	if len(years) > 0 {
+		return models.DateRange{StartYear: slices.Min(years), EndYear: slices.Max(years)}
+	}
+
+	return models.DateRange{StartYear: latest, EndYear: latest}
+}
+
+func lastYears(n string, catalog *Catalog) models.DateRange {
+	count, _ := strconv.Atoi(n)
+	count = max(count, 1)
+	start := catalog.MaxYear - count + 1
+	if catalog.MinYear > 0 {
+		start = max(start, catalog.MinYear)
+	}
+	return models.DateRange{StartYear: start, EndYear: catalog.MaxYear}
+}
+
+func appendUnique(ids []int64, id int64) []int64 {
+	if slices.Contains(ids, id) {
+		return ids
+	}
+	return append(ids, id)
+}
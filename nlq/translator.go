@@ -0,0 +1,101 @@
+package nlq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"trade-api/models"
+)
+
+// ErrNotUnderstood is wrapped by translators when a question cannot be mapped
+// to an aggregate request.
+var ErrNotUnderstood = errors.New("question not understood")
+
+// UnresolvedError reports member names a translator could not find in the
+// catalog. It matches ErrNotUnderstood: answering without the unknown member's
+// filter would be an answer to a different question.
+type UnresolvedError struct {
+	Names []string
+}
+
+func (e *UnresolvedError) Error() string {
+	quoted := make([]string, len(e.Names))
+	for i, name := range e.Names {
+		quoted[i] = strconv.Quote(name)
+	}
+	return fmt.Sprintf("%v: no product, country or port is named %s", ErrNotUnderstood, strings.Join(quoted, ", "))
+}
+
+func (e *UnresolvedError) Is(target error) bool {
+	return target == ErrNotUnderstood
+}
+
+// Translator turns an English or Arabic question into an aggregate request.
+// The result is validated by the caller before it is executed.
+type Translator interface {
+	Translate(ctx context.Context, question string) (*models.AggregateRequest, error)
+}
+
+// Catalog holds the dimension members and data years used to resolve names
+// and relative periods in questions.
+type Catalog struct {
+	Products  []models.Product
+	Countries []models.Country
+	Ports     []models.Port
+	MinYear   int
+	MaxYear   int
+}
+
+type CatalogFunc func(ctx context.Context) (*Catalog, error)
+
+// CachedCatalog reloads the catalog at most once per ttl.
+func CachedCatalog(load CatalogFunc, ttl time.Duration) CatalogFunc {
+	var mu sync.Mutex
+	var cached *Catalog
+	var loadedAt time.Time
+
+	return func(ctx context.Context) (*Catalog, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if cached != nil && time.Since(loadedAt) < ttl {
+			return cached, nil
+		}
+		catalog, err := load(ctx)
+		if err != nil {
+			return nil, err
+		}
+		cached, loadedAt = catalog, time.Now()
+		return cached, nil
+	}
+}
+
+type fallbackTranslator struct {
+	primary, fallback Translator
+}
+
+// Fallback uses primary and falls back when it fails, e.g. when a model
+// server is unreachable.
+func Fallback(primary, fallback Translator) Translator {
+	return &fallbackTranslator{primary: primary, fallback: fallback}
+}
+
+func (t *fallbackTranslator) Translate(ctx context.Context, question string) (*models.AggregateRequest, error) {
+	req, err := t.primary.Translate(ctx, question)
+	if err == nil {
+		return req, nil
+	}
+	// The fallback would skip the unknown names and answer for every member
+	var unresolved *UnresolvedError
+	if errors.As(err, &unresolved) {
+		return nil, err
+	}
+	log.Printf("Primary translator failed, falling back: %v", err)
+	return t.fallback.Translate(ctx, question)
+}
@@ -0,0 +1,205 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"trade-api/models"
+)
+
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Default              interface{}        `json:"default,omitempty"`
+	Minimum              *int               `json:"minimum,omitempty"`
+	Maximum              *int               `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+func intPtr(n int) *int {
+	return &n
+}
+
+// constraints adds the validation rules the API enforces on top of the Go
+// types, keyed by "TypeName.json_field".
+var constraints = map[string]func(*Schema){
+	"AggregateRequest.group_by": func(s *Schema) {
+		s.Items.Enum = models.GroupByFields
+		s.MinItems = intPtr(1)
+		s.Description = "Dimensions to group by. product and country cannot be combined."
+	},
+	"AggregateRequest.trade_types": func(s *Schema) {
+		s.Items.Enum = models.TradeTypes
+		s.Description = "Trade types to include. All trade types when omitted."
+	},
+	"AggregateRequest.as_of_release": func(s *Schema) {
+		s.Minimum = intPtr(1)
+		s.Description = "Release to read the data as of. The latest release when omitted."
+	},
+	"AggregateRequest.label_as_of": func(s *Schema) {
+		s.Minimum = intPtr(1)
+		s.Description = "Year whose names to label countries and ports with, as they were at its end. Current names when omitted."
+	},
+	"Filters.product_ids":  func(s *Schema) { s.MaxItems = intPtr(models.MaxFilterIDs) },
+	"Filters.country_ids":  func(s *Schema) { s.MaxItems = intPtr(models.MaxFilterIDs) },
+	"Filters.port_ids":     func(s *Schema) { s.MaxItems = intPtr(models.MaxFilterIDs) },
+	"DateRange.start_year": func(s *Schema) { s.Minimum = intPtr(1) },
+	"DateRange.end_year":   func(s *Schema) { s.Minimum = intPtr(1) },
+	"Pagination.page": func(s *Schema) {
+		s.Minimum = intPtr(1)
+		s.Default = 1
+	},
+	"Pagination.limit": func(s *Schema) {
+		s.Minimum = intPtr(1)
+		s.Maximum = intPtr(models.MaxPageLimit)
+		s.Default = models.DefaultPageLimit
+	},
+	"Sorting.sort_by": func(s *Schema) {
+		s.Enum = models.SortByFields
+		s.Default = "total_value"
+		s.Description = "Fields other than total_value require the matching dimension in group_by."
+	},
+	"Sorting.sort_order": func(s *Schema) {
+		s.Enum = models.SortOrders
+		s.Default = "desc"
+	},
+	"APIKeyRequest.scopes": func(s *Schema) {
+		s.Items.Enum = models.Scopes
+	},
+	"ProblemDetails.code": func(s *Schema) {
+		s.Description = "Stable machine-readable error code, e.g. INVALID_GROUP_BY or QUERY_TIMEOUT."
+	},
+	"ProblemDetails.field": func(s *Schema) {
+		s.Description = "JSON pointer into the request body, or the query parameter at fault."
+	},
+}
+
+var required = map[string][]string{
+	"AggregateRequest": {"date_range", "group_by"},
+	"DateRange":        {"start_year", "end_year"},
+	"ProblemDetails":   {"type", "title", "status", "detail", "detail_ar", "code"},
+	"Product":          {"product_id", "product_desc_en", "product_desc_ar"},
+	"Country":          {"country_id", "country_name_en", "country_name_ar"},
+	"Port":             {"port_id", "port_name_en", "port_name_ar", "port_type_en", "port_type_ar", "mode_id"},
+	"APIKeyRequest":    {"name", "scopes"},
+}
+
+var (
+	rawMessageType = reflect.TypeOf(json.RawMessage{})
+	timeType       = reflect.TypeOf(time.Time{})
+)
+
+// generator derives JSON schemas from Go types using their json tags. Named
+// structs are emitted once under components and referenced, unless inline is set.
+type generator struct {
+	components map[string]*Schema
+	inline     bool
+}
+
+func newGenerator() *generator {
+	return &generator{components: map[string]*Schema{}}
+}
+
+// InlineSchema returns a self-contained JSON schema for v without $refs, for
+// consumers such as tool definitions that cannot resolve components.
+func InlineSchema(v interface{}) *Schema {
+	g := &generator{components: map[string]*Schema{}, inline: true}
+	return g.schemaOf(reflect.TypeOf(v))
+}
+
+func (g *generator) ref(v interface{}) *Schema {
+	return g.schemaOf(reflect.TypeOf(v))
+}
+
+func (g *generator) schemaOf(t reflect.Type) *Schema {
+	if t.Kind() == reflect.Ptr {
+		s := g.schemaOf(t.Elem())
+		if s.Ref == "" {
+			s.Nullable = true
+		}
+		return s
+	}
+
+	switch {
+	case t == rawMessageType:
+		return &Schema{Description: "Arbitrary JSON"}
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Interface:
+		return &Schema{}
+	case reflect.Struct:
+		if g.inline || t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate.
+			g.components[t.Name()] = &Schema{}
+			*g.components[t.Name()] = *g.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+	return &Schema{}
+}
+
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: map[string]*Schema{}, Required: required[t.Name()]}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" && field.Anonymous && field.Type.Kind() == reflect.Struct {
+			// Embedded structs contribute their fields, as in encoding/json
+			embedded := g.structSchema(field.Type)
+			for k, v := range embedded.Properties {
+				s.Properties[k] = v
+			}
+			s.Required = slices.Concat(s.Required, embedded.Required)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		prop := g.schemaOf(field.Type)
+		if apply, ok := constraints[t.Name()+"."+name]; ok {
+			apply(prop)
+		}
+		s.Properties[name] = prop
+	}
+	return s
+}
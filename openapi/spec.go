@@ -0,0 +1,538 @@
+package openapi
+
+import (
+	"strings"
+	"sync"
+
+	"trade-api/models"
+	"trade-api/problem"
+	"trade-api/sdmx"
+)
+
+type HealthResponse struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+var (
+	specOnce sync.Once
+	spec     *Document
+)
+
+// Spec returns the OpenAPI document for every route registered by the server.
+func Spec() *Document {
+	specOnce.Do(func() {
+		spec = build()
+	})
+	return spec
+}
+
+func build() *Document {
+	g := newGenerator()
+	doc := &Document{
+		OpenAPI: "3.0.3",
+		Info: Info{
+			Title:       "Trade Data Warehouse API",
+			Version:     "1.0",
+			Description: "Query international trade data by product, country, port, year and trade type.",
+		},
+		Servers:  []Server{{URL: "/"}},
+		Paths:    map[string]*PathItem{},
+		Security: []SecurityRequirement{{"ApiKey": {}}},
+	}
+	doc.Components.SecuritySchemes = map[string]*SecurityScheme{
+		"ApiKey": {
+			Type: "apiKey",
+			Name: "X-API-Key",
+			In:   "header",
+			Description: "An API key, also accepted as an Authorization bearer token. Keys have scopes: " +
+				"read:dimensions for the dimensions, metadata and SDMX structure; read:trade for trade data, " +
+				"releases, quality, /ask and MCP; export for formats other than JSON and the SDMX data messages; " +
+				"admin for /api/v1/admin. Unless the server requires keys, requests without one get every scope but admin.",
+		},
+	}
+
+	add := func(method, path string, op *Operation) {
+		item, ok := doc.Paths[path]
+		if !ok {
+			item = &PathItem{}
+			doc.Paths[path] = item
+		}
+		if op.Responses == nil {
+			op.Responses = map[string]Response{}
+		}
+		op.Responses["default"] = problemResponse("Error", g.ref(problem.ProblemDetails{}))
+
+		// The system paths never need a key
+		if !strings.HasPrefix(path, "/api/") && !strings.HasPrefix(path, "/mcp") {
+			op.Security = &[]SecurityRequirement{}
+		}
+
+		// Every data route runs under middleware.Timeout
+		if strings.HasPrefix(path, "/api/v1/") && path != "/api/v1/tools" {
+			op.Parameters = append(op.Parameters, timeoutParam())
+		}
+
+		switch method {
+		case "GET":
+			item.Get = op
+		case "POST":
+			item.Post = op
+		case "PUT":
+			item.Put = op
+		case "PATCH":
+			item.Patch = op
+		case "DELETE":
+			item.Delete = op
+		}
+	}
+
+	add("GET", "/health", &Operation{
+		OperationID: "getHealth",
+		Summary:     "Health check",
+		Tags:        []string{"system"},
+		Responses: map[string]Response{
+			"200": jsonResponse("Database reachable", g.ref(HealthResponse{})),
+			"503": jsonResponse("Database unreachable", g.ref(HealthResponse{})),
+		},
+	})
+	add("GET", "/openapi.json", &Operation{
+		OperationID: "getOpenAPISpec",
+		Summary:     "This OpenAPI document",
+		Tags:        []string{"system"},
+		Responses:   map[string]Response{"200": jsonResponse("OpenAPI 3 document", &Schema{Type: "object"})},
+	})
+	add("GET", "/docs", &Operation{
+		OperationID: "getDocs",
+		Summary:     "Interactive API documentation",
+		Tags:        []string{"system"},
+		Responses:   map[string]Response{"200": contentResponse("Swagger UI", "text/html", &Schema{Type: "string"})},
+	})
+
+	// Dimensions
+	add("GET", "/api/v1/dimensions/products", &Operation{
+		OperationID: "listProducts",
+		Summary:     "List or search products",
+		Tags:        []string{"dimensions"},
+		Parameters:  []Parameter{searchParam(), limitParam()},
+		Responses:   map[string]Response{"200": jsonResponse("Products", g.ref([]models.Product{}))},
+	})
+	add("GET", "/api/v1/dimensions/countries", &Operation{
+		OperationID: "listCountries",
+		Summary:     "List or search countries",
+		Tags:        []string{"dimensions"},
+		Parameters:  []Parameter{searchParam(), limitParam()},
+		Responses:   map[string]Response{"200": jsonResponse("Countries", g.ref([]models.Country{}))},
+	})
+	add("GET", "/api/v1/dimensions/ports", &Operation{
+		OperationID: "listPorts",
+		Summary:     "List or search ports",
+		Tags:        []string{"dimensions"},
+		Parameters: []Parameter{
+			searchParam(),
+			{Name: "port_type", In: "query", Description: "Exact English port type, e.g. Sea", Schema: &Schema{Type: "string"}},
+			limitParam(),
+		},
+		Responses: map[string]Response{"200": jsonResponse("Ports", g.ref([]models.Port{}))},
+	})
+	add("GET", "/api/v1/dimensions/ports/{id}/history", &Operation{
+		OperationID: "getPortHistory",
+		Summary:     "Every version of a port's names, type and location",
+		Description: "Versions are oldest first. Each applies from valid_from up to, but not including, valid_to; " +
+			"the first has no valid_from and the current one no valid_to.",
+		Tags:       []string{"dimensions"},
+		Parameters: []Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}}},
+		Responses: map[string]Response{
+			"200": jsonResponse("Port versions", g.ref([]models.PortVersion{})),
+			"404": problemResponse("Unknown port", g.ref(problem.ProblemDetails{})),
+		},
+	})
+
+	// Trade
+	add("GET", "/api/v1/trade/summary", &Operation{
+		OperationID: "getTradeSummary",
+		Summary:     "Yearly trade summary",
+		Tags:        []string{"trade"},
+		Parameters:  append(yearRangeParams(), formatParam("json", "markdown"), langParam()),
+		Responses: map[string]Response{"200": {
+			Description: "Summary per year",
+			Content: map[string]MediaType{
+				"application/json": {Schema: g.ref([]models.TradeSummary{})},
+				"text/markdown":    {Schema: &Schema{Type: "string"}},
+			},
+		}},
+	})
+	add("GET", "/api/v1/trade/balance", &Operation{
+		OperationID: "getTradeBalance",
+		Summary:     "Trade balance over a range of years",
+		Description: "trade_balance = exports + re-exports - imports",
+		Tags:        []string{"trade"},
+		Parameters:  append(yearRangeParams(), formatParam("json", "markdown"), langParam()),
+		Responses: map[string]Response{"200": {
+			Description: "Balance for the period",
+			Content: map[string]MediaType{
+				"application/json": {Schema: g.ref(models.TradeBalance{})},
+				"text/markdown":    {Schema: &Schema{Type: "string"}},
+			},
+		}},
+	})
+	add("POST", "/api/v1/trade/aggregate", &Operation{
+		OperationID: "aggregateTradeData",
+		Summary:     "Aggregate trade values by any combination of dimensions",
+		Tags:        []string{"trade"},
+		Parameters: []Parameter{
+			formatParam("json", "geojson", "markdown"),
+			langParam(),
+			{
+				Name:        "dry_run",
+				In:          "query",
+				Description: "Admin only: return the generated SQL, arguments, fact table and joins instead of results",
+				Schema:      &Schema{Type: "boolean"},
+			},
+			{
+				Name:        "explain",
+				In:          "query",
+				Description: "Admin only: like dry_run, plus EXPLAIN (ANALYZE, FORMAT JSON) output",
+				Schema:      &Schema{Type: "boolean"},
+			},
+		},
+		RequestBody: jsonBody(g.ref(models.AggregateRequest{})),
+		Responses: map[string]Response{"200": {
+			Description: "A page of aggregated rows, or the query plan for dry_run and explain",
+			Content: map[string]MediaType{
+				"application/json": {Schema: &Schema{OneOf: []*Schema{
+					g.ref(models.PaginatedResponse{}),
+					g.ref(models.QueryPlan{}),
+				}}},
+				"application/geo+json": {Schema: g.ref(models.FeatureCollection{})},
+				"text/markdown":        {Schema: &Schema{Type: "string"}},
+			},
+		}},
+	})
+
+	// Releases
+	add("GET", "/api/v1/releases", &Operation{
+		OperationID: "listReleases",
+		Summary:     "Data releases, newest first",
+		Description: "Each load and summary rebuild creates a numbered release. Pass as_of_release to the trade " +
+			"endpoints to read the data as it was published in that release.",
+		Tags:      []string{"releases"},
+		Responses: map[string]Response{"200": jsonResponse("Releases", g.ref([]models.Release{}))},
+	})
+	add("POST", "/api/v1/releases/diff", &Operation{
+		OperationID: "diffReleases",
+		Summary:     "Aggregates that changed between two releases",
+		Description: "Runs the aggregate request in the body against both releases and returns the groups whose " +
+			"total differs. as_of_release is not allowed in the body.",
+		Tags: []string{"releases"},
+		Parameters: []Parameter{
+			{
+				Name:        "from",
+				In:          "query",
+				Description: "Release to compare against; 0 compares with no data. Defaults to the release before to.",
+				Schema:      &Schema{Type: "integer", Minimum: intPtr(0)},
+			},
+			releaseParam("to", "Release to compare; the latest when omitted"),
+		},
+		RequestBody: jsonBody(g.ref(models.AggregateRequest{})),
+		Responses:   map[string]Response{"200": jsonResponse("A page of changed aggregates", g.ref(models.ReleaseDiff{}))},
+	})
+
+	// Agents
+	add("GET", "/api/v1/tools", &Operation{
+		OperationID: "listTools",
+		Summary:     "LLM function-calling definitions for the API capabilities",
+		Description: "Parameters are JSON Schemas generated from the same rules the server validates against.",
+		Tags:        []string{"agents"},
+		Parameters: []Parameter{{
+			Name:   "format",
+			In:     "query",
+			Schema: &Schema{Type: "string", Enum: []string{"generic", "openai", "anthropic", "gemini"}, Default: "generic"},
+		}},
+		Responses: map[string]Response{"200": jsonResponse("Tool definitions in the requested format", &Schema{})},
+	})
+
+	add("GET", "/api/v1/metadata", &Operation{
+		OperationID: "getMetadata",
+		Summary:     "Describe the available data",
+		Description: "Years and trade types per fact table, port types, mode IDs, valid group_by and sort_by values, " +
+			"dimension counts, the last data load and which dimensions can be combined. Cached for 10 minutes.",
+		Tags: []string{"metadata"},
+		Responses: map[string]Response{
+			"200": jsonResponse("Data catalog", g.ref(models.Metadata{})),
+		},
+	})
+	add("GET", "/api/v1/quality", &Operation{
+		OperationID: "getQuality",
+		Summary:     "Check whether the data can be trusted",
+		Description: "Per year and trade type, the totals of both fact tables and the yearly summary and whether they agree " +
+			"within the configured tolerance; dimension IDs used by facts but missing from their dimension; dimension rows " +
+			"with empty Arabic names; and years a fact table holds without every trade type. Cached like /metadata.",
+		Tags: []string{"metadata"},
+		Responses: map[string]Response{
+			"200": jsonResponse("Data quality report", g.ref(models.QualityReport{})),
+		},
+	})
+	add("POST", "/api/v1/ask", &Operation{
+		OperationID: "askQuestion",
+		Summary:     "Answer an English or Arabic question about trade",
+		Description: "The question is translated into an aggregate request, validated and executed. " +
+			"Both the structured request and the result are returned.",
+		Tags:        []string{"agents"},
+		RequestBody: jsonBody(g.ref(models.AskRequest{})),
+		Responses: map[string]Response{
+			"200": jsonResponse("Translated request and result", g.ref(models.AskResponse{})),
+			"422": problemResponse("The question could not be translated into a valid query", g.ref(problem.ProblemDetails{})),
+		},
+	})
+	add("POST", "/mcp", &Operation{
+		OperationID: "postMCPMessage",
+		Summary:     "Model Context Protocol (Streamable HTTP transport)",
+		Description: "Send a JSON-RPC 2.0 message; the reply is returned in the response body.",
+		Tags:        []string{"agents"},
+		RequestBody: jsonBody(&Schema{Type: "object"}),
+		Responses: map[string]Response{
+			"200": jsonResponse("JSON-RPC reply", &Schema{Type: "object"}),
+			"202": {Description: "Notification accepted"},
+		},
+	})
+	add("GET", "/mcp/sse", &Operation{
+		OperationID: "openMCPStream",
+		Summary:     "Model Context Protocol (HTTP+SSE transport) event stream",
+		Description: "The first endpoint event carries the URL to POST messages to; replies arrive as message events.",
+		Tags:        []string{"agents"},
+		Responses:   map[string]Response{"200": contentResponse("Event stream", "text/event-stream", &Schema{Type: "string"})},
+	})
+	add("POST", "/mcp/messages", &Operation{
+		OperationID: "postMCPSessionMessage",
+		Summary:     "Model Context Protocol (HTTP+SSE transport) message",
+		Tags:        []string{"agents"},
+		Parameters:  []Parameter{{Name: "session_id", In: "query", Required: true, Schema: &Schema{Type: "string"}}},
+		RequestBody: jsonBody(&Schema{Type: "object"}),
+		Responses:   map[string]Response{"202": {Description: "Accepted; the reply is sent on the event stream"}},
+	})
+
+	// SDMX
+	add("GET", "/api/v1/sdmx/datastructure", &Operation{
+		OperationID: "getSDMXDataStructure",
+		Summary:     "SDMX data structure definition and code lists",
+		Tags:        []string{"sdmx"},
+		Responses: map[string]Response{
+			"200": contentResponse("SDMX-JSON structure message", sdmx.StructureMediaType, g.ref(sdmx.StructureMessage{})),
+		},
+	})
+	add("GET", "/api/v1/sdmx/data/summary", &Operation{
+		OperationID: "getSDMXSummary",
+		Summary:     "Yearly trade summary as SDMX-JSON",
+		Tags:        []string{"sdmx"},
+		Parameters:  yearRangeParams(),
+		Responses: map[string]Response{
+			"200": contentResponse("SDMX-JSON data message", sdmx.DataMediaType, g.ref(sdmx.DataMessage{})),
+		},
+	})
+	add("GET", "/api/v1/sdmx/data/balance", &Operation{
+		OperationID: "getSDMXBalance",
+		Summary:     "Trade balance as SDMX-JSON",
+		Tags:        []string{"sdmx"},
+		Parameters:  yearRangeParams(),
+		Responses: map[string]Response{
+			"200": contentResponse("SDMX-JSON data message", sdmx.DataMediaType, g.ref(sdmx.DataMessage{})),
+		},
+	})
+	add("POST", "/api/v1/sdmx/data/aggregate", &Operation{
+		OperationID: "getSDMXAggregate",
+		Summary:     "Aggregate query as SDMX-JSON",
+		Tags:        []string{"sdmx"},
+		RequestBody: jsonBody(g.ref(models.AggregateRequest{})),
+		Responses: map[string]Response{
+			"200": contentResponse("SDMX-JSON data message", sdmx.DataMediaType, g.ref(sdmx.DataMessage{})),
+		},
+	})
+
+	// Maintenance
+	add("POST", "/api/v1/admin/summary/rebuild", &Operation{
+		OperationID: "rebuildSummary",
+		Summary:     "Rebuild the yearly summary from the fact tables",
+		Description: "Admin only. Recomputes fact_yearly_summary from fact_trade_by_product_port and reconciles each year " +
+			"and trade type with fact_trade_by_country_port. The summary is published only when every difference is " +
+			"within the configured tolerance; otherwise nothing changes and the discrepancies are returned as errors.",
+		Tags: []string{"admin"},
+		Parameters: []Parameter{{
+			Name:        "dry_run",
+			In:          "query",
+			Description: "Report the rebuild and reconciliation without publishing",
+			Schema:      &Schema{Type: "boolean"},
+		}},
+		Responses: map[string]Response{
+			"200": jsonResponse("The rebuild, published unless dry_run was set", g.ref(models.SummaryRebuild{})),
+			"409": problemResponse("The fact tables differ by more than the tolerance", g.ref(problem.ProblemDetails{})),
+		},
+	})
+
+	// Dimension corrections
+	idParam := Parameter{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}}
+	for _, d := range []struct {
+		path, name, noun string
+		member           interface{}
+		effective        bool
+	}{
+		{"products", "Product", "product", models.Product{}, false},
+		{"countries", "Country", "country", models.Country{}, true},
+		{"ports", "Port", "port", models.Port{}, true},
+	} {
+		collection := "/api/v1/admin/dimensions/" + d.path
+		history := ""
+		if d.effective {
+			history = " The change takes effect in the " + d.noun + "'s history today."
+		}
+		add("POST", collection, &Operation{
+			OperationID: "create" + d.name,
+			Summary:     "Add a " + d.noun,
+			Description: "Admin only. Names are required in English and Arabic, and IDs are never reused, " +
+				"even those of deleted members." + history,
+			Tags:        []string{"admin"},
+			RequestBody: jsonBody(g.ref(d.member)),
+			Responses: map[string]Response{
+				"201": jsonResponse("The new "+d.noun, g.ref(d.member)),
+				"409": problemResponse("The ID is taken", g.ref(problem.ProblemDetails{})),
+			},
+		})
+		add("PUT", collection+"/{id}", &Operation{
+			OperationID: "update" + d.name,
+			Summary:     "Correct a " + d.noun,
+			Description: "Admin only. Replaces every attribute; the body may repeat the ID in the path." + history,
+			Tags:        []string{"admin"},
+			Parameters:  []Parameter{idParam},
+			RequestBody: jsonBody(g.ref(d.member)),
+			Responses: map[string]Response{
+				"200": jsonResponse("The updated "+d.noun, g.ref(d.member)),
+				"404": problemResponse("Unknown or deleted "+d.noun, g.ref(problem.ProblemDetails{})),
+			},
+		})
+		add("DELETE", collection+"/{id}", &Operation{
+			OperationID: "delete" + d.name,
+			Summary:     "Soft-delete a " + d.noun,
+			Description: "Admin only. The " + d.noun + " leaves the dimension lists but keeps labelling the facts that use it.",
+			Tags:        []string{"admin"},
+			Parameters:  []Parameter{idParam},
+			Responses: map[string]Response{
+				"204": {Description: "Deleted"},
+				"404": problemResponse("Unknown or already deleted "+d.noun, g.ref(problem.ProblemDetails{})),
+			},
+		})
+		add("POST", collection+"/{id}/restore", &Operation{
+			OperationID: "restore" + d.name,
+			Summary:     "Restore a deleted " + d.noun,
+			Tags:        []string{"admin"},
+			Parameters:  []Parameter{idParam},
+			Responses: map[string]Response{
+				"204": {Description: "Restored"},
+				"404": problemResponse("No deleted "+d.noun+" with the ID", g.ref(problem.ProblemDetails{})),
+			},
+		})
+	}
+	add("GET", "/api/v1/admin/dimensions/audit", &Operation{
+		OperationID: "listDimensionAudit",
+		Summary:     "Admin changes to dimension members, newest first",
+		Tags:        []string{"admin"},
+		Parameters: []Parameter{
+			{Name: "table", In: "query", Schema: &Schema{Type: "string", Enum: []string{"dim_product", "dim_country", "dim_port"}}},
+			{Name: "id", In: "query", Description: "Member ID, with or without table", Schema: &Schema{Type: "integer"}},
+			limitParam(),
+		},
+		Responses: map[string]Response{"200": jsonResponse("Audit entries", g.ref([]models.AuditEntry{}))},
+	})
+
+	add("GET", "/api/v1/admin/keys", &Operation{
+		OperationID: "listAPIKeys",
+		Summary:     "API keys, newest first",
+		Description: "Admin only. Lists each key's prefix, scopes and last use, never the key itself.",
+		Tags:        []string{"admin"},
+		Responses:   map[string]Response{"200": jsonResponse("API keys", g.ref([]models.APIKey{}))},
+	})
+	add("POST", "/api/v1/admin/keys", &Operation{
+		OperationID: "createAPIKey",
+		Summary:     "Create an API key",
+		Description: "Admin only. The response holds the key, which is shown only this once; the server keeps its hash.",
+		Tags:        []string{"admin"},
+		RequestBody: jsonBody(g.ref(models.APIKeyRequest{})),
+		Responses:   map[string]Response{"201": jsonResponse("The new key", g.ref(models.NewAPIKey{}))},
+	})
+	add("DELETE", "/api/v1/admin/keys/{id}", &Operation{
+		OperationID: "revokeAPIKey",
+		Summary:     "Revoke an API key",
+		Description: "Admin only. The key stops working at once and stays listed as revoked.",
+		Tags:        []string{"admin"},
+		Parameters:  []Parameter{{Name: "id", In: "path", Required: true, Schema: &Schema{Type: "integer"}}},
+		Responses: map[string]Response{
+			"204": {Description: "Revoked"},
+			"404": problemResponse("Unknown or already revoked key", g.ref(problem.ProblemDetails{})),
+		},
+	})
+
+	doc.Components.Schemas = g.components
+	return doc
+}
+
+func jsonResponse(description string, schema *Schema) Response {
+	return contentResponse(description, "application/json", schema)
+}
+
+func problemResponse(description string, schema *Schema) Response {
+	return contentResponse(description, problem.ContentType, schema)
+}
+
+func contentResponse(description, mediaType string, schema *Schema) Response {
+	return Response{Description: description, Content: map[string]MediaType{mediaType: {Schema: schema}}}
+}
+
+func jsonBody(schema *Schema) *RequestBody {
+	return &RequestBody{Required: true, Content: map[string]MediaType{"application/json": {Schema: schema}}}
+}
+
+func searchParam() Parameter {
+	return Parameter{Name: "search", In: "query", Description: "Case-insensitive match on the English or Arabic name", Schema: &Schema{Type: "string"}}
+}
+
+func limitParam() Parameter {
+	return Parameter{Name: "limit", In: "query", Schema: &Schema{
+		Type:    "integer",
+		Minimum: intPtr(1),
+		Maximum: intPtr(models.MaxSearchLimit),
+		Default: models.DefaultSearchLimit,
+	}}
+}
+
+func yearRangeParams() []Parameter {
+	return []Parameter{
+		{Name: "start_year", In: "query", Required: true, Schema: &Schema{Type: "integer"}},
+		{Name: "end_year", In: "query", Required: true, Schema: &Schema{Type: "integer"}},
+		releaseParam("as_of_release", "Release to read the data as of; the latest when omitted"),
+	}
+}
+
+func releaseParam(name, description string) Parameter {
+	return Parameter{Name: name, In: "query", Description: description, Schema: &Schema{Type: "integer", Minimum: intPtr(1)}}
+}
+
+func formatParam(formats ...string) Parameter {
+	return Parameter{Name: "format", In: "query", Schema: &Schema{Type: "string", Enum: formats, Default: formats[0]}}
+}
+
+func timeoutParam() Parameter {
+	return Parameter{
+		Name:        "timeout_ms",
+		In:          "query",
+		Description: "Query time limit in milliseconds, capped by the server. Defaults depend on the endpoint.",
+		Schema:      &Schema{Type: "integer", Minimum: intPtr(1)},
+	}
+}
+
+func langParam() Parameter {
+	return Parameter{
+		Name:        "lang",
+		In:          "query",
+		Description: "Language of markdown output; on JSON aggregates, drops names in the other language",
+		Schema:      &Schema{Type: "string", Enum: []string{"en", "ar"}, Default: "en"},
+	}
+}
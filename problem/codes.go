@@ -0,0 +1,68 @@
+package problem
+
+import "github.com/gofiber/fiber/v2"
+
+// Stable error codes. Clients may switch on these; messages may change.
+const (
+	CodeInvalidBody            = "INVALID_BODY"
+	CodeValidationFailed       = "VALIDATION_FAILED"
+	CodeUnknownField           = "UNKNOWN_FIELD"
+	CodeInvalidType            = "INVALID_TYPE"
+	CodeYearOutOfRange         = "YEAR_OUT_OF_RANGE"
+	CodeTooManyFilterIDs       = "TOO_MANY_FILTER_IDS"
+	CodeInvalidPagination      = "INVALID_PAGINATION"
+	CodeInvalidTimeout         = "INVALID_TIMEOUT"
+	CodeMissingDateRange       = "MISSING_DATE_RANGE"
+	CodeInvalidDateRange       = "INVALID_DATE_RANGE"
+	CodeUnknownRelease         = "UNKNOWN_RELEASE"
+	CodeMissingGroupBy         = "MISSING_GROUP_BY"
+	CodeInvalidGroupBy         = "INVALID_GROUP_BY"
+	CodeIncompatibleDimensions = "INCOMPATIBLE_DIMENSIONS"
+	CodeInvalidTradeType       = "INVALID_TRADE_TYPE"
+	CodeInvalidSortBy          = "INVALID_SORT_BY"
+	CodeInvalidSortOrder       = "INVALID_SORT_ORDER"
+	CodeInvalidFormat          = "INVALID_FORMAT"
+	CodeInvalidLang            = "INVALID_LANG"
+	CodeInvalidQuestion        = "INVALID_QUESTION"
+	CodeQuestionNotUnderstood  = "QUESTION_NOT_UNDERSTOOD"
+	CodeMissingField           = "MISSING_FIELD"
+	CodeInvalidField           = "INVALID_FIELD"
+	CodeDuplicateID            = "DUPLICATE_ID"
+	CodeVersionConflict        = "VERSION_CONFLICT"
+	CodeAuthRequired           = "AUTHENTICATION_REQUIRED"
+	CodeInvalidAPIKey          = "INVALID_API_KEY"
+	CodeScopeRequired          = "SCOPE_REQUIRED"
+	CodeAdminRequired          = "ADMIN_REQUIRED"
+	CodeReconciliationFailed   = "RECONCILIATION_FAILED"
+	CodeQueryTimeout           = "QUERY_TIMEOUT"
+	CodeQueryFailed            = "QUERY_FAILED"
+	CodeTranslatorFailed       = "TRANSLATOR_FAILED"
+	CodeSessionNotFound        = "SESSION_NOT_FOUND"
+	CodeNotFound               = "NOT_FOUND"
+	CodeMethodNotAllowed       = "METHOD_NOT_ALLOWED"
+	CodeRateLimited            = "RATE_LIMITED"
+	CodeInternal               = "INTERNAL_ERROR"
+)
+
+var statusCodes = map[int]string{
+	fiber.StatusNotFound:            CodeNotFound,
+	fiber.StatusMethodNotAllowed:    CodeMethodNotAllowed,
+	fiber.StatusTooManyRequests:     CodeRateLimited,
+	fiber.StatusInternalServerError: CodeInternal,
+}
+
+// statusMessagesAR is the Arabic fallback for errors without their own
+// Arabic message, such as those raised by the framework.
+var statusMessagesAR = map[int]string{
+	fiber.StatusBadRequest:            "الطلب غير صالح",
+	fiber.StatusUnauthorized:          "يلزم تسجيل الدخول",
+	fiber.StatusForbidden:             "ليست لديك صلاحية",
+	fiber.StatusNotFound:              "المورد غير موجود",
+	fiber.StatusMethodNotAllowed:      "الطريقة غير مسموح بها",
+	fiber.StatusRequestEntityTooLarge: "حجم الطلب كبير جداً",
+	fiber.StatusUnprocessableEntity:   "تعذّرت معالجة الطلب",
+	fiber.StatusTooManyRequests:       "عدد الطلبات كبير جداً، حاول لاحقاً",
+	fiber.StatusInternalServerError:   "خطأ داخلي في الخادم",
+	fiber.StatusServiceUnavailable:    "الخدمة غير متاحة",
+	fiber.StatusGatewayTimeout:        "انتهت مهلة الطلب",
+}
@@ -0,0 +1,201 @@
+// Package problem implements RFC 7807 problem details for API errors.
+//
+// Handlers return *Error values carrying a stable machine-readable code and
+// an English and Arabic message. Internal causes are kept on the error for
+// server-side logging and never reach the client.
+package problem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// ContentType is the media type of problem responses.
+const ContentType = "application/problem+json"
+
+// typePrefix makes codes into the URI references required by the "type" member.
+const typePrefix = "urn:trade-api:problem:"
+
+// StatusClientClosed is the status logged for requests whose client closed
+// the connection before the response, after nginx's 499.
+const StatusClientClosed = 499
+
+// ErrClientClosed is the cause of a request context canceled because the
+// client closed its connection. Nothing failed, so such requests are neither
+// reported as timeouts nor logged as errors.
+var ErrClientClosed = errors.New("client closed the connection")
+
+// ClientClosed reports whether ctx was canceled with ErrClientClosed.
+func ClientClosed(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrClientClosed)
+}
+
+// Error is an API error. Field is a JSON pointer into the request body (e.g.
+// "/group_by/0") or the name of the offending query parameter. Errors holds
+// every problem found when validation reports more than one.
+type Error struct {
+	Status    int
+	Code      string
+	Field     string
+	Message   string
+	MessageAR string
+	Err       error
+	Errors    []*Error
+}
+
+func New(status int, code, message, messageAR string) *Error {
+	return &Error{Status: status, Code: code, Message: message, MessageAR: messageAR}
+}
+
+// BadRequest is a 400 for the given field.
+func BadRequest(code, field, message, messageAR string) *Error {
+	return &Error{Status: fiber.StatusBadRequest, Code: code, Field: field, Message: message, MessageAR: messageAR}
+}
+
+// Validation reports every error in errs in one 400 response, or returns nil
+// when errs is empty. A single error keeps its own code.
+func Validation(errs []*Error) error {
+	switch len(errs) {
+	case 0:
+		return nil
+	case 1:
+		e := *errs[0]
+		e.Errors = errs
+		return &e
+	}
+	return &Error{
+		Status:    fiber.StatusBadRequest,
+		Code:      CodeValidationFailed,
+		Message:   fmt.Sprintf("The request has %d validation errors", len(errs)),
+		MessageAR: fmt.Sprintf("يحتوي الطلب على %d أخطاء في التحقق", len(errs)),
+		Errors:    errs,
+	}
+}
+
+// Internal wraps err as a 500 with a generic message; err is only logged.
+// Timeouts are reported as QUERY_TIMEOUT instead.
+func Internal(code, message, messageAR string, err error) *Error {
+	if isTimeout(err) {
+		return timeout(err)
+	}
+	return &Error{Status: fiber.StatusInternalServerError, Code: code, Message: message, MessageAR: messageAR, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Code + ": " + e.Message + ": " + e.Err.Error()
+	}
+	return e.Code + ": " + e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ProblemDetails is the problem+json body.
+type ProblemDetails struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail"`
+	DetailAR  string       `json:"detail_ar"`
+	Code      string       `json:"code"`
+	Field     string       `json:"field,omitempty"`
+	Instance  string       `json:"instance"`
+	Method    string       `json:"method"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+}
+
+// FieldError is one entry of a validation problem's errors list.
+type FieldError struct {
+	Code     string `json:"code"`
+	Field    string `json:"field,omitempty"`
+	Detail   string `json:"detail"`
+	DetailAR string `json:"detail_ar"`
+}
+
+// From converts any error returned by a handler. Framework errors such as
+// unknown routes or rate limiting get a code derived from their status.
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	if isTimeout(err) {
+		return timeout(err)
+	}
+
+	var fiberErr *fiber.Error
+	if errors.As(err, &fiberErr) {
+		if fiberErr.Code >= fiber.StatusInternalServerError {
+			return &Error{Status: fiberErr.Code, Code: statusCode(fiberErr.Code),
+				Message: http.StatusText(fiberErr.Code), MessageAR: statusMessagesAR[fiberErr.Code], Err: err}
+		}
+		return &Error{Status: fiberErr.Code, Code: statusCode(fiberErr.Code),
+			Message: fiberErr.Message, MessageAR: statusMessagesAR[fiberErr.Code]}
+	}
+
+	return &Error{Status: fiber.StatusInternalServerError, Code: CodeInternal,
+		Message: "Internal server error", MessageAR: statusMessagesAR[fiber.StatusInternalServerError], Err: err}
+}
+
+// Details renders e for the request at instance.
+func (e *Error) Details(instance, method, requestID string) ProblemDetails {
+	messageAR := e.MessageAR
+	if messageAR == "" {
+		messageAR = statusMessagesAR[e.Status]
+	}
+	var errs []FieldError
+	for _, fe := range e.Errors {
+		errs = append(errs, FieldError{Code: fe.Code, Field: fe.Field, Detail: fe.Message, DetailAR: fe.MessageAR})
+	}
+	return ProblemDetails{
+		Type:      typePrefix + e.Code,
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Message,
+		DetailAR:  messageAR,
+		Code:      e.Code,
+		Field:     e.Field,
+		Instance:  instance,
+		Method:    method,
+		RequestID: requestID,
+		Errors:    errs,
+	}
+}
+
+// isTimeout reports whether err comes from a deadline. A cancellation is not
+// one: the client left, which callers check for first with ClientClosed.
+func isTimeout(err error) bool {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	// query_canceled, raised when statement_timeout fires or by the cancel
+	// request sent as a request's deadline passes
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "57014"
+}
+
+func timeout(err error) *Error {
+	return &Error{
+		Status:    fiber.StatusGatewayTimeout,
+		Code:      CodeQueryTimeout,
+		Message:   "The query took too long. Narrow the year range or add filters.",
+		MessageAR: "استغرق الاستعلام وقتاً طويلاً. قلّص نطاق السنوات أو أضف عوامل تصفية.",
+		Err:       err,
+	}
+}
+
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	return strings.ToUpper(strings.ReplaceAll(http.StatusText(status), " ", "_"))
+}
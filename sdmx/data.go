@@ -0,0 +1,238 @@
+package sdmx
+
+import (
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"trade-api/models"
+)
+
+type DataMessage struct {
+	Header    Header           `json:"header"`
+	DataSets  []DataSet        `json:"dataSets"`
+	Structure MessageStructure `json:"structure"`
+}
+
+type DataSet struct {
+	Action       string                   `json:"action"`
+	Observations map[string][]interface{} `json:"observations"`
+}
+
+type MessageStructure struct {
+	Links      []Link          `json:"links"`
+	Name       string          `json:"name"`
+	Names      Names           `json:"names,omitempty"`
+	Dimensions ComponentValues `json:"dimensions"`
+	Measures   ComponentValues `json:"measures"`
+	Attributes ComponentValues `json:"attributes"`
+}
+
+type Link struct {
+	URN string `json:"urn"`
+	Rel string `json:"rel"`
+}
+
+type ComponentValues struct {
+	DataSet     []ValuedComponent `json:"dataSet"`
+	Observation []ValuedComponent `json:"observation"`
+}
+
+type ValuedComponent struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Names       Names  `json:"names,omitempty"`
+	KeyPosition *int   `json:"keyPosition,omitempty"`
+	Role        string `json:"role,omitempty"`
+	Values      []Code `json:"values"`
+}
+
+// Observation is a single value keyed by a code for every dimension.
+type Observation struct {
+	Key   map[string]Code
+	Value int64
+}
+
+// NewDataMessage renders observations as a flat (AllDimensions) SDMX-JSON
+// data message.
+func NewDataMessage(name Names, observations []Observation, prepared time.Time) *DataMessage {
+	values := make([][]Code, len(Dimensions))
+	positions := make([]map[string]int, len(Dimensions))
+	for i := range positions {
+		positions[i] = map[string]int{}
+	}
+
+	dataSet := DataSet{Action: "Information", Observations: map[string][]interface{}{}}
+	for _, obs := range observations {
+		key := make([]string, len(Dimensions))
+		for i, dim := range Dimensions {
+			code := obs.Key[dim]
+			pos, ok := positions[i][code.ID]
+			if !ok {
+				pos = len(values[i])
+				positions[i][code.ID] = pos
+				values[i] = append(values[i], code)
+			}
+			key[i] = strconv.Itoa(pos)
+		}
+		dataSet.Observations[strings.Join(key, ":")] = []interface{}{obs.Value}
+	}
+
+	dimensions := []ValuedComponent{}
+	for i, dim := range Dimensions {
+		position := i
+		component := ValuedComponent{
+			ID:          dim,
+			Name:        dimensionNames[dim]["en"],
+			Names:       dimensionNames[dim],
+			KeyPosition: &position,
+			Values:      values[i],
+		}
+		if dim == DimTimePeriod {
+			component.Role = "time"
+		}
+		if component.Values == nil {
+			component.Values = []Code{}
+		}
+		dimensions = append(dimensions, component)
+	}
+
+	return &DataMessage{
+		Header:   newHeader(prepared),
+		DataSets: []DataSet{dataSet},
+		Structure: MessageStructure{
+			Links: []Link{
+				{URN: urn("datastructure.DataStructure", StructureID), Rel: "datastructure"},
+				{URN: urn("datastructure.Dataflow", DataflowID), Rel: "dataflow"},
+			},
+			Name:  name["en"],
+			Names: name,
+			Dimensions: ComponentValues{
+				DataSet:     []ValuedComponent{},
+				Observation: dimensions,
+			},
+			Measures: ComponentValues{
+				DataSet: []ValuedComponent{},
+				Observation: []ValuedComponent{{
+					ID:     measureID,
+					Name:   "Observation value",
+					Values: []Code{},
+				}},
+			},
+			Attributes: ComponentValues{
+				DataSet:     []ValuedComponent{},
+				Observation: []ValuedComponent{},
+			},
+		},
+	}
+}
+
+// FromAggregate maps aggregate rows to observations. Dimensions that are not
+// grouped on are reported as totals (_T) over the filtered data.
+func FromAggregate(req *models.AggregateRequest, results []models.AggregateResult) []Observation {
+	observations := []Observation{}
+	for _, r := range results {
+		key := map[string]Code{
+			DimProduct:    TotalCode(),
+			DimCountry:    TotalCode(),
+			DimPort:       TotalCode(),
+			DimTradeType:  TotalCode(),
+			DimTimePeriod: periodCode(req.DateRange.StartYear, req.DateRange.EndYear),
+		}
+		if r.ProductID != nil {
+			key[DimProduct] = memberCode(*r.ProductID, r.ProductDescEN, r.ProductDescAR)
+		}
+		if r.CountryID != nil {
+			key[DimCountry] = memberCode(*r.CountryID, r.CountryNameEN, r.CountryNameAR)
+		}
+		if r.PortID != nil {
+			key[DimPort] = memberCode(*r.PortID, r.PortNameEN, r.PortNameAR)
+		}
+		if r.TradeType != nil {
+			key[DimTradeType] = tradeTypeCode(*r.TradeType)
+		} else if len(req.TradeTypes) == 1 {
+			key[DimTradeType] = tradeTypeCode(req.TradeTypes[0])
+		}
+		if r.Year != nil {
+			key[DimTimePeriod] = periodCode(*r.Year, *r.Year)
+		}
+		observations = append(observations, Observation{Key: key, Value: r.TotalValue})
+	}
+	return observations
+}
+
+// FromSummary emits import, export, re-export and balance observations per year.
+func FromSummary(summaries []models.TradeSummary) []Observation {
+	observations := []Observation{}
+	for _, s := range summaries {
+		period := periodCode(s.Year, s.Year)
+		observations = append(observations,
+			totalObservation("M", period, s.ImportValue),
+			totalObservation("X", period, s.ExportValue),
+			totalObservation("RX", period, s.ReExportValue),
+			totalObservation("BAL", period, s.TradeBalanceValue),
+		)
+	}
+	return observations
+}
+
+func FromBalance(balance *models.TradeBalance) []Observation {
+	period := periodCode(balance.StartYear, balance.EndYear)
+	return []Observation{
+		totalObservation("M", period, balance.TotalImport),
+		totalObservation("X", period, balance.TotalExport),
+		totalObservation("RX", period, balance.TotalReExport),
+		totalObservation("BAL", period, balance.TradeBalance),
+	}
+}
+
+func totalObservation(tradeType string, period Code, value int64) Observation {
+	return Observation{
+		Key: map[string]Code{
+			DimProduct:    TotalCode(),
+			DimCountry:    TotalCode(),
+			DimPort:       TotalCode(),
+			DimTradeType:  tradeTypeCodeByID(tradeType),
+			DimTimePeriod: period,
+		},
+		Value: value,
+	}
+}
+
+// MemberCode builds a code for a dimension table row.
+func MemberCode(id int64, nameEN, nameAR string) Code {
+	return Code{ID: strconv.FormatInt(id, 10), Name: nameEN, Names: Names{"en": nameEN, "ar": nameAR}}
+}
+
+func memberCode(id int64, nameEN, nameAR *string) Code {
+	var en, ar string
+	if nameEN != nil {
+		en = *nameEN
+	}
+	if nameAR != nil {
+		ar = *nameAR
+	}
+	return MemberCode(id, en, ar)
+}
+
+func tradeTypeCode(tradeType string) Code {
+	return tradeTypeCodeByID(TradeTypeCodes[tradeType])
+}
+
+func tradeTypeCodeByID(id string) Code {
+	i := slices.IndexFunc(tradeTypeCodelist, func(c Code) bool { return c.ID == id })
+	if i < 0 {
+		return TotalCode()
+	}
+	return tradeTypeCodelist[i]
+}
+
+// periodCode uses an ISO 8601 interval when the observation spans several years.
+func periodCode(startYear, endYear int) Code {
+	id := strconv.Itoa(startYear)
+	if endYear != startYear {
+		id += "/" + strconv.Itoa(endYear)
+	}
+	return Code{ID: id, Name: id}
+}
@@ -0,0 +1,91 @@
+package sdmx
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	AgencyID           = "MANAFETH"
+	DataflowID         = "DF_TRADE"
+	StructureID        = "DSD_TRADE"
+	ConceptSchemeID    = "CS_TRADE"
+	Version            = "1.0"
+	TotalCodeID        = "_T"
+	DataMediaType      = "application/vnd.sdmx.data+json;version=1.0.0"
+	StructureMediaType = "application/vnd.sdmx.structure+json;version=1.0.0"
+)
+
+// Dimension IDs in key order. TIME_PERIOD is always last, as SDMX requires.
+const (
+	DimProduct    = "PRODUCT"
+	DimCountry    = "COUNTRY"
+	DimPort       = "PORT"
+	DimTradeType  = "TRADE_TYPE"
+	DimTimePeriod = "TIME_PERIOD"
+)
+
+var Dimensions = []string{DimProduct, DimCountry, DimPort, DimTradeType, DimTimePeriod}
+
+var dimensionNames = map[string]Names{
+	DimProduct:    {"en": "Product", "ar": "المنتج"},
+	DimCountry:    {"en": "Country", "ar": "الدولة"},
+	DimPort:       {"en": "Port", "ar": "المنفذ"},
+	DimTradeType:  {"en": "Trade type", "ar": "نوع التجارة"},
+	DimTimePeriod: {"en": "Time period", "ar": "الفترة الزمنية"},
+}
+
+// Trade type codes follow the SDMX balance of payments convention.
+var TradeTypeCodes = map[string]string{
+	"Import":    "M",
+	"Export":    "X",
+	"Re-Export": "RX",
+}
+
+var tradeTypeCodelist = []Code{
+	{ID: "M", Name: "Import", Names: Names{"en": "Import", "ar": "واردات"}},
+	{ID: "X", Name: "Export", Names: Names{"en": "Export", "ar": "صادرات"}},
+	{ID: "RX", Name: "Re-Export", Names: Names{"en": "Re-Export", "ar": "إعادة تصدير"}},
+	{ID: "BAL", Name: "Trade balance", Names: Names{"en": "Trade balance", "ar": "الميزان التجاري"}},
+	TotalCode(),
+}
+
+type Names map[string]string
+
+type Code struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Names Names  `json:"names,omitempty"`
+}
+
+func TotalCode() Code {
+	return Code{ID: TotalCodeID, Name: "Total", Names: Names{"en": "Total", "ar": "الإجمالي"}}
+}
+
+type Sender struct {
+	ID   string `json:"id"`
+	Name string `json:"name,omitempty"`
+}
+
+type Header struct {
+	ID       string    `json:"id"`
+	Test     bool      `json:"test"`
+	Prepared time.Time `json:"prepared"`
+	Sender   Sender    `json:"sender"`
+}
+
+func newHeader(prepared time.Time) Header {
+	return Header{
+		ID:       fmt.Sprintf("IREF%d", prepared.UnixNano()),
+		Prepared: prepared.UTC(),
+		Sender:   Sender{ID: AgencyID, Name: "Trade Data Warehouse API"},
+	}
+}
+
+func urn(class, id string) string {
+	return fmt.Sprintf("urn:sdmx:org.sdmx.infomodel.%s=%s:%s(%s)", class, AgencyID, id, Version)
+}
+
+func codelistID(dimension string) string {
+	return "CL_" + dimension
+}
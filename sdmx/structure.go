@@ -0,0 +1,191 @@
+package sdmx
+
+import "time"
+
+type StructureMessage struct {
+	Meta Header        `json:"meta"`
+	Data StructureData `json:"data"`
+}
+
+type StructureData struct {
+	DataStructures []DataStructure `json:"dataStructures"`
+	Dataflows      []Dataflow      `json:"dataflows"`
+	ConceptSchemes []ConceptScheme `json:"conceptSchemes"`
+	Codelists      []Codelist      `json:"codelists"`
+}
+
+// ConceptScheme holds the concepts the data structure's components name.
+type ConceptScheme struct {
+	ID       string    `json:"id"`
+	AgencyID string    `json:"agencyID"`
+	Version  string    `json:"version"`
+	Name     string    `json:"name"`
+	Names    Names     `json:"names,omitempty"`
+	Concepts []Concept `json:"concepts"`
+}
+
+type Concept struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Names Names  `json:"names,omitempty"`
+}
+
+type Codelist struct {
+	ID       string `json:"id"`
+	AgencyID string `json:"agencyID"`
+	Version  string `json:"version"`
+	Name     string `json:"name"`
+	Names    Names  `json:"names,omitempty"`
+	Codes    []Code `json:"codes"`
+}
+
+type Dataflow struct {
+	ID        string `json:"id"`
+	AgencyID  string `json:"agencyID"`
+	Version   string `json:"version"`
+	Name      string `json:"name"`
+	Names     Names  `json:"names,omitempty"`
+	Structure string `json:"structure"`
+}
+
+type DataStructure struct {
+	ID                      string     `json:"id"`
+	AgencyID                string     `json:"agencyID"`
+	Version                 string     `json:"version"`
+	Name                    string     `json:"name"`
+	Names                   Names      `json:"names,omitempty"`
+	DataStructureComponents Components `json:"dataStructureComponents"`
+}
+
+type Components struct {
+	DimensionList DimensionList `json:"dimensionList"`
+	MeasureList   MeasureList   `json:"measureList"`
+}
+
+type DimensionList struct {
+	ID             string      `json:"id"`
+	Dimensions     []Component `json:"dimensions"`
+	TimeDimensions []Component `json:"timeDimensions"`
+}
+
+type MeasureList struct {
+	ID             string    `json:"id"`
+	PrimaryMeasure Component `json:"primaryMeasure"`
+}
+
+type Component struct {
+	ID                  string          `json:"id"`
+	Position            int             `json:"position,omitempty"`
+	ConceptIdentity     string          `json:"conceptIdentity"`
+	LocalRepresentation *Representation `json:"localRepresentation,omitempty"`
+}
+
+type Representation struct {
+	Enumeration string      `json:"enumeration,omitempty"`
+	TextFormat  *TextFormat `json:"textFormat,omitempty"`
+}
+
+type TextFormat struct {
+	TextType string `json:"textType"`
+}
+
+// NewStructureMessage builds the data structure definition for the trade
+// dataflow. Codes for the coded dimensions come from the dimension tables.
+func NewStructureMessage(products, countries, ports []Code, prepared time.Time) *StructureMessage {
+	codes := map[string][]Code{
+		DimProduct:   append(products, TotalCode()),
+		DimCountry:   append(countries, TotalCode()),
+		DimPort:      append(ports, TotalCode()),
+		DimTradeType: tradeTypeCodelist,
+	}
+
+	dimensions := []Component{}
+	codelists := []Codelist{}
+	concepts := []Concept{}
+	for i, id := range Dimensions {
+		concepts = append(concepts, Concept{ID: id, Name: dimensionNames[id]["en"], Names: dimensionNames[id]})
+		if id == DimTimePeriod {
+			continue
+		}
+		dimensions = append(dimensions, Component{
+			ID:              id,
+			Position:        i + 1,
+			ConceptIdentity: conceptURN(id),
+			LocalRepresentation: &Representation{
+				Enumeration: urn("codelist.Codelist", codelistID(id)),
+			},
+		})
+		codelists = append(codelists, Codelist{
+			ID:       codelistID(id),
+			AgencyID: AgencyID,
+			Version:  Version,
+			Name:     dimensionNames[id]["en"],
+			Names:    dimensionNames[id],
+			Codes:    codes[id],
+		})
+	}
+
+	concepts = append(concepts, Concept{ID: measureID, Name: measureNames["en"], Names: measureNames})
+
+	return &StructureMessage{
+		Meta: newHeader(prepared),
+		Data: StructureData{
+			DataStructures: []DataStructure{{
+				ID:       StructureID,
+				AgencyID: AgencyID,
+				Version:  Version,
+				Name:     "International trade",
+				Names:    Names{"en": "International trade", "ar": "التجارة الدولية"},
+				DataStructureComponents: Components{
+					DimensionList: DimensionList{
+						ID:         "DimensionDescriptor",
+						Dimensions: dimensions,
+						TimeDimensions: []Component{{
+							ID:              DimTimePeriod,
+							Position:        len(Dimensions),
+							ConceptIdentity: conceptURN(DimTimePeriod),
+							LocalRepresentation: &Representation{
+								TextFormat: &TextFormat{TextType: "ObservationalTimePeriod"},
+							},
+						}},
+					},
+					MeasureList: MeasureList{
+						ID: "MeasureDescriptor",
+						PrimaryMeasure: Component{
+							ID:              measureID,
+							ConceptIdentity: conceptURN(measureID),
+						},
+					},
+				},
+			}},
+			Dataflows: []Dataflow{{
+				ID:        DataflowID,
+				AgencyID:  AgencyID,
+				Version:   Version,
+				Name:      "International trade",
+				Names:     Names{"en": "International trade", "ar": "التجارة الدولية"},
+				Structure: urn("datastructure.DataStructure", StructureID),
+			}},
+			ConceptSchemes: []ConceptScheme{{
+				ID:       ConceptSchemeID,
+				AgencyID: AgencyID,
+				Version:  Version,
+				Name:     "International trade concepts",
+				Names:    Names{"en": "International trade concepts", "ar": "مفاهيم التجارة الدولية"},
+				Concepts: concepts,
+			}},
+			Codelists: codelists,
+		},
+	}
+}
+
+// measureID is the primary measure, the trade value of an observation.
+const measureID = "OBS_VALUE"
+
+var measureNames = Names{"en": "Trade value", "ar": "قيمة التجارة"}
+
+// conceptURN refers to concept id of the CS_TRADE scheme the structure
+// message emits.
+func conceptURN(id string) string {
+	return urn("conceptscheme.Concept", ConceptSchemeID) + "." + id
+}
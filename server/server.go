@@ -0,0 +1,204 @@
+package server
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/compress"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/helmet"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/recover"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+
+	"trade-api/config"
+	"trade-api/handlers"
+	"trade-api/mcp"
+	"trade-api/middleware"
+	"trade-api/models"
+	"trade-api/nlq"
+	"trade-api/openapi"
+	"trade-api/problem"
+	"trade-api/store"
+)
+
+// New builds the Fiber app with global middleware and every API route.
+func New(st store.Store, cfg *config.Config) *fiber.App {
+	// Create Fiber app
+	app := fiber.New(fiber.Config{
+		AppName:      "Trade Data Warehouse API v1.0",
+		ErrorHandler: customErrorHandler,
+	})
+
+	// Global middleware
+	app.Use(recover.New())
+	app.Use(requestid.New())
+	app.Use(helmet.New(helmet.Config{
+		// Swagger UI loads its assets from a CDN
+		Next: func(c *fiber.Ctx) bool { return c.Path() == "/docs" },
+	}))
+	app.Use(compress.New(compress.Config{
+		// Compression buffers the body, which would stall event streams
+		Next: func(c *fiber.Ctx) bool { return c.Path() == "/mcp/sse" },
+	}))
+	if len(cfg.CORS.AllowOrigins) > 0 {
+		app.Use(cors.New(cors.Config{
+			AllowOrigins: strings.Join(cfg.CORS.AllowOrigins, ","),
+			AllowHeaders: strings.Join(cfg.CORS.AllowHeaders, ","),
+			MaxAge:       int(cfg.CORS.MaxAge.Seconds()),
+		}))
+	}
+	if cfg.Log.Requests {
+		app.Use(logger.New(logger.Config{
+			Format:     cfg.Log.Format,
+			TimeFormat: cfg.Log.TimeFormat,
+		}))
+	}
+
+	// Rate limiting
+	if cfg.RateLimit.Enabled {
+		app.Use(limiter.New(limiter.Config{
+			Max:        cfg.RateLimit.Max,
+			Expiration: cfg.RateLimit.Window,
+		}))
+	}
+
+	// Cancel database work when the client goes away
+	app.Use(middleware.CancelOnDisconnect(cfg.Timeouts.DisconnectPoll))
+
+	// API keys, and the admin token, grant the scopes routes require
+	auth := middleware.NewAuth(st, middleware.AuthConfig{
+		AdminToken: cfg.Server.AdminToken,
+		Required:   cfg.Auth.Required,
+		CacheTTL:   cfg.Auth.CacheTTL,
+	})
+	app.Use(auth.Handler())
+	readDimensions := middleware.RequireScope(models.ScopeReadDimensions)
+	readTrade := middleware.RequireScope(models.ScopeReadTrade)
+
+	// Health check
+	app.Get("/health", func(c *fiber.Ctx) error {
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.Timeouts.Health)
+		defer cancel()
+
+		if err := st.Ping(ctx); err != nil {
+			log.Printf("Health check failed: %v", err)
+			return c.Status(503).JSON(fiber.Map{"status": "unhealthy", "error": "database unreachable"})
+		}
+		return c.JSON(fiber.Map{"status": "healthy"})
+	})
+
+	// API documentation
+	app.Get("/openapi.json", func(c *fiber.Ctx) error {
+		return c.JSON(openapi.Spec())
+	})
+	app.Get("/docs", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.SendString(openapi.DocsHTML)
+	})
+
+	// Model Context Protocol transports
+	mcpServer := mcp.NewServer(st, cfg.Timeouts.Aggregate)
+	app.Post("/mcp", readDimensions, readTrade, mcpServer.StreamableHTTP())
+	app.Get("/mcp/sse", readDimensions, readTrade, mcpServer.SSE())
+	app.Post("/mcp/messages", readDimensions, readTrade, mcpServer.Messages())
+
+	// API routes
+	api := app.Group("/api/v1")
+	timeouts := cfg.Timeouts
+	lookup := middleware.Timeout(timeouts.Lookup, timeouts.Max)
+	summary := middleware.Timeout(timeouts.Summary, timeouts.Max)
+	aggregate := middleware.Timeout(timeouts.Aggregate, timeouts.Max)
+
+	// Responses derived from the dimension tables, dropped when admins
+	// change a member
+	dimensionCache := &middleware.CacheGeneration{}
+
+	// Dimension endpoints
+	dimensions := api.Group("/dimensions", readDimensions, lookup)
+	dimensions.Get("/products", middleware.Cache(cfg.Cache.Dimensions, dimensionCache), handlers.GetProducts(st))
+	dimensions.Get("/countries", middleware.Cache(cfg.Cache.Dimensions, dimensionCache), handlers.GetCountries(st))
+	dimensions.Get("/ports", middleware.Cache(cfg.Cache.Dimensions, dimensionCache), handlers.GetPorts(st))
+	dimensions.Get("/ports/:id/history", middleware.Cache(cfg.Cache.Dimensions, dimensionCache), handlers.GetPortHistory(st))
+
+	// Data catalog
+	api.Get("/metadata", readDimensions, middleware.Cache(cfg.Cache.Metadata, dimensionCache), aggregate, handlers.GetMetadata(st))
+	api.Get("/quality", readTrade, middleware.Cache(cfg.Cache.Metadata, dimensionCache), aggregate, handlers.GetQuality(st, cfg.Summary.Tolerance))
+
+	// Trade endpoints
+	trade := api.Group("/trade", readTrade)
+	trade.Get("/summary", summary, handlers.GetTradeSummary(st))
+	trade.Get("/balance", summary, handlers.GetTradeBalance(st))
+	trade.Post("/aggregate", aggregate, handlers.AggregateTradeData(st))
+
+	// Releases
+	api.Get("/releases", readTrade, lookup, handlers.GetReleases(st))
+	api.Post("/releases/diff", readTrade, aggregate, handlers.DiffReleases(st))
+
+	// Agent tool definitions
+	api.Get("/tools", handlers.GetTools())
+
+	// Natural-language questions
+	catalog := nlq.CachedCatalog(handlers.LoadCatalog(st), cfg.Cache.Catalog)
+	var translator nlq.Translator = nlq.NewRuleTranslator(catalog)
+	if ask := cfg.Ask; ask.TranslatorURL != "" {
+		httpTranslator := nlq.NewHTTPTranslator(ask.TranslatorURL, ask.TranslatorModel, ask.TranslatorAPIKey, catalog)
+		translator = nlq.Fallback(httpTranslator, translator)
+	}
+	api.Post("/ask", readTrade, aggregate, handlers.AskQuestion(st, translator))
+
+	// SDMX endpoints
+	sdmx := api.Group("/sdmx")
+	sdmx.Get("/datastructure", readDimensions, middleware.Cache(cfg.Cache.Dimensions, dimensionCache), summary, handlers.GetSDMXStructure(st))
+	sdmxData := sdmx.Group("/data", middleware.RequireScope(models.ScopeReadTrade, models.ScopeExport))
+	sdmxData.Get("/summary", summary, handlers.GetSDMXSummary(st))
+	sdmxData.Get("/balance", summary, handlers.GetSDMXBalance(st))
+	sdmxData.Post("/aggregate", aggregate, handlers.GetSDMXAggregate(st))
+
+	// Maintenance
+	admin := api.Group("/admin", middleware.RequireAdmin())
+	admin.Post("/summary/rebuild", aggregate, handlers.PostRebuildSummary(st, cfg.Summary.Tolerance))
+
+	// Dimension corrections
+	invalidate := dimensionCache.Invalidate
+	members := admin.Group("/dimensions", lookup)
+	members.Post("/products", handlers.CreateProduct(st, invalidate))
+	members.Put("/products/:id", handlers.UpdateProduct(st, invalidate))
+	members.Post("/countries", handlers.CreateCountry(st, invalidate))
+	members.Put("/countries/:id", handlers.UpdateCountry(st, invalidate))
+	members.Post("/ports", handlers.CreatePort(st, invalidate))
+	members.Put("/ports/:id", handlers.UpdatePort(st, invalidate))
+	for path, table := range map[string]string{"/products": "dim_product", "/countries": "dim_country", "/ports": "dim_port"} {
+		members.Delete(path+"/:id", handlers.DeleteMember(st, table, invalidate))
+		members.Post(path+"/:id/restore", handlers.RestoreMember(st, table, invalidate))
+	}
+	members.Get("/audit", handlers.GetAudit(st))
+
+	// API keys
+	admin.Get("/keys", lookup, handlers.GetKeys(st))
+	admin.Post("/keys", lookup, handlers.PostKey(st))
+	admin.Delete("/keys/:id", lookup, handlers.RevokeKey(st, auth.Forget))
+
+	return app
+}
+
+// customErrorHandler writes every error as RFC 7807 problem details. Internal
+// causes are logged with the request ID and never sent to the client.
+func customErrorHandler(c *fiber.Ctx, err error) error {
+	// No one is left to read the response, and nothing failed
+	if problem.ClientClosed(c.UserContext()) {
+		return c.SendStatus(problem.StatusClientClosed)
+	}
+
+	p := problem.From(err)
+	requestID, _ := c.Locals(requestid.ConfigDefault.ContextKey).(string)
+
+	if p.Status >= fiber.StatusInternalServerError {
+		log.Printf("[%s] %s %s: %v", requestID, c.Method(), c.Path(), err)
+	}
+
+	return c.Status(p.Status).JSON(p.Details(c.Path(), c.Method(), requestID), problem.ContentType)
+}
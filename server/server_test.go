@@ -0,0 +1,241 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"trade-api/config"
+	"trade-api/models"
+	"trade-api/openapi"
+	"trade-api/problem"
+	"trade-api/store/storetest"
+)
+
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+func TestEveryRouteHasSpecEntry(t *testing.T) {
+	app := New(storetest.New(), config.Default())
+	spec := openapi.Spec()
+
+	registered := map[string]bool{}
+	for _, route := range app.GetRoutes(true) {
+		if route.Method == "HEAD" {
+			continue
+		}
+		path := pathParam.ReplaceAllString(route.Path, "{$1}")
+		registered[route.Method+" "+path] = true
+
+		item, ok := spec.Paths[path]
+		if !ok || item.Operation(route.Method) == nil {
+			t.Errorf("route %s %s has no OpenAPI entry", route.Method, path)
+		}
+	}
+
+	for path, item := range spec.Paths {
+		for _, method := range []string{"GET", "POST", "PUT", "PATCH", "DELETE"} {
+			if item.Operation(method) != nil && !registered[method+" "+path] {
+				t.Errorf("OpenAPI entry %s %s has no registered route", method, path)
+			}
+		}
+	}
+}
+
+func TestSpecIsValidJSON(t *testing.T) {
+	data, err := json.Marshal(openapi.Spec())
+	if err != nil {
+		t.Fatalf("marshal spec: %v", err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("unmarshal spec: %v", err)
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	for _, name := range []string{"AggregateRequest", "AggregateResult", "PaginatedResponse"} {
+		if _, ok := schemas[name]; !ok {
+			t.Errorf("missing component schema %s", name)
+		}
+	}
+}
+
+func TestSpecCapsFilterIDs(t *testing.T) {
+	filters := map[string]*openapi.Schema{
+		"component": openapi.Spec().Components.Schemas["Filters"],
+		"inline":    openapi.InlineSchema(models.AggregateRequest{}).Properties["filters"],
+	}
+	for name, schema := range filters {
+		if schema == nil {
+			t.Fatalf("%s: no Filters schema", name)
+		}
+		for _, field := range []string{"product_ids", "country_ids", "port_ids"} {
+			prop := schema.Properties[field]
+			if prop == nil || prop.MaxItems == nil || *prop.MaxItems != models.MaxFilterIDs {
+				t.Errorf("%s: %s has no maxItems of %d", name, field, models.MaxFilterIDs)
+			}
+		}
+	}
+}
+
+func TestValidationErrorIsProblemDetails(t *testing.T) {
+	app := New(storetest.New(), config.Default())
+
+	body := `{"date_range":{"start_year":2021,"end_year":2022},"group_by":["year","bogus"],
+		"sorting":{"sort_by":"total_value","sort_order":"desc"}}`
+	req := httptest.NewRequest("POST", "/api/v1/trade/aggregate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != problem.ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, problem.ContentType)
+	}
+
+	var details problem.ProblemDetails
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		t.Fatal(err)
+	}
+	if details.Code != problem.CodeInvalidGroupBy || details.Field != "/group_by/1" {
+		t.Errorf("code, field = %s, %s", details.Code, details.Field)
+	}
+	if details.DetailAR == "" || details.RequestID == "" {
+		t.Errorf("missing detail_ar or request_id: %+v", details)
+	}
+}
+
+func TestValidationReportsAllErrors(t *testing.T) {
+	app := New(storetest.New(), config.Default())
+
+	body := `{"date_range":{"start_year":2022,"end_year":2020},"group_bys":["year"],
+		"trade_types":["Import","Transit"],"sorting":{"sort_order":"up"}}`
+	req := httptest.NewRequest("POST", "/api/v1/trade/aggregate", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 400 {
+		t.Fatalf("status = %d, want 400", resp.StatusCode)
+	}
+
+	var details problem.ProblemDetails
+	if err := json.NewDecoder(resp.Body).Decode(&details); err != nil {
+		t.Fatal(err)
+	}
+	if details.Code != problem.CodeValidationFailed {
+		t.Errorf("code = %s, want %s", details.Code, problem.CodeValidationFailed)
+	}
+
+	got := map[string]string{}
+	for _, e := range details.Errors {
+		got[e.Field] = e.Code
+	}
+	want := map[string]string{
+		"/date_range/start_year": problem.CodeInvalidDateRange,
+		"/group_bys":             problem.CodeUnknownField,
+		"/group_by":              problem.CodeMissingGroupBy,
+		"/trade_types/1":         problem.CodeInvalidTradeType,
+		"/sorting/sort_order":    problem.CodeInvalidSortOrder,
+	}
+	for field, code := range want {
+		if got[field] != code {
+			t.Errorf("%s: code = %q, want %q", field, got[field], code)
+		}
+	}
+	if len(details.Errors) != len(want) {
+		t.Errorf("got %d errors, want %d: %+v", len(details.Errors), len(want), details.Errors)
+	}
+}
+
+func TestHealth(t *testing.T) {
+	st := storetest.New()
+	app := New(st, config.Default())
+
+	resp, err := app.Test(httptest.NewRequest("GET", "/health", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 200 {
+		t.Errorf("status = %d, want 200", resp.StatusCode)
+	}
+
+	st.Err = errors.New("connection refused")
+	resp, err = app.Test(httptest.NewRequest("GET", "/health", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != 503 {
+		t.Errorf("status = %d, want 503", resp.StatusCode)
+	}
+}
+
+func TestDocs(t *testing.T) {
+	app := New(storetest.New(), config.Default())
+
+	for path, contentType := range map[string]string{
+		"/openapi.json": "application/json",
+		"/docs":         "text/html",
+	} {
+		resp, err := app.Test(httptest.NewRequest("GET", path, nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != 200 || !strings.HasPrefix(resp.Header.Get("Content-Type"), contentType) {
+			t.Errorf("%s: status = %d, Content-Type = %q", path, resp.StatusCode, resp.Header.Get("Content-Type"))
+		}
+	}
+}
+
+func TestErrorHandlerTimeoutsAndDisconnects(t *testing.T) {
+	queryCanceled := &pgconn.PgError{Code: "57014", Message: "canceling statement due to user request"}
+	tests := []struct {
+		name   string
+		ctx    func() (context.Context, context.CancelFunc)
+		err    error
+		status int
+	}{
+		{"deadline", func() (context.Context, context.CancelFunc) {
+			return context.WithTimeout(context.Background(), 0)
+		}, queryCanceled, fiber.StatusGatewayTimeout},
+		{"disconnect", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancelCause(context.Background())
+			cancel(problem.ErrClientClosed)
+			return ctx, func() {}
+		}, queryCanceled, problem.StatusClientClosed},
+		{"canceled", func() (context.Context, context.CancelFunc) {
+			ctx, cancel := context.WithCancel(context.Background())
+			cancel()
+			return ctx, cancel
+		}, context.Canceled, fiber.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		app := fiber.New(fiber.Config{ErrorHandler: customErrorHandler})
+		app.Get("/", func(c *fiber.Ctx) error {
+			ctx, cancel := tt.ctx()
+			defer cancel()
+			c.SetUserContext(ctx)
+			return problem.Internal(problem.CodeQueryFailed, "query failed", "فشل الاستعلام", tt.err)
+		})
+		resp, err := app.Test(httptest.NewRequest("GET", "/", nil))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if resp.StatusCode != tt.status {
+			t.Errorf("%s: status = %d, want %d", tt.name, resp.StatusCode, tt.status)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+
+	"trade-api/models"
+)
+
+// dimensionKeys are the ID columns of the dimension tables admins change.
+var dimensionKeys = map[string]string{
+	"dim_product": "product_id",
+	"dim_country": "country_id",
+	"dim_port":    "port_id",
+}
+
+func (s *Postgres) CreateProduct(ctx context.Context, p models.Product, actor string) error {
+	return s.changeMember(ctx, "dim_product", p.ProductID, models.AuditCreate, actor, time.Time{}, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO dim_product (product_id, product_desc_en, product_desc_ar) VALUES ($1, $2, $3)
+		`, p.ProductID, p.ProductDescEN, p.ProductDescAR)
+		return err
+	})
+}
+
+func (s *Postgres) UpdateProduct(ctx context.Context, p models.Product, actor string) error {
+	return s.changeMember(ctx, "dim_product", p.ProductID, models.AuditUpdate, actor, time.Time{}, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE dim_product SET product_desc_en = $2, product_desc_ar = $3 WHERE product_id = $1
+		`, p.ProductID, p.ProductDescEN, p.ProductDescAR)
+		return err
+	})
+}
+
+func (s *Postgres) CreateCountry(ctx context.Context, c models.Country, effective time.Time, actor string) error {
+	return s.changeMember(ctx, "dim_country", c.CountryID, models.AuditCreate, actor, effective, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO dim_country (country_id, country_name_en, country_name_ar, iso_code) VALUES ($1, $2, $3, $4)
+		`, c.CountryID, c.CountryNameEN, c.CountryNameAR, c.ISOCode)
+		return err
+	})
+}
+
+func (s *Postgres) UpdateCountry(ctx context.Context, c models.Country, effective time.Time, actor string) error {
+	return s.changeMember(ctx, "dim_country", c.CountryID, models.AuditUpdate, actor, effective, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE dim_country SET country_name_en = $2, country_name_ar = $3, iso_code = $4 WHERE country_id = $1
+		`, c.CountryID, c.CountryNameEN, c.CountryNameAR, c.ISOCode)
+		return err
+	})
+}
+
+func (s *Postgres) CreatePort(ctx context.Context, p models.Port, effective time.Time, actor string) error {
+	return s.changeMember(ctx, "dim_port", p.PortID, models.AuditCreate, actor, effective, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO dim_port (port_id, port_name_en, port_name_ar, port_type_en, port_type_ar, mode_id, latitude, longitude)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		`, p.PortID, p.PortNameEN, p.PortNameAR, p.PortTypeEN, p.PortTypeAR, p.ModeID, p.Latitude, p.Longitude)
+		return err
+	})
+}
+
+func (s *Postgres) UpdatePort(ctx context.Context, p models.Port, effective time.Time, actor string) error {
+	return s.changeMember(ctx, "dim_port", p.PortID, models.AuditUpdate, actor, effective, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, `
+			UPDATE dim_port SET port_name_en = $2, port_name_ar = $3, port_type_en = $4, port_type_ar = $5,
+				mode_id = $6, latitude = $7, longitude = $8
+			WHERE port_id = $1
+		`, p.PortID, p.PortNameEN, p.PortNameAR, p.PortTypeEN, p.PortTypeAR, p.ModeID, p.Latitude, p.Longitude)
+		return err
+	})
+}
+
+func (s *Postgres) DeleteMember(ctx context.Context, table string, id int64, actor string) error {
+	return s.setDeleted(ctx, table, id, models.AuditDelete, actor, "now()")
+}
+
+func (s *Postgres) RestoreMember(ctx context.Context, table string, id int64, actor string) error {
+	return s.setDeleted(ctx, table, id, models.AuditRestore, actor, "NULL")
+}
+
+func (s *Postgres) setDeleted(ctx context.Context, table string, id int64, action, actor, deletedAt string) error {
+	return s.changeMember(ctx, table, id, action, actor, time.Time{}, func(tx pgx.Tx) error {
+		_, err := tx.Exec(ctx, fmt.Sprintf(`UPDATE %s SET deleted_at = %s WHERE %s = $1`, table, deletedAt, dimensionKeys[table]), id)
+		return err
+	})
+}
+
+// changeMember makes a change to member id of table with apply, and records
+// it in the audit trail and the table's history, all in one transaction.
+// The member's row is locked first, so concurrent changes to it queue up
+// and each sees the one before.
+func (s *Postgres) changeMember(ctx context.Context, table string, id int64, action, actor string, effective time.Time, apply func(pgx.Tx) error) error {
+	key, ok := dimensionKeys[table]
+	if !ok {
+		return fmt.Errorf("unknown dimension table %q", table)
+	}
+
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	member := fmt.Sprintf(`SELECT to_jsonb(d) - 'deleted_at', d.deleted_at IS NOT NULL FROM %s d WHERE d.%s = $1`, table, key)
+	var before json.RawMessage
+	var deleted bool
+	err = tx.QueryRow(ctx, member+" FOR UPDATE", id).Scan(&before, &deleted)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+	exists := err == nil
+	switch action {
+	case models.AuditCreate:
+		if exists {
+			return ErrExists
+		}
+	case models.AuditRestore:
+		if !exists || !deleted {
+			return ErrNotFound
+		}
+	default:
+		if !exists || deleted {
+			return ErrNotFound
+		}
+	}
+
+	if err := apply(tx); err != nil {
+		// Another transaction created the member since the check
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
+			return ErrExists
+		}
+		return err
+	}
+
+	var after json.RawMessage
+	if action != models.AuditDelete {
+		if err := tx.QueryRow(ctx, member, id).Scan(&after, &deleted); err != nil {
+			return err
+		}
+	}
+	if action == models.AuditCreate || action == models.AuditRestore {
+		before = nil
+	}
+	if _, err := tx.Exec(ctx, `
+		INSERT INTO dimension_audit (table_name, member_id, action, actor, before, after)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, table, id, action, actor, nullJSON(before), nullJSON(after)); err != nil {
+		return err
+	}
+
+	if action == models.AuditCreate || action == models.AuditUpdate {
+		if _, err := RecordHistory(ctx, tx, table, effective); err != nil {
+			return err
+		}
+	}
+	return tx.Commit(ctx)
+}
+
+func (s *Postgres) Audit(ctx context.Context, table string, id int64, limit int) ([]models.AuditEntry, error) {
+	query := `
+		SELECT audit_id, table_name, member_id, action, actor, before, after, changed_at
+		FROM dimension_audit
+		WHERE 1=1
+	`
+	args := []interface{}{}
+	argCount := 0
+
+	if table != "" {
+		argCount++
+		query += fmt.Sprintf(" AND table_name = $%d", argCount)
+		args = append(args, table)
+	}
+	if id != 0 {
+		argCount++
+		query += fmt.Sprintf(" AND member_id = $%d", argCount)
+		args = append(args, id)
+	}
+
+	argCount++
+	query += fmt.Sprintf(" ORDER BY audit_id DESC LIMIT $%d", argCount)
+	args = append(args, limit)
+
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		if err := rows.Scan(&e.AuditID, &e.Table, &e.ID, &e.Action, &e.Actor, &e.Before, &e.After, &e.ChangedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// nullJSON passes an empty document as SQL NULL.
+func nullJSON(doc json.RawMessage) interface{} {
+	if len(doc) == 0 {
+		return nil
+	}
+	return doc
+}
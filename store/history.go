@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// histories are the ID and attribute columns of the dimensions that keep a
+// history table, named after the dimension with a _history suffix.
+var histories = map[string]struct {
+	key     string
+	columns []string
+}{
+	"dim_country": {"country_id", []string{"country_name_en", "country_name_ar", "iso_code"}},
+	"dim_port":    {"port_id", []string{"port_name_en", "port_name_ar", "port_type_en", "port_type_ar", "mode_id", "latitude", "longitude"}},
+}
+
+// ErrLaterVersion is returned by RecordHistory for a change that would take
+// effect before a member's current version.
+var ErrLaterVersion = errors.New("members changed have versions from a later date")
+
+// RecordHistory brings the history of dimension up to date with the table
+// in tx, and returns the number of versions it added. Members whose
+// attributes changed get a new version from effective, the day the change
+// took effect, and members no longer in the table have their current
+// version closed then. A member's first version applies since always. A
+// second change on the same day replaces the first. Dimensions without a
+// history table are left alone.
+func RecordHistory(ctx context.Context, tx pgx.Tx, dimension string, effective time.Time) (int64, error) {
+	h, ok := histories[dimension]
+	if !ok {
+		return 0, nil
+	}
+	key, columns := h.key, h.columns
+	history := dimension + "_history"
+
+	var current, versioned []string
+	for _, c := range columns {
+		current = append(current, "d."+c)
+		versioned = append(versioned, "h."+c)
+	}
+	// The member's current version no longer matches the table
+	changed := fmt.Sprintf(`h.valid_to IS NULL AND NOT EXISTS (
+		SELECT 1 FROM %[1]s d WHERE d.%[2]s = h.%[2]s AND (%[3]s) IS NOT DISTINCT FROM (%[4]s)
+	)`, dimension, key, strings.Join(current, ", "), strings.Join(versioned, ", "))
+
+	rows, err := tx.Query(ctx, fmt.Sprintf(`
+		SELECT h.%[1]s FROM %[2]s h WHERE %[3]s AND h.valid_from > $1 ORDER BY h.%[1]s
+	`, key, history, changed), effective)
+	if err != nil {
+		return 0, err
+	}
+	later, err := pgx.CollectRows(rows, pgx.RowTo[int64])
+	if err != nil {
+		return 0, err
+	}
+	if len(later) > 0 {
+		return 0, fmt.Errorf("%w: %d changed on %s, such as %s %d",
+			ErrLaterVersion, len(later), effective.Format(time.DateOnly), key, later[0])
+	}
+
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`
+		DELETE FROM %[1]s h WHERE %[2]s AND h.valid_from = $1
+	`, history, changed), effective); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec(ctx, fmt.Sprintf(`
+		UPDATE %[1]s h SET valid_to = $1 WHERE %[2]s
+	`, history, changed), effective); err != nil {
+		return 0, err
+	}
+
+	names := strings.Join(append([]string{key}, columns...), ", ")
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (%[2]s, valid_from)
+		SELECT %[3]s, CASE WHEN EXISTS (SELECT 1 FROM %[1]s o WHERE o.%[4]s = d.%[4]s) THEN $1::date END
+		FROM %[5]s d
+		WHERE NOT EXISTS (SELECT 1 FROM %[1]s h WHERE h.%[4]s = d.%[4]s AND h.valid_to IS NULL)
+	`, history, names, "d."+key+", "+strings.Join(current, ", "), key, dimension), effective)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"trade-api/models"
+)
+
+const keyColumns = `key_id, name, prefix, scopes, hash, created_at, last_used_at, revoked_at`
+
+func (s *Postgres) CreateKey(ctx context.Context, k *models.APIKey) error {
+	return s.db.QueryRow(ctx, `
+		INSERT INTO api_keys (name, prefix, hash, scopes) VALUES ($1, $2, $3, $4)
+		RETURNING key_id, created_at
+	`, k.Name, k.Prefix, k.Hash, k.Scopes).Scan(&k.KeyID, &k.CreatedAt)
+}
+
+func (s *Postgres) KeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	k, err := scanKey(s.db.QueryRow(ctx, `SELECT `+keyColumns+` FROM api_keys WHERE prefix = $1`, prefix))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+func (s *Postgres) Keys(ctx context.Context) ([]models.APIKey, error) {
+	rows, err := s.db.Query(ctx, `SELECT `+keyColumns+` FROM api_keys ORDER BY key_id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
+
+func (s *Postgres) RevokeKey(ctx context.Context, id int64) error {
+	tag, err := s.db.Exec(ctx, `UPDATE api_keys SET revoked_at = now() WHERE key_id = $1 AND revoked_at IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+func (s *Postgres) TouchKey(ctx context.Context, id int64, at time.Time) error {
+	_, err := s.db.Exec(ctx, `UPDATE api_keys SET last_used_at = $2 WHERE key_id = $1`, id, at)
+	return err
+}
+
+func scanKey(row pgx.Row) (models.APIKey, error) {
+	var k models.APIKey
+	err := row.Scan(&k.KeyID, &k.Name, &k.Prefix, &k.Scopes, &k.Hash, &k.CreatedAt, &k.LastUsedAt, &k.RevokedAt)
+	return k, err
+}
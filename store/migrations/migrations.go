@@ -0,0 +1,285 @@
+// Package migrations versions the warehouse schema. Migrations are SQL files
+// embedded in the binary, named <version>_<name>.up.sql with a matching
+// .down.sql, and applied in version order. Applied versions are recorded in
+// schema_migrations, and a Postgres advisory lock keeps concurrent runs, such
+// as several replicas auto-migrating at startup, from interleaving.
+package migrations
+
+import (
+	"cmp"
+	"context"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+//go:embed sql/*.sql
+var files embed.FS
+
+// lockID is the advisory lock key, shared by every process migrating the same
+// database.
+const lockID int64 = 0x7472616465617069 // "tradeapi"
+
+var fileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// State is a migration and when it was applied. AppliedAt is nil for pending
+// migrations, and Name is empty for applied versions this binary does not
+// know, which a newer release recorded.
+type State struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time
+}
+
+var all = mustLoad()
+
+// All returns the embedded migrations in version order.
+func All() []Migration {
+	return slices.Clone(all)
+}
+
+func mustLoad() []Migration {
+	migrations, err := load(files)
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
+
+func load(fsys fs.FS) ([]Migration, error) {
+	paths, err := fs.Glob(fsys, "sql/*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, path := range paths {
+		m := fileName.FindStringSubmatch(path[len("sql/"):])
+		if m == nil {
+			return nil, fmt.Errorf("migration %s: name must be <version>_<name>.up.sql or .down.sql", path)
+		}
+		version, _ := strconv.Atoi(m[1])
+		data, err := fs.ReadFile(fsys, path)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != m[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, m[2])
+		}
+		if m[3] == "up" {
+			migration.Up = string(data)
+		} else {
+			migration.Down = string(data)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d %s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	slices.SortFunc(migrations, func(a, b Migration) int { return cmp.Compare(a.Version, b.Version) })
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must run 1, 2, 3, ... without gaps; found %d at position %d", m.Version, i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// Up applies every pending migration, each in its own transaction, and
+// returns those it applied.
+func Up(ctx context.Context, db *pgxpool.Pool) ([]Migration, error) {
+	var applied []Migration
+	err := withLock(ctx, db, func(conn *pgx.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, m := range all {
+			if _, ok := done[m.Version]; ok {
+				continue
+			}
+			err := run(ctx, conn, m.Up, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, m.Version, m.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d %s up: %w", m.Version, m.Name, err)
+			}
+			applied = append(applied, m)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps applied migrations, newest first, and returns
+// those it reverted.
+func Down(ctx context.Context, db *pgxpool.Pool, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := withLock(ctx, db, func(conn *pgx.Conn) error {
+		done, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		versions := make([]int, 0, len(done))
+		for version := range done {
+			versions = append(versions, version)
+		}
+		slices.Sort(versions)
+		slices.Reverse(versions)
+
+		for _, version := range versions[:min(steps, len(versions))] {
+			if version > len(all) {
+				return fmt.Errorf("database is at version %d, which this binary does not know how to revert", version)
+			}
+			m := all[version-1]
+			err := run(ctx, conn, m.Down, `DELETE FROM schema_migrations WHERE version = $1`, m.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d %s down: %w", m.Version, m.Name, err)
+			}
+			reverted = append(reverted, m)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// Status lists every known migration and any unknown applied version, in
+// version order. It only reads: it neither waits for a running migration nor
+// creates schema_migrations, and reports every migration as pending in a
+// database that has never been migrated.
+func Status(ctx context.Context, db *pgxpool.Pool) ([]State, error) {
+	var exists bool
+	if err := db.QueryRow(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&exists); err != nil {
+		return nil, fmt.Errorf("unable to look up schema_migrations: %w", err)
+	}
+	done := map[int]time.Time{}
+	if exists {
+		var err error
+		if done, err = appliedVersions(ctx, db); err != nil {
+			return nil, err
+		}
+	}
+
+	var states []State
+	for _, m := range all {
+		state := State{Version: m.Version, Name: m.Name}
+		if at, ok := done[m.Version]; ok {
+			state.AppliedAt = &at
+		}
+		states = append(states, state)
+	}
+	for version, at := range done {
+		if version > len(all) {
+			states = append(states, State{Version: version, AppliedAt: &at})
+		}
+	}
+	slices.SortFunc(states, func(a, b State) int { return cmp.Compare(a.Version, b.Version) })
+	return states, nil
+}
+
+// withLock runs fn on one connection while holding the advisory lock, after
+// making sure schema_migrations exists.
+func withLock(ctx context.Context, db *pgxpool.Pool, fn func(*pgx.Conn) error) error {
+	conn, err := db.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("unable to acquire connection: %w", err)
+	}
+	defer conn.Release()
+
+	// Waiting for the lock and running migrations may take longer than the
+	// pool's statement_timeout, which is meant for request queries
+	if _, err := conn.Exec(ctx, `SET statement_timeout = 0`); err != nil {
+		return fmt.Errorf("unable to lift statement timeout: %w", err)
+	}
+	defer func() {
+		if _, err := conn.Exec(context.Background(), `RESET statement_timeout`); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	if _, err := conn.Exec(ctx, `SELECT pg_advisory_lock($1)`, lockID); err != nil {
+		return fmt.Errorf("unable to take migration lock: %w", err)
+	}
+	defer func() {
+		// Unlock even if ctx has ended, or the pooled connection keeps the lock
+		if _, err := conn.Exec(context.Background(), `SELECT pg_advisory_unlock($1)`, lockID); err != nil {
+			conn.Conn().Close(context.Background())
+		}
+	}()
+
+	_, err = conn.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version    INTEGER PRIMARY KEY,
+			name       TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("unable to create schema_migrations: %w", err)
+	}
+	return fn(conn.Conn())
+}
+
+// querier is the part of pgx.Conn and pgxpool.Pool that appliedVersions needs.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...interface{}) (pgx.Rows, error)
+}
+
+func appliedVersions(ctx context.Context, conn querier) (map[int]time.Time, error) {
+	rows, err := conn.Query(ctx, `SELECT version, applied_at FROM schema_migrations`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	done := map[int]time.Time{}
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, err
+		}
+		done[version] = at
+	}
+	return done, rows.Err()
+}
+
+// run executes a migration script and its bookkeeping statement in one
+// transaction.
+func run(ctx context.Context, conn *pgx.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,59 @@
+package migrations
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations := All()
+	if len(migrations) == 0 {
+		t.Fatal("no migrations embedded")
+	}
+	for i, m := range migrations {
+		if m.Version != i+1 || m.Name == "" || strings.TrimSpace(m.Up) == "" || strings.TrimSpace(m.Down) == "" {
+			t.Errorf("migration %d = %+v", i, m)
+		}
+	}
+}
+
+func TestLoadRejectsMalformedSets(t *testing.T) {
+	file := func(sql string) *fstest.MapFile { return &fstest.MapFile{Data: []byte(sql)} }
+	tests := []struct {
+		name string
+		fsys fstest.MapFS
+		want string
+	}{
+		{"bad name", fstest.MapFS{"sql/first.up.sql": file("SELECT 1")}, "name must be"},
+		{"missing down", fstest.MapFS{"sql/0001_first.up.sql": file("SELECT 1")}, "needs both"},
+		{"renamed", fstest.MapFS{
+			"sql/0001_first.up.sql":    file("SELECT 1"),
+			"sql/0001_second.down.sql": file("SELECT 1"),
+		}, "named both"},
+		{"gap", fstest.MapFS{
+			"sql/0001_first.up.sql":   file("SELECT 1"),
+			"sql/0001_first.down.sql": file("SELECT 1"),
+			"sql/0003_third.up.sql":   file("SELECT 1"),
+			"sql/0003_third.down.sql": file("SELECT 1"),
+		}, "without gaps"},
+	}
+	for _, tt := range tests {
+		if _, err := load(tt.fsys); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: err = %v, want %q", tt.name, err, tt.want)
+		}
+	}
+
+	migrations, err := load(fstest.MapFS{
+		"sql/0002_second.up.sql":   file("B"),
+		"sql/0002_second.down.sql": file("b"),
+		"sql/0001_first.up.sql":    file("A"),
+		"sql/0001_first.down.sql":  file("a"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[0].Name != "first" || migrations[1].Up != "B" || migrations[1].Down != "b" {
+		t.Errorf("got %+v", migrations)
+	}
+}
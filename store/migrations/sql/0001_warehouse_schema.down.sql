@@ -0,0 +1,21 @@
+-- Dropping the warehouse would destroy the data it holds, which may predate
+-- migrations, so refuse unless every table is empty.
+DO $$
+BEGIN
+    IF EXISTS (SELECT 1 FROM dim_product)
+       OR EXISTS (SELECT 1 FROM dim_country)
+       OR EXISTS (SELECT 1 FROM dim_port)
+       OR EXISTS (SELECT 1 FROM fact_trade_by_product_port)
+       OR EXISTS (SELECT 1 FROM fact_trade_by_country_port)
+       OR EXISTS (SELECT 1 FROM fact_yearly_summary) THEN
+        RAISE EXCEPTION 'the warehouse tables hold data; empty or drop them by hand to revert the first migration';
+    END IF;
+END
+$$;
+
+DROP TABLE IF EXISTS fact_yearly_summary;
+DROP TABLE IF EXISTS fact_trade_by_country_port;
+DROP TABLE IF EXISTS fact_trade_by_product_port;
+DROP TABLE IF EXISTS dim_port;
+DROP TABLE IF EXISTS dim_country;
+DROP TABLE IF EXISTS dim_product;
@@ -0,0 +1,67 @@
+-- Star schema read by the API. IF NOT EXISTS lets databases created before
+-- migrations existed adopt this version; the ALTERs below add the columns
+-- introduced since, which CREATE TABLE IF NOT EXISTS skips on such tables.
+
+CREATE TABLE IF NOT EXISTS dim_product (
+    product_id      BIGINT PRIMARY KEY,
+    product_desc_en TEXT NOT NULL,
+    product_desc_ar TEXT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS dim_country (
+    country_id      BIGINT PRIMARY KEY,
+    country_name_en TEXT NOT NULL,
+    country_name_ar TEXT NOT NULL,
+    iso_code        TEXT
+);
+
+CREATE TABLE IF NOT EXISTS dim_port (
+    port_id      BIGINT PRIMARY KEY,
+    port_name_en TEXT NOT NULL,
+    port_name_ar TEXT NOT NULL,
+    port_type_en TEXT NOT NULL,
+    port_type_ar TEXT NOT NULL,
+    mode_id      INTEGER NOT NULL,
+    latitude     DOUBLE PRECISION,
+    longitude    DOUBLE PRECISION
+);
+
+ALTER TABLE dim_country ADD COLUMN IF NOT EXISTS iso_code TEXT;
+ALTER TABLE dim_port
+    ADD COLUMN IF NOT EXISTS latitude  DOUBLE PRECISION,
+    ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION;
+
+CREATE TABLE IF NOT EXISTS fact_trade_by_product_port (
+    year       INTEGER NOT NULL,
+    product_id BIGINT NOT NULL REFERENCES dim_product,
+    port_id    BIGINT NOT NULL REFERENCES dim_port,
+    trade_type TEXT NOT NULL,
+    value      BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS fact_trade_by_country_port (
+    year       INTEGER NOT NULL,
+    country_id BIGINT NOT NULL REFERENCES dim_country,
+    port_id    BIGINT NOT NULL REFERENCES dim_port,
+    trade_type TEXT NOT NULL,
+    value      BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS fact_yearly_summary (
+    year               INTEGER PRIMARY KEY,
+    import_value       BIGINT,
+    export_value       BIGINT,
+    reexport_value     BIGINT,
+    tradebalance_value BIGINT
+);
+
+-- Every aggregate filters on a year range and usually on trade type
+CREATE INDEX IF NOT EXISTS idx_product_port_year
+    ON fact_trade_by_product_port (year, trade_type, product_id, port_id);
+CREATE INDEX IF NOT EXISTS idx_country_port_year
+    ON fact_trade_by_country_port (year, trade_type, country_id, port_id);
+
+-- Port and port type filters
+CREATE INDEX IF NOT EXISTS idx_product_port_port ON fact_trade_by_product_port (port_id);
+CREATE INDEX IF NOT EXISTS idx_country_port_port ON fact_trade_by_country_port (port_id);
+CREATE INDEX IF NOT EXISTS idx_dim_port_type ON dim_port (port_type_en);
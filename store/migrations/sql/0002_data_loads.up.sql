@@ -0,0 +1,10 @@
+-- One row per successful run of the load command
+CREATE TABLE data_loads (
+    load_id     BIGSERIAL PRIMARY KEY,
+    source      TEXT NOT NULL,
+    started_at  TIMESTAMPTZ NOT NULL,
+    finished_at TIMESTAMPTZ NOT NULL,
+    report      JSONB NOT NULL
+);
+
+CREATE INDEX ON data_loads (finished_at);
@@ -0,0 +1,16 @@
+ALTER TABLE data_loads DROP COLUMN release_id;
+
+-- Only the current rows survive
+DELETE FROM fact_trade_by_product_port WHERE valid_to_release IS NOT NULL;
+DELETE FROM fact_trade_by_country_port WHERE valid_to_release IS NOT NULL;
+DELETE FROM fact_yearly_summary WHERE valid_to_release IS NOT NULL;
+
+DROP INDEX idx_yearly_summary_current;
+ALTER TABLE fact_yearly_summary DROP CONSTRAINT fact_yearly_summary_pkey;
+
+ALTER TABLE fact_trade_by_product_port DROP COLUMN valid_from_release, DROP COLUMN valid_to_release;
+ALTER TABLE fact_trade_by_country_port DROP COLUMN valid_from_release, DROP COLUMN valid_to_release;
+ALTER TABLE fact_yearly_summary DROP COLUMN valid_from_release, DROP COLUMN valid_to_release;
+ALTER TABLE fact_yearly_summary ADD PRIMARY KEY (year);
+
+DROP TABLE releases;
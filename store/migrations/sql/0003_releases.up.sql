@@ -0,0 +1,50 @@
+-- Numbered vintages of the fact data. Every load and summary rebuild creates
+-- a release; rows are never changed in place but closed and replaced, so the
+-- numbers published in any release can be read back.
+CREATE TABLE releases (
+    release_id INTEGER PRIMARY KEY,
+    source     TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- Data loaded before releases were tracked becomes release 1
+INSERT INTO releases (release_id, source)
+SELECT 1, 'data present before releases were tracked'
+WHERE EXISTS (SELECT 1 FROM fact_trade_by_product_port)
+   OR EXISTS (SELECT 1 FROM fact_trade_by_country_port)
+   OR EXISTS (SELECT 1 FROM fact_yearly_summary);
+
+-- A row belongs to releases valid_from_release up to, but not including,
+-- valid_to_release. Current rows have no valid_to_release.
+ALTER TABLE fact_trade_by_product_port
+    ADD COLUMN valid_from_release INTEGER NOT NULL DEFAULT 1 REFERENCES releases,
+    ADD COLUMN valid_to_release   INTEGER REFERENCES releases;
+ALTER TABLE fact_trade_by_product_port ALTER COLUMN valid_from_release DROP DEFAULT;
+
+ALTER TABLE fact_trade_by_country_port
+    ADD COLUMN valid_from_release INTEGER NOT NULL DEFAULT 1 REFERENCES releases,
+    ADD COLUMN valid_to_release   INTEGER REFERENCES releases;
+ALTER TABLE fact_trade_by_country_port ALTER COLUMN valid_from_release DROP DEFAULT;
+
+ALTER TABLE fact_yearly_summary
+    ADD COLUMN valid_from_release INTEGER NOT NULL DEFAULT 1 REFERENCES releases,
+    ADD COLUMN valid_to_release   INTEGER REFERENCES releases;
+ALTER TABLE fact_yearly_summary ALTER COLUMN valid_from_release DROP DEFAULT;
+
+-- The summary keeps one row per year and release, and one current row per year.
+-- A table created by hand may name its primary key differently.
+DO $$
+DECLARE
+    pkey name;
+BEGIN
+    SELECT conname INTO pkey FROM pg_constraint
+    WHERE conrelid = 'fact_yearly_summary'::regclass AND contype = 'p';
+    IF pkey IS NOT NULL THEN
+        EXECUTE format('ALTER TABLE fact_yearly_summary DROP CONSTRAINT %I', pkey);
+    END IF;
+END
+$$;
+ALTER TABLE fact_yearly_summary ADD PRIMARY KEY (year, valid_from_release);
+CREATE UNIQUE INDEX idx_yearly_summary_current ON fact_yearly_summary (year) WHERE valid_to_release IS NULL;
+
+ALTER TABLE data_loads ADD COLUMN release_id INTEGER REFERENCES releases;
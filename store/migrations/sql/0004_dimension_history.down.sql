@@ -0,0 +1,2 @@
+DROP TABLE dim_port_history;
+DROP TABLE dim_country_history;
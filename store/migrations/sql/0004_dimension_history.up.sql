@@ -0,0 +1,39 @@
+-- Every version of the country and port attributes, so aggregates can label
+-- members as they were in a given year. A version applies from valid_from up
+-- to, but not including, valid_to. A member's first version has no
+-- valid_from and its current version no valid_to.
+CREATE TABLE dim_country_history (
+    country_id      BIGINT NOT NULL,
+    country_name_en TEXT NOT NULL,
+    country_name_ar TEXT NOT NULL,
+    iso_code        TEXT,
+    valid_from      DATE,
+    valid_to        DATE,
+    CHECK (valid_from < valid_to)
+);
+
+CREATE TABLE dim_port_history (
+    port_id      BIGINT NOT NULL,
+    port_name_en TEXT NOT NULL,
+    port_name_ar TEXT NOT NULL,
+    port_type_en TEXT NOT NULL,
+    port_type_ar TEXT NOT NULL,
+    mode_id      INTEGER NOT NULL,
+    latitude     DOUBLE PRECISION,
+    longitude    DOUBLE PRECISION,
+    valid_from   DATE,
+    valid_to     DATE,
+    CHECK (valid_from < valid_to)
+);
+
+CREATE INDEX idx_country_history ON dim_country_history (country_id, valid_from);
+CREATE UNIQUE INDEX idx_country_history_current ON dim_country_history (country_id) WHERE valid_to IS NULL;
+CREATE INDEX idx_port_history ON dim_port_history (port_id, valid_from);
+CREATE UNIQUE INDEX idx_port_history_current ON dim_port_history (port_id) WHERE valid_to IS NULL;
+
+-- Today's attributes are all that is known of the past
+INSERT INTO dim_country_history (country_id, country_name_en, country_name_ar, iso_code)
+SELECT country_id, country_name_en, country_name_ar, iso_code FROM dim_country;
+
+INSERT INTO dim_port_history (port_id, port_name_en, port_name_ar, port_type_en, port_type_ar, mode_id, latitude, longitude)
+SELECT port_id, port_name_en, port_name_ar, port_type_en, port_type_ar, mode_id, latitude, longitude FROM dim_port;
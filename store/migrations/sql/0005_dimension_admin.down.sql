@@ -0,0 +1,5 @@
+DROP TABLE dimension_audit;
+
+ALTER TABLE dim_port DROP COLUMN deleted_at;
+ALTER TABLE dim_country DROP COLUMN deleted_at;
+ALTER TABLE dim_product DROP COLUMN deleted_at;
@@ -0,0 +1,20 @@
+-- Admins soft-delete dimension members, which keeps the rows facts refer to
+-- but hides them from the dimension lists.
+ALTER TABLE dim_product ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE dim_country ADD COLUMN deleted_at TIMESTAMPTZ;
+ALTER TABLE dim_port ADD COLUMN deleted_at TIMESTAMPTZ;
+
+-- Every change an admin made to a dimension member. before is null for a
+-- created or restored member and after for a deleted one.
+CREATE TABLE dimension_audit (
+    audit_id   BIGSERIAL PRIMARY KEY,
+    table_name TEXT NOT NULL,
+    member_id  BIGINT NOT NULL,
+    action     TEXT NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore')),
+    actor      TEXT NOT NULL,
+    before     JSONB,
+    after      JSONB,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_dimension_audit_member ON dimension_audit (table_name, member_id);
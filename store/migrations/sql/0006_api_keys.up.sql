@@ -0,0 +1,12 @@
+-- Keys clients authenticate with. Only the SHA-256 hash of a key is kept;
+-- prefix, the public start of the key, finds it and names it in lists.
+CREATE TABLE api_keys (
+    key_id       BIGSERIAL PRIMARY KEY,
+    name         TEXT NOT NULL,
+    prefix       TEXT NOT NULL UNIQUE,
+    hash         BYTEA NOT NULL,
+    scopes       TEXT[] NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at   TIMESTAMPTZ
+);
@@ -0,0 +1,850 @@
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"trade-api/models"
+	"trade-api/utils"
+)
+
+const yearRangeTTL = 10 * time.Minute
+
+// factReferences are the dimension columns of each fact table.
+var factReferences = []struct{ table, column, dimension string }{
+	{utils.ProductFactTable, "product_id", "dim_product"},
+	{utils.ProductFactTable, "port_id", "dim_port"},
+	{utils.CountryFactTable, "country_id", "dim_country"},
+	{utils.CountryFactTable, "port_id", "dim_port"},
+}
+
+// arabicColumns are the translated dimension columns, with the ID and
+// English name that identify a row.
+var arabicColumns = []struct{ table, id, nameEN, column string }{
+	{"dim_product", "product_id", "product_desc_en", "product_desc_ar"},
+	{"dim_country", "country_id", "country_name_en", "country_name_ar"},
+	{"dim_port", "port_id", "port_name_en", "port_name_ar"},
+	{"dim_port", "port_id", "port_name_en", "port_type_ar"},
+}
+
+// Postgres is the Store backed by the warehouse database.
+type Postgres struct {
+	db *pgxpool.Pool
+
+	yearsMu      sync.Mutex
+	minYear      int
+	maxYear      int
+	yearsExpires time.Time
+	factYears    map[factYearsKey]factYears
+}
+
+// factYearsKey and factYears cache FactYearRange.
+type factYearsKey struct {
+	table   string
+	release int // the latest release for the current rows
+}
+
+type factYears struct {
+	min, max int
+	expires  time.Time
+}
+
+var _ Store = (*Postgres)(nil)
+
+func NewPostgres(db *pgxpool.Pool) *Postgres {
+	return &Postgres{db: db}
+}
+
+// readTx begins a read-only transaction for a request's queries. When ctx
+// has a deadline, the transaction's statement_timeout is set to the time
+// left, so Postgres ends the query itself even if the cancel request sent
+// when ctx ends is lost. Callers roll it back when done.
+func (s *Postgres) readTx(ctx context.Context) (pgx.Tx, error) {
+	tx, err := s.db.BeginTx(ctx, pgx.TxOptions{AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		left := max(time.Until(deadline).Milliseconds(), 1)
+		if _, err := tx.Exec(ctx, `SELECT set_config('statement_timeout', $1, true)`, strconv.FormatInt(left, 10)); err != nil {
+			tx.Rollback(ctx)
+			return nil, err
+		}
+	}
+	return tx, nil
+}
+
+func (s *Postgres) Ping(ctx context.Context) error {
+	return s.db.Ping(ctx)
+}
+
+func (s *Postgres) Products(ctx context.Context, search string, limit int) ([]models.Product, error) {
+	query := `
+		SELECT product_id, product_desc_en, product_desc_ar
+		FROM dim_product
+		WHERE deleted_at IS NULL
+	`
+	args := []interface{}{}
+	argCount := 0
+
+	if search != "" {
+		argCount++
+		query += fmt.Sprintf(" AND (product_desc_en ILIKE $%d OR product_desc_ar ILIKE $%d)", argCount, argCount)
+		args = append(args, "%"+search+"%")
+	}
+
+	query += " ORDER BY product_desc_en"
+	if limit > 0 {
+		argCount++
+		query += fmt.Sprintf(" LIMIT $%d", argCount)
+		args = append(args, limit)
+	}
+
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	products := []models.Product{}
+	for rows.Next() {
+		var p models.Product
+		if err := rows.Scan(&p.ProductID, &p.ProductDescEN, &p.ProductDescAR); err != nil {
+			return nil, err
+		}
+		products = append(products, p)
+	}
+
+	return products, rows.Err()
+}
+
+func (s *Postgres) Countries(ctx context.Context, search string, limit int) ([]models.Country, error) {
+	query := `
+		SELECT country_id, country_name_en, country_name_ar, iso_code
+		FROM dim_country
+		WHERE deleted_at IS NULL
+	`
+	args := []interface{}{}
+	argCount := 0
+
+	if search != "" {
+		argCount++
+		query += fmt.Sprintf(" AND (country_name_en ILIKE $%d OR country_name_ar ILIKE $%d)", argCount, argCount)
+		args = append(args, "%"+search+"%")
+	}
+
+	query += " ORDER BY country_name_en"
+	if limit > 0 {
+		argCount++
+		query += fmt.Sprintf(" LIMIT $%d", argCount)
+		args = append(args, limit)
+	}
+
+	return s.queryCountries(ctx, query, args...)
+}
+
+func (s *Postgres) CountriesByID(ctx context.Context, ids []int64) ([]models.Country, error) {
+	return s.queryCountries(ctx, `
+		SELECT country_id, country_name_en, country_name_ar, iso_code
+		FROM dim_country
+		WHERE country_id = ANY($1)
+		ORDER BY country_id
+	`, ids)
+}
+
+func (s *Postgres) queryCountries(ctx context.Context, query string, args ...interface{}) ([]models.Country, error) {
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	countries := []models.Country{}
+	for rows.Next() {
+		var country models.Country
+		if err := rows.Scan(&country.CountryID, &country.CountryNameEN, &country.CountryNameAR, &country.ISOCode); err != nil {
+			return nil, err
+		}
+		countries = append(countries, country)
+	}
+
+	return countries, rows.Err()
+}
+
+func (s *Postgres) Ports(ctx context.Context, search, portType string, limit int) ([]models.Port, error) {
+	query := `
+		SELECT port_id, port_name_en, port_name_ar, port_type_en, port_type_ar, mode_id, latitude, longitude
+		FROM dim_port
+		WHERE deleted_at IS NULL
+	`
+	args := []interface{}{}
+	argCount := 0
+
+	if search != "" {
+		argCount++
+		query += fmt.Sprintf(" AND (port_name_en ILIKE $%d OR port_name_ar ILIKE $%d)", argCount, argCount)
+		args = append(args, "%"+search+"%")
+	}
+
+	if portType != "" {
+		argCount++
+		query += fmt.Sprintf(" AND port_type_en = $%d", argCount)
+		args = append(args, portType)
+	}
+
+	query += " ORDER BY port_name_en"
+	if limit > 0 {
+		argCount++
+		query += fmt.Sprintf(" LIMIT $%d", argCount)
+		args = append(args, limit)
+	}
+
+	return s.queryPorts(ctx, query, args...)
+}
+
+func (s *Postgres) PortsByID(ctx context.Context, ids []int64) ([]models.Port, error) {
+	return s.queryPorts(ctx, `
+		SELECT port_id, port_name_en, port_name_ar, port_type_en, port_type_ar, mode_id, latitude, longitude
+		FROM dim_port
+		WHERE port_id = ANY($1)
+		ORDER BY port_id
+	`, ids)
+}
+
+func (s *Postgres) queryPorts(ctx context.Context, query string, args ...interface{}) ([]models.Port, error) {
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ports := []models.Port{}
+	for rows.Next() {
+		var port models.Port
+		if err := rows.Scan(&port.PortID, &port.PortNameEN, &port.PortNameAR,
+			&port.PortTypeEN, &port.PortTypeAR, &port.ModeID, &port.Latitude, &port.Longitude); err != nil {
+			return nil, err
+		}
+		ports = append(ports, port)
+	}
+
+	return ports, rows.Err()
+}
+
+func (s *Postgres) PortHistory(ctx context.Context, id int64) ([]models.PortVersion, error) {
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT port_id, port_name_en, port_name_ar, port_type_en, port_type_ar, mode_id, latitude, longitude,
+			valid_from, valid_to
+		FROM dim_port_history
+		WHERE port_id = $1
+		ORDER BY valid_from NULLS FIRST
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []models.PortVersion{}
+	for rows.Next() {
+		var v models.PortVersion
+		if err := rows.Scan(&v.PortID, &v.PortNameEN, &v.PortNameAR, &v.PortTypeEN, &v.PortTypeAR,
+			&v.ModeID, &v.Latitude, &v.Longitude, &v.ValidFrom, &v.ValidTo); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+func (s *Postgres) PortTypes(ctx context.Context) ([]models.PortType, error) {
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT DISTINCT mode_id, port_type_en, port_type_ar
+		FROM dim_port
+		WHERE deleted_at IS NULL
+		ORDER BY mode_id, port_type_en
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	portTypes := []models.PortType{}
+	for rows.Next() {
+		var pt models.PortType
+		if err := rows.Scan(&pt.ModeID, &pt.PortTypeEN, &pt.PortTypeAR); err != nil {
+			return nil, err
+		}
+		portTypes = append(portTypes, pt)
+	}
+	return portTypes, rows.Err()
+}
+
+func (s *Postgres) Counts(ctx context.Context) (models.DimensionCounts, error) {
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return models.DimensionCounts{}, err
+	}
+	defer tx.Rollback(ctx)
+
+	var counts models.DimensionCounts
+	err = tx.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM dim_product WHERE deleted_at IS NULL),
+			(SELECT COUNT(*) FROM dim_country WHERE deleted_at IS NULL),
+			(SELECT COUNT(*) FROM dim_port WHERE deleted_at IS NULL)
+	`).Scan(&counts.Products, &counts.Countries, &counts.Ports)
+	return counts, err
+}
+
+func (s *Postgres) YearlySummary(ctx context.Context, startYear, endYear, release int) ([]models.TradeSummary, error) {
+	inRelease, args := utils.ReleaseCondition("s", release, 3)
+	query := `
+		SELECT
+			year,
+			COALESCE(import_value, 0) as import_value,
+			COALESCE(export_value, 0) as export_value,
+			COALESCE(reexport_value, 0) as reexport_value,
+			COALESCE(tradebalance_value, 0) as tradebalance_value,
+			COALESCE(import_value, 0) + COALESCE(export_value, 0) + COALESCE(reexport_value, 0) as total_trade_value
+		FROM fact_yearly_summary s
+		WHERE year BETWEEN $1 AND $2 AND ` + inRelease + `
+		ORDER BY year
+	`
+
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, query, append([]interface{}{startYear, endYear}, args...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summaries := []models.TradeSummary{}
+	for rows.Next() {
+		var ts models.TradeSummary
+		if err := rows.Scan(&ts.Year, &ts.ImportValue, &ts.ExportValue, &ts.ReExportValue,
+			&ts.TradeBalanceValue, &ts.TotalTradeValue); err != nil {
+			return nil, err
+		}
+		summaries = append(summaries, ts)
+	}
+
+	return summaries, rows.Err()
+}
+
+func (s *Postgres) Balance(ctx context.Context, startYear, endYear, release int) (*models.TradeBalance, error) {
+	inRelease, args := utils.ReleaseCondition("s", release, 3)
+	query := `
+		SELECT
+			COALESCE(SUM(import_value), 0) as total_import,
+			COALESCE(SUM(export_value), 0) as total_export,
+			COALESCE(SUM(reexport_value), 0) as total_reexport,
+			COALESCE(SUM(export_value), 0) + COALESCE(SUM(reexport_value), 0) - COALESCE(SUM(import_value), 0) as trade_balance
+		FROM fact_yearly_summary s
+		WHERE year BETWEEN $1 AND $2 AND ` + inRelease + `
+	`
+
+	balance := &models.TradeBalance{
+		StartYear: startYear,
+		EndYear:   endYear,
+	}
+
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	err = tx.QueryRow(ctx, query, append([]interface{}{startYear, endYear}, args...)...).Scan(
+		&balance.TotalImport,
+		&balance.TotalExport,
+		&balance.TotalReExport,
+		&balance.TradeBalance,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return balance, nil
+}
+
+func (s *Postgres) Aggregate(ctx context.Context, req *models.AggregateRequest) ([]models.AggregateResult, int64, error) {
+	q, err := utils.BuildAggregateQuery(req)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var totalCount int64
+	if err := tx.QueryRow(ctx, q.CountQuery, q.Args...).Scan(&totalCount); err != nil {
+		return nil, 0, err
+	}
+
+	query, args := q.Paginated(req.Pagination.Limit, req.Pagination.Offset())
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := []models.AggregateResult{}
+	for rows.Next() {
+		result := models.AggregateResult{}
+		if err := rows.Scan(utils.BuildScanTargets(req, &result)...); err != nil {
+			return nil, 0, err
+		}
+		results = append(results, result)
+	}
+
+	return results, totalCount, rows.Err()
+}
+
+func (s *Postgres) AggregateDiff(ctx context.Context, req *models.AggregateRequest, from, to int) ([]models.AggregateChange, int64, error) {
+	q, err := utils.BuildAggregateDiffQuery(req, from, to)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var totalCount int64
+	if err := tx.QueryRow(ctx, q.CountQuery, q.Args...).Scan(&totalCount); err != nil {
+		return nil, 0, err
+	}
+
+	query, args := q.Paginated(req.Pagination.Limit, req.Pagination.Offset())
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	changes := []models.AggregateChange{}
+	for rows.Next() {
+		change := models.AggregateChange{}
+		if err := rows.Scan(utils.BuildDiffScanTargets(req, &change)...); err != nil {
+			return nil, 0, err
+		}
+		change.Change = change.TotalValue - change.PreviousValue
+		changes = append(changes, change)
+	}
+
+	return changes, totalCount, rows.Err()
+}
+
+func (s *Postgres) ExplainAggregate(ctx context.Context, req *models.AggregateRequest) (json.RawMessage, error) {
+	q, err := utils.BuildAggregateQuery(req)
+	if err != nil {
+		return nil, err
+	}
+	query, args := q.Paginated(req.Pagination.Limit, req.Pagination.Offset())
+
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var plan json.RawMessage
+	if err := tx.QueryRow(ctx, "EXPLAIN (ANALYZE, FORMAT JSON) "+query, args...).Scan(&plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// YearRange is read on every aggregate validation, so it is cached for
+// yearRangeTTL. A failed read falls back to the last known range.
+func (s *Postgres) YearRange(ctx context.Context) (int, int, error) {
+	s.yearsMu.Lock()
+	minYear, maxYear, fresh := s.minYear, s.maxYear, time.Now().Before(s.yearsExpires)
+	s.yearsMu.Unlock()
+	if fresh {
+		return minYear, maxYear, nil
+	}
+
+	var readMin, readMax int
+	tx, err := s.readTx(ctx)
+	if err == nil {
+		err = tx.QueryRow(ctx, `SELECT COALESCE(MIN(year), 0), COALESCE(MAX(year), 0) FROM fact_yearly_summary WHERE valid_to_release IS NULL`).
+			Scan(&readMin, &readMax)
+		tx.Rollback(ctx)
+	}
+	if err != nil {
+		if maxYear != 0 {
+			return minYear, maxYear, nil
+		}
+		return 0, 0, err
+	}
+
+	s.yearsMu.Lock()
+	s.minYear, s.maxYear = readMin, readMax
+	s.yearsExpires = time.Now().Add(yearRangeTTL)
+	s.yearsMu.Unlock()
+	return readMin, readMax, nil
+}
+
+// FactYearRange is read on every aggregate validation, so it is cached per
+// table and release for yearRangeTTL. The current rows are cached under the
+// latest release, so a load by another process shows on the next read. A
+// failed read falls back to the last known range.
+func (s *Postgres) FactYearRange(ctx context.Context, table string, release int) (int, int, error) {
+	if !slices.Contains([]string{utils.ProductFactTable, utils.CountryFactTable}, table) {
+		return 0, 0, fmt.Errorf("unknown fact table %q", table)
+	}
+
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	key := factYearsKey{table, release}
+	if release == 0 {
+		if err := tx.QueryRow(ctx, `SELECT COALESCE(MAX(release_id), 0) FROM releases`).Scan(&key.release); err != nil {
+			return 0, 0, err
+		}
+	}
+
+	s.yearsMu.Lock()
+	cached, ok := s.factYears[key]
+	s.yearsMu.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.min, cached.max, nil
+	}
+
+	inRelease, args := utils.ReleaseCondition("f", release, 1)
+	var minYear, maxYear int
+	err = tx.QueryRow(ctx, `SELECT COALESCE(MIN(year), 0), COALESCE(MAX(year), 0) FROM `+table+` f WHERE `+inRelease, args...).
+		Scan(&minYear, &maxYear)
+	if err != nil {
+		if ok && cached.max != 0 {
+			return cached.min, cached.max, nil
+		}
+		return 0, 0, err
+	}
+
+	s.yearsMu.Lock()
+	if s.factYears == nil {
+		s.factYears = map[factYearsKey]factYears{}
+	}
+	s.factYears[key] = factYears{min: minYear, max: maxYear, expires: time.Now().Add(yearRangeTTL)}
+	s.yearsMu.Unlock()
+	return minYear, maxYear, nil
+}
+
+func (s *Postgres) SummaryYears(ctx context.Context) ([]int, error) {
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT year FROM fact_yearly_summary WHERE valid_to_release IS NULL ORDER BY year`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	years := []int{}
+	for rows.Next() {
+		var year int
+		if err := rows.Scan(&year); err != nil {
+			return nil, err
+		}
+		years = append(years, year)
+	}
+	return years, rows.Err()
+}
+
+// FactTables reads the years and trade types present in the current rows of
+// each fact table. It scans the tables, so callers should cache the result.
+func (s *Postgres) FactTables(ctx context.Context) ([]models.FactTableMetadata, error) {
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	tables := []models.FactTableMetadata{}
+	for _, table := range []string{utils.ProductFactTable, utils.CountryFactTable} {
+		fact := models.FactTableMetadata{
+			Name:       table,
+			Dimensions: utils.FactTableDimensions[table],
+			Years:      []int{},
+			TradeTypes: []string{},
+		}
+
+		// table is one of the fixed fact table names, never client input
+		rows, err := tx.Query(ctx, `SELECT DISTINCT year, trade_type FROM `+table+` WHERE valid_to_release IS NULL ORDER BY year, trade_type`)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var year int
+			var tradeType string
+			if err := rows.Scan(&year, &tradeType); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if !slices.Contains(fact.Years, year) {
+				fact.Years = append(fact.Years, year)
+			}
+			if !slices.Contains(fact.TradeTypes, tradeType) {
+				fact.TradeTypes = append(fact.TradeTypes, tradeType)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		slices.Sort(fact.TradeTypes)
+		tables = append(tables, fact)
+	}
+	return tables, nil
+}
+
+// LastDataLoad is the finish time of the latest run of the load command.
+// Databases loaded by other means fall back to the last time Postgres
+// analyzed the fact tables, which follows every bulk load.
+func (s *Postgres) LastDataLoad(ctx context.Context) (*time.Time, error) {
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var last *time.Time
+	err = tx.QueryRow(ctx, `
+		SELECT COALESCE(
+			(SELECT MAX(finished_at) FROM data_loads),
+			(SELECT MAX(GREATEST(last_analyze, last_autoanalyze))
+			 FROM pg_stat_user_tables
+			 WHERE relname IN ($1, $2, 'fact_yearly_summary'))
+		)
+	`, utils.ProductFactTable, utils.CountryFactTable).Scan(&last)
+	return last, err
+}
+
+func (s *Postgres) Releases(ctx context.Context) ([]models.Release, error) {
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `SELECT release_id, source, created_at FROM releases ORDER BY release_id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	releases := []models.Release{}
+	for rows.Next() {
+		var r models.Release
+		if err := rows.Scan(&r.ReleaseID, &r.Source, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		releases = append(releases, r)
+	}
+	return releases, rows.Err()
+}
+
+func (s *Postgres) FactTotals(ctx context.Context) ([]models.FactTotal, error) {
+	// One statement, so both tables are read from the same snapshot
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, `
+		SELECT $1::text, year, trade_type, SUM(value)::bigint FROM `+utils.ProductFactTable+`
+		WHERE valid_to_release IS NULL GROUP BY year, trade_type
+		UNION ALL
+		SELECT $2::text, year, trade_type, SUM(value)::bigint FROM `+utils.CountryFactTable+`
+		WHERE valid_to_release IS NULL GROUP BY year, trade_type
+		ORDER BY 1, 2, 3
+	`, utils.ProductFactTable, utils.CountryFactTable)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []models.FactTotal{}
+	for rows.Next() {
+		var t models.FactTotal
+		if err := rows.Scan(&t.Table, &t.Year, &t.TradeType, &t.Value); err != nil {
+			return nil, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// summaryValues are the columns of fact_yearly_summary besides year.
+var summaryValues = []string{"import_value", "export_value", "reexport_value", "tradebalance_value"}
+
+// ReplaceYearlySummary closes the current summary rows that summaries change
+// or drop and inserts the new ones, in a release of its own. It also expires
+// the cached year range, which the summary defines.
+func (s *Postgres) ReplaceYearlySummary(ctx context.Context, summaries []models.TradeSummary) (int, error) {
+	tx, err := s.db.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	release, err := NewRelease(ctx, tx, "rebuild-summary")
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(ctx, `
+		CREATE TEMP TABLE stage_yearly_summary (
+			year INTEGER, import_value BIGINT, export_value BIGINT, reexport_value BIGINT, tradebalance_value BIGINT
+		) ON COMMIT DROP
+	`)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"stage_yearly_summary"}, append([]string{"year"}, summaryValues...),
+		pgx.CopyFromSlice(len(summaries), func(i int) ([]any, error) {
+			ts := summaries[i]
+			return []any{ts.Year, ts.ImportValue, ts.ExportValue, ts.ReExportValue, ts.TradeBalanceValue}, nil
+		}))
+	if err != nil {
+		return 0, err
+	}
+	_, _, err = ReplaceVersions(ctx, tx, Versioned{
+		Table:  "fact_yearly_summary",
+		Stage:  "stage_yearly_summary",
+		Key:    []string{"year"},
+		Values: summaryValues,
+	}, release)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+
+	s.yearsMu.Lock()
+	s.yearsExpires = time.Time{}
+	s.yearsMu.Unlock()
+	return release, nil
+}
+
+func (s *Postgres) OrphanedIDs(ctx context.Context) ([]models.OrphanedID, error) {
+	parts := make([]string, len(factReferences))
+	for i, r := range factReferences {
+		parts[i] = fmt.Sprintf(`
+			SELECT '%[1]s', '%[2]s', f.%[2]s, COUNT(*) FROM %[1]s f
+			WHERE NOT EXISTS (SELECT 1 FROM %[3]s d WHERE d.%[2]s = f.%[2]s)
+			GROUP BY f.%[2]s`, r.table, r.column, r.dimension)
+	}
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, strings.Join(parts, " UNION ALL ")+" ORDER BY 1, 2, 3")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orphans := []models.OrphanedID{}
+	for rows.Next() {
+		var o models.OrphanedID
+		if err := rows.Scan(&o.Table, &o.Column, &o.ID, &o.Rows); err != nil {
+			return nil, err
+		}
+		orphans = append(orphans, o)
+	}
+	return orphans, rows.Err()
+}
+
+func (s *Postgres) MissingTranslations(ctx context.Context) ([]models.MissingTranslation, error) {
+	parts := make([]string, len(arabicColumns))
+	for i, c := range arabicColumns {
+		parts[i] = fmt.Sprintf(`
+			SELECT '%[1]s', %[2]s, '%[4]s', %[3]s FROM %[1]s
+			WHERE deleted_at IS NULL AND btrim(COALESCE(%[4]s, '')) = ''`, c.table, c.id, c.nameEN, c.column)
+	}
+	tx, err := s.readTx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	rows, err := tx.Query(ctx, strings.Join(parts, " UNION ALL ")+" ORDER BY 1, 3, 2")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	missing := []models.MissingTranslation{}
+	for rows.Next() {
+		var m models.MissingTranslation
+		if err := rows.Scan(&m.Table, &m.ID, &m.Column, &m.NameEN); err != nil {
+			return nil, err
+		}
+		missing = append(missing, m)
+	}
+	return missing, rows.Err()
+}
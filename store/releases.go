@@ -0,0 +1,93 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// NewRelease records a release from source in tx and returns its number.
+// Releases are numbered in commit order without gaps, so writers creating
+// one wait here for each other to commit.
+func NewRelease(ctx context.Context, tx pgx.Tx, source string) (int, error) {
+	// Plain reads of releases are not blocked
+	if _, err := tx.Exec(ctx, `LOCK TABLE releases IN EXCLUSIVE MODE`); err != nil {
+		return 0, err
+	}
+	var release int
+	err := tx.QueryRow(ctx, `
+		INSERT INTO releases (release_id, source)
+		SELECT COALESCE(MAX(release_id), 0) + 1, $1 FROM releases
+		RETURNING release_id
+	`, source).Scan(&release)
+	return release, err
+}
+
+// DryRunRelease stands in for the release of a load that is rolled back.
+// Numbered releases start at 1.
+const DryRunRelease = 0
+
+// NewDryRunRelease records DryRunRelease in tx, for changes that will be
+// rolled back to refer to. Unlike NewRelease it takes no lock and uses up no
+// release number; overlapping dry runs wait for each other on its key.
+func NewDryRunRelease(ctx context.Context, tx pgx.Tx, source string) (int, error) {
+	_, err := tx.Exec(ctx, `INSERT INTO releases (release_id, source) VALUES ($1, $2)`, DryRunRelease, source)
+	return DryRunRelease, err
+}
+
+// Versioned is a table whose rows are versioned by release, and the staging
+// table holding its new contents. The staging table has the Key and Values
+// columns.
+type Versioned struct {
+	Table string
+	Stage string
+	// Key identifies a row across its versions
+	Key    []string
+	Values []string
+	// Scope is a condition on the current rows, aliased p, that the staged
+	// rows replace, such as the staged years. Empty replaces every one.
+	Scope string
+}
+
+// ReplaceVersions makes the staged rows the current rows of v.Table within
+// v.Scope, as of release. Current rows the stage changes or lacks are closed
+// and the changed and new rows inserted; rows it repeats unchanged are kept.
+// It returns the numbers of rows closed and inserted.
+func ReplaceVersions(ctx context.Context, tx pgx.Tx, v Versioned, release int) (closed, inserted int64, err error) {
+	scope := "TRUE"
+	if v.Scope != "" {
+		scope = v.Scope
+	}
+	var match, staged, current []string
+	for _, k := range v.Key {
+		match = append(match, fmt.Sprintf("s.%[1]s = p.%[1]s", k))
+	}
+	for _, c := range v.Values {
+		staged = append(staged, "s."+c)
+		current = append(current, "p."+c)
+	}
+
+	tag, err := tx.Exec(ctx, fmt.Sprintf(`
+		UPDATE %[1]s p SET valid_to_release = $1
+		WHERE p.valid_to_release IS NULL AND %[2]s AND NOT EXISTS (
+			SELECT 1 FROM %[3]s s WHERE %[4]s AND (%[5]s) IS NOT DISTINCT FROM (%[6]s)
+		)
+	`, v.Table, scope, v.Stage, strings.Join(match, " AND "), strings.Join(staged, ", "), strings.Join(current, ", ")), release)
+	if err != nil {
+		return 0, 0, err
+	}
+	closed = tag.RowsAffected()
+
+	columns := strings.Join(append(append([]string{}, v.Key...), v.Values...), ", ")
+	tag, err = tx.Exec(ctx, fmt.Sprintf(`
+		INSERT INTO %[1]s (%[2]s, valid_from_release)
+		SELECT %[2]s, $1::integer FROM %[3]s s
+		WHERE NOT EXISTS (SELECT 1 FROM %[1]s p WHERE p.valid_to_release IS NULL AND %[4]s)
+	`, v.Table, columns, v.Stage, strings.Join(match, " AND ")), release)
+	if err != nil {
+		return closed, 0, err
+	}
+	return closed, tag.RowsAffected(), nil
+}
@@ -0,0 +1,144 @@
+// Package store reads the trade data warehouse. Handlers depend on the
+// interfaces here rather than on a database pool, so they can run against the
+// Postgres backend in production and an in-memory fake in tests.
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"trade-api/models"
+)
+
+// DimensionStore reads products, countries and ports. Searches match either
+// language and a limit of zero returns every member. Lists, counts and port
+// types leave out deleted members; lookups by ID and history include them.
+type DimensionStore interface {
+	Products(ctx context.Context, search string, limit int) ([]models.Product, error)
+	Countries(ctx context.Context, search string, limit int) ([]models.Country, error)
+	Ports(ctx context.Context, search, portType string, limit int) ([]models.Port, error)
+
+	CountriesByID(ctx context.Context, ids []int64) ([]models.Country, error)
+	PortsByID(ctx context.Context, ids []int64) ([]models.Port, error)
+	// PortHistory returns every version of a port, oldest first, or none
+	// for an unknown port.
+	PortHistory(ctx context.Context, id int64) ([]models.PortVersion, error)
+
+	PortTypes(ctx context.Context) ([]models.PortType, error)
+	Counts(ctx context.Context) (models.DimensionCounts, error)
+}
+
+// TradeStore reads the fact and yearly summary tables. Reads take a release
+// to read the data as it stood then, or 0 for the latest; everything else
+// reads the latest.
+type TradeStore interface {
+	YearlySummary(ctx context.Context, startYear, endYear, release int) ([]models.TradeSummary, error)
+	Balance(ctx context.Context, startYear, endYear, release int) (*models.TradeBalance, error)
+
+	// Aggregate returns one page of a validated request and the total number
+	// of groups across all pages.
+	Aggregate(ctx context.Context, req *models.AggregateRequest) ([]models.AggregateResult, int64, error)
+	// AggregateDiff returns one page of the groups of a validated request
+	// whose totals differ between releases from and to, and the total number
+	// of such groups. Release 0 is before the first release.
+	AggregateDiff(ctx context.Context, req *models.AggregateRequest, from, to int) ([]models.AggregateChange, int64, error)
+	// ExplainAggregate runs the page query under EXPLAIN ANALYZE.
+	ExplainAggregate(ctx context.Context, req *models.AggregateRequest) (json.RawMessage, error)
+
+	// YearRange returns the first and last years in the yearly summary, or
+	// zeros when it is empty.
+	YearRange(ctx context.Context) (minYear, maxYear int, err error)
+	// FactYearRange returns the first and last years of a fact table's rows
+	// in release, or the current rows for release 0, or zeros when there are
+	// none.
+	FactYearRange(ctx context.Context, table string, release int) (minYear, maxYear int, err error)
+	SummaryYears(ctx context.Context) ([]int, error)
+	FactTables(ctx context.Context) ([]models.FactTableMetadata, error)
+	LastDataLoad(ctx context.Context) (*time.Time, error)
+	// Releases returns every release, newest first.
+	Releases(ctx context.Context) ([]models.Release, error)
+}
+
+// SummaryStore maintains fact_yearly_summary from the detailed fact tables.
+type SummaryStore interface {
+	// FactTotals sums both fact tables by year and trade type, from one
+	// snapshot of the data.
+	FactTotals(ctx context.Context) ([]models.FactTotal, error)
+	// ReplaceYearlySummary makes summaries the whole yearly summary in a new
+	// release, which it returns.
+	ReplaceYearlySummary(ctx context.Context, summaries []models.TradeSummary) (int, error)
+}
+
+// QualityStore finds rows that make the warehouse incomplete.
+type QualityStore interface {
+	// OrphanedIDs returns the dimension IDs fact rows use that are not in
+	// their dimension table.
+	OrphanedIDs(ctx context.Context) ([]models.OrphanedID, error)
+	// MissingTranslations returns the dimension rows, other than deleted ones,
+	// with an empty Arabic column.
+	MissingTranslations(ctx context.Context) ([]models.MissingTranslation, error)
+}
+
+// Errors AdminStore returns for a member that does not fit the change.
+var (
+	ErrExists   = errors.New("member already exists")
+	ErrNotFound = errors.New("member not found")
+)
+
+// AdminStore changes dimension members on behalf of an admin and records
+// each change, with its actor, in the audit trail. Deleted members keep
+// labelling the facts that use them but leave the dimension lists. Country
+// and port changes take effect in their history on the effective day.
+type AdminStore interface {
+	// Creating a member returns ErrExists when its ID is taken, even by a
+	// deleted member. Updating one returns ErrNotFound when it does not
+	// exist or is deleted.
+	CreateProduct(ctx context.Context, p models.Product, actor string) error
+	UpdateProduct(ctx context.Context, p models.Product, actor string) error
+	CreateCountry(ctx context.Context, c models.Country, effective time.Time, actor string) error
+	UpdateCountry(ctx context.Context, c models.Country, effective time.Time, actor string) error
+	CreatePort(ctx context.Context, p models.Port, effective time.Time, actor string) error
+	UpdatePort(ctx context.Context, p models.Port, effective time.Time, actor string) error
+
+	// DeleteMember soft-deletes member id of a dimension table, and
+	// RestoreMember undoes it. Both return ErrNotFound when there is no
+	// such member to delete or restore.
+	DeleteMember(ctx context.Context, table string, id int64, actor string) error
+	RestoreMember(ctx context.Context, table string, id int64, actor string) error
+
+	// Audit returns up to limit changes, newest first, to the members of
+	// table, or of every table when it is empty, with ID id, or any ID when
+	// it is 0.
+	Audit(ctx context.Context, table string, id int64, limit int) ([]models.AuditEntry, error)
+}
+
+// ErrKeyNotFound is returned for an API key that does not exist, or is
+// already revoked when revoking it.
+var ErrKeyNotFound = errors.New("api key not found")
+
+// KeyStore keeps the API keys clients authenticate with.
+type KeyStore interface {
+	// CreateKey stores k and sets its ID and creation time.
+	CreateKey(ctx context.Context, k *models.APIKey) error
+	// KeyByPrefix returns the key with prefix, revoked or not.
+	KeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error)
+	// Keys returns every key, newest first.
+	Keys(ctx context.Context) ([]models.APIKey, error)
+	RevokeKey(ctx context.Context, id int64) error
+	// TouchKey records that key id was used at.
+	TouchKey(ctx context.Context, id int64, at time.Time) error
+}
+
+// Store is everything the API reads, the yearly summary it maintains, the
+// dimension changes admins make and the API keys.
+type Store interface {
+	DimensionStore
+	TradeStore
+	SummaryStore
+	QualityStore
+	AdminStore
+	KeyStore
+	Ping(ctx context.Context) error
+}
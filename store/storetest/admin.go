@@ -0,0 +1,282 @@
+package storetest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"time"
+
+	"trade-api/models"
+	"trade-api/store"
+)
+
+func (m *Memory) CreateProduct(ctx context.Context, p models.Product, actor string) error {
+	if err := m.checkNew("dim_product", p.ProductID); err != nil {
+		return err
+	}
+	m.Fixtures.Products = append(m.Fixtures.Products, p)
+	m.audit("dim_product", p.ProductID, models.AuditCreate, actor, nil, p)
+	return nil
+}
+
+func (m *Memory) UpdateProduct(ctx context.Context, p models.Product, actor string) error {
+	i, err := m.current("dim_product", p.ProductID)
+	if err != nil {
+		return err
+	}
+	before := m.Fixtures.Products[i]
+	m.Fixtures.Products[i] = p
+	m.audit("dim_product", p.ProductID, models.AuditUpdate, actor, before, p)
+	return nil
+}
+
+func (m *Memory) CreateCountry(ctx context.Context, c models.Country, effective time.Time, actor string) error {
+	if err := m.checkNew("dim_country", c.CountryID); err != nil {
+		return err
+	}
+	history, err := record(m.Fixtures.CountryHistory, countrySpan(c.CountryID), nil, models.CountryVersion{Country: c}, effective)
+	if err != nil {
+		return err
+	}
+	m.Fixtures.Countries = append(m.Fixtures.Countries, c)
+	m.Fixtures.CountryHistory = history
+	m.audit("dim_country", c.CountryID, models.AuditCreate, actor, nil, c)
+	return nil
+}
+
+func (m *Memory) UpdateCountry(ctx context.Context, c models.Country, effective time.Time, actor string) error {
+	i, err := m.current("dim_country", c.CountryID)
+	if err != nil {
+		return err
+	}
+	before := m.Fixtures.Countries[i]
+	if !reflect.DeepEqual(before, c) {
+		history, err := record(m.Fixtures.CountryHistory, countrySpan(c.CountryID),
+			&models.CountryVersion{Country: before}, models.CountryVersion{Country: c}, effective)
+		if err != nil {
+			return err
+		}
+		m.Fixtures.CountryHistory = history
+	}
+	m.Fixtures.Countries[i] = c
+	m.audit("dim_country", c.CountryID, models.AuditUpdate, actor, before, c)
+	return nil
+}
+
+func (m *Memory) CreatePort(ctx context.Context, p models.Port, effective time.Time, actor string) error {
+	if err := m.checkNew("dim_port", p.PortID); err != nil {
+		return err
+	}
+	history, err := record(m.Fixtures.PortHistory, portSpan(p.PortID), nil, models.PortVersion{Port: p}, effective)
+	if err != nil {
+		return err
+	}
+	m.Fixtures.Ports = append(m.Fixtures.Ports, p)
+	m.Fixtures.PortHistory = history
+	m.audit("dim_port", p.PortID, models.AuditCreate, actor, nil, p)
+	return nil
+}
+
+func (m *Memory) UpdatePort(ctx context.Context, p models.Port, effective time.Time, actor string) error {
+	i, err := m.current("dim_port", p.PortID)
+	if err != nil {
+		return err
+	}
+	before := m.Fixtures.Ports[i]
+	if !reflect.DeepEqual(before, p) {
+		history, err := record(m.Fixtures.PortHistory, portSpan(p.PortID),
+			&models.PortVersion{Port: before}, models.PortVersion{Port: p}, effective)
+		if err != nil {
+			return err
+		}
+		m.Fixtures.PortHistory = history
+	}
+	m.Fixtures.Ports[i] = p
+	m.audit("dim_port", p.PortID, models.AuditUpdate, actor, before, p)
+	return nil
+}
+
+func (m *Memory) DeleteMember(ctx context.Context, table string, id int64, actor string) error {
+	i, err := m.current(table, id)
+	if err != nil {
+		return err
+	}
+	if m.Fixtures.Deleted == nil {
+		m.Fixtures.Deleted = map[string][]int64{}
+	}
+	m.Fixtures.Deleted[table] = append(m.Fixtures.Deleted[table], id)
+	m.audit(table, id, models.AuditDelete, actor, m.member(table, i), nil)
+	return nil
+}
+
+func (m *Memory) RestoreMember(ctx context.Context, table string, id int64, actor string) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	i, err := m.index(table, id)
+	if err != nil {
+		return err
+	}
+	if i < 0 || !m.deleted(table, id) {
+		return store.ErrNotFound
+	}
+	m.Fixtures.Deleted[table] = slices.DeleteFunc(m.Fixtures.Deleted[table], func(d int64) bool { return d == id })
+	m.audit(table, id, models.AuditRestore, actor, nil, m.member(table, i))
+	return nil
+}
+
+func (m *Memory) Audit(ctx context.Context, table string, id int64, limit int) ([]models.AuditEntry, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	entries := []models.AuditEntry{}
+	for _, e := range slices.Backward(m.Fixtures.Audit) {
+		if (table == "" || e.Table == table) && (id == 0 || e.ID == id) {
+			entries = append(entries, e)
+		}
+	}
+	return truncate(entries, limit), nil
+}
+
+// checkNew returns ErrExists when id is taken in table, even by a deleted
+// member.
+func (m *Memory) checkNew(table string, id int64) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	i, err := m.index(table, id)
+	if err != nil {
+		return err
+	}
+	if i >= 0 {
+		return store.ErrExists
+	}
+	return nil
+}
+
+// current returns the index of member id of table, or ErrNotFound when it
+// does not exist or is deleted.
+func (m *Memory) current(table string, id int64) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	i, err := m.index(table, id)
+	if err != nil {
+		return 0, err
+	}
+	if i < 0 || m.deleted(table, id) {
+		return 0, store.ErrNotFound
+	}
+	return i, nil
+}
+
+// index returns the index of member id in the fixtures of table, or -1.
+func (m *Memory) index(table string, id int64) (int, error) {
+	switch table {
+	case "dim_product":
+		return slices.IndexFunc(m.Fixtures.Products, func(p models.Product) bool { return p.ProductID == id }), nil
+	case "dim_country":
+		return slices.IndexFunc(m.Fixtures.Countries, func(c models.Country) bool { return c.CountryID == id }), nil
+	case "dim_port":
+		return slices.IndexFunc(m.Fixtures.Ports, func(p models.Port) bool { return p.PortID == id }), nil
+	}
+	return 0, fmt.Errorf("unknown dimension table %q", table)
+}
+
+// member returns the member at index i of the fixtures of table.
+func (m *Memory) member(table string, i int) interface{} {
+	switch table {
+	case "dim_product":
+		return m.Fixtures.Products[i]
+	case "dim_country":
+		return m.Fixtures.Countries[i]
+	}
+	return m.Fixtures.Ports[i]
+}
+
+// deleted reports whether member id of table is soft-deleted.
+func (m *Memory) deleted(table string, id int64) bool {
+	return slices.Contains(m.Fixtures.Deleted[table], id)
+}
+
+func (m *Memory) audit(table string, id int64, action, actor string, before, after interface{}) {
+	m.Fixtures.Audit = append(m.Fixtures.Audit, models.AuditEntry{
+		AuditID:   int64(len(m.Fixtures.Audit) + 1),
+		Table:     table,
+		ID:        id,
+		Action:    action,
+		Actor:     actor,
+		Before:    document(before),
+		After:     document(after),
+		ChangedAt: time.Now().UTC(),
+	})
+}
+
+func document(member interface{}) json.RawMessage {
+	if member == nil {
+		return nil
+	}
+	doc, err := json.Marshal(member)
+	if err != nil {
+		panic(err)
+	}
+	return doc
+}
+
+// span returns whether a version belongs to a member, and its bounds.
+type span[V any] func(v *V) (owned bool, from, to **time.Time)
+
+func countrySpan(id int64) span[models.CountryVersion] {
+	return func(v *models.CountryVersion) (bool, **time.Time, **time.Time) {
+		return v.CountryID == id, &v.ValidFrom, &v.ValidTo
+	}
+}
+
+func portSpan(id int64) span[models.PortVersion] {
+	return func(v *models.PortVersion) (bool, **time.Time, **time.Time) {
+		return v.PortID == id, &v.ValidFrom, &v.ValidTo
+	}
+}
+
+// record adds current to a member's history from effective, the way
+// store.RecordHistory does. The open version closes on effective, or is
+// replaced when it opened that day. previous is the member's version before
+// the change, which starts its history when it has none; it is nil for a
+// new member.
+func record[V any](history []V, of span[V], previous *V, current V, effective time.Time) ([]V, error) {
+	history = slices.Clone(history)
+	open, versions := -1, 0
+	for i := range history {
+		owned, _, to := of(&history[i])
+		if !owned {
+			continue
+		}
+		versions++
+		if *to == nil {
+			open = i
+		}
+	}
+	if versions == 0 && previous != nil {
+		history = append(history, *previous)
+		open = len(history) - 1
+	}
+
+	if open >= 0 {
+		_, from, to := of(&history[open])
+		switch {
+		case *from != nil && (*from).After(effective):
+			return nil, store.ErrLaterVersion
+		case *from != nil && (*from).Equal(effective):
+			history = slices.Delete(history, open, open+1)
+		default:
+			*to = &effective
+		}
+	}
+	if versions > 0 || previous != nil {
+		_, from, _ := of(&current)
+		*from = &effective
+	}
+	return append(history, current), nil
+}
@@ -0,0 +1,67 @@
+package storetest
+
+import (
+	"context"
+	"slices"
+	"time"
+
+	"trade-api/models"
+	"trade-api/store"
+)
+
+func (m *Memory) CreateKey(ctx context.Context, k *models.APIKey) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	k.KeyID = int64(len(m.Fixtures.APIKeys) + 1)
+	k.CreatedAt = time.Now().UTC()
+	m.Fixtures.APIKeys = append(m.Fixtures.APIKeys, *k)
+	return nil
+}
+
+func (m *Memory) KeyByPrefix(ctx context.Context, prefix string) (*models.APIKey, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	i := slices.IndexFunc(m.Fixtures.APIKeys, func(k models.APIKey) bool { return k.Prefix == prefix })
+	if i < 0 {
+		return nil, store.ErrKeyNotFound
+	}
+	k := m.Fixtures.APIKeys[i]
+	return &k, nil
+}
+
+func (m *Memory) Keys(ctx context.Context) ([]models.APIKey, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	keys := slices.Clone(m.Fixtures.APIKeys)
+	slices.Reverse(keys)
+	if keys == nil {
+		keys = []models.APIKey{}
+	}
+	return keys, nil
+}
+
+func (m *Memory) RevokeKey(ctx context.Context, id int64) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	i := slices.IndexFunc(m.Fixtures.APIKeys, func(k models.APIKey) bool { return k.KeyID == id })
+	if i < 0 || m.Fixtures.APIKeys[i].RevokedAt != nil {
+		return store.ErrKeyNotFound
+	}
+	now := time.Now().UTC()
+	m.Fixtures.APIKeys[i].RevokedAt = &now
+	return nil
+}
+
+func (m *Memory) TouchKey(ctx context.Context, id int64, at time.Time) error {
+	if m.Err != nil {
+		return m.Err
+	}
+	if i := slices.IndexFunc(m.Fixtures.APIKeys, func(k models.APIKey) bool { return k.KeyID == id }); i >= 0 {
+		m.Fixtures.APIKeys[i].LastUsedAt = &at
+	}
+	return nil
+}
@@ -0,0 +1,796 @@
+// Package storetest provides an in-memory store.Store for tests, seeded from
+// JSON fixtures. It answers every query in Go with the same semantics as the
+// Postgres backend.
+package storetest
+
+import (
+	"cmp"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"trade-api/models"
+	"trade-api/store"
+	"trade-api/utils"
+)
+
+//go:embed testdata/fixtures.json
+var defaultFixtures []byte
+
+// Fact is a row of either fact table. ProductID is set for the product table
+// and CountryID for the country table. A fact is part of the releases from
+// ValidFrom, or the first when it is 0, up to but not including ValidTo, or
+// every later release when it is 0.
+type Fact struct {
+	Year      int    `json:"year"`
+	ProductID int64  `json:"product_id,omitempty"`
+	CountryID int64  `json:"country_id,omitempty"`
+	PortID    int64  `json:"port_id"`
+	TradeType string `json:"trade_type"`
+	Value     int64  `json:"value"`
+	ValidFrom int    `json:"valid_from_release,omitempty"`
+	ValidTo   int    `json:"valid_to_release,omitempty"`
+}
+
+// current reports whether f is part of the latest release.
+func (f Fact) current() bool {
+	return f.ValidTo == 0
+}
+
+// inRelease reports whether f is part of release. Release 0 is before the
+// first, so it has no facts.
+func (f Fact) inRelease(release int) bool {
+	return max(f.ValidFrom, 1) <= release && (f.ValidTo == 0 || f.ValidTo > release)
+}
+
+// visible reports whether f is part of release, or current for release 0.
+func (f Fact) visible(release int) bool {
+	if release == 0 {
+		return f.current()
+	}
+	return f.inRelease(release)
+}
+
+// SummarySnapshot is the yearly summary as it stood before release
+// SupersededBy replaced it.
+type SummarySnapshot struct {
+	SupersededBy int                   `json:"superseded_by"`
+	Summary      []models.TradeSummary `json:"summary"`
+}
+
+// Fixtures is the data a Memory store serves. YearlySummary is the current
+// summary and SummaryHistory the earlier ones, oldest first. CountryHistory
+// and PortHistory hold every version of the members that changed; the others
+// only have their current version. Deleted lists the soft-deleted member IDs
+// of each dimension table, Audit the admin changes, oldest first, and APIKeys
+// the keys in the order they were created.
+type Fixtures struct {
+	Products       []models.Product        `json:"products"`
+	Countries      []models.Country        `json:"countries"`
+	Ports          []models.Port           `json:"ports"`
+	CountryHistory []models.CountryVersion `json:"country_history,omitempty"`
+	PortHistory    []models.PortVersion    `json:"port_history,omitempty"`
+	ProductFacts   []Fact                  `json:"product_facts"`
+	CountryFacts   []Fact                  `json:"country_facts"`
+	YearlySummary  []models.TradeSummary   `json:"yearly_summary"`
+	SummaryHistory []SummarySnapshot       `json:"summary_history,omitempty"`
+	Releases       []models.Release        `json:"releases"`
+	LastDataLoad   *time.Time              `json:"last_data_load"`
+	Deleted        map[string][]int64      `json:"deleted,omitempty"`
+	Audit          []models.AuditEntry     `json:"audit,omitempty"`
+	APIKeys        []models.APIKey         `json:"api_keys,omitempty"`
+}
+
+// Memory is an in-memory store.Store. Set Err to make every call fail.
+type Memory struct {
+	Fixtures
+	Err error
+}
+
+var _ store.Store = (*Memory)(nil)
+
+// New returns a store seeded from the fixtures in testdata/fixtures.json.
+func New() *Memory {
+	m, err := parse(defaultFixtures)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// Load returns a store seeded from a fixtures file.
+func Load(path string) (*Memory, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return parse(data)
+}
+
+func parse(data []byte) (*Memory, error) {
+	var f Fixtures
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("parse fixtures: %w", err)
+	}
+	return &Memory{Fixtures: f}, nil
+}
+
+func (m *Memory) Ping(ctx context.Context) error {
+	return m.Err
+}
+
+func (m *Memory) Products(ctx context.Context, search string, limit int) ([]models.Product, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	products := []models.Product{}
+	for _, p := range m.Fixtures.Products {
+		if !m.deleted("dim_product", p.ProductID) && matches(search, p.ProductDescEN, p.ProductDescAR) {
+			products = append(products, p)
+		}
+	}
+	slices.SortStableFunc(products, func(a, b models.Product) int { return cmp.Compare(a.ProductDescEN, b.ProductDescEN) })
+	return truncate(products, limit), nil
+}
+
+func (m *Memory) Countries(ctx context.Context, search string, limit int) ([]models.Country, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	countries := []models.Country{}
+	for _, c := range m.Fixtures.Countries {
+		if !m.deleted("dim_country", c.CountryID) && matches(search, c.CountryNameEN, c.CountryNameAR) {
+			countries = append(countries, c)
+		}
+	}
+	slices.SortStableFunc(countries, func(a, b models.Country) int { return cmp.Compare(a.CountryNameEN, b.CountryNameEN) })
+	return truncate(countries, limit), nil
+}
+
+func (m *Memory) Ports(ctx context.Context, search, portType string, limit int) ([]models.Port, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	ports := []models.Port{}
+	for _, p := range m.Fixtures.Ports {
+		if !m.deleted("dim_port", p.PortID) && matches(search, p.PortNameEN, p.PortNameAR) && (portType == "" || p.PortTypeEN == portType) {
+			ports = append(ports, p)
+		}
+	}
+	slices.SortStableFunc(ports, func(a, b models.Port) int { return cmp.Compare(a.PortNameEN, b.PortNameEN) })
+	return truncate(ports, limit), nil
+}
+
+func (m *Memory) CountriesByID(ctx context.Context, ids []int64) ([]models.Country, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	countries := []models.Country{}
+	for _, c := range m.Fixtures.Countries {
+		if slices.Contains(ids, c.CountryID) {
+			countries = append(countries, c)
+		}
+	}
+	return countries, nil
+}
+
+func (m *Memory) PortsByID(ctx context.Context, ids []int64) ([]models.Port, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	ports := []models.Port{}
+	for _, p := range m.Fixtures.Ports {
+		if slices.Contains(ids, p.PortID) {
+			ports = append(ports, p)
+		}
+	}
+	return ports, nil
+}
+
+func (m *Memory) PortHistory(ctx context.Context, id int64) ([]models.PortVersion, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	versions := []models.PortVersion{}
+	for _, v := range m.Fixtures.PortHistory {
+		if v.PortID == id {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		if p, ok := m.port(id, 0); ok {
+			versions = append(versions, models.PortVersion{Port: p})
+		}
+	}
+	// The first version has no start, which sorts as the zero time
+	slices.SortStableFunc(versions, func(a, b models.PortVersion) int {
+		return deref(a.ValidFrom).Compare(deref(b.ValidFrom))
+	})
+	return versions, nil
+}
+
+func (m *Memory) PortTypes(ctx context.Context) ([]models.PortType, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	portTypes := []models.PortType{}
+	for _, p := range m.Fixtures.Ports {
+		if m.deleted("dim_port", p.PortID) {
+			continue
+		}
+		pt := models.PortType{ModeID: p.ModeID, PortTypeEN: p.PortTypeEN, PortTypeAR: p.PortTypeAR}
+		if !slices.Contains(portTypes, pt) {
+			portTypes = append(portTypes, pt)
+		}
+	}
+	slices.SortFunc(portTypes, func(a, b models.PortType) int {
+		return cmp.Or(cmp.Compare(a.ModeID, b.ModeID), cmp.Compare(a.PortTypeEN, b.PortTypeEN))
+	})
+	return portTypes, nil
+}
+
+func (m *Memory) Counts(ctx context.Context) (models.DimensionCounts, error) {
+	if m.Err != nil {
+		return models.DimensionCounts{}, m.Err
+	}
+	var counts models.DimensionCounts
+	for _, p := range m.Fixtures.Products {
+		if !m.deleted("dim_product", p.ProductID) {
+			counts.Products++
+		}
+	}
+	for _, c := range m.Fixtures.Countries {
+		if !m.deleted("dim_country", c.CountryID) {
+			counts.Countries++
+		}
+	}
+	for _, p := range m.Fixtures.Ports {
+		if !m.deleted("dim_port", p.PortID) {
+			counts.Ports++
+		}
+	}
+	return counts, nil
+}
+
+func (m *Memory) YearlySummary(ctx context.Context, startYear, endYear, release int) ([]models.TradeSummary, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	summaries := []models.TradeSummary{}
+	for _, s := range m.summaryAt(release) {
+		if s.Year >= startYear && s.Year <= endYear {
+			s.TotalTradeValue = s.ImportValue + s.ExportValue + s.ReExportValue
+			summaries = append(summaries, s)
+		}
+	}
+	slices.SortFunc(summaries, func(a, b models.TradeSummary) int { return cmp.Compare(a.Year, b.Year) })
+	return summaries, nil
+}
+
+// summaryAt returns the yearly summary as it stood in release, or the current
+// one for release 0.
+func (m *Memory) summaryAt(release int) []models.TradeSummary {
+	if release > 0 {
+		for _, s := range m.Fixtures.SummaryHistory {
+			if s.SupersededBy > release {
+				return s.Summary
+			}
+		}
+	}
+	return m.Fixtures.YearlySummary
+}
+
+func (m *Memory) Balance(ctx context.Context, startYear, endYear, release int) (*models.TradeBalance, error) {
+	summaries, err := m.YearlySummary(ctx, startYear, endYear, release)
+	if err != nil {
+		return nil, err
+	}
+	balance := &models.TradeBalance{StartYear: startYear, EndYear: endYear}
+	for _, s := range summaries {
+		balance.TotalImport += s.ImportValue
+		balance.TotalExport += s.ExportValue
+		balance.TotalReExport += s.ReExportValue
+	}
+	balance.TradeBalance = balance.TotalExport + balance.TotalReExport - balance.TotalImport
+	return balance, nil
+}
+
+func (m *Memory) Aggregate(ctx context.Context, req *models.AggregateRequest) ([]models.AggregateResult, int64, error) {
+	if m.Err != nil {
+		return nil, 0, m.Err
+	}
+
+	facts := m.Fixtures.ProductFacts
+	if utils.FactTable(req) == utils.CountryFactTable {
+		facts = m.Fixtures.CountryFacts
+	}
+
+	groups := map[string]*models.AggregateResult{}
+	keys := []string{}
+	for _, f := range facts {
+		if !f.visible(req.AsOfRelease) || !m.selected(req, f) {
+			continue
+		}
+		key := m.groupKey(req.GroupBy, f)
+		group, ok := groups[key]
+		if !ok {
+			group = m.newGroup(req, f)
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		group.TotalValue += f.Value
+	}
+
+	slices.Sort(keys)
+	results := make([]models.AggregateResult, 0, len(keys))
+	for _, key := range keys {
+		results = append(results, *groups[key])
+	}
+	page, total := sortPage(req, results, func(r *models.AggregateResult) *models.AggregateResult { return r })
+	return page, total, nil
+}
+
+func (m *Memory) AggregateDiff(ctx context.Context, req *models.AggregateRequest, from, to int) ([]models.AggregateChange, int64, error) {
+	if m.Err != nil {
+		return nil, 0, m.Err
+	}
+
+	facts := m.Fixtures.ProductFacts
+	if utils.FactTable(req) == utils.CountryFactTable {
+		facts = m.Fixtures.CountryFacts
+	}
+
+	groups := map[string]*models.AggregateChange{}
+	keys := []string{}
+	for _, f := range facts {
+		inFrom, inTo := f.inRelease(from), f.inRelease(to)
+		if !(inFrom || inTo) || !m.selected(req, f) {
+			continue
+		}
+		key := m.groupKey(req.GroupBy, f)
+		group, ok := groups[key]
+		if !ok {
+			group = &models.AggregateChange{AggregateResult: *m.newGroup(req, f)}
+			groups[key] = group
+			keys = append(keys, key)
+		}
+		if inFrom {
+			group.PreviousValue += f.Value
+		}
+		if inTo {
+			group.TotalValue += f.Value
+		}
+	}
+
+	slices.Sort(keys)
+	changes := []models.AggregateChange{}
+	for _, key := range keys {
+		if c := *groups[key]; c.TotalValue != c.PreviousValue {
+			c.Change = c.TotalValue - c.PreviousValue
+			changes = append(changes, c)
+		}
+	}
+	page, total := sortPage(req, changes, func(c *models.AggregateChange) *models.AggregateResult { return &c.AggregateResult })
+	return page, total, nil
+}
+
+// sortPage sorts items by the requested field, keeping their order on ties,
+// and returns the requested page and the number of items.
+func sortPage[T any](req *models.AggregateRequest, items []T, result func(*T) *models.AggregateResult) ([]T, int64) {
+	slices.SortStableFunc(items, func(a, b T) int {
+		c := compareBy(req.Sorting.SortBy, *result(&a), *result(&b))
+		if req.Sorting.SortOrder == "desc" {
+			return -c
+		}
+		return c
+	})
+
+	start := min(req.Pagination.Offset(), len(items))
+	end := min(start+req.Pagination.Limit, len(items))
+	return items[start:end], int64(len(items))
+}
+
+func (m *Memory) ExplainAggregate(ctx context.Context, req *models.AggregateRequest) (json.RawMessage, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return nil, errors.New("storetest: EXPLAIN is not supported by the in-memory store")
+}
+
+func (m *Memory) YearRange(ctx context.Context) (int, int, error) {
+	years, err := m.SummaryYears(ctx)
+	if err != nil || len(years) == 0 {
+		return 0, 0, err
+	}
+	return years[0], years[len(years)-1], nil
+}
+
+func (m *Memory) FactYearRange(ctx context.Context, table string, release int) (int, int, error) {
+	if m.Err != nil {
+		return 0, 0, m.Err
+	}
+	facts := m.Fixtures.ProductFacts
+	if table == utils.CountryFactTable {
+		facts = m.Fixtures.CountryFacts
+	}
+	minYear, maxYear := 0, 0
+	for _, f := range facts {
+		if !f.visible(release) {
+			continue
+		}
+		if minYear == 0 || f.Year < minYear {
+			minYear = f.Year
+		}
+		maxYear = max(maxYear, f.Year)
+	}
+	return minYear, maxYear, nil
+}
+
+func (m *Memory) SummaryYears(ctx context.Context) ([]int, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	years := []int{}
+	for _, s := range m.Fixtures.YearlySummary {
+		years = append(years, s.Year)
+	}
+	slices.Sort(years)
+	return years, nil
+}
+
+func (m *Memory) FactTables(ctx context.Context) ([]models.FactTableMetadata, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	tables := []models.FactTableMetadata{}
+	for _, table := range []struct {
+		name  string
+		facts []Fact
+	}{
+		{utils.ProductFactTable, m.Fixtures.ProductFacts},
+		{utils.CountryFactTable, m.Fixtures.CountryFacts},
+	} {
+		fact := models.FactTableMetadata{
+			Name:       table.name,
+			Dimensions: utils.FactTableDimensions[table.name],
+			Years:      []int{},
+			TradeTypes: []string{},
+		}
+		for _, f := range table.facts {
+			if !f.current() {
+				continue
+			}
+			if !slices.Contains(fact.Years, f.Year) {
+				fact.Years = append(fact.Years, f.Year)
+			}
+			if !slices.Contains(fact.TradeTypes, f.TradeType) {
+				fact.TradeTypes = append(fact.TradeTypes, f.TradeType)
+			}
+		}
+		slices.Sort(fact.Years)
+		slices.Sort(fact.TradeTypes)
+		tables = append(tables, fact)
+	}
+	return tables, nil
+}
+
+func (m *Memory) LastDataLoad(ctx context.Context) (*time.Time, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	return m.Fixtures.LastDataLoad, nil
+}
+
+func (m *Memory) Releases(ctx context.Context) ([]models.Release, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	releases := slices.Clone(m.Fixtures.Releases)
+	slices.SortFunc(releases, func(a, b models.Release) int { return cmp.Compare(b.ReleaseID, a.ReleaseID) })
+	if releases == nil {
+		releases = []models.Release{}
+	}
+	return releases, nil
+}
+
+func (m *Memory) FactTotals(ctx context.Context) ([]models.FactTotal, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	totals := []models.FactTotal{}
+	for _, table := range []struct {
+		name  string
+		facts []Fact
+	}{
+		{utils.ProductFactTable, m.Fixtures.ProductFacts},
+		{utils.CountryFactTable, m.Fixtures.CountryFacts},
+	} {
+		byKey := map[string]*models.FactTotal{}
+		for _, f := range table.facts {
+			if !f.current() {
+				continue
+			}
+			key := fmt.Sprintf("%d|%s", f.Year, f.TradeType)
+			total, ok := byKey[key]
+			if !ok {
+				total = &models.FactTotal{Table: table.name, Year: f.Year, TradeType: f.TradeType}
+				byKey[key] = total
+			}
+			total.Value += f.Value
+		}
+		for _, total := range byKey {
+			totals = append(totals, *total)
+		}
+	}
+	slices.SortFunc(totals, func(a, b models.FactTotal) int {
+		return cmp.Or(cmp.Compare(a.Table, b.Table), cmp.Compare(a.Year, b.Year), cmp.Compare(a.TradeType, b.TradeType))
+	})
+	return totals, nil
+}
+
+// ReplaceYearlySummary keeps the summary it replaces in SummaryHistory.
+func (m *Memory) ReplaceYearlySummary(ctx context.Context, summaries []models.TradeSummary) (int, error) {
+	if m.Err != nil {
+		return 0, m.Err
+	}
+	release := 1
+	for _, r := range m.Fixtures.Releases {
+		release = max(release, r.ReleaseID+1)
+	}
+	m.Fixtures.Releases = append(m.Fixtures.Releases, models.Release{ReleaseID: release, Source: "rebuild-summary", CreatedAt: time.Now().UTC()})
+	m.Fixtures.SummaryHistory = append(m.Fixtures.SummaryHistory, SummarySnapshot{SupersededBy: release, Summary: m.Fixtures.YearlySummary})
+	m.Fixtures.YearlySummary = slices.Clone(summaries)
+	return release, nil
+}
+
+func (m *Memory) OrphanedIDs(ctx context.Context) ([]models.OrphanedID, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	products, countries, ports := map[int64]bool{}, map[int64]bool{}, map[int64]bool{}
+	for _, p := range m.Fixtures.Products {
+		products[p.ProductID] = true
+	}
+	for _, c := range m.Fixtures.Countries {
+		countries[c.CountryID] = true
+	}
+	for _, p := range m.Fixtures.Ports {
+		ports[p.PortID] = true
+	}
+
+	counts := map[models.OrphanedID]int64{}
+	count := func(table, column string, id int64, known map[int64]bool) {
+		if !known[id] {
+			counts[models.OrphanedID{Table: table, Column: column, ID: id}]++
+		}
+	}
+	for _, f := range m.Fixtures.ProductFacts {
+		count(utils.ProductFactTable, "product_id", f.ProductID, products)
+		count(utils.ProductFactTable, "port_id", f.PortID, ports)
+	}
+	for _, f := range m.Fixtures.CountryFacts {
+		count(utils.CountryFactTable, "country_id", f.CountryID, countries)
+		count(utils.CountryFactTable, "port_id", f.PortID, ports)
+	}
+
+	orphans := []models.OrphanedID{}
+	for o, rows := range counts {
+		o.Rows = rows
+		orphans = append(orphans, o)
+	}
+	slices.SortFunc(orphans, func(a, b models.OrphanedID) int {
+		return cmp.Or(cmp.Compare(a.Table, b.Table), cmp.Compare(a.Column, b.Column), cmp.Compare(a.ID, b.ID))
+	})
+	return orphans, nil
+}
+
+func (m *Memory) MissingTranslations(ctx context.Context) ([]models.MissingTranslation, error) {
+	if m.Err != nil {
+		return nil, m.Err
+	}
+	missing := []models.MissingTranslation{}
+	check := func(table string, id int64, nameEN, column, value string) {
+		if !m.deleted(table, id) && strings.TrimSpace(value) == "" {
+			missing = append(missing, models.MissingTranslation{Table: table, ID: id, Column: column, NameEN: nameEN})
+		}
+	}
+	for _, p := range m.Fixtures.Products {
+		check("dim_product", p.ProductID, p.ProductDescEN, "product_desc_ar", p.ProductDescAR)
+	}
+	for _, c := range m.Fixtures.Countries {
+		check("dim_country", c.CountryID, c.CountryNameEN, "country_name_ar", c.CountryNameAR)
+	}
+	for _, p := range m.Fixtures.Ports {
+		check("dim_port", p.PortID, p.PortNameEN, "port_name_ar", p.PortNameAR)
+		check("dim_port", p.PortID, p.PortNameEN, "port_type_ar", p.PortTypeAR)
+	}
+	slices.SortFunc(missing, func(a, b models.MissingTranslation) int {
+		return cmp.Or(cmp.Compare(a.Table, b.Table), cmp.Compare(a.Column, b.Column), cmp.Compare(a.ID, b.ID))
+	})
+	return missing, nil
+}
+
+// selected reports whether f passes the request's year, trade type and
+// filter conditions.
+func (m *Memory) selected(req *models.AggregateRequest, f Fact) bool {
+	if f.Year < req.DateRange.StartYear || f.Year > req.DateRange.EndYear {
+		return false
+	}
+	if len(req.TradeTypes) > 0 && !slices.Contains(req.TradeTypes, f.TradeType) {
+		return false
+	}
+	filters := req.Filters
+	if len(filters.ProductIDs) > 0 && !slices.Contains(filters.ProductIDs, f.ProductID) {
+		return false
+	}
+	if len(filters.CountryIDs) > 0 && !slices.Contains(filters.CountryIDs, f.CountryID) {
+		return false
+	}
+	if len(filters.PortIDs) > 0 && !slices.Contains(filters.PortIDs, f.PortID) {
+		return false
+	}
+	if len(filters.PortTypes) > 0 {
+		port, ok := m.port(f.PortID, 0)
+		if !ok || !slices.Contains(filters.PortTypes, port.PortTypeEN) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m *Memory) groupKey(groupBy []string, f Fact) string {
+	parts := []string{}
+	for _, field := range models.GroupByFields {
+		if !slices.Contains(groupBy, field) {
+			continue
+		}
+		switch field {
+		case "year":
+			parts = append(parts, fmt.Sprintf("%06d", f.Year))
+		case "product":
+			parts = append(parts, fmt.Sprintf("%020d", f.ProductID))
+		case "country":
+			parts = append(parts, fmt.Sprintf("%020d", f.CountryID))
+		case "port":
+			parts = append(parts, fmt.Sprintf("%020d", f.PortID))
+		case "trade_type":
+			parts = append(parts, f.TradeType)
+		}
+	}
+	return strings.Join(parts, "|")
+}
+
+func (m *Memory) newGroup(req *models.AggregateRequest, f Fact) *models.AggregateResult {
+	groupBy := req.GroupBy
+	result := &models.AggregateResult{}
+	if slices.Contains(groupBy, "year") {
+		year := f.Year
+		result.Year = &year
+	}
+	if slices.Contains(groupBy, "product") {
+		id := f.ProductID
+		result.ProductID = &id
+		for _, p := range m.Fixtures.Products {
+			if p.ProductID == id {
+				result.ProductDescEN, result.ProductDescAR = ptr(p.ProductDescEN), ptr(p.ProductDescAR)
+			}
+		}
+	}
+	if slices.Contains(groupBy, "country") {
+		id := f.CountryID
+		result.CountryID = &id
+		if c, ok := m.country(id, req.LabelAsOf); ok {
+			result.CountryNameEN, result.CountryNameAR = ptr(c.CountryNameEN), ptr(c.CountryNameAR)
+		}
+	}
+	if slices.Contains(groupBy, "port") {
+		id := f.PortID
+		result.PortID = &id
+		if p, ok := m.port(id, req.LabelAsOf); ok {
+			result.PortNameEN, result.PortNameAR = ptr(p.PortNameEN), ptr(p.PortNameAR)
+		}
+	}
+	if slices.Contains(groupBy, "trade_type") {
+		result.TradeType = ptr(f.TradeType)
+	}
+	return result
+}
+
+// country returns a country as it was at the end of year, or as it is now
+// for year 0.
+func (m *Memory) country(id int64, year int) (models.Country, bool) {
+	if year > 0 {
+		for _, v := range m.Fixtures.CountryHistory {
+			if v.CountryID == id && effectiveAt(v.ValidFrom, v.ValidTo, year) {
+				return v.Country, true
+			}
+		}
+	}
+	for _, c := range m.Fixtures.Countries {
+		if c.CountryID == id {
+			return c, true
+		}
+	}
+	return models.Country{}, false
+}
+
+// port returns a port as it was at the end of year, or as it is now for
+// year 0.
+func (m *Memory) port(id int64, year int) (models.Port, bool) {
+	if year > 0 {
+		for _, v := range m.Fixtures.PortHistory {
+			if v.PortID == id && effectiveAt(v.ValidFrom, v.ValidTo, year) {
+				return v.Port, true
+			}
+		}
+	}
+	for _, p := range m.Fixtures.Ports {
+		if p.PortID == id {
+			return p, true
+		}
+	}
+	return models.Port{}, false
+}
+
+// effectiveAt reports whether a version from validFrom to validTo applies at
+// the end of year.
+func effectiveAt(validFrom, validTo *time.Time, year int) bool {
+	end := time.Date(year, 12, 31, 0, 0, 0, 0, time.UTC)
+	return (validFrom == nil || !validFrom.After(end)) && (validTo == nil || validTo.After(end))
+}
+
+func compareBy(field string, a, b models.AggregateResult) int {
+	switch field {
+	case "year":
+		return cmp.Compare(deref(a.Year), deref(b.Year))
+	case "product_desc_en":
+		return cmp.Compare(deref(a.ProductDescEN), deref(b.ProductDescEN))
+	case "country_name_en":
+		return cmp.Compare(deref(a.CountryNameEN), deref(b.CountryNameEN))
+	case "port_name_en":
+		return cmp.Compare(deref(a.PortNameEN), deref(b.PortNameEN))
+	case "trade_type":
+		return cmp.Compare(deref(a.TradeType), deref(b.TradeType))
+	}
+	return cmp.Compare(a.TotalValue, b.TotalValue)
+}
+
+// matches reports whether search is a case-insensitive substring of either
+// name, like ILIKE '%search%'.
+func matches(search string, names ...string) bool {
+	if search == "" {
+		return true
+	}
+	search = strings.ToLower(search)
+	for _, name := range names {
+		if strings.Contains(strings.ToLower(name), search) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncate[T any](items []T, limit int) []T {
+	if limit > 0 && len(items) > limit {
+		return items[:limit]
+	}
+	return items
+}
+
+func ptr[T any](v T) *T {
+	return &v
+}
+
+func deref[T any](p *T) T {
+	var zero T
+	if p == nil {
+		return zero
+	}
+	return *p
+}
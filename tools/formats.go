@@ -0,0 +1,76 @@
+package tools
+
+import "trade-api/openapi"
+
+var Formats = []string{"generic", "openai", "anthropic", "gemini"}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIFunction struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Parameters  *openapi.Schema `json:"parameters"`
+}
+
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	InputSchema *openapi.Schema `json:"input_schema"`
+}
+
+type geminiTools struct {
+	FunctionDeclarations []openAIFunction `json:"function_declarations"`
+}
+
+// Render converts tool definitions to the shape expected by a function-calling API.
+func Render(defs []Tool, format string) interface{} {
+	switch format {
+	case "openai":
+		out := []openAITool{}
+		for _, t := range defs {
+			out = append(out, openAITool{
+				Type:     "function",
+				Function: openAIFunction{Name: t.Name, Description: t.Description, Parameters: t.Parameters},
+			})
+		}
+		return out
+	case "anthropic":
+		out := []anthropicTool{}
+		for _, t := range defs {
+			out = append(out, anthropicTool{Name: t.Name, Description: t.Description, InputSchema: t.Parameters})
+		}
+		return out
+	case "gemini":
+		out := geminiTools{FunctionDeclarations: []openAIFunction{}}
+		for _, t := range defs {
+			out.FunctionDeclarations = append(out.FunctionDeclarations, openAIFunction{
+				Name:        t.Name,
+				Description: t.Description,
+				Parameters:  geminiSchema(t.Parameters),
+			})
+		}
+		return []geminiTools{out}
+	}
+	return defs
+}
+
+// geminiSchema strips keywords outside the OpenAPI subset Gemini accepts.
+func geminiSchema(s *openapi.Schema) *openapi.Schema {
+	if s == nil {
+		return nil
+	}
+	out := *s
+	out.Default = nil
+	out.AdditionalProperties = nil
+	out.Items = geminiSchema(s.Items)
+	if s.Properties != nil {
+		out.Properties = map[string]*openapi.Schema{}
+		for name, prop := range s.Properties {
+			out.Properties[name] = geminiSchema(prop)
+		}
+	}
+	return &out
+}
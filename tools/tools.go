@@ -0,0 +1,102 @@
+package tools
+
+import (
+	"trade-api/models"
+	"trade-api/openapi"
+)
+
+// Tool describes one API capability for LLM function calling. Method and Path
+// tell the agent which endpoint executes the call: GET tools send their
+// arguments as query parameters, POST tools as the JSON body.
+type Tool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Method      string          `json:"method"`
+	Path        string          `json:"path"`
+	Parameters  *openapi.Schema `json:"parameters"`
+}
+
+func Definitions() []Tool {
+	return []Tool{
+		{
+			Name:        "search_products",
+			Description: "Search products by English or Arabic description. Use the returned product_id values in aggregate_trade filters.",
+			Method:      "GET",
+			Path:        "/api/v1/dimensions/products",
+			Parameters:  searchParameters(nil),
+		},
+		{
+			Name:        "search_countries",
+			Description: "Search trading partner countries by English or Arabic name. Use the returned country_id values in aggregate_trade filters.",
+			Method:      "GET",
+			Path:        "/api/v1/dimensions/countries",
+			Parameters:  searchParameters(nil),
+		},
+		{
+			Name:        "search_ports",
+			Description: "Search ports of entry by English or Arabic name, optionally by port type (e.g. Sea, Air, Land). Use the returned port_id values in aggregate_trade filters.",
+			Method:      "GET",
+			Path:        "/api/v1/dimensions/ports",
+			Parameters: searchParameters(map[string]*openapi.Schema{
+				"port_type": {Type: "string", Description: "Exact English port type, e.g. Sea"},
+			}),
+		},
+		{
+			Name: "aggregate_trade",
+			Description: "Sum trade values over a range of years, grouped by any of: year, product, country, port, trade_type. " +
+				"Product and country data live in separate fact tables, so product and country cannot be grouped or filtered together. " +
+				"Results are paginated and sorted by total_value descending unless sorting is given.",
+			Method:     "POST",
+			Path:       "/api/v1/trade/aggregate",
+			Parameters: openapi.InlineSchema(models.AggregateRequest{}),
+		},
+		{
+			Name:        "get_trade_summary",
+			Description: "Yearly totals of imports, exports, re-exports, trade balance and total trade for a range of years.",
+			Method:      "GET",
+			Path:        "/api/v1/trade/summary",
+			Parameters:  yearRangeParameters(),
+		},
+		{
+			Name:        "get_trade_balance",
+			Description: "Total imports, exports, re-exports and trade balance (exports + re-exports - imports) over a range of years.",
+			Method:      "GET",
+			Path:        "/api/v1/trade/balance",
+			Parameters:  yearRangeParameters(),
+		},
+	}
+}
+
+func searchParameters(extra map[string]*openapi.Schema) *openapi.Schema {
+	minLimit, maxLimit := 1, models.MaxSearchLimit
+	properties := map[string]*openapi.Schema{
+		"search": {Type: "string", Description: "Case-insensitive substring of the English or Arabic name"},
+		"limit": {
+			Type:    "integer",
+			Minimum: &minLimit,
+			Maximum: &maxLimit,
+			Default: models.DefaultSearchLimit,
+		},
+	}
+	for name, schema := range extra {
+		properties[name] = schema
+	}
+	return &openapi.Schema{Type: "object", Properties: properties}
+}
+
+func yearRangeParameters() *openapi.Schema {
+	minRelease := 1
+	return &openapi.Schema{
+		Type: "object",
+		Properties: map[string]*openapi.Schema{
+			"start_year": {Type: "integer", Description: "First year, inclusive"},
+			"end_year":   {Type: "integer", Description: "Last year, inclusive; must be >= start_year"},
+			"as_of_release": {
+				Type:        "integer",
+				Minimum:     &minRelease,
+				Description: "Release to read the figures as published in; the latest when omitted",
+			},
+		},
+		Required: []string{"start_year", "end_year"},
+	}
+}
@@ -0,0 +1,156 @@
+package utils
+
+import (
+	"fmt"
+	"strings"
+
+	"trade-api/models"
+)
+
+var tradeTypeLabels = map[string]map[string]string{
+	"en": {"Import": "Imports", "Export": "Exports", "Re-Export": "Re-exports"},
+	"ar": {"Import": "الواردات", "Export": "الصادرات", "Re-Export": "إعادة التصدير"},
+}
+
+var groupByLabels = map[string]map[string]string{
+	"en": {"year": "year", "product": "product", "country": "country", "port": "port", "trade_type": "trade type"},
+	"ar": {"year": "السنة", "product": "المنتج", "country": "الدولة", "port": "المنفذ", "trade_type": "نوع التجارة"},
+}
+
+var portTypeLabels = map[string]string{"Sea": "البحرية", "Air": "الجوية", "Land": "البرية"}
+
+// DescribeAggregate summarises the filters and grouping of an aggregate
+// request in one sentence, e.g. "Imports from 2020–2023 via Sea ports,
+// grouped by country and year."
+func DescribeAggregate(req *models.AggregateRequest, lang string) string {
+	if lang == "ar" {
+		return describeAggregateAR(req)
+	}
+
+	subject := "Trade"
+	if len(req.TradeTypes) > 0 {
+		labels := []string{}
+		for _, tt := range req.TradeTypes {
+			labels = append(labels, tradeTypeLabels["en"][tt])
+		}
+		subject = joinList(labels, "and")
+		subject = strings.ToUpper(subject[:1]) + strings.ToLower(subject[1:])
+	}
+
+	parts := []string{subject + " " + describeYearsEN(req.DateRange)}
+	if len(req.Filters.PortTypes) > 0 {
+		parts[0] += " via " + joinList(req.Filters.PortTypes, "and") + " ports"
+	}
+	if n := len(req.Filters.ProductIDs); n > 0 {
+		parts = append(parts, fmt.Sprintf("for %s", plural(n, "selected product", "selected products")))
+	}
+	if n := len(req.Filters.CountryIDs); n > 0 {
+		parts = append(parts, fmt.Sprintf("with %s", plural(n, "selected country", "selected countries")))
+	}
+	if n := len(req.Filters.PortIDs); n > 0 {
+		parts = append(parts, fmt.Sprintf("through %s", plural(n, "selected port", "selected ports")))
+	}
+
+	if req.AsOfRelease > 0 {
+		parts = append(parts, fmt.Sprintf("as of release %d", req.AsOfRelease))
+	}
+	if req.LabelAsOf > 0 {
+		parts = append(parts, fmt.Sprintf("with names as of %d", req.LabelAsOf))
+	}
+
+	groups := []string{}
+	for _, g := range req.GroupBy {
+		groups = append(groups, groupByLabels["en"][g])
+	}
+	parts = append(parts, "grouped by "+joinList(groups, "and"))
+
+	return strings.Join(parts, ", ") + "."
+}
+
+func describeAggregateAR(req *models.AggregateRequest) string {
+	subject := "التجارة"
+	if len(req.TradeTypes) > 0 {
+		labels := []string{}
+		for _, tt := range req.TradeTypes {
+			labels = append(labels, tradeTypeLabels["ar"][tt])
+		}
+		subject = strings.Join(labels, " و")
+	}
+
+	years := fmt.Sprintf("من %d إلى %d", req.DateRange.StartYear, req.DateRange.EndYear)
+	if req.DateRange.StartYear == req.DateRange.EndYear {
+		years = fmt.Sprintf("في عام %d", req.DateRange.StartYear)
+	}
+
+	parts := []string{subject + " " + years}
+	if len(req.Filters.PortTypes) > 0 {
+		labels := []string{}
+		for _, pt := range req.Filters.PortTypes {
+			if label, ok := portTypeLabels[pt]; ok {
+				labels = append(labels, label)
+			} else {
+				labels = append(labels, pt)
+			}
+		}
+		parts[0] += " عبر المنافذ " + strings.Join(labels, " و")
+	}
+	if n := len(req.Filters.ProductIDs); n > 0 {
+		parts = append(parts, fmt.Sprintf("لعدد %d من المنتجات المحددة", n))
+	}
+	if n := len(req.Filters.CountryIDs); n > 0 {
+		parts = append(parts, fmt.Sprintf("مع %d من الدول المحددة", n))
+	}
+	if n := len(req.Filters.PortIDs); n > 0 {
+		parts = append(parts, fmt.Sprintf("عبر %d من المنافذ المحددة", n))
+	}
+
+	if req.AsOfRelease > 0 {
+		parts = append(parts, fmt.Sprintf("كما في الإصدار %d", req.AsOfRelease))
+	}
+	if req.LabelAsOf > 0 {
+		parts = append(parts, fmt.Sprintf("بالأسماء كما كانت في %d", req.LabelAsOf))
+	}
+
+	groups := []string{}
+	for _, g := range req.GroupBy {
+		groups = append(groups, groupByLabels["ar"][g])
+	}
+	parts = append(parts, "مجمعة حسب "+strings.Join(groups, " و"))
+
+	return strings.Join(parts, "، ") + "."
+}
+
+// DescribeYearRange describes a summary or balance period.
+func DescribeYearRange(title map[string]string, startYear, endYear int, lang string) string {
+	if lang == "ar" {
+		if startYear == endYear {
+			return fmt.Sprintf("%s في عام %d.", title["ar"], startYear)
+		}
+		return fmt.Sprintf("%s من %d إلى %d.", title["ar"], startYear, endYear)
+	}
+	return fmt.Sprintf("%s %s.", title["en"], describeYearsEN(models.DateRange{StartYear: startYear, EndYear: endYear}))
+}
+
+func describeYearsEN(dr models.DateRange) string {
+	if dr.StartYear == dr.EndYear {
+		return fmt.Sprintf("in %d", dr.StartYear)
+	}
+	return fmt.Sprintf("from %d–%d", dr.StartYear, dr.EndYear)
+}
+
+func joinList(items []string, conjunction string) string {
+	switch len(items) {
+	case 0:
+		return ""
+	case 1:
+		return items[0]
+	}
+	return strings.Join(items[:len(items)-1], ", ") + " " + conjunction + " " + items[len(items)-1]
+}
+
+func plural(n int, singular, pluralForm string) string {
+	if n == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %s", n, pluralForm)
+}
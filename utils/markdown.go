@@ -0,0 +1,208 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"trade-api/models"
+)
+
+var markdownHeaders = map[string]map[string]string{
+	"en": {
+		"product": "Product", "country": "Country", "port": "Port", "year": "Year", "trade_type": "Trade type",
+		"value": "Value", "total": "Total", "import": "Import", "export": "Export", "reexport": "Re-export",
+		"balance": "Trade balance", "total_trade": "Total trade", "period": "Period", "page_total": "Page total",
+	},
+	"ar": {
+		"product": "المنتج", "country": "الدولة", "port": "المنفذ", "year": "السنة", "trade_type": "نوع التجارة",
+		"value": "القيمة", "total": "الإجمالي", "import": "الواردات", "export": "الصادرات", "reexport": "إعادة التصدير",
+		"balance": "الميزان التجاري", "total_trade": "إجمالي التجارة", "period": "الفترة", "page_total": "إجمالي الصفحة",
+	},
+}
+
+var tradeTypeNamesAR = map[string]string{"Import": "واردات", "Export": "صادرات", "Re-Export": "إعادة تصدير"}
+
+// FormatNumber renders an integer with thousands separators.
+func FormatNumber(n int64) string {
+	digits := strconv.FormatInt(n, 10)
+	sign := ""
+	if n < 0 {
+		sign, digits = "-", digits[1:]
+	}
+
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return sign + b.String()
+}
+
+// AggregateMarkdown renders an aggregate page as a compact markdown table in a
+// single language, with a totals row and a description of the filters.
+func AggregateMarkdown(req *models.AggregateRequest, results []models.AggregateResult, meta models.PaginationMeta, lang string) string {
+	labels := markdownHeaders[lang]
+
+	header := []string{}
+	for _, g := range req.GroupBy {
+		header = append(header, labels[g])
+	}
+	header = append(header, labels["value"])
+
+	rows := [][]string{}
+	var total int64
+	for _, r := range results {
+		row := []string{}
+		for _, g := range req.GroupBy {
+			row = append(row, aggregateCell(r, g, lang))
+		}
+		row = append(row, FormatNumber(r.TotalValue))
+		rows = append(rows, row)
+		total += r.TotalValue
+	}
+
+	totalLabel := labels["total"]
+	if meta.TotalPages > 1 {
+		totalLabel = labels["page_total"]
+	}
+	totalRow := make([]string, len(header))
+	totalRow[0] = "**" + totalLabel + "**"
+	totalRow[len(totalRow)-1] = "**" + FormatNumber(total) + "**"
+	rows = append(rows, totalRow)
+
+	footer := fmt.Sprintf("Page %d of %d (%s rows).", meta.CurrentPage, meta.TotalPages, FormatNumber(meta.TotalCount))
+	if lang == "ar" {
+		footer = fmt.Sprintf("الصفحة %d من %d (%s صف).", meta.CurrentPage, meta.TotalPages, FormatNumber(meta.TotalCount))
+	}
+
+	return DescribeAggregate(req, lang) + "\n\n" + markdownTable(header, rows, len(header)-1) + "\n" + footer + "\n"
+}
+
+func SummaryMarkdown(summaries []models.TradeSummary, startYear, endYear int, lang string) string {
+	labels := markdownHeaders[lang]
+	header := []string{labels["year"], labels["import"], labels["export"], labels["reexport"], labels["balance"], labels["total_trade"]}
+
+	rows := [][]string{}
+	var totals models.TradeSummary
+	for _, s := range summaries {
+		rows = append(rows, []string{
+			strconv.Itoa(s.Year),
+			FormatNumber(s.ImportValue),
+			FormatNumber(s.ExportValue),
+			FormatNumber(s.ReExportValue),
+			FormatNumber(s.TradeBalanceValue),
+			FormatNumber(s.TotalTradeValue),
+		})
+		totals.ImportValue += s.ImportValue
+		totals.ExportValue += s.ExportValue
+		totals.ReExportValue += s.ReExportValue
+		totals.TradeBalanceValue += s.TradeBalanceValue
+		totals.TotalTradeValue += s.TotalTradeValue
+	}
+	rows = append(rows, []string{
+		"**" + labels["total"] + "**",
+		"**" + FormatNumber(totals.ImportValue) + "**",
+		"**" + FormatNumber(totals.ExportValue) + "**",
+		"**" + FormatNumber(totals.ReExportValue) + "**",
+		"**" + FormatNumber(totals.TradeBalanceValue) + "**",
+		"**" + FormatNumber(totals.TotalTradeValue) + "**",
+	})
+
+	title := map[string]string{"en": "Yearly trade summary", "ar": "الملخص السنوي للتجارة"}
+	return DescribeYearRange(title, startYear, endYear, lang) + "\n\n" + markdownTable(header, rows, 1)
+}
+
+func BalanceMarkdown(balance *models.TradeBalance, lang string) string {
+	labels := markdownHeaders[lang]
+	header := []string{labels["period"], labels["import"], labels["export"], labels["reexport"], labels["balance"]}
+
+	period := strconv.Itoa(balance.StartYear)
+	if balance.EndYear != balance.StartYear {
+		period += "–" + strconv.Itoa(balance.EndYear)
+	}
+	rows := [][]string{{
+		period,
+		FormatNumber(balance.TotalImport),
+		FormatNumber(balance.TotalExport),
+		FormatNumber(balance.TotalReExport),
+		FormatNumber(balance.TradeBalance),
+	}}
+
+	title := map[string]string{"en": "Trade balance (exports + re-exports − imports)", "ar": "الميزان التجاري (الصادرات + إعادة التصدير − الواردات)"}
+	return DescribeYearRange(title, balance.StartYear, balance.EndYear, lang) + "\n\n" + markdownTable(header, rows, 1)
+}
+
+// ProjectAggregateLang drops the names in the other language so each row
+// carries a single label per dimension.
+func ProjectAggregateLang(results []models.AggregateResult, lang string) {
+	for i := range results {
+		r := &results[i]
+		if lang == "en" {
+			r.ProductDescAR, r.CountryNameAR, r.PortNameAR = nil, nil, nil
+		} else {
+			r.ProductDescEN, r.CountryNameEN, r.PortNameEN = nil, nil, nil
+		}
+	}
+}
+
+func aggregateCell(r models.AggregateResult, groupBy, lang string) string {
+	pick := func(en, ar *string) string {
+		if lang == "ar" && ar != nil && *ar != "" {
+			return *ar
+		}
+		if en != nil {
+			return *en
+		}
+		return ""
+	}
+
+	switch groupBy {
+	case "product":
+		return pick(r.ProductDescEN, r.ProductDescAR)
+	case "country":
+		return pick(r.CountryNameEN, r.CountryNameAR)
+	case "port":
+		return pick(r.PortNameEN, r.PortNameAR)
+	case "year":
+		if r.Year != nil {
+			return strconv.Itoa(*r.Year)
+		}
+	case "trade_type":
+		if r.TradeType != nil {
+			if lang == "ar" {
+				return tradeTypeNamesAR[*r.TradeType]
+			}
+			return *r.TradeType
+		}
+	}
+	return ""
+}
+
+// markdownTable right-aligns the columns from numericFrom onwards.
+func markdownTable(header []string, rows [][]string, numericFrom int) string {
+	var b strings.Builder
+	writeRow := func(cells []string) {
+		b.WriteString("|")
+		for _, cell := range cells {
+			b.WriteString(" " + strings.ReplaceAll(cell, "|", `\|`) + " |")
+		}
+		b.WriteString("\n")
+	}
+
+	writeRow(header)
+	separator := make([]string, len(header))
+	for i := range separator {
+		separator[i] = "---"
+		if i >= numericFrom {
+			separator[i] = "---:"
+		}
+	}
+	writeRow(separator)
+	for _, row := range rows {
+		writeRow(row)
+	}
+	return b.String()
+}
@@ -1,155 +1,365 @@
 package utils
 
 import (
+	"errors"
 	"fmt"
 	"strings"
 
 	"trade-api/models"
 )
 
-func BuildAggregateQuery(req *models.AggregateRequest) (string, string, []interface{}) {
-	args := []interface{}{}
-	argCount := 0
+// AggregateQuery is the SQL generated for an aggregate request. Query and
+// CountQuery share Args; use Paginated to add LIMIT and OFFSET.
+type AggregateQuery struct {
+	Query      string
+	CountQuery string
+	Args       []interface{}
+	FactTable  string
+	Joins      []string
+}
 
-	// Determine which fact table to use
-	needsProduct := contains(req.GroupBy, "product") || len(req.Filters.ProductIDs) > 0
-	needsCountry := contains(req.GroupBy, "country") || len(req.Filters.CountryIDs) > 0
+// Paginated returns the data query with LIMIT and OFFSET placeholders appended
+// and the matching arguments.
+func (q *AggregateQuery) Paginated(limit, offset int) (string, []interface{}) {
+	query := q.Query + fmt.Sprintf(" LIMIT $%d OFFSET $%d", len(q.Args)+1, len(q.Args)+2)
+	args := append(append([]interface{}{}, q.Args...), limit, offset)
+	return query, args
+}
+
+// Fact tables behind aggregate queries. Products and countries are recorded in
+// separate tables, so no query can group or filter by both.
+const (
+	ProductFactTable = "fact_trade_by_product_port"
+	CountryFactTable = "fact_trade_by_country_port"
+)
 
-	if needsProduct && needsCountry {
-		panic("Cannot query both products and countries in the same request due to data structure")
+// ErrIncompatibleDimensions is returned for requests that need both fact tables.
+var ErrIncompatibleDimensions = errors.New("products and countries cannot be queried together")
+
+// FactTableDimensions lists the dimensions each fact table can answer.
+var FactTableDimensions = map[string][]string{
+	ProductFactTable: {"year", "product", "port", "trade_type"},
+	CountryFactTable: {"year", "country", "port", "trade_type"},
+}
+
+// FactTable returns the fact table that answers req: the country table when
+// it groups or filters by country, otherwise the product table.
+func FactTable(req *models.AggregateRequest) string {
+	if contains(req.GroupBy, "country") || len(req.Filters.CountryIDs) > 0 {
+		return CountryFactTable
 	}
+	return ProductFactTable
+}
 
-	var factTable string
-	var dimensionJoins []string
-	var selectFields []string
-	var groupByFields []string
+// ReleaseCondition returns the condition selecting the rows of the table
+// aliased alias as they stood in release, with its placeholder numbered n,
+// and the argument it takes. Release 0 selects the current rows and takes no
+// argument.
+func ReleaseCondition(alias string, release, n int) (string, []interface{}) {
+	if release == 0 {
+		return alias + ".valid_to_release IS NULL", nil
+	}
+	return inRelease(alias, n), []interface{}{release}
+}
 
-	// Build based on fact table
-	if needsProduct {
-		factTable = "fact_trade_by_product_port"
+// inRelease is the condition for rows that are part of the release in
+// placeholder n. A row belongs to the releases from valid_from_release up
+// to, but not including, valid_to_release.
+func inRelease(alias string, n int) string {
+	return fmt.Sprintf("%[1]s.valid_from_release <= $%[2]d AND (%[1]s.valid_to_release IS NULL OR %[1]s.valid_to_release > $%[2]d)", alias, n)
+}
 
-		if contains(req.GroupBy, "product") {
-			dimensionJoins = append(dimensionJoins, "JOIN dim_product p ON f.product_id = p.product_id")
-			selectFields = append(selectFields, "p.product_id", "p.product_desc_en", "p.product_desc_ar")
-			groupByFields = append(groupByFields, "p.product_id", "p.product_desc_en", "p.product_desc_ar")
-		}
-	} else if needsCountry {
-		factTable = "fact_trade_by_country_port"
+// effectiveAt is the condition for the dimension history rows, aliased
+// alias, in effect at the end of the year in placeholder n.
+func effectiveAt(alias string, n int) string {
+	return fmt.Sprintf("(%[1]s.valid_from IS NULL OR %[1]s.valid_from <= make_date($%[2]d, 12, 31)) AND "+
+		"(%[1]s.valid_to IS NULL OR %[1]s.valid_to > make_date($%[2]d, 12, 31))", alias, n)
+}
+
+// aggregateParts is the SQL an aggregate request and a diff of it share.
+// columns are selected and groupFields grouped by, in the same order.
+type aggregateParts struct {
+	factTable   string
+	joins       []string
+	columns     []string
+	groupFields []string
+	where       []string
+	args        []interface{}
+}
+
+// group selects and groups by expr, named name when it is not a plain
+// column of that name.
+func (p *aggregateParts) group(expr, name string) {
+	p.groupFields = append(p.groupFields, expr)
+	if !strings.HasSuffix(expr, "."+name) {
+		expr += " AS " + name
+	}
+	p.columns = append(p.columns, expr)
+}
+
+// BuildAggregateQuery generates the SQL for req. Requests are validated before
+// they get here, but the builder rejects anything it cannot turn into valid
+// SQL rather than trusting that, since sort fields are spliced into the query.
+func BuildAggregateQuery(req *models.AggregateRequest) (*AggregateQuery, error) {
+	if err := checkAggregateRequest(req); err != nil {
+		return nil, err
+	}
+	p := buildAggregateParts(req)
+
+	// Facts as of the requested release
+	release, args := ReleaseCondition("f", req.AsOfRelease, len(p.args)+1)
+	p.where = append(p.where, release)
+	p.args = append(p.args, args...)
+
+	// Always add total_value
+	selectFields := append(append([]string{}, p.columns...), "SUM(f.value) as total_value")
+
+	// Build final query
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s f
+		%s
+		WHERE %s
+		GROUP BY %s
+		ORDER BY %s %s
+	`,
+		strings.Join(selectFields, ", "),
+		p.factTable,
+		strings.Join(p.joins, " "),
+		strings.Join(p.where, " AND "),
+		strings.Join(p.groupFields, ", "),
+		req.Sorting.SortBy,
+		strings.ToUpper(req.Sorting.SortOrder),
+	)
+
+	// Build count query
+	countQuery := fmt.Sprintf(`
+		SELECT COUNT(*) FROM (
+			SELECT %s
+			FROM %s f
+			%s
+			WHERE %s
+			GROUP BY %s
+		) as subquery
+	`,
+		strings.Join(p.groupFields, ", "),
+		p.factTable,
+		strings.Join(p.joins, " "),
+		strings.Join(p.where, " AND "),
+		strings.Join(p.groupFields, ", "),
+	)
+
+	return &AggregateQuery{
+		Query:      query,
+		CountQuery: countQuery,
+		Args:       p.args,
+		FactTable:  p.factTable,
+		Joins:      p.joins,
+	}, nil
+}
+
+// BuildAggregateDiffQuery generates the SQL comparing the groups of req
+// between releases from and to, ignoring req.AsOfRelease. It selects the
+// group columns, the total in to as total_value and the total in from as
+// previous_value, for the groups whose totals differ. Release 0 is before
+// the first release, when there was no data.
+func BuildAggregateDiffQuery(req *models.AggregateRequest, from, to int) (*AggregateQuery, error) {
+	if err := checkAggregateRequest(req); err != nil {
+		return nil, err
+	}
+	p := buildAggregateParts(req)
+
+	n := len(p.args)
+	p.args = append(p.args, from, to)
+	inFrom, inTo := inRelease("f", n+1), inRelease("f", n+2)
+	p.where = append(p.where, fmt.Sprintf("((%s) OR (%s))", inFrom, inTo))
+
+	previous := fmt.Sprintf("COALESCE(SUM(f.value) FILTER (WHERE %s), 0)", inFrom)
+	total := fmt.Sprintf("COALESCE(SUM(f.value) FILTER (WHERE %s), 0)", inTo)
+	selectFields := append(append([]string{}, p.columns...), total+" as total_value", previous+" as previous_value")
+
+	query := fmt.Sprintf(`
+		SELECT %s
+		FROM %s f
+		%s
+		WHERE %s
+		GROUP BY %s
+		HAVING %s <> %s
+		ORDER BY %s %s
+	`,
+		strings.Join(selectFields, ", "),
+		p.factTable,
+		strings.Join(p.joins, " "),
+		strings.Join(p.where, " AND "),
+		strings.Join(p.groupFields, ", "),
+		total, previous,
+		req.Sorting.SortBy,
+		strings.ToUpper(req.Sorting.SortOrder),
+	)
 
-		if contains(req.GroupBy, "country") {
-			dimensionJoins = append(dimensionJoins, "JOIN dim_country c ON f.country_id = c.country_id")
-			selectFields = append(selectFields, "c.country_id", "c.country_name_en", "c.country_name_ar")
-			groupByFields = append(groupByFields, "c.country_id", "c.country_name_en", "c.country_name_ar")
+	countQuery := fmt.Sprintf(`
+		SELECT COUNT(*) FROM (
+			SELECT %s
+			FROM %s f
+			%s
+			WHERE %s
+			GROUP BY %s
+			HAVING %s <> %s
+		) as subquery
+	`,
+		strings.Join(p.groupFields, ", "),
+		p.factTable,
+		strings.Join(p.joins, " "),
+		strings.Join(p.where, " AND "),
+		strings.Join(p.groupFields, ", "),
+		total, previous,
+	)
+
+	return &AggregateQuery{
+		Query:      query,
+		CountQuery: countQuery,
+		Args:       p.args,
+		FactTable:  p.factTable,
+		Joins:      p.joins,
+	}, nil
+}
+
+// buildAggregateParts generates the joins, grouping and filters of a checked
+// request.
+func buildAggregateParts(req *models.AggregateRequest) *aggregateParts {
+	p := &aggregateParts{factTable: FactTable(req)}
+	argCount := 0
+
+	// Date range
+	p.where = append(p.where, fmt.Sprintf("f.year BETWEEN $%d AND $%d", argCount+1, argCount+2))
+	p.args = append(p.args, req.DateRange.StartYear, req.DateRange.EndYear)
+	argCount += 2
+
+	// Countries and ports are labelled from their history when asked for
+	// another year's names. Members without a version then, such as those
+	// added since, keep their current names, and filters always match the
+	// current members, so the labels never change the totals.
+	join := func(table, alias, key string) string {
+		return fmt.Sprintf("JOIN %[1]s %[2]s ON f.%[3]s = %[2]s.%[3]s", table, alias, key)
+	}
+	label := func(alias, column string) string {
+		return alias + "." + column
+	}
+	if req.LabelAsOf > 0 {
+		// The year is only bound once a history table is joined
+		n := 0
+		current := join
+		join = func(table, alias, key string) string {
+			if n == 0 {
+				argCount++
+				p.args = append(p.args, req.LabelAsOf)
+				n = argCount
+			}
+			return current(table, alias, key) + fmt.Sprintf(" LEFT JOIN %[1]s_history %[2]sh ON f.%[3]s = %[2]sh.%[3]s AND %[4]s",
+				table, alias, key, effectiveAt(alias+"h", n))
 		}
-	} else {
-		// Default to product table if no specific dimension requested
-		factTable = "fact_trade_by_product_port"
+		label = func(alias, column string) string {
+			return fmt.Sprintf("COALESCE(%[1]sh.%[2]s, %[1]s.%[2]s)", alias, column)
+		}
+	}
+
+	// Products and countries are never both grouped; see checkAggregateRequest
+	if contains(req.GroupBy, "product") {
+		p.joins = append(p.joins, "JOIN dim_product p ON f.product_id = p.product_id")
+		p.group("p.product_id", "product_id")
+		p.group("p.product_desc_en", "product_desc_en")
+		p.group("p.product_desc_ar", "product_desc_ar")
+	}
+	if contains(req.GroupBy, "country") {
+		p.joins = append(p.joins, join("dim_country", "c", "country_id"))
+		p.group("c.country_id", "country_id")
+		p.group(label("c", "country_name_en"), "country_name_en")
+		p.group(label("c", "country_name_ar"), "country_name_ar")
 	}
 
 	// Add port joins if needed
 	if contains(req.GroupBy, "port") || len(req.Filters.PortTypes) > 0 || len(req.Filters.PortIDs) > 0 {
-		dimensionJoins = append(dimensionJoins, "JOIN dim_port dp ON f.port_id = dp.port_id")
 		if contains(req.GroupBy, "port") {
-			selectFields = append(selectFields, "dp.port_id", "dp.port_name_en", "dp.port_name_ar")
-			groupByFields = append(groupByFields, "dp.port_id", "dp.port_name_en", "dp.port_name_ar")
+			p.joins = append(p.joins, join("dim_port", "dp", "port_id"))
+			p.group("dp.port_id", "port_id")
+			p.group(label("dp", "port_name_en"), "port_name_en")
+			p.group(label("dp", "port_name_ar"), "port_name_ar")
+		} else {
+			p.joins = append(p.joins, "JOIN dim_port dp ON f.port_id = dp.port_id")
 		}
 	}
 
 	// Add year grouping
 	if contains(req.GroupBy, "year") {
-		selectFields = append(selectFields, "f.year")
-		groupByFields = append(groupByFields, "f.year")
+		p.group("f.year", "year")
 	}
 
 	// Add trade_type grouping
 	if contains(req.GroupBy, "trade_type") {
-		selectFields = append(selectFields, "f.trade_type")
-		groupByFields = append(groupByFields, "f.trade_type")
+		p.group("f.trade_type", "trade_type")
 	}
 
-	// Always add total_value
-	selectFields = append(selectFields, "SUM(f.value) as total_value")
-
-	// Build WHERE clause
-	whereClauses := []string{}
-
-	// Date range (requires 2 parameters)
-	argCount++
-	whereClauses = append(whereClauses, fmt.Sprintf("f.year BETWEEN $%d AND $%d", argCount, argCount+1))
-	args = append(args, req.DateRange.StartYear, req.DateRange.EndYear)
-	argCount++ // Increment for the second parameter
-
 	// Trade types
 	if len(req.TradeTypes) > 0 {
 		argCount++
-		whereClauses = append(whereClauses, fmt.Sprintf("f.trade_type = ANY($%d)", argCount))
-		args = append(args, req.TradeTypes)
+		p.where = append(p.where, fmt.Sprintf("f.trade_type = ANY($%d)", argCount))
+		p.args = append(p.args, req.TradeTypes)
 	}
 
 	// Product filter
 	if len(req.Filters.ProductIDs) > 0 {
 		argCount++
-		whereClauses = append(whereClauses, fmt.Sprintf("f.product_id = ANY($%d)", argCount))
-		args = append(args, req.Filters.ProductIDs)
+		p.where = append(p.where, fmt.Sprintf("f.product_id = ANY($%d)", argCount))
+		p.args = append(p.args, req.Filters.ProductIDs)
 	}
 
 	// Country filter
 	if len(req.Filters.CountryIDs) > 0 {
 		argCount++
-		whereClauses = append(whereClauses, fmt.Sprintf("f.country_id = ANY($%d)", argCount))
-		args = append(args, req.Filters.CountryIDs)
+		p.where = append(p.where, fmt.Sprintf("f.country_id = ANY($%d)", argCount))
+		p.args = append(p.args, req.Filters.CountryIDs)
 	}
 
 	// Port filter
 	if len(req.Filters.PortIDs) > 0 {
 		argCount++
-		whereClauses = append(whereClauses, fmt.Sprintf("f.port_id = ANY($%d)", argCount))
-		args = append(args, req.Filters.PortIDs)
+		p.where = append(p.where, fmt.Sprintf("f.port_id = ANY($%d)", argCount))
+		p.args = append(p.args, req.Filters.PortIDs)
 	}
 
 	// Port type filter
 	if len(req.Filters.PortTypes) > 0 {
 		argCount++
-		whereClauses = append(whereClauses, fmt.Sprintf("dp.port_type_en = ANY($%d)", argCount))
-		args = append(args, req.Filters.PortTypes)
+		p.where = append(p.where, fmt.Sprintf("dp.port_type_en = ANY($%d)", argCount))
+		p.args = append(p.args, req.Filters.PortTypes)
 	}
 
-	// Build final query
-	query := fmt.Sprintf(`
-		SELECT %s
-		FROM %s f
-		%s
-		WHERE %s
-		GROUP BY %s
-		ORDER BY %s %s
-	`,
-		strings.Join(selectFields, ", "),
-		factTable,
-		strings.Join(dimensionJoins, " "),
-		strings.Join(whereClauses, " AND "),
-		strings.Join(groupByFields, ", "),
-		req.Sorting.SortBy,
-		strings.ToUpper(req.Sorting.SortOrder),
-	)
-
-	// Build count query
-	countQuery := fmt.Sprintf(`
-		SELECT COUNT(*) FROM (
-			SELECT %s
-			FROM %s f
-			%s
-			WHERE %s
-			GROUP BY %s
-		) as subquery
-	`,
-		strings.Join(groupByFields, ", "),
-		factTable,
-		strings.Join(dimensionJoins, " "),
-		strings.Join(whereClauses, " AND "),
-		strings.Join(groupByFields, ", "),
-	)
+	return p
+}
 
-	return query, countQuery, args
+func checkAggregateRequest(req *models.AggregateRequest) error {
+	if len(req.GroupBy) == 0 {
+		return errors.New("group_by is empty")
+	}
+	for _, g := range req.GroupBy {
+		if !contains(models.GroupByFields, g) {
+			return fmt.Errorf("unknown group_by field %q", g)
+		}
+	}
+	if (contains(req.GroupBy, "product") || len(req.Filters.ProductIDs) > 0) &&
+		(contains(req.GroupBy, "country") || len(req.Filters.CountryIDs) > 0) {
+		return ErrIncompatibleDimensions
+	}
+	if !contains(models.SortByFields, req.Sorting.SortBy) {
+		return fmt.Errorf("unknown sort_by field %q", req.Sorting.SortBy)
+	}
+	if group, ok := models.SortByGroup[req.Sorting.SortBy]; ok && !contains(req.GroupBy, group) {
+		return fmt.Errorf("sort_by %s requires group_by %s", req.Sorting.SortBy, group)
+	}
+	if !contains(models.SortOrders, req.Sorting.SortOrder) {
+		return fmt.Errorf("unknown sort_order %q", req.Sorting.SortOrder)
+	}
+	return nil
 }
 
 func BuildScanTargets(req *models.AggregateRequest, result *models.AggregateResult) []interface{} {
@@ -175,6 +385,12 @@ func BuildScanTargets(req *models.AggregateRequest, result *models.AggregateResu
 	return targets
 }
 
+// BuildDiffScanTargets returns the scan targets of a row of
+// BuildAggregateDiffQuery.
+func BuildDiffScanTargets(req *models.AggregateRequest, change *models.AggregateChange) []interface{} {
+	return append(BuildScanTargets(req, &change.AggregateResult), &change.PreviousValue)
+}
+
 func contains(slice []string, item string) bool {
 	for _, s := range slice {
 		if s == item {
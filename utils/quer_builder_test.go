@@ -0,0 +1,316 @@
+package utils
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"trade-api/models"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files in testdata")
+
+var placeholder = regexp.MustCompile(`\$(\d+)`)
+
+var filterNames = []string{"trade_types", "product_ids", "country_ids", "port_ids", "port_types"}
+
+// newRequest builds a valid request grouped by groupBy with the named
+// filters set.
+func newRequest(groupBy []string, filters ...string) *models.AggregateRequest {
+	req := &models.AggregateRequest{
+		DateRange:  models.DateRange{StartYear: 2020, EndYear: 2023},
+		GroupBy:    groupBy,
+		Pagination: models.Pagination{Page: 3, Limit: 10},
+		Sorting:    models.Sorting{SortBy: "total_value", SortOrder: "desc"},
+	}
+	for _, name := range filters {
+		switch name {
+		case "trade_types":
+			req.TradeTypes = []string{"Import", "Export"}
+		case "product_ids":
+			req.Filters.ProductIDs = []int64{1, 2}
+		case "country_ids":
+			req.Filters.CountryIDs = []int64{10}
+		case "port_ids":
+			req.Filters.PortIDs = []int64{100, 200}
+		case "port_types":
+			req.Filters.PortTypes = []string{"Sea"}
+		}
+	}
+	return req
+}
+
+// subsets returns every non-empty subset of items, in a stable order, except
+// those containing both a and b.
+func subsets(items []string, a, b string) [][]string {
+	var result [][]string
+	for mask := 1; mask < 1<<len(items); mask++ {
+		var subset []string
+		for i, item := range items {
+			if mask&(1<<i) != 0 {
+				subset = append(subset, item)
+			}
+		}
+		if !(slices.Contains(subset, a) && slices.Contains(subset, b)) {
+			result = append(result, subset)
+		}
+	}
+	return result
+}
+
+// goldenCases covers every group_by combination without filters, every filter
+// combination grouped by year, and each sort field.
+func goldenCases() map[string]*models.AggregateRequest {
+	cases := map[string]*models.AggregateRequest{}
+	for _, groupBy := range subsets(models.GroupByFields, "product", "country") {
+		cases["group_by_"+strings.Join(groupBy, "-")] = newRequest(groupBy)
+	}
+	for _, filters := range subsets(filterNames, "product_ids", "country_ids") {
+		cases["filters_"+strings.Join(filters, "-")] = newRequest([]string{"year"}, filters...)
+	}
+	for sortBy, group := range models.SortByGroup {
+		req := newRequest([]string{group})
+		req.Sorting = models.Sorting{SortBy: sortBy, SortOrder: "asc"}
+		cases["sort_by_"+sortBy] = req
+	}
+	req := newRequest([]string{"year"}, "trade_types")
+	req.AsOfRelease = 4
+	cases["as_of_release"] = req
+	req = newRequest([]string{"country", "port"}, "port_types")
+	req.LabelAsOf = 2019
+	cases["label_as_of"] = req
+	// Filters match the current ports, so no history is joined
+	req = newRequest([]string{"year"}, "port_types")
+	req.LabelAsOf = 2019
+	cases["label_as_of_port_types"] = req
+	return cases
+}
+
+// formatQuery collapses whitespace and starts each clause on a new line.
+func formatQuery(query string) string {
+	query = strings.Join(strings.Fields(query), " ")
+	for _, clause := range []string{"FROM", "JOIN", "WHERE", "GROUP BY", "HAVING", "ORDER BY", "LIMIT"} {
+		query = strings.ReplaceAll(query, " "+clause+" ", "\n"+clause+" ")
+	}
+	return strings.ReplaceAll(query, " LEFT\nJOIN ", "\nLEFT JOIN ")
+}
+
+func TestBuildAggregateQueryGolden(t *testing.T) {
+	cases := goldenCases()
+	if want := 23 + 23 + len(models.SortByGroup) + 3; len(cases) != want {
+		t.Fatalf("got %d cases, want %d", len(cases), want)
+	}
+
+	for name, req := range cases {
+		t.Run(name, func(t *testing.T) {
+			q, err := BuildAggregateQuery(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, args := q.Paginated(req.Pagination.Limit, req.Pagination.Offset())
+			checkQuery(t, req, query, q.CountQuery, q.Args, args, len(BuildScanTargets(req, &models.AggregateResult{})))
+			checkGolden(t, filepath.Join("testdata", "aggregate", name+".sql"), q, query, args)
+		})
+	}
+}
+
+func TestBuildAggregateDiffQueryGolden(t *testing.T) {
+	labelled := newRequest([]string{"port"})
+	labelled.LabelAsOf = 2019
+	cases := map[string]*models.AggregateRequest{
+		"group_by_year":                  newRequest([]string{"year"}),
+		"group_by_port-year":             newRequest([]string{"port", "year"}, "trade_types"),
+		"filters_country_ids-port_types": newRequest([]string{"country"}, "country_ids", "port_types"),
+		"label_as_of":                    labelled,
+	}
+	for name, req := range cases {
+		t.Run(name, func(t *testing.T) {
+			q, err := BuildAggregateDiffQuery(req, 2, 5)
+			if err != nil {
+				t.Fatal(err)
+			}
+			query, args := q.Paginated(req.Pagination.Limit, req.Pagination.Offset())
+			checkQuery(t, req, query, q.CountQuery, q.Args, args, len(BuildDiffScanTargets(req, &models.AggregateChange{})))
+			checkGolden(t, filepath.Join("testdata", "aggregate_diff", name+".sql"), q, query, args)
+		})
+	}
+}
+
+// checkGolden compares the paginated query and q's count query with the
+// golden file at path, or rewrites it with -update.
+func checkGolden(t *testing.T, path string, q *AggregateQuery, query string, args []interface{}) {
+	t.Helper()
+
+	got := fmt.Sprintf("-- fact table: %s\n-- args: %v\n%s;\n\n-- count\n%s;\n",
+		q.FactTable, args, formatQuery(query), formatQuery(q.CountQuery))
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(got), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("%v (run go test ./utils -update to create it)", err)
+	}
+	if got != string(want) {
+		t.Errorf("SQL differs from %s (run go test ./utils -update if intended):\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+func TestBuildAggregateQueryRejectsInvalidRequests(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*models.AggregateRequest)
+	}{
+		{"no group_by", func(r *models.AggregateRequest) { r.GroupBy = nil }},
+		{"unknown group_by", func(r *models.AggregateRequest) { r.GroupBy = []string{"year", "region"} }},
+		{"product and country", func(r *models.AggregateRequest) { r.GroupBy = []string{"product", "country"} }},
+		{"product filter with country", func(r *models.AggregateRequest) {
+			r.GroupBy = []string{"country"}
+			r.Filters.ProductIDs = []int64{1}
+		}},
+		{"unknown sort_by", func(r *models.AggregateRequest) { r.Sorting.SortBy = "1; DROP TABLE dim_port" }},
+		{"sort_by not grouped", func(r *models.AggregateRequest) { r.Sorting.SortBy = "port_name_en" }},
+		{"unknown sort_order", func(r *models.AggregateRequest) { r.Sorting.SortOrder = "sideways" }},
+	}
+	for _, tt := range tests {
+		req := newRequest([]string{"year"})
+		tt.modify(req)
+		if q, err := BuildAggregateQuery(req); err == nil {
+			t.Errorf("%s: built %q, want error", tt.name, q.Query)
+		}
+	}
+
+	req := newRequest([]string{"product", "country"})
+	if _, err := BuildAggregateQuery(req); !errors.Is(err, ErrIncompatibleDimensions) {
+		t.Errorf("product and country: err = %v, want ErrIncompatibleDimensions", err)
+	}
+}
+
+func FuzzBuildAggregateQuery(f *testing.F) {
+	f.Add(uint8(0b00001), uint8(0), uint8(0), uint8(1), "", 2020, 2023, 10, 1)
+	f.Add(uint8(0b11101), uint8(0b11101), uint8(4), uint8(0), "", 2019, 2019, 1, 7)
+	f.Add(uint8(0b01010), uint8(0b01111), uint8(2), uint8(1), "", 2023, 2020, 1000, 1)
+	f.Add(uint8(0b100001), uint8(0), uint8(6), uint8(2), "year DESC; --", 0, 0, 0, 0)
+
+	f.Fuzz(func(t *testing.T, groupMask, filterMask, sortIdx, orderIdx uint8, extra string, start, end, limit, page int) {
+		// Bit 5 of groupMask, sort index 6 and order index 2 use extra in
+		// place of a known value
+		req := &models.AggregateRequest{
+			DateRange:  models.DateRange{StartYear: start, EndYear: end},
+			Pagination: models.Pagination{Page: page, Limit: limit},
+		}
+		for i, field := range models.GroupByFields {
+			if groupMask&(1<<i) != 0 {
+				req.GroupBy = append(req.GroupBy, field)
+			}
+		}
+		if groupMask&(1<<5) != 0 {
+			req.GroupBy = append(req.GroupBy, extra)
+		}
+		filters := newRequest(nil, selected(filterNames, filterMask)...)
+		req.TradeTypes, req.Filters = filters.TradeTypes, filters.Filters
+
+		req.Sorting.SortBy = pick(models.SortByFields, sortIdx, extra)
+		req.Sorting.SortOrder = pick(models.SortOrders, orderIdx, extra)
+
+		q, err := BuildAggregateQuery(req)
+
+		wellFormed := len(req.GroupBy) > 0 &&
+			!slices.ContainsFunc(req.GroupBy, func(g string) bool { return !slices.Contains(models.GroupByFields, g) }) &&
+			!(FactTable(req) == CountryFactTable && (slices.Contains(req.GroupBy, "product") || len(req.Filters.ProductIDs) > 0)) &&
+			slices.Contains(models.SortByFields, req.Sorting.SortBy) &&
+			slices.Contains(models.SortOrders, req.Sorting.SortOrder) &&
+			(models.SortByGroup[req.Sorting.SortBy] == "" || slices.Contains(req.GroupBy, models.SortByGroup[req.Sorting.SortBy]))
+		if wellFormed != (err == nil) {
+			t.Fatalf("well-formed = %v, err = %v for %+v", wellFormed, err, req)
+		}
+		if err != nil {
+			return
+		}
+
+		query, args := q.Paginated(limit, (page-1)*limit)
+		checkQuery(t, req, query, q.CountQuery, q.Args, args, len(BuildScanTargets(req, &models.AggregateResult{})))
+	})
+}
+
+// checkQuery asserts that the data and count queries number their
+// placeholders $1..$n with n equal to the number of arguments, parse as a
+// single SELECT, and select one column per scan target.
+func checkQuery(t *testing.T, req *models.AggregateRequest, query, countQuery string, countArgs, args []interface{}, targets int) {
+	t.Helper()
+
+	checkPlaceholders(t, "query", textPlaceholders(query), len(args))
+	checkPlaceholders(t, "count query", textPlaceholders(countQuery), len(countArgs))
+
+	if !canParseSQL {
+		return
+	}
+	columns, params, err := parseSQL(query)
+	if err != nil {
+		t.Fatalf("query does not parse: %v\n%s", err, query)
+	}
+	checkPlaceholders(t, "parsed query", params, len(args))
+	if columns != targets {
+		t.Errorf("query selects %d columns, want %d scan targets", columns, targets)
+	}
+
+	if _, params, err = parseSQL(countQuery); err != nil {
+		t.Fatalf("count query does not parse: %v\n%s", err, countQuery)
+	}
+	checkPlaceholders(t, "parsed count query", params, len(countArgs))
+}
+
+func checkPlaceholders(t *testing.T, what string, numbers []int, nargs int) {
+	t.Helper()
+
+	seen := map[int]bool{}
+	for _, n := range numbers {
+		if n < 1 || n > nargs {
+			t.Fatalf("%s uses $%d with %d args", what, n, nargs)
+		}
+		seen[n] = true
+	}
+	if len(seen) != nargs {
+		t.Fatalf("%s uses %d distinct placeholders, want %d", what, len(seen), nargs)
+	}
+}
+
+func textPlaceholders(query string) []int {
+	var numbers []int
+	for _, m := range placeholder.FindAllStringSubmatch(query, -1) {
+		n, _ := strconv.Atoi(m[1])
+		numbers = append(numbers, n)
+	}
+	return numbers
+}
+
+func selected(items []string, mask uint8) []string {
+	var result []string
+	for i, item := range items {
+		if mask&(1<<i) != 0 {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// pick returns options[i] or, for the index just past the options, other.
+func pick(options []string, i uint8, other string) string {
+	n := int(i) % (len(options) + 1)
+	if n == len(options) {
+		return other
+	}
+	return options[n]
+}
@@ -0,0 +1,41 @@
+//go:build cgo
+
+package utils
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	pg_query "github.com/pganalyze/pg_query_go/v6"
+)
+
+const canParseSQL = true
+
+var paramRef = regexp.MustCompile(`"ParamRef":\{"number":(\d+)`)
+
+// parseSQL runs query through the Postgres parser and returns the number of
+// output columns and the placeholder numbers it references.
+func parseSQL(query string) (columns int, params []int, err error) {
+	result, err := pg_query.Parse(query)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(result.Stmts) != 1 {
+		return 0, nil, fmt.Errorf("got %d statements, want 1", len(result.Stmts))
+	}
+	selectStmt := result.Stmts[0].Stmt.GetSelectStmt()
+	if selectStmt == nil {
+		return 0, nil, fmt.Errorf("not a SELECT statement")
+	}
+
+	tree, err := pg_query.ParseToJSON(query)
+	if err != nil {
+		return 0, nil, err
+	}
+	for _, m := range paramRef.FindAllStringSubmatch(tree, -1) {
+		n, _ := strconv.Atoi(m[1])
+		params = append(params, n)
+	}
+	return len(selectStmt.TargetList), params, nil
+}
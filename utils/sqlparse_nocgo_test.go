@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package utils
+
+// The Postgres parser needs cgo; without it only the text checks run.
+const canParseSQL = false
+
+func parseSQL(query string) (int, []int, error) {
+	return 0, nil, nil
+}
@@ -0,0 +1,15 @@
+-- fact table: fact_trade_by_product_port
+-- args: [2020 2023 [1 2] 10 20]
+SELECT f.year, SUM(f.value) as total_value
+FROM fact_trade_by_product_port f
+WHERE f.year BETWEEN $1 AND $2 AND f.product_id = ANY($3) AND f.valid_to_release IS NULL
+GROUP BY f.year
+ORDER BY total_value DESC
+LIMIT $4 OFFSET $5;
+
+-- count
+SELECT COUNT(*)
+FROM ( SELECT f.year
+FROM fact_trade_by_product_port f
+WHERE f.year BETWEEN $1 AND $2 AND f.product_id = ANY($3) AND f.valid_to_release IS NULL
+GROUP BY f.year ) as subquery;
@@ -0,0 +1,15 @@
+-- fact table: fact_trade_by_country_port
+-- args: [2020 2023 [Import Export] [10] 10 20]
+SELECT f.year, SUM(f.value) as total_value
+FROM fact_trade_by_country_port f
+WHERE f.year BETWEEN $1 AND $2 AND f.trade_type = ANY($3) AND f.country_id = ANY($4) AND f.valid_to_release IS NULL
+GROUP BY f.year
+ORDER BY total_value DESC
+LIMIT $5 OFFSET $6;
+
+-- count
+SELECT COUNT(*)
+FROM ( SELECT f.year
+FROM fact_trade_by_country_port f
+WHERE f.year BETWEEN $1 AND $2 AND f.trade_type = ANY($3) AND f.country_id = ANY($4) AND f.valid_to_release IS NULL
+GROUP BY f.year ) as subquery;
@@ -0,0 +1,17 @@
+-- fact table: fact_trade_by_product_port
+-- args: [2020 2023 10 20]
+SELECT p.product_id, p.product_desc_en, p.product_desc_ar, SUM(f.value) as total_value
+FROM fact_trade_by_product_port f
+JOIN dim_product p ON f.product_id = p.product_id
+WHERE f.year BETWEEN $1 AND $2 AND f.valid_to_release IS NULL
+GROUP BY p.product_id, p.product_desc_en, p.product_desc_ar
+ORDER BY total_value DESC
+LIMIT $3 OFFSET $4;
+
+-- count
+SELECT COUNT(*)
+FROM ( SELECT p.product_id, p.product_desc_en, p.product_desc_ar
+FROM fact_trade_by_product_port f
+JOIN dim_product p ON f.product_id = p.product_id
+WHERE f.year BETWEEN $1 AND $2 AND f.valid_to_release IS NULL
+GROUP BY p.product_id, p.product_desc_en, p.product_desc_ar ) as subquery;
@@ -0,0 +1,19 @@
+-- fact table: fact_trade_by_country_port
+-- args: [2020 2023 10 20]
+SELECT c.country_id, c.country_name_en, c.country_name_ar, dp.port_id, dp.port_name_en, dp.port_name_ar, f.year, SUM(f.value) as total_value
+FROM fact_trade_by_country_port f
+JOIN dim_country c ON f.country_id = c.country_id
+JOIN dim_port dp ON f.port_id = dp.port_id
+WHERE f.year BETWEEN $1 AND $2 AND f.valid_to_release IS NULL
+GROUP BY c.country_id, c.country_name_en, c.country_name_ar, dp.port_id, dp.port_name_en, dp.port_name_ar, f.year
+ORDER BY total_value DESC
+LIMIT $3 OFFSET $4;
+
+-- count
+SELECT COUNT(*)
+FROM ( SELECT c.country_id, c.country_name_en, c.country_name_ar, dp.port_id, dp.port_name_en, dp.port_name_ar, f.year
+FROM fact_trade_by_country_port f
+JOIN dim_country c ON f.country_id = c.country_id
+JOIN dim_port dp ON f.port_id = dp.port_id
+WHERE f.year BETWEEN $1 AND $2 AND f.valid_to_release IS NULL
+GROUP BY c.country_id, c.country_name_en, c.country_name_ar, dp.port_id, dp.port_name_en, dp.port_name_ar, f.year ) as subquery;
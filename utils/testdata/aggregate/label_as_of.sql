@@ -0,0 +1,23 @@
+-- fact table: fact_trade_by_country_port
+-- args: [2020 2023 2019 [Sea] 10 20]
+SELECT c.country_id, COALESCE(ch.country_name_en, c.country_name_en) AS country_name_en, COALESCE(ch.country_name_ar, c.country_name_ar) AS country_name_ar, dp.port_id, COALESCE(dph.port_name_en, dp.port_name_en) AS port_name_en, COALESCE(dph.port_name_ar, dp.port_name_ar) AS port_name_ar, SUM(f.value) as total_value
+FROM fact_trade_by_country_port f
+JOIN dim_country c ON f.country_id = c.country_id
+LEFT JOIN dim_country_history ch ON f.country_id = ch.country_id AND (ch.valid_from IS NULL OR ch.valid_from <= make_date($3, 12, 31)) AND (ch.valid_to IS NULL OR ch.valid_to > make_date($3, 12, 31))
+JOIN dim_port dp ON f.port_id = dp.port_id
+LEFT JOIN dim_port_history dph ON f.port_id = dph.port_id AND (dph.valid_from IS NULL OR dph.valid_from <= make_date($3, 12, 31)) AND (dph.valid_to IS NULL OR dph.valid_to > make_date($3, 12, 31))
+WHERE f.year BETWEEN $1 AND $2 AND dp.port_type_en = ANY($4) AND f.valid_to_release IS NULL
+GROUP BY c.country_id, COALESCE(ch.country_name_en, c.country_name_en), COALESCE(ch.country_name_ar, c.country_name_ar), dp.port_id, COALESCE(dph.port_name_en, dp.port_name_en), COALESCE(dph.port_name_ar, dp.port_name_ar)
+ORDER BY total_value DESC
+LIMIT $5 OFFSET $6;
+
+-- count
+SELECT COUNT(*)
+FROM ( SELECT c.country_id, COALESCE(ch.country_name_en, c.country_name_en), COALESCE(ch.country_name_ar, c.country_name_ar), dp.port_id, COALESCE(dph.port_name_en, dp.port_name_en), COALESCE(dph.port_name_ar, dp.port_name_ar)
+FROM fact_trade_by_country_port f
+JOIN dim_country c ON f.country_id = c.country_id
+LEFT JOIN dim_country_history ch ON f.country_id = ch.country_id AND (ch.valid_from IS NULL OR ch.valid_from <= make_date($3, 12, 31)) AND (ch.valid_to IS NULL OR ch.valid_to > make_date($3, 12, 31))
+JOIN dim_port dp ON f.port_id = dp.port_id
+LEFT JOIN dim_port_history dph ON f.port_id = dph.port_id AND (dph.valid_from IS NULL OR dph.valid_from <= make_date($3, 12, 31)) AND (dph.valid_to IS NULL OR dph.valid_to > make_date($3, 12, 31))
+WHERE f.year BETWEEN $1 AND $2 AND dp.port_type_en = ANY($4) AND f.valid_to_release IS NULL
+GROUP BY c.country_id, COALESCE(ch.country_name_en, c.country_name_en), COALESCE(ch.country_name_ar, c.country_name_ar), dp.port_id, COALESCE(dph.port_name_en, dp.port_name_en), COALESCE(dph.port_name_ar, dp.port_name_ar) ) as subquery;
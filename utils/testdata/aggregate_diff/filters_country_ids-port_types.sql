@@ -0,0 +1,21 @@
+-- fact table: fact_trade_by_country_port
+-- args: [2020 2023 [10] [Sea] 2 5 10 20]
+SELECT c.country_id, c.country_name_en, c.country_name_ar, COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $6 AND (f.valid_to_release IS NULL OR f.valid_to_release > $6)), 0) as total_value, COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)), 0) as previous_value
+FROM fact_trade_by_country_port f
+JOIN dim_country c ON f.country_id = c.country_id
+JOIN dim_port dp ON f.port_id = dp.port_id
+WHERE f.year BETWEEN $1 AND $2 AND f.country_id = ANY($3) AND dp.port_type_en = ANY($4) AND ((f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)) OR (f.valid_from_release <= $6 AND (f.valid_to_release IS NULL OR f.valid_to_release > $6)))
+GROUP BY c.country_id, c.country_name_en, c.country_name_ar
+HAVING COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $6 AND (f.valid_to_release IS NULL OR f.valid_to_release > $6)), 0) <> COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)), 0)
+ORDER BY total_value DESC
+LIMIT $7 OFFSET $8;
+
+-- count
+SELECT COUNT(*)
+FROM ( SELECT c.country_id, c.country_name_en, c.country_name_ar
+FROM fact_trade_by_country_port f
+JOIN dim_country c ON f.country_id = c.country_id
+JOIN dim_port dp ON f.port_id = dp.port_id
+WHERE f.year BETWEEN $1 AND $2 AND f.country_id = ANY($3) AND dp.port_type_en = ANY($4) AND ((f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)) OR (f.valid_from_release <= $6 AND (f.valid_to_release IS NULL OR f.valid_to_release > $6)))
+GROUP BY c.country_id, c.country_name_en, c.country_name_ar
+HAVING COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $6 AND (f.valid_to_release IS NULL OR f.valid_to_release > $6)), 0) <> COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)), 0) ) as subquery;
@@ -0,0 +1,17 @@
+-- fact table: fact_trade_by_product_port
+-- args: [2020 2023 2 5 10 20]
+SELECT f.year, COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)), 0) as total_value, COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $3 AND (f.valid_to_release IS NULL OR f.valid_to_release > $3)), 0) as previous_value
+FROM fact_trade_by_product_port f
+WHERE f.year BETWEEN $1 AND $2 AND ((f.valid_from_release <= $3 AND (f.valid_to_release IS NULL OR f.valid_to_release > $3)) OR (f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)))
+GROUP BY f.year
+HAVING COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)), 0) <> COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $3 AND (f.valid_to_release IS NULL OR f.valid_to_release > $3)), 0)
+ORDER BY total_value DESC
+LIMIT $5 OFFSET $6;
+
+-- count
+SELECT COUNT(*)
+FROM ( SELECT f.year
+FROM fact_trade_by_product_port f
+WHERE f.year BETWEEN $1 AND $2 AND ((f.valid_from_release <= $3 AND (f.valid_to_release IS NULL OR f.valid_to_release > $3)) OR (f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)))
+GROUP BY f.year
+HAVING COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)), 0) <> COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $3 AND (f.valid_to_release IS NULL OR f.valid_to_release > $3)), 0) ) as subquery;
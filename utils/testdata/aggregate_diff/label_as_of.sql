@@ -0,0 +1,21 @@
+-- fact table: fact_trade_by_product_port
+-- args: [2020 2023 2019 2 5 10 20]
+SELECT dp.port_id, COALESCE(dph.port_name_en, dp.port_name_en) AS port_name_en, COALESCE(dph.port_name_ar, dp.port_name_ar) AS port_name_ar, COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)), 0) as total_value, COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)), 0) as previous_value
+FROM fact_trade_by_product_port f
+JOIN dim_port dp ON f.port_id = dp.port_id
+LEFT JOIN dim_port_history dph ON f.port_id = dph.port_id AND (dph.valid_from IS NULL OR dph.valid_from <= make_date($3, 12, 31)) AND (dph.valid_to IS NULL OR dph.valid_to > make_date($3, 12, 31))
+WHERE f.year BETWEEN $1 AND $2 AND ((f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)) OR (f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)))
+GROUP BY dp.port_id, COALESCE(dph.port_name_en, dp.port_name_en), COALESCE(dph.port_name_ar, dp.port_name_ar)
+HAVING COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)), 0) <> COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)), 0)
+ORDER BY total_value DESC
+LIMIT $6 OFFSET $7;
+
+-- count
+SELECT COUNT(*)
+FROM ( SELECT dp.port_id, COALESCE(dph.port_name_en, dp.port_name_en), COALESCE(dph.port_name_ar, dp.port_name_ar)
+FROM fact_trade_by_product_port f
+JOIN dim_port dp ON f.port_id = dp.port_id
+LEFT JOIN dim_port_history dph ON f.port_id = dph.port_id AND (dph.valid_from IS NULL OR dph.valid_from <= make_date($3, 12, 31)) AND (dph.valid_to IS NULL OR dph.valid_to > make_date($3, 12, 31))
+WHERE f.year BETWEEN $1 AND $2 AND ((f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)) OR (f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)))
+GROUP BY dp.port_id, COALESCE(dph.port_name_en, dp.port_name_en), COALESCE(dph.port_name_ar, dp.port_name_ar)
+HAVING COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $5 AND (f.valid_to_release IS NULL OR f.valid_to_release > $5)), 0) <> COALESCE(SUM(f.value) FILTER (WHERE f.valid_from_release <= $4 AND (f.valid_to_release IS NULL OR f.valid_to_release > $4)), 0) ) as subquery;